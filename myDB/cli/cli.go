@@ -1,47 +1,130 @@
 package main
 
 import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
     "fmt"
-    "net/rpc"
+    "os"
+    "os/signal"
+    "sort"
+    "strconv"
     "strings"
+    "time"
 
     "github.com/chzyer/readline"
+    "github.com/shafigh75/go_files/myDB/client"
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
     "github.com/spf13/cobra"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
 )
 
-// RPCRequest and RPCResponse structures
-type RPCRequest struct {
-    Key   string `json:"key"`
-    Value string `json:"value,omitempty"`
-    TTL   int64  `json:"ttl"` // TTL in seconds
-}
-
-type RPCResponse struct {
-    Success bool   `json:"success"`
-    Data    string `json:"data,omitempty"`
-    Error   string `json:"error,omitempty"`
-}
-
-var client *rpc.Client
+var (
+    db         *client.Client
+    serverList string
+    opts       client.Options
+    caCert     string
+    certFile   string
+    keyFile    string
+)
 
 var rootCmd = &cobra.Command{
     Use:   "mycli",
     Short: "My CLI application",
     Long:  `This is a sample CLI application using Cobra with autocompletion and REPL.`,
     Run: func(cmd *cobra.Command, args []string) {
+        for _, addr := range strings.Split(serverList, ",") {
+            if addr = strings.TrimSpace(addr); addr != "" {
+                opts.Servers = append(opts.Servers, addr)
+            }
+        }
+        if caCert != "" || certFile != "" || keyFile != "" {
+            var err error
+            if opts.TLS, err = loadTLSConfig(); err != nil {
+                fmt.Println("Error loading TLS certificates:", err)
+                return
+            }
+        }
+        var err error
+        if db, err = client.New(opts); err != nil {
+            fmt.Println("Error connecting to gRPC server:", err)
+            return
+        }
+        defer db.Close()
+
         fmt.Println("Welcome to My CLI! Type 'help' for available commands.")
         startREPL()
     },
 }
 
+func init() {
+    rootCmd.Flags().StringVarP(&serverList, "servers", "s", "localhost:50051", "comma separated gRPC addresses of the server or of the cluster members")
+    rootCmd.Flags().StringVarP(&opts.User, "user", "u", "", "user to log in as, for servers with an ACL")
+    rootCmd.Flags().StringVarP(&opts.Password, "password", "p", "", "password of --user")
+    rootCmd.Flags().StringVar(&opts.Token, "token", "", "API token to log in with instead of --user and --password")
+    rootCmd.Flags().StringVar(&caCert, "cacert", "", "CA certificate (PEM) to verify the servers with; connects over TLS")
+    rootCmd.Flags().StringVar(&certFile, "cert", "", "client certificate (PEM) to present to servers that verify them; connects over TLS")
+    rootCmd.Flags().StringVar(&keyFile, "key", "", "private key (PEM) of --cert")
+}
+
+// loadTLSConfig builds the TLS configuration from --cacert, --cert and
+// --key. Without --cacert the servers are verified with the system CAs.
+func loadTLSConfig() (*tls.Config, error) {
+    cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+    if caCert != "" {
+        data, err := os.ReadFile(caCert)
+        if err != nil {
+            return nil, err
+        }
+        cfg.RootCAs = x509.NewCertPool()
+        if !cfg.RootCAs.AppendCertsFromPEM(data) {
+            return nil, fmt.Errorf("no certificates in %s", caCert)
+        }
+    }
+    if certFile != "" || keyFile != "" {
+        cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+        if err != nil {
+            return nil, err
+        }
+        cfg.Certificates = []tls.Certificate{cert}
+    }
+    return cfg, nil
+}
+
+// printError prints the message of a failed call.
+func printError(err error) {
+    fmt.Println("Error:", status.Convert(err).Message())
+}
+
 func startREPL() {
     // Define completer
     completer := readline.NewPrefixCompleter(
         readline.PcItem("help"),
         readline.PcItem("exit"),
+        readline.PcItem("auth", readline.PcItem("user"), readline.PcItem("password")),
         readline.PcItem("set", readline.PcItem("key"), readline.PcItem("value"), readline.PcItem("ttl")),
         readline.PcItem("get", readline.PcItem("key")),
         readline.PcItem("delete", readline.PcItem("key")),
+        readline.PcItem("mset", readline.PcItem("key"), readline.PcItem("value")),
+        readline.PcItem("mget", readline.PcItem("key")),
+        readline.PcItem("expire", readline.PcItem("key"), readline.PcItem("ttl")),
+        readline.PcItem("persist", readline.PcItem("key")),
+        readline.PcItem("ttl", readline.PcItem("key")),
+        readline.PcItem("incr", readline.PcItem("key")),
+        readline.PcItem("decr", readline.PcItem("key")),
+        readline.PcItem("incrby", readline.PcItem("key"), readline.PcItem("delta")),
+        readline.PcItem("setnx", readline.PcItem("key"), readline.PcItem("value"), readline.PcItem("ttl")),
+        readline.PcItem("getset", readline.PcItem("key"), readline.PcItem("value"), readline.PcItem("ttl")),
+        readline.PcItem("cas", readline.PcItem("key"), readline.PcItem("revision"), readline.PcItem("value"), readline.PcItem("ttl")),
+        readline.PcItem("watch", readline.PcItem("prefix"), readline.PcItem("revision")),
+        readline.PcItem("scan", readline.PcItem("prefix"), readline.PcItem("cursor"), readline.PcItem("count")),
+        readline.PcItem("range", readline.PcItem("start"), readline.PcItem("end"), readline.PcItem("cursor"), readline.PcItem("count")),
+        readline.PcItem("count", readline.PcItem("prefix")),
+        readline.PcItem("publish", readline.PcItem("channel"), readline.PcItem("message")),
+        readline.PcItem("subscribe", readline.PcItem("channel")),
+        readline.PcItem("psubscribe", readline.PcItem("pattern")),
     )
 
     // Create readline instance
@@ -50,7 +133,7 @@ func startREPL() {
         HistoryFile:     "/tmp/readline.tmp",
         AutoComplete:    completer,
         InterruptPrompt: "^C",
-        EOFPrompt:      "exit",
+        EOFPrompt:       "exit",
     })
     if err != nil {
         fmt.Println("Error creating readline:", err)
@@ -82,91 +165,536 @@ func handleCommand(input string) {
 
     switch args[0] {
     case "help":
-        fmt.Println("Available commands: help, exit, set [key] [value] [ttl], get [key], delete [key]")
+        fmt.Println("Available commands: help, exit, auth [user] [password] or auth [token], " +
+            "set [key] [value] [ttl], get [key], delete [key], " +
+            "mset [key] [value] [key] [value]..., mget [key...], " +
+            "expire [key] [ttl], persist [key], ttl [key], " +
+            "incr [key], decr [key], incrby [key] [delta], setnx [key] [value] [ttl], getset [key] [value] [ttl], " +
+            "cas [key] [revision] [value] [ttl], watch [prefix] [revision], scan [prefix] [cursor] [count], " +
+            "range [start] [end] [cursor] [count], count [prefix], publish [channel] [message], " +
+            "subscribe [channel...], psubscribe [pattern...], config get [pattern], config set [name] [value], info [section]")
+    case "auth":
+        switch len(args) {
+        case 2:
+            authenticate(&pb.LoginRequest{Token: args[1]})
+        case 3:
+            authenticate(&pb.LoginRequest{Name: args[1], Password: args[2]})
+        default:
+            fmt.Println("Usage: auth [user] [password] or auth [token]")
+        }
     case "set":
-        if len(args) < 4 {
+        if len(args) < 3 {
             fmt.Println("Usage: set [key] [value] [ttl]")
             return
         }
-        key := args[1]
-        ttl := int64(0)
-        // Get the TTL from the last argument
-        fmt.Sscanf(args[len(args)-1], "%d", &ttl)
-        // Join all arguments except the first and last as the value
-        value := strings.Join(args[2:len(args)-1], " ")
-        setKey(key, value, ttl)
+        value, ttl := valueAndTTL(args[2:])
+        setKey(args[1], value, ttl)
     case "get":
         if len(args) != 2 {
             fmt.Println("Usage: get [key]")
             return
         }
         getKey(args[1])
+    case "mset":
+        if len(args) < 3 || len(args)%2 != 1 {
+            fmt.Println("Usage: mset [key] [value] [key] [value]...")
+            return
+        }
+        msetKeys(args[1:])
+    case "mget":
+        if len(args) < 2 {
+            fmt.Println("Usage: mget [key...]")
+            return
+        }
+        mgetKeys(args[1:])
     case "delete":
         if len(args) != 2 {
             fmt.Println("Usage: delete [key]")
             return
         }
         deleteKey(args[1])
+    case "expire":
+        var ttl int64
+        if len(args) != 3 {
+            fmt.Println("Usage: expire [key] [ttl]")
+            return
+        }
+        if _, err := fmt.Sscanf(args[2], "%d", &ttl); err != nil || ttl <= 0 {
+            fmt.Println("Error: ttl must be a positive number of seconds, use persist to remove it")
+            return
+        }
+        expireKey(args[1], ttl)
+    case "persist":
+        if len(args) != 2 {
+            fmt.Println("Usage: persist [key]")
+            return
+        }
+        persistKey(args[1])
+    case "ttl":
+        if len(args) != 2 {
+            fmt.Println("Usage: ttl [key]")
+            return
+        }
+        keyTTL(args[1])
+    case "incr", "decr":
+        if len(args) != 2 {
+            fmt.Printf("Usage: %s [key]\n", args[0])
+            return
+        }
+        delta := int64(1)
+        if args[0] == "decr" {
+            delta = -1
+        }
+        incrKey(args[1], delta)
+    case "incrby":
+        var delta int64
+        if len(args) != 3 {
+            fmt.Println("Usage: incrby [key] [delta]")
+            return
+        }
+        if _, err := fmt.Sscanf(args[2], "%d", &delta); err != nil {
+            fmt.Println("Error: delta must be an integer")
+            return
+        }
+        incrKey(args[1], delta)
+    case "setnx", "getset":
+        if len(args) < 3 {
+            fmt.Printf("Usage: %s [key] [value] [ttl]\n", args[0])
+            return
+        }
+        value, ttl := valueAndTTL(args[2:])
+        if args[0] == "setnx" {
+            setKeyNX(args[1], value, ttl)
+        } else {
+            getSetKey(args[1], value, ttl)
+        }
+    case "cas":
+        var revision uint64
+        if len(args) < 4 {
+            fmt.Println("Usage: cas [key] [revision] [value] [ttl]")
+            return
+        }
+        if _, err := fmt.Sscanf(args[2], "%d", &revision); err != nil {
+            fmt.Println("Error: revision must be a number (0 for a new key)")
+            return
+        }
+        value, ttl := valueAndTTL(args[3:])
+        compareAndSwap(args[1], revision, value, ttl)
+    case "watch":
+        var prefix string
+        var from uint64
+        if len(args) > 3 {
+            fmt.Println("Usage: watch [prefix] [revision]")
+            return
+        }
+        if len(args) > 1 {
+            prefix = args[1]
+        }
+        if len(args) == 3 {
+            if _, err := fmt.Sscanf(args[2], "%d", &from); err != nil {
+                fmt.Println("Error: revision must be a number")
+                return
+            }
+        }
+        watchKeys(prefix, from)
+    case "scan", "range", "count":
+        // Positional arguments can be left out from the end; "*" stands
+        // for an empty prefix or an open end.
+        req := &pb.ScanRequest{}
+        fields := map[string][]*string{
+            "scan":  {&req.Prefix, &req.Cursor},
+            "range": {&req.Start, &req.End, &req.Cursor},
+            "count": {&req.Prefix},
+        }[args[0]]
+        if len(args) > len(fields)+2 || (args[0] == "count" && len(args) > 2) {
+            fmt.Println("Usage: scan [prefix] [cursor] [count], range [start] [end] [cursor] [count] or count [prefix]")
+            return
+        }
+        for i, f := range fields {
+            if i+1 < len(args) && args[i+1] != "*" {
+                *f = args[i+1]
+            }
+        }
+        if len(args) == len(fields)+2 {
+            if _, err := fmt.Sscanf(args[len(args)-1], "%d", &req.Count); err != nil {
+                fmt.Println("Error: count must be a number")
+                return
+            }
+        }
+        if args[0] == "count" {
+            countKeys(req)
+        } else {
+            req.Values = args[0] == "range"
+            scanKeys(req)
+        }
+    case "publish":
+        if len(args) < 3 {
+            fmt.Println("Usage: publish [channel] [message]")
+            return
+        }
+        publish(args[1], strings.Join(args[2:], " "))
+    case "subscribe":
+        if len(args) < 2 {
+            fmt.Println("Usage: subscribe [channel...]")
+            return
+        }
+        subscribe(&pb.SubscribeRequest{Channels: args[1:]})
+    case "psubscribe":
+        if len(args) < 2 {
+            fmt.Println("Usage: psubscribe [pattern...]")
+            return
+        }
+        subscribe(&pb.SubscribeRequest{Patterns: args[1:]})
+    case "config":
+        switch {
+        case len(args) >= 2 && len(args) <= 3 && args[1] == "get":
+            pattern := "*"
+            if len(args) == 3 {
+                pattern = args[2]
+            }
+            configGet(pattern)
+        case len(args) >= 4 && args[1] == "set":
+            configSet(args[2], strings.Join(args[3:], " "))
+        default:
+            fmt.Println("Usage: config get [pattern] or config set [name] [value]")
+        }
+    case "info":
+        if len(args) > 2 {
+            fmt.Println("Usage: info [section]")
+            return
+        }
+        section := ""
+        if len(args) == 2 {
+            section = args[1]
+        }
+        info(section)
     default:
         fmt.Printf("Unknown command: %s\n", input)
     }
 }
 
-func setKey(key, value string, ttl int64) {
-    req := RPCRequest{Key: key, Value: value, TTL: ttl}
-    var resp RPCResponse
-    err := client.Call("InMemoryStore.RPCSet", &req, &resp)
+// authenticate checks req with the server and, when it is right, sends it
+// with every call from now on.
+func authenticate(req *pb.LoginRequest) {
+    var user string
+    var err error
+    if req.Token != "" {
+        user, err = db.LoginToken(context.Background(), req.Token)
+    } else {
+        user, err = db.Login(context.Background(), req.Name, req.Password)
+    }
     if err != nil {
-        fmt.Println("Error calling RPCSet:", err)
+        fmt.Println("Error logging in:", status.Convert(err).Message())
         return
     }
-    if resp.Success {
-        fmt.Println("Key set successfully.")
-    } else {
-        fmt.Println("Error:", resp.Error)
+    fmt.Println("Logged in as", user)
+}
+
+// valueAndTTL splits the arguments after the key into the value, which
+// may hold spaces, and the TTL in seconds. The last argument is the TTL
+// when there are several and it is a number; without one the key does not
+// expire.
+func valueAndTTL(args []string) (string, int64) {
+    ttl := int64(0)
+    if len(args) > 1 {
+        if n, err := strconv.ParseInt(args[len(args)-1], 10, 64); err == nil {
+            ttl, args = n, args[:len(args)-1]
+        }
     }
+    return strings.Join(args, " "), ttl
+}
+
+func setKey(key, value string, ttl int64) {
+    if err := db.Set(context.Background(), key, value, time.Duration(ttl)*time.Second); err != nil {
+        printError(err)
+        return
+    }
+    fmt.Println("Key set successfully.")
 }
 
 func getKey(key string) {
-    req := RPCRequest{Key: key}
-    var resp RPCResponse
-    err := client.Call("InMemoryStore.RPCGet", &req, &resp)
+    value, revision, err := db.Get(context.Background(), key)
     if err != nil {
-        fmt.Println("Error calling RPCGet:", err)
+        printError(err)
         return
     }
-    if resp.Success {
-        fmt.Printf("Value: %s\n", resp.Data)
-    } else {
-        fmt.Println("Error:", resp.Error)
+    fmt.Printf("Value: %s\n", value)
+    fmt.Printf("Revision: %d\n", revision)
+}
+
+// msetKeys sets the keys and values of pairs in one call.
+func msetKeys(pairs []string) {
+    items := make([]client.Item, 0, len(pairs)/2)
+    for i := 0; i < len(pairs); i += 2 {
+        items = append(items, client.Item{Key: pairs[i], Value: pairs[i+1]})
+    }
+    results, err := db.MSet(context.Background(), items...)
+    if err != nil {
+        printError(err)
+        return
     }
+    set := 0
+    for _, r := range results {
+        if r.Success {
+            set++
+        } else {
+            fmt.Printf("%s: %s\n", r.Key, r.Error)
+        }
+    }
+    fmt.Printf("Set %d of %d keys.\n", set, len(results))
 }
 
-func deleteKey(key string) {
-    req := RPCRequest{Key: key}
-    var resp RPCResponse
-    err := client.Call("InMemoryStore.RPCDelete", &req, &resp)
+// mgetKeys prints the values of keys, read in one call.
+func mgetKeys(keys []string) {
+    results, err := db.MGet(context.Background(), keys...)
     if err != nil {
-        fmt.Println("Error calling RPCDelete:", err)
+        printError(err)
         return
     }
-    if resp.Success {
+    for i, r := range results {
+        if r.Success {
+            fmt.Printf("%d) %s = %s\n", i+1, r.Key, r.Value)
+        } else {
+            fmt.Printf("%d) %s: %s\n", i+1, r.Key, r.Error)
+        }
+    }
+}
+
+func deleteKey(key string) {
+    existed, err := db.Delete(context.Background(), key)
+    switch {
+    case err != nil:
+        printError(err)
+    case existed:
         fmt.Println("Key deleted successfully.")
+    default:
+        fmt.Println("Key did not exist.")
+    }
+}
+
+func expireKey(key string, ttl int64) {
+    if err := db.Expire(context.Background(), key, time.Duration(ttl)*time.Second); err != nil {
+        printError(err)
+        return
+    }
+    fmt.Printf("Key expires in %d seconds.\n", ttl)
+}
+
+func persistKey(key string) {
+    hadTTL, err := db.Persist(context.Background(), key)
+    switch {
+    case err != nil:
+        printError(err)
+    case hadTTL:
+        fmt.Println("Key no longer expires.")
+    default:
+        fmt.Println("Key had no TTL.")
+    }
+}
+
+func keyTTL(key string) {
+    ttl, err := db.TTL(context.Background(), key)
+    switch {
+    case err != nil:
+        printError(err)
+    case ttl == client.NoExpiry:
+        fmt.Println("Key does not expire.")
+    default:
+        fmt.Printf("TTL: %v\n", ttl)
+    }
+}
+
+func incrKey(key string, delta int64) {
+    value, err := db.Incr(context.Background(), key, delta)
+    if err != nil {
+        printError(err)
+        return
+    }
+    fmt.Printf("Value: %d\n", value)
+}
+
+func setKeyNX(key, value string, ttl int64) {
+    set, err := db.SetNX(context.Background(), key, value, time.Duration(ttl)*time.Second)
+    switch {
+    case err != nil:
+        printError(err)
+    case set:
+        fmt.Println("Key set successfully.")
+    default:
+        fmt.Println("Key already exists, not set.")
+    }
+}
+
+func getSetKey(key, value string, ttl int64) {
+    old, existed, err := db.GetSet(context.Background(), key, value, time.Duration(ttl)*time.Second)
+    switch {
+    case err != nil:
+        printError(err)
+    case existed:
+        fmt.Printf("Old value: %s\n", old)
+    default:
+        fmt.Println("Key set successfully, it had no value before.")
+    }
+}
+
+func compareAndSwap(key string, revision uint64, value string, ttl int64) {
+    current, err := db.CompareAndSwap(context.Background(), key, revision, value, time.Duration(ttl)*time.Second)
+    switch {
+    case errors.Is(err, client.ErrConflict):
+        fmt.Printf("Key was changed, its revision is now %d.\n", current)
+    case err != nil:
+        printError(err)
+    default:
+        fmt.Printf("Key set successfully, revision %d.\n", current)
+    }
+}
+
+// untilInterrupt returns a context that is cancelled by Ctrl-C, for the
+// commands that stream until then.
+func untilInterrupt() (context.Context, context.CancelFunc) {
+    return signal.NotifyContext(context.Background(), os.Interrupt)
+}
+
+// watchKeys prints the changes to keys starting with prefix until Ctrl-C,
+// starting at revision from (0 for now). The client resumes the watch
+// when the server goes away, so no change is missed.
+func watchKeys(prefix string, from uint64) {
+    ctx, stop := untilInterrupt()
+    defer stop()
+
+    fmt.Printf("Watching keys starting with %q, press Ctrl-C to stop.\n", prefix)
+    err := db.Watch(ctx, prefix, from, func(e *pb.WatchEvent) error {
+        printEvent(e)
+        return nil
+    })
+    if ctx.Err() != nil {
+        fmt.Println("Stopped watching.")
+        return
+    }
+    printError(err)
+}
+
+func printEvent(e *pb.WatchEvent) {
+    switch {
+    case e.Type != "set":
+        fmt.Printf("[%d] %s %s\n", e.Rev, e.Type, e.Key)
+    case e.ValueType != "":
+        fmt.Printf("[%d] set %s (%s)\n", e.Rev, e.Key, e.ValueType)
+    default:
+        fmt.Printf("[%d] set %s = %s\n", e.Rev, e.Key, e.Value)
+    }
+}
+
+func scanKeys(req *pb.ScanRequest) {
+    resp, err := db.Scan(context.Background(), req)
+    if err != nil {
+        printError(err)
+        return
+    }
+    for _, key := range resp.Keys {
+        fmt.Println(key)
+    }
+    for _, e := range resp.Entries {
+        if e.Type != "" {
+            fmt.Printf("%s (%s)\n", e.Key, e.Type)
+        } else {
+            fmt.Printf("%s = %s\n", e.Key, e.Value)
+        }
+    }
+    if resp.Cursor == "0" {
+        fmt.Println("(end)")
     } else {
-        fmt.Println("Error:", resp.Error)
+        fmt.Println("Next cursor:", resp.Cursor)
     }
 }
 
-func main() {
-    // Connect to the RPC server
-    var err error
-    client, err = rpc.Dial("tcp", "localhost:1234")
+func countKeys(req *pb.ScanRequest) {
+    n, err := db.Count(context.Background(), req)
+    if err != nil {
+        printError(err)
+        return
+    }
+    fmt.Printf("Keys: %d\n", n)
+}
+
+func publish(channel, message string) {
+    receivers, err := db.Publish(context.Background(), channel, message)
+    if err != nil {
+        printError(err)
+        return
+    }
+    fmt.Printf("Delivered to %d subscribers.\n", receivers)
+}
+
+// configGet prints the server settings whose names match pattern.
+func configGet(pattern string) {
+    settings, err := db.GetConfig(context.Background(), pattern)
+    if err != nil {
+        printError(err)
+        return
+    }
+    names := make([]string, 0, len(settings))
+    for name := range settings {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    for _, name := range names {
+        fmt.Printf("%s = %s\n", name, settings[name])
+    }
+}
+
+// configSet changes a setting of the server while it runs.
+func configSet(name, value string) {
+    value, err := db.SetConfig(context.Background(), name, value)
     if err != nil {
-        fmt.Println("Error connecting to RPC server:", err)
+        printError(err)
         return
     }
-    defer client.Close()
+    fmt.Printf("%s = %s\n", name, value)
+}
 
+// info prints the server's statistics, like the INFO command of Redis.
+func info(section string) {
+    text, err := db.Info(context.Background(), section)
+    if err != nil {
+        printError(err)
+        return
+    }
+    fmt.Print(text)
+}
+
+// subscribe prints the messages of a subscription until Ctrl-C. The client
+// subscribes again when the server goes away; the messages published in
+// between are lost.
+func subscribe(req *pb.SubscribeRequest) {
+    ctx, stop := untilInterrupt()
+    defer stop()
+
+    var dropped uint64
+    fmt.Println("Subscribed, press Ctrl-C to stop.")
+    err := db.Subscribe(ctx, req, func(m *pb.Message) error {
+        switch {
+        case m.Dropped > dropped:
+            fmt.Printf("%d messages were dropped, this subscriber is too slow.\n", m.Dropped-dropped)
+            dropped = m.Dropped
+        case m.Pattern != "":
+            fmt.Printf("[%s] (%s) %s\n", m.Channel, m.Pattern, m.Payload)
+        default:
+            fmt.Printf("[%s] %s\n", m.Channel, m.Payload)
+        }
+        return nil
+    })
+    switch {
+    case ctx.Err() != nil:
+        fmt.Println("Unsubscribed.")
+    case status.Code(err) == codes.Aborted:
+        fmt.Println("Subscription ended:", status.Convert(err).Message())
+    default:
+        printError(err)
+    }
+}
+
+func main() {
     if err := rootCmd.Execute(); err != nil {
         fmt.Println(err)
         return
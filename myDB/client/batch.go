@@ -0,0 +1,116 @@
+package client
+
+import (
+    "context"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// Item is a key and value for MSet.
+type Item struct {
+    Key   string
+    Value string
+    TTL   time.Duration // 0 for no expiry
+}
+
+// batch makes a batch call and answers with one result per key, in the
+// order of the request. The server sends each key to the node owning it.
+func (c *Client) batch(ctx context.Context, fn func(context.Context, pb.MyDBClient) (*pb.BatchReply, error)) ([]*pb.BatchResult, error) {
+    var resp *pb.BatchReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = fn(ctx, db)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return resp.Results, nil
+}
+
+// MGet reads keys in one call. A missing key has a result that failed.
+func (c *Client) MGet(ctx context.Context, keys ...string) ([]*pb.BatchResult, error) {
+    return c.batch(ctx, func(ctx context.Context, db pb.MyDBClient) (*pb.BatchReply, error) {
+        return db.MGet(ctx, &pb.BatchRequest{Keys: keys})
+    })
+}
+
+// MSet sets items in one call, written as one transaction.
+func (c *Client) MSet(ctx context.Context, items ...Item) ([]*pb.BatchResult, error) {
+    req := &pb.BatchRequest{}
+    for _, item := range items {
+        req.Items = append(req.Items, &pb.BatchItem{Key: item.Key, Value: item.Value, Ttl: seconds(item.TTL)})
+    }
+    return c.batch(ctx, func(ctx context.Context, db pb.MyDBClient) (*pb.BatchReply, error) {
+        return db.MSet(ctx, req)
+    })
+}
+
+// MDel deletes keys in one call. Like Delete it is retried, so a key
+// reported missing may have been deleted by an attempt before the retry.
+func (c *Client) MDel(ctx context.Context, keys ...string) ([]*pb.BatchResult, error) {
+    return c.batch(ctx, func(ctx context.Context, db pb.MyDBClient) (*pb.BatchReply, error) {
+        return db.MDel(ctx, &pb.BatchRequest{Keys: keys})
+    })
+}
+
+// Txn applies the ops of req when all its conditions hold. Otherwise it
+// answers with the failed conditions in Failed and ErrConflict. It is not
+// retried when the server goes away, as it may have been applied.
+func (c *Client) Txn(ctx context.Context, req *pb.TxnRequest) (*pb.TxnReply, error) {
+    var resp *pb.TxnReply
+    err := c.do(ctx, false, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Txn(ctx, req)
+        return err
+    })
+    if st := status.Convert(err); st.Code() == codes.Aborted {
+        for _, d := range st.Details() {
+            if failed, ok := d.(*pb.TxnReply); ok {
+                return failed, ErrConflict
+            }
+        }
+        return nil, ErrConflict
+    }
+    return resp, err
+}
+
+// Command runs a list, hash, set or sorted set command written as in
+// Redis, such as "LPUSH", "key", "value". Commands are not retried, as
+// most of them change the value.
+func (c *Client) Command(ctx context.Context, args ...string) (*pb.Reply, error) {
+    var resp *pb.CommandReply
+    err := c.do(ctx, false, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Command(ctx, &pb.CommandRequest{Args: args})
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return resp.Reply, nil
+}
+
+// Scan answers with a page of the keys req asks for and the cursor of the
+// next page, "0" after the last one.
+func (c *Client) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanReply, error) {
+    var resp *pb.ScanReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Scan(ctx, req)
+        return err
+    })
+    return resp, err
+}
+
+// Count answers with the number of keys req asks for.
+func (c *Client) Count(ctx context.Context, req *pb.ScanRequest) (int64, error) {
+    var resp *pb.ScanReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Count(ctx, req)
+        return err
+    })
+    if err != nil {
+        return 0, err
+    }
+    return resp.Count, nil
+}
@@ -0,0 +1,280 @@
+// Package client is a Go client for mydb over its gRPC API. A Client keeps
+// a pool of connections to each server, fails over between the members of
+// a cluster, bounds every call with a timeout and retries the calls that
+// are safe to repeat, so it rides out server restarts and leader changes.
+package client
+
+import (
+    "context"
+    "crypto/tls"
+    "encoding/base64"
+    "errors"
+    "math/rand"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/backoff"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/status"
+)
+
+var (
+    ErrNotFound  = errors.New("mydb: key not found")
+    ErrKeyExists = errors.New("mydb: key already exists")
+    ErrConflict  = errors.New("mydb: revision changed")
+    ErrClosed    = errors.New("mydb: client is closed")
+    errNoServers = errors.New("mydb: no servers given")
+)
+
+// NoExpiry is the TTL of a key that does not expire.
+const NoExpiry time.Duration = -1
+
+// Options configure a Client. Only Servers is required.
+type Options struct {
+    // Servers are the gRPC addresses of the server or of the cluster
+    // members. Calls go to the first one until it fails.
+    Servers []string
+    // User and Password, or Token, are sent with every call to servers
+    // with an ACL.
+    User, Password, Token string
+    // TLS makes the connections use TLS when set.
+    TLS *tls.Config
+    // PoolSize is the number of connections to each server, 4 by default.
+    PoolSize int
+    // Timeout bounds each attempt of a call, 10s by default, negative for
+    // none. The context of the call can end it sooner. Watch and Subscribe
+    // have no timeout.
+    Timeout time.Duration
+    // Retries is how often a call that failed because the server was
+    // unavailable is tried again, 5 by default, negative for never.
+    Retries int
+    // MinBackoff and MaxBackoff bound the wait before a retry, which
+    // doubles from one to the other: 50ms and 2s by default.
+    MinBackoff, MaxBackoff time.Duration
+}
+
+func (o *Options) setDefaults() {
+    if o.PoolSize <= 0 {
+        o.PoolSize = 4
+    }
+    if o.Timeout == 0 {
+        o.Timeout = 10 * time.Second
+    }
+    if o.Retries == 0 {
+        o.Retries = 5
+    }
+    if o.MinBackoff <= 0 {
+        o.MinBackoff = 50 * time.Millisecond
+    }
+    if o.MaxBackoff < o.MinBackoff {
+        o.MaxBackoff = max(2*time.Second, o.MinBackoff)
+    }
+}
+
+// Client talks to a mydb server or cluster. It is safe for concurrent use.
+type Client struct {
+    opts    Options
+    conns   [][]*grpc.ClientConn // opts.PoolSize connections per server
+    stubs   [][]pb.MyDBClient    // one per connection
+    next    atomic.Uint64        // round robin over the pool of a server
+    closed  atomic.Bool
+    mu      sync.Mutex
+    current int // index of the server calls go to
+    auth    string
+}
+
+// New returns a client for the servers of opts. It does not connect yet:
+// connections are made on first use and made again whenever they break.
+func New(opts Options) (*Client, error) {
+    if len(opts.Servers) == 0 {
+        return nil, errNoServers
+    }
+    opts.setDefaults()
+    c := &Client{opts: opts, auth: authorization(opts.User, opts.Password, opts.Token)}
+    var creds credentials.TransportCredentials = insecure.NewCredentials()
+    if opts.TLS != nil {
+        creds = credentials.NewTLS(opts.TLS)
+    }
+    dialOpts := []grpc.DialOption{
+        grpc.WithTransportCredentials(creds),
+        grpc.WithPerRPCCredentials(loginCredentials{c}),
+        // Reconnect to a restarted server about as fast as calls retry,
+        // not after the minutes the gRPC default backs off to.
+        grpc.WithConnectParams(grpc.ConnectParams{
+            Backoff:           backoff.Config{BaseDelay: opts.MinBackoff, Multiplier: 2, Jitter: 0.2, MaxDelay: opts.MaxBackoff},
+            MinConnectTimeout: 5 * time.Second,
+        }),
+    }
+    for _, addr := range opts.Servers {
+        conns := make([]*grpc.ClientConn, opts.PoolSize)
+        stubs := make([]pb.MyDBClient, opts.PoolSize)
+        for i := range conns {
+            conn, err := grpc.NewClient(addr, dialOpts...)
+            if err != nil {
+                c.Close()
+                return nil, err
+            }
+            conns[i], stubs[i] = conn, pb.NewMyDBClient(conn)
+        }
+        c.conns = append(c.conns, conns)
+        c.stubs = append(c.stubs, stubs)
+    }
+    return c, nil
+}
+
+// Close closes every connection. Calls made after it fail with ErrClosed.
+func (c *Client) Close() error {
+    c.closed.Store(true)
+    for _, conns := range c.conns {
+        for _, conn := range conns {
+            conn.Close()
+        }
+    }
+    return nil
+}
+
+// authorization is the metadata the server authenticates a call with.
+func authorization(user, password, token string) string {
+    switch {
+    case token != "":
+        return "Bearer " + token
+    case user != "" || password != "":
+        return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))
+    }
+    return ""
+}
+
+// loginCredentials sends the credentials of the client with every call, as
+// the server authenticates calls one by one.
+type loginCredentials struct{ c *Client }
+
+func (l loginCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+    l.c.mu.Lock()
+    defer l.c.mu.Unlock()
+    if l.c.auth == "" {
+        return nil, nil
+    }
+    return map[string]string{"authorization": l.c.auth}, nil
+}
+
+// RequireTransportSecurity is false so plain connections work too, as
+// they do for the HTTP API.
+func (loginCredentials) RequireTransportSecurity() bool { return false }
+
+// pick returns the current server and a connection to it from the pool.
+func (c *Client) pick() (int, pb.MyDBClient) {
+    c.mu.Lock()
+    server := c.current
+    c.mu.Unlock()
+    stubs := c.stubs[server]
+    return server, stubs[c.next.Add(1)%uint64(len(stubs))]
+}
+
+// failover sends the calls to the server after server, unless another
+// call already moved on.
+func (c *Client) failover(server int) {
+    c.mu.Lock()
+    if c.current == server {
+        c.current = (server + 1) % len(c.stubs)
+    }
+    c.mu.Unlock()
+}
+
+// backoff waits before retry attempt+1: MinBackoff doubled for each
+// attempt up to MaxBackoff, of which a random half to all.
+func (c *Client) backoff(ctx context.Context, attempt int) error {
+    d := c.opts.MinBackoff
+    for i := 0; i < attempt && d < c.opts.MaxBackoff; i++ {
+        d *= 2
+    }
+    d = min(d, c.opts.MaxBackoff)
+    d = d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+    t := time.NewTimer(d)
+    defer t.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-t.C:
+        return nil
+    }
+}
+
+// retryable tells whether a call that failed with err may be made again.
+// An unavailable server may have run a call before it went away, so only
+// idempotent calls are retried then, unless the server said it turned the
+// call away: a follower asked to write, or a cluster without a leader. A
+// call that ran out of time is retried when it is idempotent.
+func retryable(err error, idempotent bool) bool {
+    switch status.Code(err) {
+    case codes.Unavailable:
+        msg := status.Convert(err).Message()
+        return idempotent || strings.HasPrefix(msg, "READONLY") || strings.HasPrefix(msg, "NOTLEADER")
+    case codes.DeadlineExceeded:
+        return idempotent
+    }
+    return false
+}
+
+// do runs fn on a connection to the current server, within Timeout. When
+// the call fails in a way retryable allows, it goes to the next server
+// after a backoff, up to Retries times. A missing key comes back as
+// ErrNotFound.
+func (c *Client) do(ctx context.Context, idempotent bool, fn func(ctx context.Context, db pb.MyDBClient) error) error {
+    for attempt := 0; ; attempt++ {
+        if c.closed.Load() {
+            return ErrClosed
+        }
+        server, db := c.pick()
+        callCtx, cancel := ctx, context.CancelFunc(func() {})
+        if c.opts.Timeout > 0 {
+            callCtx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+        }
+        err := fn(callCtx, db)
+        cancel()
+        switch {
+        case err == nil:
+            return nil
+        case status.Code(err) == codes.NotFound:
+            return ErrNotFound
+        case attempt >= c.opts.Retries || ctx.Err() != nil || !retryable(err, idempotent):
+            return err
+        }
+        c.failover(server)
+        if err := c.backoff(ctx, attempt); err != nil {
+            return err
+        }
+    }
+}
+
+// Login checks a user and password with the server and, when they are
+// right, sends them with every call from now on. It answers with the name
+// of the user.
+func (c *Client) Login(ctx context.Context, user, password string) (string, error) {
+    return c.login(ctx, &pb.LoginRequest{Name: user, Password: password}, authorization(user, password, ""))
+}
+
+// LoginToken is Login with an API token.
+func (c *Client) LoginToken(ctx context.Context, token string) (string, error) {
+    return c.login(ctx, &pb.LoginRequest{Token: token}, authorization("", "", token))
+}
+
+func (c *Client) login(ctx context.Context, req *pb.LoginRequest, auth string) (string, error) {
+    var resp *pb.LoginReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Login(ctx, req)
+        return err
+    })
+    if err != nil {
+        return "", err
+    }
+    c.mu.Lock()
+    c.auth = auth
+    c.mu.Unlock()
+    return resp.User, nil
+}
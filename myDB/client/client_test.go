@@ -0,0 +1,173 @@
+package client
+
+import (
+    "context"
+    "errors"
+    "net"
+    "sync"
+    "sync/atomic"
+    "testing"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// flakyServer is unavailable for its first failures calls to Get and for
+// every call to Incr.
+type flakyServer struct {
+    pb.UnimplementedMyDBServer
+    failures int32
+    gets     atomic.Int32
+    incrs    atomic.Int32
+}
+
+func (s *flakyServer) Get(_ context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    if s.gets.Add(1) <= s.failures {
+        return nil, status.Error(codes.Unavailable, "down")
+    }
+    if in.Key != "a" {
+        return nil, status.Error(codes.NotFound, "Key not found or expired")
+    }
+    return &pb.KeyReply{Value: "1", Revision: 7, Exists: true}, nil
+}
+
+func (s *flakyServer) Incr(context.Context, *pb.KeyRequest) (*pb.KeyReply, error) {
+    s.incrs.Add(1)
+    return nil, status.Error(codes.Unavailable, "down")
+}
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+    net.Listener
+    accepts atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+    conn, err := l.Listener.Accept()
+    if err == nil {
+        l.accepts.Add(1)
+    }
+    return conn, err
+}
+
+// listen serves s on addr, a free port when empty, until the returned
+// server is stopped or the test ends.
+func listen(t *testing.T, addr string, s pb.MyDBServer) (*countingListener, *grpc.Server) {
+    if addr == "" {
+        addr = "127.0.0.1:0"
+    }
+    l, err := net.Listen("tcp", addr)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cl := &countingListener{Listener: l}
+    srv := grpc.NewServer()
+    pb.RegisterMyDBServer(srv, s)
+    go srv.Serve(cl)
+    t.Cleanup(srv.Stop)
+    return cl, srv
+}
+
+func serve(t *testing.T, s pb.MyDBServer) string {
+    l, _ := listen(t, "", s)
+    return l.Addr().String()
+}
+
+func TestRetries(t *testing.T) {
+    flaky := &flakyServer{failures: 1}
+    // Nothing listens on the first address, so calls fail over.
+    c, err := New(Options{Servers: []string{"127.0.0.1:1", serve(t, flaky)}, PoolSize: 2, MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    ctx := context.Background()
+
+    if v, rev, err := c.Get(ctx, "a"); err != nil || v != "1" || rev != 7 {
+        t.Fatalf("get: %q %d %v", v, rev, err)
+    }
+    if _, _, err := c.Get(ctx, "b"); !errors.Is(err, ErrNotFound) {
+        t.Fatalf("missing key: %v", err)
+    }
+    if _, err := c.Incr(ctx, "a", 1); status.Code(err) != codes.Unavailable || flaky.incrs.Load() != 1 {
+        t.Fatalf("incr was retried: %v, %d calls", err, flaky.incrs.Load())
+    }
+    c.Close()
+    if _, _, err := c.Get(ctx, "a"); err != ErrClosed {
+        t.Fatalf("get after close: %v", err)
+    }
+}
+
+func TestPool(t *testing.T) {
+    l, _ := listen(t, "", &flakyServer{})
+    c, err := New(Options{Servers: []string{l.Addr().String()}, PoolSize: 3})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    ctx := context.Background()
+
+    // Many more concurrent calls than connections share the pool: every
+    // connection is used and none is made beyond it.
+    var wg sync.WaitGroup
+    errs := make(chan error, 32)
+    for i := 0; i < 32; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for j := 0; j < 20; j++ {
+                if _, _, err := c.Get(ctx, "a"); err != nil {
+                    errs <- err
+                    return
+                }
+            }
+        }()
+    }
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Fatal(err)
+    }
+    if n := l.accepts.Load(); n != 3 {
+        t.Fatalf("%d connections for a pool of 3", n)
+    }
+}
+
+func TestReconnect(t *testing.T) {
+    flaky := &flakyServer{}
+    l, srv := listen(t, "", flaky)
+    addr := l.Addr().String()
+    c, err := New(Options{Servers: []string{addr}, PoolSize: 2, Retries: 10, MinBackoff: time.Millisecond, MaxBackoff: 50 * time.Millisecond})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer c.Close()
+    ctx := context.Background()
+
+    for i := 0; i < 4; i++ {
+        if _, _, err := c.Get(ctx, "a"); err != nil {
+            t.Fatalf("before the restart: %v", err)
+        }
+    }
+    srv.Stop()
+    if _, _, err := c.Get(ctx, "a"); status.Code(err) != codes.Unavailable {
+        t.Fatalf("server down: %v", err)
+    }
+
+    // The same client reaches the server once it is back on its address,
+    // over every connection of the pool.
+    l, _ = listen(t, addr, flaky)
+    deadline := time.Now().Add(5 * time.Second)
+    for l.accepts.Load() < 2 {
+        if time.Now().After(deadline) {
+            t.Fatalf("%d connections to the restarted server, want 2", l.accepts.Load())
+        }
+        if v, _, err := c.Get(ctx, "a"); err != nil || v != "1" {
+            t.Fatalf("after the restart: %q %v", v, err)
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
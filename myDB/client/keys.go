@@ -0,0 +1,136 @@
+package client
+
+import (
+    "context"
+    "strconv"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// seconds turns a TTL into the whole seconds the server takes, rounding up
+// so a short TTL does not become no expiry.
+func seconds(ttl time.Duration) int64 {
+    return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// key makes the call of a key method such as pb.MyDBClient.Get.
+func (c *Client) key(ctx context.Context, idempotent bool, method func(pb.MyDBClient, context.Context, *pb.KeyRequest, ...grpc.CallOption) (*pb.KeyReply, error), req *pb.KeyRequest) (*pb.KeyReply, error) {
+    var resp *pb.KeyReply
+    err := c.do(ctx, idempotent, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = method(db, ctx, req)
+        return err
+    })
+    return resp, err
+}
+
+// Get answers with the value of key and its revision, or ErrNotFound.
+func (c *Client) Get(ctx context.Context, key string) (string, uint64, error) {
+    resp, err := c.key(ctx, true, pb.MyDBClient.Get, &pb.KeyRequest{Key: key})
+    if err != nil {
+        return "", 0, err
+    }
+    return resp.Value, resp.Revision, nil
+}
+
+// Set sets key to value, expiring after ttl (0 for never).
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+    _, err := c.key(ctx, true, pb.MyDBClient.Set, &pb.KeyRequest{Key: key, Value: value, Ttl: seconds(ttl)})
+    return err
+}
+
+// Delete removes key and tells whether it was there. Delete is retried
+// when the server goes away, and a retry finds the key already gone if
+// the first attempt removed it: the key is gone either way, but false
+// only reliably means it was missing when nothing was retried. When the
+// answer matters, delete with a Txn conditioned on the revision Get
+// returned, which is not retried.
+func (c *Client) Delete(ctx context.Context, key string) (bool, error) {
+    resp, err := c.key(ctx, true, pb.MyDBClient.Delete, &pb.KeyRequest{Key: key})
+    if err != nil {
+        return false, err
+    }
+    return resp.Exists, nil
+}
+
+// Expire makes an existing key expire after ttl.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) error {
+    _, err := c.key(ctx, true, pb.MyDBClient.Expire, &pb.KeyRequest{Key: key, Ttl: seconds(ttl)})
+    return err
+}
+
+// Persist removes the TTL of key and tells whether it had one. Like
+// Delete's, the answer may be false after a retry whose first attempt
+// removed the TTL.
+func (c *Client) Persist(ctx context.Context, key string) (bool, error) {
+    resp, err := c.key(ctx, true, pb.MyDBClient.Persist, &pb.KeyRequest{Key: key})
+    if err != nil {
+        return false, err
+    }
+    return resp.Exists, nil
+}
+
+// TTL answers with the time key has left, or NoExpiry.
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+    resp, err := c.key(ctx, true, pb.MyDBClient.TTL, &pb.KeyRequest{Key: key})
+    if err != nil {
+        return 0, err
+    }
+    ms, err := strconv.ParseInt(resp.Value, 10, 64)
+    if err != nil || ms < 0 {
+        return NoExpiry, err
+    }
+    return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Incr adds delta to the integer value of key and answers with the result.
+// It is not retried, as a retry could add delta twice.
+func (c *Client) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+    resp, err := c.key(ctx, false, pb.MyDBClient.Incr, &pb.KeyRequest{Key: key, Delta: delta})
+    if err != nil {
+        return 0, err
+    }
+    return strconv.ParseInt(resp.Value, 10, 64)
+}
+
+// SetNX sets key unless it exists, and tells whether it did.
+func (c *Client) SetNX(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+    _, err := c.key(ctx, false, pb.MyDBClient.SetNX, &pb.KeyRequest{Key: key, Value: value, Ttl: seconds(ttl)})
+    if status.Code(err) == codes.AlreadyExists {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// GetSet sets key and answers with the value it had, and whether it had
+// one.
+func (c *Client) GetSet(ctx context.Context, key, value string, ttl time.Duration) (string, bool, error) {
+    resp, err := c.key(ctx, false, pb.MyDBClient.GetSet, &pb.KeyRequest{Key: key, Value: value, Ttl: seconds(ttl)})
+    if err != nil {
+        return "", false, err
+    }
+    return resp.Value, resp.Exists, nil
+}
+
+// CompareAndSwap sets key if it is still at revision (0 for a key that
+// must not exist yet) and answers with its new revision. When the key
+// changed in between it answers with the current revision and
+// ErrConflict.
+func (c *Client) CompareAndSwap(ctx context.Context, key string, revision uint64, value string, ttl time.Duration) (uint64, error) {
+    resp, err := c.key(ctx, false, pb.MyDBClient.CompareAndSwap, &pb.KeyRequest{Key: key, Value: value, Ttl: seconds(ttl), Revision: revision})
+    if st := status.Convert(err); st.Code() == codes.Aborted {
+        for _, d := range st.Details() {
+            if current, ok := d.(*pb.KeyReply); ok {
+                return current.Revision, ErrConflict
+            }
+        }
+        return 0, ErrConflict
+    }
+    if err != nil {
+        return 0, err
+    }
+    return resp.Revision, nil
+}
@@ -0,0 +1,49 @@
+package client
+
+import (
+    "context"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+)
+
+// GetConfig answers with the server settings whose names match pattern,
+// such as "max-*".
+func (c *Client) GetConfig(ctx context.Context, pattern string) (map[string]string, error) {
+    var resp *pb.ConfigReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.GetConfig(ctx, &pb.ConfigRequest{Pattern: pattern})
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return resp.Settings, nil
+}
+
+// SetConfig changes a setting of the server while it runs and answers with
+// its new value as the server shows it.
+func (c *Client) SetConfig(ctx context.Context, name, value string) (string, error) {
+    var resp *pb.ConfigReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.SetConfig(ctx, &pb.ConfigRequest{Name: name, Value: value})
+        return err
+    })
+    if err != nil {
+        return "", err
+    }
+    return resp.Settings[name], nil
+}
+
+// Info answers with the statistics of the server in the text of the INFO
+// command, for section or the default sections when it is empty.
+func (c *Client) Info(ctx context.Context, section string) (string, error) {
+    var resp *pb.InfoReply
+    err := c.do(ctx, true, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Info(ctx, &pb.InfoRequest{Section: section})
+        return err
+    })
+    if err != nil {
+        return "", err
+    }
+    return resp.Text, nil
+}
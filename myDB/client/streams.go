@@ -0,0 +1,93 @@
+package client
+
+import (
+    "context"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+)
+
+// Watch calls fn with the changes to the keys starting with prefix, from
+// revision from on (0 for now), until ctx is done or fn fails. When the
+// server goes away Watch connects again, to the next server if there are
+// several, and carries on after the last change fn got, so none is
+// missed.
+func (c *Client) Watch(ctx context.Context, prefix string, from uint64, fn func(*pb.WatchEvent) error) error {
+    for attempt := 0; ; attempt++ {
+        if c.closed.Load() {
+            return ErrClosed
+        }
+        server, db := c.pick()
+        stream, err := db.Watch(ctx, &pb.WatchRequest{Prefix: prefix, From: from})
+        for err == nil {
+            var e *pb.WatchEvent
+            if e, err = stream.Recv(); err == nil {
+                attempt = 0
+                if err := fn(e); err != nil {
+                    return err
+                }
+                from = e.Rev + 1
+            }
+        }
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if status.Code(err) != codes.Unavailable {
+            return err
+        }
+        c.failover(server)
+        if err := c.backoff(ctx, attempt); err != nil {
+            return err
+        }
+    }
+}
+
+// Publish sends message to the subscribers of channel and answers with
+// how many got it. It is not retried, so a message is not sent twice.
+func (c *Client) Publish(ctx context.Context, channel, message string) (int64, error) {
+    var resp *pb.PublishReply
+    err := c.do(ctx, false, func(ctx context.Context, db pb.MyDBClient) (err error) {
+        resp, err = db.Publish(ctx, &pb.PublishRequest{Channel: channel, Message: message})
+        return err
+    })
+    if err != nil {
+        return 0, err
+    }
+    return resp.Receivers, nil
+}
+
+// Subscribe calls fn with the messages of the subscription req asks for,
+// until ctx is done, fn fails or the server ends the subscription, which
+// comes back as an ABORTED status. A message with only Dropped set tells
+// how many messages the server dropped for this subscriber so far. When
+// the server goes away Subscribe subscribes again, to the next server if
+// there are several; the messages published in between are lost.
+func (c *Client) Subscribe(ctx context.Context, req *pb.SubscribeRequest, fn func(*pb.Message) error) error {
+    for attempt := 0; ; attempt++ {
+        if c.closed.Load() {
+            return ErrClosed
+        }
+        server, db := c.pick()
+        stream, err := db.Subscribe(ctx, req)
+        for err == nil {
+            var m *pb.Message
+            if m, err = stream.Recv(); err == nil {
+                attempt = 0
+                if err := fn(m); err != nil {
+                    return err
+                }
+            }
+        }
+        if ctx.Err() != nil {
+            return ctx.Err()
+        }
+        if status.Code(err) != codes.Unavailable {
+            return err
+        }
+        c.failover(server)
+        if err := c.backoff(ctx, attempt); err != nil {
+            return err
+        }
+    }
+}
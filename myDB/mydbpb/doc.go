@@ -0,0 +1,5 @@
+// Package mydbpb holds the gRPC API of mydb: the messages and the client
+// and server of the MyDB service, generated from mydb.proto.
+package mydbpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative mydb.proto
@@ -0,0 +1,1061 @@
+// The gRPC API of mydb. It offers what the net/rpc and HTTP APIs offer, to
+// clients in any language. Failed calls end with a gRPC status whose
+// message is the error of the store, such as "Key not found or expired" or
+// "WRONGTYPE ..."; see the README for how the codes are picked.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: mydb.proto
+
+package mydbpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MyDB_Login_FullMethodName          = "/mydb.MyDB/Login"
+	MyDB_Get_FullMethodName            = "/mydb.MyDB/Get"
+	MyDB_Set_FullMethodName            = "/mydb.MyDB/Set"
+	MyDB_Delete_FullMethodName         = "/mydb.MyDB/Delete"
+	MyDB_Expire_FullMethodName         = "/mydb.MyDB/Expire"
+	MyDB_Persist_FullMethodName        = "/mydb.MyDB/Persist"
+	MyDB_TTL_FullMethodName            = "/mydb.MyDB/TTL"
+	MyDB_Incr_FullMethodName           = "/mydb.MyDB/Incr"
+	MyDB_SetNX_FullMethodName          = "/mydb.MyDB/SetNX"
+	MyDB_GetSet_FullMethodName         = "/mydb.MyDB/GetSet"
+	MyDB_CompareAndSwap_FullMethodName = "/mydb.MyDB/CompareAndSwap"
+	MyDB_MGet_FullMethodName           = "/mydb.MyDB/MGet"
+	MyDB_MSet_FullMethodName           = "/mydb.MyDB/MSet"
+	MyDB_MDel_FullMethodName           = "/mydb.MyDB/MDel"
+	MyDB_Txn_FullMethodName            = "/mydb.MyDB/Txn"
+	MyDB_Command_FullMethodName        = "/mydb.MyDB/Command"
+	MyDB_Scan_FullMethodName           = "/mydb.MyDB/Scan"
+	MyDB_Count_FullMethodName          = "/mydb.MyDB/Count"
+	MyDB_Watch_FullMethodName          = "/mydb.MyDB/Watch"
+	MyDB_Publish_FullMethodName        = "/mydb.MyDB/Publish"
+	MyDB_Subscribe_FullMethodName      = "/mydb.MyDB/Subscribe"
+	MyDB_GetConfig_FullMethodName      = "/mydb.MyDB/GetConfig"
+	MyDB_SetConfig_FullMethodName      = "/mydb.MyDB/SetConfig"
+	MyDB_Info_FullMethodName           = "/mydb.MyDB/Info"
+)
+
+// MyDBClient is the client API for MyDB service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MyDBClient interface {
+	// Login checks a name and password or an API token and answers with
+	// the user. Calls are authenticated one by one, with the same
+	// credentials in the authorization metadata ("Basic ..." or
+	// "Bearer ...") or with a client certificate.
+	Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginReply, error)
+	Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	Set(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// Delete sets exists when the key was there to delete.
+	Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// Expire sets the TTL of an existing key to ttl seconds.
+	Expire(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// Persist removes the TTL of a key; exists tells whether it had one.
+	Persist(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// TTL answers with the milliseconds the key has left in value, -1 when
+	// it does not expire.
+	TTL(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// Incr adds delta to an integer value and answers with the result.
+	Incr(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// SetNX sets a key that does not exist yet, and fails with
+	// ALREADY_EXISTS otherwise.
+	SetNX(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// GetSet sets a key and answers with the value it had, if it existed.
+	GetSet(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	// CompareAndSwap sets a key that is still at revision (0 for a key that
+	// must not exist yet). Otherwise it fails with ABORTED and a KeyReply
+	// with the current revision in the status details.
+	CompareAndSwap(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error)
+	MGet(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error)
+	MSet(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error)
+	MDel(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error)
+	// Txn applies ops when every condition holds. Otherwise it fails with
+	// ABORTED and a TxnReply with the failed conditions in the status
+	// details.
+	Txn(ctx context.Context, in *TxnRequest, opts ...grpc.CallOption) (*TxnReply, error)
+	// Command runs a list, hash, set or sorted set command written as in
+	// Redis: ["LPUSH", "key", "value"].
+	Command(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (*CommandReply, error)
+	Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanReply, error)
+	Count(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanReply, error)
+	// Watch streams the changes to the keys starting with prefix, from
+	// revision from on (0 for now), until the client cancels.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	// Publish answers with the number of subscribers that got the message.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishReply, error)
+	// Subscribe streams the messages published on the channels and
+	// patterns until the client cancels.
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Message], error)
+	GetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*ConfigReply, error)
+	SetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*ConfigReply, error)
+	// Info answers with the INFO text of one section, or the default ones.
+	Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoReply, error)
+}
+
+type myDBClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMyDBClient(cc grpc.ClientConnInterface) MyDBClient {
+	return &myDBClient{cc}
+}
+
+func (c *myDBClient) Login(ctx context.Context, in *LoginRequest, opts ...grpc.CallOption) (*LoginReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LoginReply)
+	err := c.cc.Invoke(ctx, MyDB_Login_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Get(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Set(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Set_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Delete(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Expire(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Expire_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Persist(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Persist_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) TTL(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_TTL_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Incr(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_Incr_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) SetNX(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_SetNX_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) GetSet(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_GetSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) CompareAndSwap(ctx context.Context, in *KeyRequest, opts ...grpc.CallOption) (*KeyReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KeyReply)
+	err := c.cc.Invoke(ctx, MyDB_CompareAndSwap_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) MGet(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchReply)
+	err := c.cc.Invoke(ctx, MyDB_MGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) MSet(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchReply)
+	err := c.cc.Invoke(ctx, MyDB_MSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) MDel(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchReply)
+	err := c.cc.Invoke(ctx, MyDB_MDel_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Txn(ctx context.Context, in *TxnRequest, opts ...grpc.CallOption) (*TxnReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TxnReply)
+	err := c.cc.Invoke(ctx, MyDB_Txn_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Command(ctx context.Context, in *CommandRequest, opts ...grpc.CallOption) (*CommandReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CommandReply)
+	err := c.cc.Invoke(ctx, MyDB_Command_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Scan(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScanReply)
+	err := c.cc.Invoke(ctx, MyDB_Scan_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Count(ctx context.Context, in *ScanRequest, opts ...grpc.CallOption) (*ScanReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ScanReply)
+	err := c.cc.Invoke(ctx, MyDB_Count_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MyDB_ServiceDesc.Streams[0], MyDB_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyDB_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *myDBClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*PublishReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PublishReply)
+	err := c.cc.Invoke(ctx, MyDB_Publish_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Message], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MyDB_ServiceDesc.Streams[1], MyDB_Subscribe_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SubscribeRequest, Message]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyDB_SubscribeClient = grpc.ServerStreamingClient[Message]
+
+func (c *myDBClient) GetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*ConfigReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigReply)
+	err := c.cc.Invoke(ctx, MyDB_GetConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) SetConfig(ctx context.Context, in *ConfigRequest, opts ...grpc.CallOption) (*ConfigReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ConfigReply)
+	err := c.cc.Invoke(ctx, MyDB_SetConfig_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *myDBClient) Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InfoReply)
+	err := c.cc.Invoke(ctx, MyDB_Info_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MyDBServer is the server API for MyDB service.
+// All implementations must embed UnimplementedMyDBServer
+// for forward compatibility.
+type MyDBServer interface {
+	// Login checks a name and password or an API token and answers with
+	// the user. Calls are authenticated one by one, with the same
+	// credentials in the authorization metadata ("Basic ..." or
+	// "Bearer ...") or with a client certificate.
+	Login(context.Context, *LoginRequest) (*LoginReply, error)
+	Get(context.Context, *KeyRequest) (*KeyReply, error)
+	Set(context.Context, *KeyRequest) (*KeyReply, error)
+	// Delete sets exists when the key was there to delete.
+	Delete(context.Context, *KeyRequest) (*KeyReply, error)
+	// Expire sets the TTL of an existing key to ttl seconds.
+	Expire(context.Context, *KeyRequest) (*KeyReply, error)
+	// Persist removes the TTL of a key; exists tells whether it had one.
+	Persist(context.Context, *KeyRequest) (*KeyReply, error)
+	// TTL answers with the milliseconds the key has left in value, -1 when
+	// it does not expire.
+	TTL(context.Context, *KeyRequest) (*KeyReply, error)
+	// Incr adds delta to an integer value and answers with the result.
+	Incr(context.Context, *KeyRequest) (*KeyReply, error)
+	// SetNX sets a key that does not exist yet, and fails with
+	// ALREADY_EXISTS otherwise.
+	SetNX(context.Context, *KeyRequest) (*KeyReply, error)
+	// GetSet sets a key and answers with the value it had, if it existed.
+	GetSet(context.Context, *KeyRequest) (*KeyReply, error)
+	// CompareAndSwap sets a key that is still at revision (0 for a key that
+	// must not exist yet). Otherwise it fails with ABORTED and a KeyReply
+	// with the current revision in the status details.
+	CompareAndSwap(context.Context, *KeyRequest) (*KeyReply, error)
+	MGet(context.Context, *BatchRequest) (*BatchReply, error)
+	MSet(context.Context, *BatchRequest) (*BatchReply, error)
+	MDel(context.Context, *BatchRequest) (*BatchReply, error)
+	// Txn applies ops when every condition holds. Otherwise it fails with
+	// ABORTED and a TxnReply with the failed conditions in the status
+	// details.
+	Txn(context.Context, *TxnRequest) (*TxnReply, error)
+	// Command runs a list, hash, set or sorted set command written as in
+	// Redis: ["LPUSH", "key", "value"].
+	Command(context.Context, *CommandRequest) (*CommandReply, error)
+	Scan(context.Context, *ScanRequest) (*ScanReply, error)
+	Count(context.Context, *ScanRequest) (*ScanReply, error)
+	// Watch streams the changes to the keys starting with prefix, from
+	// revision from on (0 for now), until the client cancels.
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	// Publish answers with the number of subscribers that got the message.
+	Publish(context.Context, *PublishRequest) (*PublishReply, error)
+	// Subscribe streams the messages published on the channels and
+	// patterns until the client cancels.
+	Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Message]) error
+	GetConfig(context.Context, *ConfigRequest) (*ConfigReply, error)
+	SetConfig(context.Context, *ConfigRequest) (*ConfigReply, error)
+	// Info answers with the INFO text of one section, or the default ones.
+	Info(context.Context, *InfoRequest) (*InfoReply, error)
+	mustEmbedUnimplementedMyDBServer()
+}
+
+// UnimplementedMyDBServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMyDBServer struct{}
+
+func (UnimplementedMyDBServer) Login(context.Context, *LoginRequest) (*LoginReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Login not implemented")
+}
+func (UnimplementedMyDBServer) Get(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedMyDBServer) Set(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedMyDBServer) Delete(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMyDBServer) Expire(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Expire not implemented")
+}
+func (UnimplementedMyDBServer) Persist(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Persist not implemented")
+}
+func (UnimplementedMyDBServer) TTL(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method TTL not implemented")
+}
+func (UnimplementedMyDBServer) Incr(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Incr not implemented")
+}
+func (UnimplementedMyDBServer) SetNX(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetNX not implemented")
+}
+func (UnimplementedMyDBServer) GetSet(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetSet not implemented")
+}
+func (UnimplementedMyDBServer) CompareAndSwap(context.Context, *KeyRequest) (*KeyReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method CompareAndSwap not implemented")
+}
+func (UnimplementedMyDBServer) MGet(context.Context, *BatchRequest) (*BatchReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method MGet not implemented")
+}
+func (UnimplementedMyDBServer) MSet(context.Context, *BatchRequest) (*BatchReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method MSet not implemented")
+}
+func (UnimplementedMyDBServer) MDel(context.Context, *BatchRequest) (*BatchReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method MDel not implemented")
+}
+func (UnimplementedMyDBServer) Txn(context.Context, *TxnRequest) (*TxnReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Txn not implemented")
+}
+func (UnimplementedMyDBServer) Command(context.Context, *CommandRequest) (*CommandReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Command not implemented")
+}
+func (UnimplementedMyDBServer) Scan(context.Context, *ScanRequest) (*ScanReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Scan not implemented")
+}
+func (UnimplementedMyDBServer) Count(context.Context, *ScanRequest) (*ScanReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Count not implemented")
+}
+func (UnimplementedMyDBServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Error(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedMyDBServer) Publish(context.Context, *PublishRequest) (*PublishReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedMyDBServer) Subscribe(*SubscribeRequest, grpc.ServerStreamingServer[Message]) error {
+	return status.Error(codes.Unimplemented, "method Subscribe not implemented")
+}
+func (UnimplementedMyDBServer) GetConfig(context.Context, *ConfigRequest) (*ConfigReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetConfig not implemented")
+}
+func (UnimplementedMyDBServer) SetConfig(context.Context, *ConfigRequest) (*ConfigReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetConfig not implemented")
+}
+func (UnimplementedMyDBServer) Info(context.Context, *InfoRequest) (*InfoReply, error) {
+	return nil, status.Error(codes.Unimplemented, "method Info not implemented")
+}
+func (UnimplementedMyDBServer) mustEmbedUnimplementedMyDBServer() {}
+func (UnimplementedMyDBServer) testEmbeddedByValue()              {}
+
+// UnsafeMyDBServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MyDBServer will
+// result in compilation errors.
+type UnsafeMyDBServer interface {
+	mustEmbedUnimplementedMyDBServer()
+}
+
+func RegisterMyDBServer(s grpc.ServiceRegistrar, srv MyDBServer) {
+	// If the following call panics, it indicates UnimplementedMyDBServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MyDB_ServiceDesc, srv)
+}
+
+func _MyDB_Login_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Login(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Login_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Login(ctx, req.(*LoginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Get(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Set(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Delete(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Expire_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Expire(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Expire_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Expire(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Persist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Persist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Persist_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Persist(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_TTL_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).TTL(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_TTL_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).TTL(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Incr_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Incr(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Incr_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Incr(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_SetNX_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).SetNX(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_SetNX_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).SetNX(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_GetSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).GetSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_GetSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).GetSet(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_CompareAndSwap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).CompareAndSwap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_CompareAndSwap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).CompareAndSwap(ctx, req.(*KeyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_MGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).MGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_MGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).MGet(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_MSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).MSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_MSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).MSet(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_MDel_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).MDel(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_MDel_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).MDel(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Txn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Txn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Txn_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Txn(ctx, req.(*TxnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Command_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CommandRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Command(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Command_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Command(ctx, req.(*CommandRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Scan_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Scan(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Scan_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Scan(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Count_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Count(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Count_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Count(ctx, req.(*ScanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MyDBServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyDB_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _MyDB_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Publish_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Subscribe_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SubscribeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MyDBServer).Subscribe(m, &grpc.GenericServerStream[SubscribeRequest, Message]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MyDB_SubscribeServer = grpc.ServerStreamingServer[Message]
+
+func _MyDB_GetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).GetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_GetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).GetConfig(ctx, req.(*ConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_SetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ConfigRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).SetConfig(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_SetConfig_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).SetConfig(ctx, req.(*ConfigRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MyDB_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MyDBServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MyDB_Info_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MyDBServer).Info(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MyDB_ServiceDesc is the grpc.ServiceDesc for MyDB service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MyDB_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "mydb.MyDB",
+	HandlerType: (*MyDBServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Login",
+			Handler:    _MyDB_Login_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _MyDB_Get_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _MyDB_Set_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _MyDB_Delete_Handler,
+		},
+		{
+			MethodName: "Expire",
+			Handler:    _MyDB_Expire_Handler,
+		},
+		{
+			MethodName: "Persist",
+			Handler:    _MyDB_Persist_Handler,
+		},
+		{
+			MethodName: "TTL",
+			Handler:    _MyDB_TTL_Handler,
+		},
+		{
+			MethodName: "Incr",
+			Handler:    _MyDB_Incr_Handler,
+		},
+		{
+			MethodName: "SetNX",
+			Handler:    _MyDB_SetNX_Handler,
+		},
+		{
+			MethodName: "GetSet",
+			Handler:    _MyDB_GetSet_Handler,
+		},
+		{
+			MethodName: "CompareAndSwap",
+			Handler:    _MyDB_CompareAndSwap_Handler,
+		},
+		{
+			MethodName: "MGet",
+			Handler:    _MyDB_MGet_Handler,
+		},
+		{
+			MethodName: "MSet",
+			Handler:    _MyDB_MSet_Handler,
+		},
+		{
+			MethodName: "MDel",
+			Handler:    _MyDB_MDel_Handler,
+		},
+		{
+			MethodName: "Txn",
+			Handler:    _MyDB_Txn_Handler,
+		},
+		{
+			MethodName: "Command",
+			Handler:    _MyDB_Command_Handler,
+		},
+		{
+			MethodName: "Scan",
+			Handler:    _MyDB_Scan_Handler,
+		},
+		{
+			MethodName: "Count",
+			Handler:    _MyDB_Count_Handler,
+		},
+		{
+			MethodName: "Publish",
+			Handler:    _MyDB_Publish_Handler,
+		},
+		{
+			MethodName: "GetConfig",
+			Handler:    _MyDB_GetConfig_Handler,
+		},
+		{
+			MethodName: "SetConfig",
+			Handler:    _MyDB_SetConfig_Handler,
+		},
+		{
+			MethodName: "Info",
+			Handler:    _MyDB_Info_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _MyDB_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Subscribe",
+			Handler:       _MyDB_Subscribe_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "mydb.proto",
+}
@@ -0,0 +1,130 @@
+// Package ring implements a consistent hash ring with virtual nodes, used to
+// spread keys over several myDB nodes. Adding or removing a node only moves
+// the keys in the ranges that node gains or loses.
+package ring
+
+import (
+    "sort"
+    "strconv"
+    "sync"
+)
+
+// DefaultReplicas is the number of virtual nodes per node when none is given.
+const DefaultReplicas = 128
+
+// Ring maps keys to nodes. It is safe for concurrent use.
+type Ring struct {
+    mu       sync.RWMutex
+    replicas int
+    hashes   []uint64          // sorted virtual node positions
+    owners   map[uint64]string // virtual node position -> node
+    nodes    map[string]struct{}
+}
+
+// New creates a ring with replicas virtual nodes per node.
+func New(replicas int, nodes ...string) *Ring {
+    if replicas <= 0 {
+        replicas = DefaultReplicas
+    }
+    r := &Ring{
+        replicas: replicas,
+        owners:   make(map[uint64]string),
+        nodes:    make(map[string]struct{}),
+    }
+    for _, n := range nodes {
+        r.add(n)
+    }
+    r.sort()
+    return r
+}
+
+// Add puts node on the ring. Adding a node twice has no effect.
+func (r *Ring) Add(node string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.add(node)
+    r.sort()
+}
+
+// Remove takes node off the ring.
+func (r *Ring) Remove(node string) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if _, ok := r.nodes[node]; !ok {
+        return
+    }
+    delete(r.nodes, node)
+    for i := 0; i < r.replicas; i++ {
+        delete(r.owners, Hash(node+"#"+strconv.Itoa(i)))
+    }
+    r.sort()
+}
+
+// Get returns the node owning key: the first virtual node clockwise from
+// the key's hash. It returns "" for an empty ring.
+func (r *Ring) Get(key string) string {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    if len(r.hashes) == 0 {
+        return ""
+    }
+    h := Hash(key)
+    i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+    if i == len(r.hashes) {
+        i = 0
+    }
+    return r.owners[r.hashes[i]]
+}
+
+// Nodes returns the nodes on the ring in sorted order.
+func (r *Ring) Nodes() []string {
+    r.mu.RLock()
+    defer r.mu.RUnlock()
+    nodes := make([]string, 0, len(r.nodes))
+    for n := range r.nodes {
+        nodes = append(nodes, n)
+    }
+    sort.Strings(nodes)
+    return nodes
+}
+
+// Replicas returns the number of virtual nodes per node.
+func (r *Ring) Replicas() int {
+    return r.replicas
+}
+
+func (r *Ring) add(node string) {
+    if _, ok := r.nodes[node]; ok {
+        return
+    }
+    r.nodes[node] = struct{}{}
+    for i := 0; i < r.replicas; i++ {
+        r.owners[Hash(node+"#"+strconv.Itoa(i))] = node
+    }
+}
+
+func (r *Ring) sort() {
+    r.hashes = r.hashes[:0]
+    for h := range r.owners {
+        r.hashes = append(r.hashes, h)
+    }
+    sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// Hash is djb2 followed by a 64-bit finalizer. djb2 alone maps similar
+// strings such as "node#1" and "node#2" to neighbouring values, which would
+// bunch a node's virtual nodes together; the finalizer spreads them out.
+func Hash(s string) uint64 {
+    var hash uint64 = 5381
+    for i := 0; i < len(s); i++ {
+        hash = ((hash << 5) + hash) + uint64(s[i]) // hash * 33 + c
+    }
+
+    // fmix64 from MurmurHash3
+    hash ^= hash >> 33
+    hash *= 0xff51afd7ed558ccd
+    hash ^= hash >> 33
+    hash *= 0xc4ceb9fe1a85ec53
+    hash ^= hash >> 33
+    return hash
+}
@@ -0,0 +1,60 @@
+package ring
+
+import (
+    "fmt"
+    "testing"
+)
+
+func TestRing(t *testing.T) {
+    const keys = 100000
+    nodes := []string{"10.0.0.1:1234", "10.0.0.2:1234", "10.0.0.3:1234", "10.0.0.4:1234"}
+    r := New(0, nodes...)
+    if r.Replicas() != DefaultReplicas || fmt.Sprint(r.Nodes()) != fmt.Sprint(nodes) {
+        t.Fatalf("replicas %d, nodes %v", r.Replicas(), r.Nodes())
+    }
+    if New(0).Get("k") != "" {
+        t.Fatal("an empty ring has an owner")
+    }
+
+    // The keys are spread evenly enough over the nodes.
+    owners := make(map[string]string, keys)
+    count := make(map[string]int)
+    for i := 0; i < keys; i++ {
+        key := fmt.Sprint("key:", i)
+        owners[key] = r.Get(key)
+        count[owners[key]]++
+    }
+    for _, n := range nodes {
+        if share := float64(count[n]) / keys; share < 0.15 || share > 0.35 {
+            t.Fatalf("%s owns %.1f%% of the keys", n, share*100)
+        }
+    }
+
+    // Adding a node moves only keys to it, about a fifth of them.
+    added := "10.0.0.5:1234"
+    r.Add(added)
+    r.Add(added)
+    moved := 0
+    for key, owner := range owners {
+        if now := r.Get(key); now != owner {
+            if now != added {
+                t.Fatalf("%s moved from %s to %s", key, owner, now)
+            }
+            moved++
+        }
+    }
+    if share := float64(moved) / keys; share < 0.1 || share > 0.3 {
+        t.Fatalf("adding a node moved %.1f%% of the keys", share*100)
+    }
+
+    // Removing it again gives every key back to its old owner, and removing
+    // another moves only that node's keys.
+    r.Remove(added)
+    r.Remove(nodes[0])
+    for key, owner := range owners {
+        now := r.Get(key)
+        if owner == nodes[0] && now == nodes[0] || owner != nodes[0] && now != owner {
+            t.Fatalf("%s is on %s, was on %s", key, now, owner)
+        }
+    }
+}
@@ -0,0 +1,333 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "strconv"
+    "strings"
+)
+
+var (
+    errKeyExists        = errors.New("key already exists")
+    errRevisionMismatch = errors.New("CONFLICT revision mismatch")
+    errOverflow         = errors.New("ERR increment or decrement would overflow")
+)
+
+// IncrBy adds delta to the integer stored under key and returns the result.
+// A missing key counts as 0; an existing key keeps its expiration.
+func (s *InMemoryStore) IncrBy(key string, delta int64) (int64, error) {
+    var n int64
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        var cur int64
+        if exists {
+            if v.Type != TypeString {
+                return nil, errWrongType
+            }
+            i, err := strconv.ParseInt(v.Value, 10, 64)
+            if err != nil {
+                return nil, errNotInteger
+            }
+            cur = i
+        }
+        if addOverflows(cur, delta) {
+            return nil, errOverflow
+        }
+        n = cur + delta
+        return &Mutation{Op: OpSet, Key: key, Value: strconv.FormatInt(n, 10), Expiration: v.Expiration}, nil
+    })
+    return n, err
+}
+
+// SetNX sets key only if it does not exist and reports whether it did.
+func (s *InMemoryStore) SetNX(key, value string, ttl int64) (bool, error) {
+    if err := checkTTL(ttl); err != nil {
+        return false, err
+    }
+    return s.setNX(key, value, expirationAfter(ttl))
+}
+
+func (s *InMemoryStore) setNX(key, value string, expiration int64) (bool, error) {
+    set := false
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if exists {
+            return nil, nil
+        }
+        set = true
+        return &Mutation{Op: OpSet, Key: key, Value: value, Expiration: expiration}, nil
+    })
+    return set && err == nil, err
+}
+
+// GetSet sets key and returns the value it held before, if any.
+func (s *InMemoryStore) GetSet(key, value string, ttl int64) (string, bool, error) {
+    if err := checkTTL(ttl); err != nil {
+        return "", false, err
+    }
+    return s.getSet(key, value, expirationAfter(ttl))
+}
+
+func (s *InMemoryStore) getSet(key, value string, expiration int64) (string, bool, error) {
+    var old string
+    var existed bool
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if exists && v.Type != TypeString {
+            return nil, errWrongType
+        }
+        old, existed = v.Value, exists
+        return &Mutation{Op: OpSet, Key: key, Value: value, Expiration: expiration}, nil
+    })
+    return old, existed, err
+}
+
+// CompareAndSwap sets key only if its revision is still revision, where 0
+// stands for a key that does not exist. It returns the revision of the key
+// afterwards; on errRevisionMismatch that is the current one, so the caller
+// can read the key again and retry.
+func (s *InMemoryStore) CompareAndSwap(key, value string, ttl int64, revision uint64) (uint64, error) {
+    if err := checkTTL(ttl); err != nil {
+        return 0, err
+    }
+    var current uint64
+    var m *Mutation
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if exists {
+            current = v.Revision
+        }
+        if current != revision {
+            return nil, errRevisionMismatch
+        }
+        m = &Mutation{Op: OpSet, Key: key, Value: value, Expiration: expirationAfter(ttl)}
+        return m, nil
+    })
+    if err != nil {
+        return current, err
+    }
+    return m.Revision, nil // stamped by update
+}
+
+// addOverflows reports whether a+b does not fit in an int64.
+func addOverflows(a, b int64) bool {
+    return (b > 0 && a > math.MaxInt64-b) || (b < 0 && a < math.MinInt64-b)
+}
+
+func (s *InMemoryStore) RPCIncr(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    n, err := s.IncrBy(req.Key, req.Delta)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    resp.Data = strconv.FormatInt(n, 10)
+    return nil
+}
+
+// RPCSetNX fails with errKeyExists and sets Exists when the key is there.
+func (s *InMemoryStore) RPCSetNX(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    set, err := s.SetNX(req.Key, req.Value, req.TTL)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    if !set {
+        resp.Success = false
+        resp.Error = errKeyExists.Error()
+        resp.Exists = true
+        return nil
+    }
+    resp.Success = true
+    return nil
+}
+
+// RPCGetSet returns the previous value in Data, and Exists tells an empty
+// value from a missing one.
+func (s *InMemoryStore) RPCGetSet(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    old, existed, err := s.GetSet(req.Key, req.Value, req.TTL)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    resp.Data = old
+    resp.Exists = existed
+    return nil
+}
+
+func (s *InMemoryStore) RPCCompareAndSwap(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    rev, err := s.CompareAndSwap(req.Key, req.Value, req.TTL, req.Revision)
+    resp.Revision = rev
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    return nil
+}
+
+// invoke runs the RPC method fn for req on this node, or on the owner of
+// the key when it lives on another shard, so the HTTP and gRPC handlers
+// answer the same way in both cases.
+func (store *InMemoryStore) invoke(method string, fn func(*RPCRequest, *RPCResponse) error, req *RPCRequest) (RPCResponse, error) {
+    var resp RPCResponse
+    if owner, local := store.route(req.Key); !local {
+        err := store.sharding.call(owner, "InMemoryStore."+method, req, &resp)
+        if err != nil {
+            err = fmt.Errorf("shard %s: %w", owner, err)
+        }
+        return resp, err
+    }
+    err := fn(req, &resp)
+    return resp, err
+}
+
+// errorStatus picks the HTTP status for an error message from the store.
+func errorStatus(msg string) int {
+    switch {
+    case strings.HasPrefix(msg, "ERR "), strings.HasPrefix(msg, "WRONGTYPE"), strings.HasPrefix(msg, "CROSSSHARD"):
+        return http.StatusBadRequest
+    case strings.HasPrefix(msg, "CONFLICT"), msg == errKeyExists.Error():
+        return http.StatusConflict
+    case msg == errKeyNotFound.Error():
+        return http.StatusNotFound
+    case strings.HasPrefix(msg, "NOAUTH"), strings.HasPrefix(msg, "WRONGPASS"):
+        return http.StatusUnauthorized
+    case strings.HasPrefix(msg, "NOPERM"):
+        return http.StatusForbidden
+    case strings.HasPrefix(msg, "OOM"):
+        return http.StatusInsufficientStorage
+    default:
+        return http.StatusInternalServerError
+    }
+}
+
+// writeRPCResult answers an HTTP request with the outcome of an RPC method.
+// ok fills in the response when the call succeeded.
+func writeRPCResult(w http.ResponseWriter, resp RPCResponse, err error, ok func(out *APIResponse)) {
+    if err != nil {
+        w.WriteHeader(http.StatusBadGateway)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    out := APIResponse{Success: resp.Success, Error: resp.Error, Revision: resp.Revision}
+    if !resp.Success {
+        w.WriteHeader(errorStatus(resp.Error))
+    } else if ok != nil {
+        ok(&out)
+    }
+    json.NewEncoder(w).Encode(out)
+}
+
+// incrHandler serves /incr and /decr, which take {"key": ..., "delta": n}
+// with delta defaulting to 1. sign is -1 for /decr.
+func (store *InMemoryStore) incrHandler(sign int64) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if store.redirectToLeader(w, r) {
+            return
+        }
+        var req struct {
+            Key   string `json:"key"`
+            Delta *int64 `json:"delta"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            httpError(w, http.StatusBadRequest, "Invalid request")
+            return
+        }
+        delta := int64(1)
+        if req.Delta != nil {
+            delta = *req.Delta
+        }
+        if sign < 0 && delta == math.MinInt64 {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: errOverflow.Error()})
+            return
+        }
+        args := &RPCRequest{Key: req.Key, Delta: sign * delta}
+        if !authorized(w, r, "InMemoryStore.RPCIncr", args) {
+            return
+        }
+        resp, err := store.invoke("RPCIncr", store.RPCIncr, args)
+        writeRPCResult(w, resp, err, func(out *APIResponse) {
+            out.Data, _ = strconv.ParseInt(resp.Data, 10, 64)
+        })
+    }
+}
+
+func (store *InMemoryStore) setNXHandler(w http.ResponseWriter, r *http.Request) {
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req RPCRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    args := &RPCRequest{Key: req.Key, Value: req.Value, TTL: req.TTL}
+    if !authorized(w, r, "InMemoryStore.RPCSetNX", args) {
+        return
+    }
+    resp, err := store.invoke("RPCSetNX", store.RPCSetNX, args)
+    writeRPCResult(w, resp, err, nil)
+}
+
+// getSetHandler returns the previous value in data, which is left out when
+// the key did not exist.
+func (store *InMemoryStore) getSetHandler(w http.ResponseWriter, r *http.Request) {
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req RPCRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    args := &RPCRequest{Key: req.Key, Value: req.Value, TTL: req.TTL}
+    if !authorized(w, r, "InMemoryStore.RPCGetSet", args) {
+        return
+    }
+    resp, err := store.invoke("RPCGetSet", store.RPCGetSet, args)
+    writeRPCResult(w, resp, err, func(out *APIResponse) {
+        if resp.Exists {
+            out.Data = resp.Data
+        }
+    })
+}
+
+// casHandler takes {"key", "value", "ttl", "revision"} and answers 409 with
+// the current revision when the key has changed in the meantime.
+func (store *InMemoryStore) casHandler(w http.ResponseWriter, r *http.Request) {
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req RPCRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCCompareAndSwap", &req) {
+        return
+    }
+    resp, err := store.invoke("RPCCompareAndSwap", store.RPCCompareAndSwap, &req)
+    writeRPCResult(w, resp, err, nil)
+}
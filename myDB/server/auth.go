@@ -0,0 +1,579 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/gob"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "net/http"
+    "net/rpc"
+    "os"
+    "strings"
+    "sync"
+    "time"
+)
+
+var (
+    errNoAuth    = errors.New("NOAUTH Authentication required.")
+    errWrongPass = errors.New("WRONGPASS invalid username-password pair or user is disabled.")
+    errNoUsers   = errors.New("ERR AUTH called without any users configured, see -acl-file")
+)
+
+// access is what a user may do with a key. Each level includes the ones
+// below it.
+type access uint8
+
+const (
+    accessNone  access = iota
+    accessRead         // read the keys, scan them, watch them, subscribe to the channels
+    accessWrite        // change and delete the keys, publish to the channels
+    accessAdmin        // on the empty prefix: snapshots, replication, cluster membership
+)
+
+var accessNames = map[string]access{"none": accessNone, "read": accessRead, "write": accessWrite, "admin": accessAdmin}
+
+func (a access) String() string {
+    for name, v := range accessNames {
+        if v == a {
+            return name
+        }
+    }
+    return "unknown"
+}
+
+func (a *access) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err != nil {
+        return err
+    }
+    v, ok := accessNames[strings.ToLower(s)]
+    if !ok {
+        return fmt.Errorf("unknown access %q, use none, read, write or admin", s)
+    }
+    *a = v
+    return nil
+}
+
+// ACLConfig is the file given with -acl-file:
+//
+//	{"users": [{"name": "app", "password": "sha256:5e88...", "tokens": ["t0k3n"],
+//	            "permissions": [{"prefix": "session:", "access": "write"}]}]}
+//
+// Passwords and tokens are either plain or "sha256:" and the hex SHA-256
+// of the secret.
+type ACLConfig struct {
+    Users []ACLUser `json:"users"`
+}
+
+type ACLUser struct {
+    Name        string       `json:"name"`
+    Password    string       `json:"password,omitempty"`
+    Tokens      []string     `json:"tokens,omitempty"`
+    Permissions []Permission `json:"permissions"`
+}
+
+// Permission grants access to the keys (and pub/sub channels) starting
+// with Prefix. For a key the permission with the longest matching prefix
+// counts, so a narrower prefix can grant less than a wider one.
+type Permission struct {
+    Prefix string `json:"prefix"`
+    Access access `json:"access"`
+}
+
+// ACL authenticates users and decides what they may do. The same need
+// checks run for HTTP, RPC and RESP requests, see callNeeds and
+// respCommand.
+type ACL struct {
+    users  map[string]*ACLUser
+    tokens map[string]*ACLUser // by the SHA-256 of the token
+}
+
+// LoadACL reads the users from the JSON file at path.
+func LoadACL(path string) (*ACL, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, err
+    }
+    var cfg ACLConfig
+    if err := json.Unmarshal(data, &cfg); err != nil {
+        return nil, fmt.Errorf("parse %s: %w", path, err)
+    }
+    return NewACL(cfg)
+}
+
+func NewACL(cfg ACLConfig) (*ACL, error) {
+    a := &ACL{users: make(map[string]*ACLUser), tokens: make(map[string]*ACLUser)}
+    for i := range cfg.Users {
+        u := &cfg.Users[i]
+        if u.Name == "" {
+            return nil, errors.New("a user has no name")
+        }
+        if _, dup := a.users[u.Name]; dup {
+            return nil, fmt.Errorf("user %q is defined twice", u.Name)
+        }
+        a.users[u.Name] = u
+        for _, t := range u.Tokens {
+            a.tokens[secretHash(t)] = u
+        }
+    }
+    return a, nil
+}
+
+// secretHash returns the hex SHA-256 of a configured secret, which may
+// already be given as one.
+func secretHash(secret string) string {
+    if h, ok := strings.CutPrefix(secret, "sha256:"); ok {
+        return strings.ToLower(h)
+    }
+    sum := sha256.Sum256([]byte(secret))
+    return hex.EncodeToString(sum[:])
+}
+
+// Login returns the user with name and password.
+func (a *ACL) Login(name, password string) (*ACLUser, error) {
+    u, ok := a.users[name]
+    if !ok || u.Password == "" {
+        return nil, errWrongPass
+    }
+    sum := sha256.Sum256([]byte(password))
+    if subtle.ConstantTimeCompare([]byte(secretHash(u.Password)), []byte(hex.EncodeToString(sum[:]))) != 1 {
+        return nil, errWrongPass
+    }
+    return u, nil
+}
+
+// Token returns the user an API token belongs to.
+func (a *ACL) Token(token string) (*ACLUser, error) {
+    sum := sha256.Sum256([]byte(token))
+    u, ok := a.tokens[hex.EncodeToString(sum[:])]
+    if !ok {
+        return nil, errWrongPass
+    }
+    return u, nil
+}
+
+// authenticate logs in with a token when name is empty and with a password
+// otherwise.
+func (a *ACL) authenticate(name, secret string) (*ACLUser, error) {
+    if name == "" {
+        return a.Token(secret)
+    }
+    return a.Login(name, secret)
+}
+
+// level returns the access u has to key.
+func (u *ACLUser) level(key string) access {
+    best, level := -1, accessNone
+    for _, p := range u.Permissions {
+        if len(p.Prefix) > best && strings.HasPrefix(key, p.Prefix) {
+            best, level = len(p.Prefix), p.Access
+        }
+    }
+    return level
+}
+
+// covers reports whether u has at least a to every key in [start, end),
+// where an empty end means no upper bound. The access only changes where
+// the keys of a permission start or end, so those are the keys to check.
+func (u *ACLUser) covers(start, end string, a access) bool {
+    if u.level(start) < a {
+        return false
+    }
+    inside := func(key string) bool { return key > start && (end == "" || key < end) }
+    for _, p := range u.Permissions {
+        if inside(p.Prefix) && u.level(p.Prefix) < a {
+            return false
+        }
+        if pe := prefixEnd(p.Prefix); pe != "" && inside(pe) && u.level(pe) < a {
+            return false
+        }
+    }
+    return true
+}
+
+// need is what a request asks of its user: access to a key, or to every
+// key in [key, end) when span is set.
+type need struct {
+    access access
+    key    string
+    end    string
+    span   bool
+}
+
+func keyNeeds(a access, keys ...string) []need {
+    needs := make([]need, len(keys))
+    for i, key := range keys {
+        needs[i] = need{access: a, key: key}
+    }
+    return needs
+}
+
+func prefixNeed(a access, prefix string) need {
+    return need{access: a, key: prefix, end: prefixEnd(prefix), span: true}
+}
+
+// adminNeed is what operations on the whole server ask for.
+var adminNeed = []need{prefixNeed(accessAdmin, "")}
+
+// authorize checks that u may do what needs ask for. A nil ACL allows
+// everything; otherwise a nil user has not logged in yet.
+func (a *ACL) authorize(u *ACLUser, needs []need) error {
+    if a == nil {
+        return nil
+    }
+    if u == nil {
+        return errNoAuth
+    }
+    for _, n := range needs {
+        switch {
+        case n.span && !u.covers(n.key, n.end, n.access):
+            if n.end == prefixEnd(n.key) {
+                return fmt.Errorf("NOPERM user %s has no %s access to the keys starting with %q", u.Name, n.access, n.key)
+            }
+            return fmt.Errorf("NOPERM user %s has no %s access to the keys from %q to %q", u.Name, n.access, n.key, n.end)
+        case !n.span && u.level(n.key) < n.access:
+            return fmt.Errorf("NOPERM user %s has no %s access to key %q", u.Name, n.access, n.key)
+        }
+    }
+    return nil
+}
+
+// callNeeds maps an RPC method to what a call with args asks of the user.
+// HTTP handlers describe their requests as the RPC call they amount to, so
+// the same table decides for both. Methods that are not listed need admin
+// access; those mapped to nil only need a logged in user.
+var callNeeds = map[string]func(args interface{}) []need{
+    "InMemoryStore.RPCGet":            rpcKey(accessRead),
+    "InMemoryStore.RPCTTL":            rpcKey(accessRead),
+    "InMemoryStore.RPCSet":            rpcKey(accessWrite),
+    "InMemoryStore.RPCDelete":         rpcKey(accessWrite),
+    "InMemoryStore.RPCIncr":           rpcKey(accessWrite),
+    "InMemoryStore.RPCSetNX":          rpcKey(accessWrite),
+    "InMemoryStore.RPCGetSet":         rpcKey(accessWrite),
+    "InMemoryStore.RPCCompareAndSwap": rpcKey(accessWrite),
+    "InMemoryStore.RPCExpire":         rpcKey(accessWrite),
+    "InMemoryStore.RPCPersist":        rpcKey(accessWrite),
+    "InMemoryStore.RPCMGet":           func(args interface{}) []need { return keyNeeds(accessRead, args.(*BatchRequest).Keys...) },
+    "InMemoryStore.RPCMSet":           func(args interface{}) []need { return keyNeeds(accessWrite, args.(*BatchRequest).itemKeys()...) },
+    "InMemoryStore.RPCMDel":           func(args interface{}) []need { return keyNeeds(accessWrite, args.(*BatchRequest).Keys...) },
+    "InMemoryStore.RPCTxn":            txnNeeds,
+    "InMemoryStore.RPCCommand":        func(args interface{}) []need { return commandNeeds(args.(*CommandRequest).Args) },
+    "InMemoryStore.RPCScan":           scanNeeds,
+    "InMemoryStore.RPCCount":          scanNeeds,
+    "InMemoryStore.RPCWatch":          func(args interface{}) []need { return []need{prefixNeed(accessRead, args.(*WatchRequest).Prefix)} },
+    "InMemoryStore.RPCMemoryStats":    nil,
+    "PubSub.Publish":                  func(args interface{}) []need { return keyNeeds(accessWrite, args.(*PublishRequest).Channel) },
+    "PubSub.Subscribe":                subscribeNeeds,
+    "PubSub.Receive":                  nil, // only on the caller's own subscriptions, see PubSub.lookup
+    "PubSub.Unsubscribe":              nil,
+    "Sharding.Nodes":                  nil,
+    "Replication.Status":              nil, // GET /replication/status
+    "Raft.Status":                     nil, // GET /raft/status and /raft/members
+    "Stats.Info":                      nil, // GET /info and /metrics
+}
+
+func rpcKey(a access) func(args interface{}) []need {
+    return func(args interface{}) []need { return keyNeeds(a, args.(*RPCRequest).Key) }
+}
+
+func txnNeeds(args interface{}) []need {
+    req := args.(*TxnRequest)
+    var needs []need
+    for _, c := range req.Conditions {
+        needs = append(needs, need{access: accessRead, key: c.Key})
+    }
+    for _, op := range req.Ops {
+        needs = append(needs, need{access: accessWrite, key: op.Key})
+    }
+    return needs
+}
+
+// commandNeeds covers the list, hash, set and sorted set commands, whose
+// key is always args[1].
+func commandNeeds(args []string) []need {
+    if len(args) < 2 {
+        return nil // rejected by lookupCommand
+    }
+    a := accessRead
+    if cmd, ok := storeCommands[strings.ToUpper(args[0])]; ok && cmd.write {
+        a = accessWrite
+    }
+    return keyNeeds(a, args[1])
+}
+
+// scanNeeds asks for read access to every key the scan could return.
+func scanNeeds(args interface{}) []need {
+    start, end := args.(*ScanRequest).keyRange()
+    return []need{{access: accessRead, key: start, end: end, span: true}}
+}
+
+func subscribeNeeds(args interface{}) []need {
+    req := args.(*SubscribeRequest)
+    needs := keyNeeds(accessRead, req.Channels...)
+    for _, p := range req.Patterns {
+        needs = append(needs, prefixNeed(accessRead, globPrefix(p)))
+    }
+    return needs
+}
+
+// globPrefix returns the literal start of a glob pattern, which every
+// string it matches starts with.
+func globPrefix(pattern string) string {
+    if i := strings.IndexAny(pattern, `*?[\`); i >= 0 {
+        return pattern[:i]
+    }
+    return pattern
+}
+
+// callAllowed checks a call of method with args by u.
+func (a *ACL) callAllowed(u *ACLUser, method string, args interface{}) error {
+    if a == nil || method == "Auth.Login" {
+        return nil
+    }
+    needs := adminNeed
+    if fn, ok := callNeeds[method]; ok {
+        needs = nil
+        if fn != nil {
+            needs = fn(args)
+        }
+    }
+    return a.authorize(u, needs)
+}
+
+// HTTP
+
+type authContextKey struct{}
+
+// httpSession is what the middleware found out about the caller of an
+// HTTP request.
+type httpSession struct {
+    acl  *ACL
+    user *ACLUser
+}
+
+// protect authenticates every request to next with HTTP basic auth
+// (user and password), a bearer token or a client certificate, and leaves
+// the permission checks to the handlers, see authorized.
+func (a *ACL) protect(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var u *ACLUser
+        var err error
+        if name, password, ok := r.BasicAuth(); ok {
+            u, err = a.Login(name, password)
+        } else if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+            u, err = a.Token(token)
+        } else if u = a.certUser(r.TLS); u == nil {
+            err = errNoAuth
+        }
+        if err != nil {
+            w.Header().Set("WWW-Authenticate", `Basic realm="mydb"`)
+            w.WriteHeader(http.StatusUnauthorized)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+            return
+        }
+        ctx := context.WithValue(r.Context(), authContextKey{}, &httpSession{acl: a, user: u})
+        next.ServeHTTP(w, r.WithContext(ctx))
+    })
+}
+
+// authorized answers r with 403 and returns false unless its user may make
+// the RPC call of method with args. Without ACLs every request is allowed.
+func authorized(w http.ResponseWriter, r *http.Request, method string, args interface{}) bool {
+    sess, ok := r.Context().Value(authContextKey{}).(*httpSession)
+    if !ok {
+        return true
+    }
+    if err := sess.acl.callAllowed(sess.user, method, args); err != nil {
+        w.WriteHeader(errorStatus(err.Error()))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return false
+    }
+    return true
+}
+
+// RPC
+
+// LoginRequest logs an RPC connection in, with Name and Password or with
+// an API token in Token.
+type LoginRequest struct {
+    Name     string `json:"name,omitempty"`
+    Password string `json:"password,omitempty"`
+    Token    string `json:"token,omitempty"`
+}
+
+type LoginResponse struct {
+    User string `json:"user"`
+}
+
+// authService is registered as "Auth". The login itself is done by the
+// connection's authCodec, which is where the user is kept.
+type authService struct{ acl *ACL }
+
+func (s *authService) Login(req *LoginRequest, resp *LoginResponse) error {
+    if s.acl == nil {
+        return errNoUsers
+    }
+    u, err := s.acl.authenticate(req.Name, req.secret())
+    if err != nil {
+        return err
+    }
+    resp.User = u.Name
+    return nil
+}
+
+func (req *LoginRequest) secret() string {
+    if req.Name == "" {
+        return req.Token
+    }
+    return req.Password
+}
+
+// rpcLogin holds the credentials this node presents to the other nodes of
+// the cluster, nil when they do not use ACLs. See dialTimeout.
+var rpcLogin *LoginRequest
+
+// login authenticates client with rpcLogin, if set.
+func login(client *rpc.Client) error {
+    if rpcLogin == nil {
+        return nil
+    }
+    var resp LoginResponse
+    return client.Call("Auth.Login", rpcLogin, &resp)
+}
+
+// serveRPC serves one RPC connection, checking every call against the ACL
+// of the user the connection logged in as, or that its client certificate
+// names. Without an ACL every call is allowed. Clients may pipeline calls:
+// up to pipeline of them are served at once, and the next one is only read
+// when one of those has been answered.
+func (a *ACL) serveRPC(conn net.Conn, pipeline int) {
+    user, err := a.handshake(conn)
+    if err != nil {
+        conn.Close()
+        return
+    }
+    metrics.rpcClients.Add(1)
+    defer metrics.rpcClients.Add(-1)
+    buf := bufio.NewWriter(conn)
+    rpc.ServeCodec(&authCodec{
+        acl:    a,
+        user:   user,
+        calls:  make(map[uint64]rpcCall),
+        slots:  make(chan struct{}, pipeline),
+        rwc:    conn,
+        dec:    gob.NewDecoder(conn),
+        enc:    gob.NewEncoder(buf),
+        encBuf: buf,
+    })
+}
+
+// authCodec is the gob codec of net/rpc, which decides after decoding the
+// arguments of each call whether the connection's user may make it. An
+// error from ReadRequestBody is sent back as the call's error and the
+// connection carries on. It also times each call for the metrics.
+type authCodec struct {
+    acl    *ACL
+    user   *ACLUser
+    method string
+
+    mu    sync.Mutex         // calls are answered while the next one is read
+    calls map[uint64]rpcCall // the calls being served, by sequence number
+    slots chan struct{}      // one per call being served, see serveRPC
+
+    rwc    io.ReadWriteCloser
+    dec    *gob.Decoder
+    enc    *gob.Encoder
+    encBuf *bufio.Writer
+    closed bool
+}
+
+// rpcCall is a call being served.
+type rpcCall struct {
+    method string
+    start  time.Time
+}
+
+func (c *authCodec) ReadRequestHeader(r *rpc.Request) error {
+    c.slots <- struct{}{}
+    if err := c.dec.Decode(r); err != nil {
+        <-c.slots
+        return err
+    }
+    c.method = r.ServiceMethod
+    c.mu.Lock()
+    c.calls[r.Seq] = rpcCall{method: r.ServiceMethod, start: time.Now()}
+    c.mu.Unlock()
+    return nil
+}
+
+func (c *authCodec) ReadRequestBody(body interface{}) error {
+    if err := c.dec.Decode(body); err != nil || body == nil || c.acl == nil {
+        return err
+    }
+    if req, ok := body.(*LoginRequest); ok && c.method == "Auth.Login" {
+        u, err := c.acl.authenticate(req.Name, req.secret())
+        if err != nil {
+            return err // the connection stays logged in as it was
+        }
+        c.user = u
+        return nil
+    }
+    if err := c.acl.callAllowed(c.user, c.method, body); err != nil {
+        return err
+    }
+    if args, ok := body.(callerArgs); ok {
+        args.setCaller(c.user)
+    }
+    return nil
+}
+
+// callerArgs are the arguments of calls that depend on who makes them,
+// such as the pub/sub calls that only work on the caller's subscriptions.
+type callerArgs interface {
+    setCaller(u *ACLUser)
+}
+
+func (c *authCodec) WriteResponse(r *rpc.Response, body interface{}) (err error) {
+    c.mu.Lock()
+    call, ok := c.calls[r.Seq]
+    delete(c.calls, r.Seq)
+    c.mu.Unlock()
+    if ok {
+        defer func() { <-c.slots }()
+        defer func() {
+            method := call.method
+            if strings.HasPrefix(r.Error, "rpc: can't find") {
+                method = "unknown" // keeps made up names from making up labels
+            }
+            metrics.observe("rpc", method, time.Since(call.start), r.Error != "" || err != nil)
+        }()
+    }
+    if err = c.enc.Encode(r); err != nil {
+        if c.encBuf.Flush() == nil {
+            c.Close() // gob could not encode the header
+        }
+        return
+    }
+    if err = c.enc.Encode(body); err != nil {
+        if c.encBuf.Flush() == nil {
+            c.Close()
+        }
+        return
+    }
+    return c.encBuf.Flush()
+}
+
+func (c *authCodec) Close() error {
+    if c.closed {
+        return nil
+    }
+    c.closed = true
+    return c.rwc.Close()
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+    "strings"
+    "testing"
+)
+
+func TestACLAuthorize(t *testing.T) {
+    acl, err := NewACL(ACLConfig{Users: []ACLUser{{
+        Name:     "app",
+        Password: "sha256:5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8", // "password"
+        Tokens:   []string{"t0ken"},
+        Permissions: []Permission{
+            {Prefix: "", Access: accessRead},
+            {Prefix: "app:", Access: accessWrite},
+            {Prefix: "app:secret:", Access: accessNone},
+        },
+    }}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := acl.Login("app", "wrong"); err != errWrongPass {
+        t.Fatalf("wrong password: got %v", err)
+    }
+    if _, err := acl.Token("t0ken"); err != nil {
+        t.Fatalf("token: %v", err)
+    }
+    u, err := acl.Login("app", "password")
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        method string
+        args   interface{}
+        want   string // prefix of the error, "" when allowed
+    }{
+        {"InMemoryStore.RPCGet", &RPCRequest{Key: "other"}, ""},
+        {"InMemoryStore.RPCSet", &RPCRequest{Key: "other"}, "NOPERM"},
+        {"InMemoryStore.RPCSet", &RPCRequest{Key: "app:x"}, ""},
+        {"InMemoryStore.RPCGet", &RPCRequest{Key: "app:secret:x"}, "NOPERM"},
+        {"InMemoryStore.RPCScan", &ScanRequest{Prefix: "app:"}, "NOPERM"},
+        {"InMemoryStore.RPCScan", &ScanRequest{Prefix: "app:x"}, ""},
+        {"InMemoryStore.RPCScan", &ScanRequest{Start: "app:a", End: "app:b"}, ""},
+        {"InMemoryStore.RPCScan", &ScanRequest{Start: "app:a", End: "app:t"}, "NOPERM"},
+        {"InMemoryStore.RPCScan", &ScanRequest{Start: "app:a"}, "NOPERM"},
+        {"InMemoryStore.RPCTxn", &TxnRequest{Conditions: []TxnCondition{{Key: "other"}}, Ops: []TxnOp{{Op: "set", Key: "app:x"}}}, ""},
+        {"InMemoryStore.RPCCommand", &CommandRequest{Args: []string{"LPUSH", "list", "x"}}, "NOPERM"},
+        {"InMemoryStore.RPCCommand", &CommandRequest{Args: []string{"LRANGE", "list", "0", "-1"}}, ""},
+        {"PubSub.Subscribe", &SubscribeRequest{Patterns: []string{"app:*"}}, "NOPERM"},
+        {"PubSub.Publish", &PublishRequest{Channel: "app:events"}, ""},
+        {"InMemoryStore.RPCSnapshot", &RPCRequest{}, "NOPERM"},
+        {"Raft.AppendEntries", nil, "NOPERM"},
+        {"PubSub.Stats", nil, "NOPERM"},
+        {"Sharding.Nodes", nil, ""},
+    }
+    for _, tt := range tests {
+        err := acl.callAllowed(u, tt.method, tt.args)
+        if (err == nil) != (tt.want == "") || (err != nil && !strings.HasPrefix(err.Error(), tt.want)) {
+            t.Errorf("%s %+v: got %v, want %q", tt.method, tt.args, err, tt.want)
+        }
+    }
+    if err := acl.callAllowed(nil, "Sharding.Nodes", nil); err != errNoAuth {
+        t.Errorf("not logged in: got %v", err)
+    }
+}
+
+func TestPubSubOwner(t *testing.T) {
+    ps := NewPubSub(16, policyDrop)
+    alice, bob := &ACLUser{Name: "alice"}, &ACLUser{Name: "bob"}
+    var sub SubscribeResponse
+    if err := ps.Subscribe(&SubscribeRequest{Channels: []string{"news"}, caller: alice}, &sub); err != nil {
+        t.Fatal(err)
+    }
+    var other SubscribeResponse
+    ps.Subscribe(&SubscribeRequest{Channels: []string{"news"}, caller: alice}, &other)
+    if sub.ID == other.ID || sub.ID+1 == other.ID {
+        t.Fatalf("guessable IDs %d and %d", sub.ID, other.ID)
+    }
+
+    var resp ReceiveResponse
+    if err := ps.Unsubscribe(&ReceiveRequest{ID: sub.ID, caller: bob}, &resp); err != errNoSubscription {
+        t.Fatalf("unsubscribe by another user: %v", err)
+    }
+    ps.publish("news", "hi")
+    ps.Receive(&ReceiveRequest{ID: sub.ID, caller: bob}, &resp)
+    if !resp.Closed || len(resp.Messages) != 0 {
+        t.Fatalf("receive by another user: %+v", resp)
+    }
+    resp = ReceiveResponse{}
+    ps.Receive(&ReceiveRequest{ID: sub.ID, caller: alice}, &resp)
+    if len(resp.Messages) != 1 || resp.Messages[0].Payload != "hi" {
+        t.Fatalf("receive by the owner: %+v", resp)
+    }
+}
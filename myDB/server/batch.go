@@ -0,0 +1,340 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "sync"
+)
+
+// BatchItem is one key of an RPCMSet call with its value.
+type BatchItem struct {
+    Key   string `json:"key"`
+    Value string `json:"value"`
+    TTL   int64  `json:"ttl,omitempty"` // TTL in seconds, 0 for no expiry
+}
+
+// BatchRequest names the keys of an RPCMGet or RPCMDel call in Keys, and
+// the keys and values of an RPCMSet call in Items.
+type BatchRequest struct {
+    Keys  []string    `json:"keys,omitempty"`
+    Items []BatchItem `json:"items,omitempty"`
+}
+
+// BatchResult is the outcome for one key of a batch. Keys owned by another
+// node fail with MOVED and name the Owner, so only they need to be sent
+// again.
+type BatchResult struct {
+    Key      string `json:"key"`
+    Success  bool   `json:"success"`
+    Data     string `json:"data,omitempty"`
+    Error    string `json:"error,omitempty"`
+    Revision uint64 `json:"revision,omitempty"`
+    Owner    string `json:"owner,omitempty"`
+}
+
+// BatchResponse has one result per key, in the order of the request. When
+// Success is false the batch as a whole failed, for example because it is
+// over -max-batch, was sent to a follower or does not fit in -maxmemory,
+// and nothing was done.
+type BatchResponse struct {
+    Success bool          `json:"success"`
+    Error   string        `json:"error,omitempty"`
+    Leader  string        `json:"leader,omitempty"`
+    Results []BatchResult `json:"results,omitempty"`
+}
+
+// itemKeys returns the keys of req.Items.
+func (req *BatchRequest) itemKeys() []string {
+    keys := make([]string, len(req.Items))
+    for i, item := range req.Items {
+        keys[i] = item.Key
+    }
+    return keys
+}
+
+// subset returns the part of req with the keys at positions idx.
+func (req *BatchRequest) subset(idx []int) *BatchRequest {
+    sub := &BatchRequest{}
+    for _, i := range idx {
+        if i < len(req.Keys) {
+            sub.Keys = append(sub.Keys, req.Keys[i])
+        }
+        if i < len(req.Items) {
+            sub.Items = append(sub.Items, req.Items[i])
+        }
+    }
+    return sub
+}
+
+// batchTooLarge refuses a batch of n keys when that is over -max-batch, and
+// reports whether it did so.
+func (s *InMemoryStore) batchTooLarge(n int, resp *BatchResponse) bool {
+    max := s.maxBatch.Load()
+    if int64(n) <= max {
+        return false
+    }
+    resp.Success = false
+    resp.Error = fmt.Sprintf("ERR batch of %d keys is over max-batch %d", n, max)
+    return true
+}
+
+// itemMoved is movedTo for one key of a batch.
+func (s *InMemoryStore) itemMoved(key string, r *BatchResult) bool {
+    owner, local := s.route(key)
+    if local {
+        return false
+    }
+    r.Error = "MOVED " + owner
+    r.Owner = owner
+    return true
+}
+
+// RPCMGet reads req.Keys. Missing keys fail with errKeyNotFound.
+func (s *InMemoryStore) RPCMGet(req *BatchRequest, resp *BatchResponse) error {
+    if s.batchTooLarge(len(req.Keys), resp) {
+        return nil
+    }
+    if err := s.checkRead(); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Results = make([]BatchResult, len(req.Keys))
+    for i, key := range req.Keys {
+        r := &resp.Results[i]
+        r.Key = key
+        if s.itemMoved(key, r) {
+            continue
+        }
+        if v, exists, err := s.lookup(key); err != nil {
+            r.Error = err.Error()
+        } else if exists {
+            r.Success = true
+            r.Data = v.Value
+            r.Revision = v.Revision
+        } else {
+            r.Error = errKeyNotFound.Error()
+        }
+    }
+    resp.Success = true
+    return nil
+}
+
+// RPCMSet sets req.Items. The keys that can be set here are written as one
+// transaction, see Txn, so they are logged and replicated together; keys
+// with an invalid TTL or owned by another node fail on their own.
+func (s *InMemoryStore) RPCMSet(req *BatchRequest, resp *BatchResponse) error {
+    if s.batchTooLarge(len(req.Items), resp) {
+        return nil
+    }
+    results := make([]BatchResult, len(req.Items))
+    var ops []TxnOp
+    var at []int // position of each op in req.Items
+    for i, item := range req.Items {
+        r := &results[i]
+        r.Key = item.Key
+        if s.itemMoved(item.Key, r) {
+            continue
+        }
+        if err := checkTTL(item.TTL); err != nil {
+            r.Error = err.Error()
+            continue
+        }
+        ops = append(ops, TxnOp{Op: "set", Key: item.Key, Value: item.Value, TTL: item.TTL})
+        at = append(at, i)
+    }
+    revs, err := s.Txn(nil, ops)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    for j, i := range at {
+        results[i].Success = true
+        results[i].Revision = revs[j]
+    }
+    resp.Success = true
+    resp.Results = results
+    return nil
+}
+
+// RPCMDel deletes req.Keys, as one transaction like RPCMSet.
+func (s *InMemoryStore) RPCMDel(req *BatchRequest, resp *BatchResponse) error {
+    if s.batchTooLarge(len(req.Keys), resp) {
+        return nil
+    }
+    results := make([]BatchResult, len(req.Keys))
+    var ops []TxnOp
+    var at []int
+    for i, key := range req.Keys {
+        results[i].Key = key
+        if !s.itemMoved(key, &results[i]) {
+            ops = append(ops, TxnOp{Op: "delete", Key: key})
+            at = append(at, i)
+        }
+    }
+    if _, err := s.Txn(nil, ops); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    for _, i := range at {
+        results[i].Success = true
+    }
+    resp.Success = true
+    resp.Results = results
+    return nil
+}
+
+// runBatch runs the batch method fn, whose keys are keys, for an HTTP or
+// gRPC request. With sharding the batch is split by the node owning each key,
+// the parts run on their owners at the same time and the results are put
+// back in order; a part that fails as a whole fails each of its keys.
+func (store *InMemoryStore) runBatch(method string, fn func(*BatchRequest, *BatchResponse) error, req *BatchRequest, keys []string) BatchResponse {
+    var resp BatchResponse
+    if store.sharding == nil {
+        fn(req, &resp)
+        return resp
+    }
+    if store.batchTooLarge(len(keys), &resp) {
+        return resp
+    }
+    parts := make(map[string][]int) // by owner, "" for this node
+    for i, key := range keys {
+        owner, local := store.route(key)
+        if local {
+            owner = ""
+        }
+        parts[owner] = append(parts[owner], i)
+    }
+
+    resp = BatchResponse{Success: true, Results: make([]BatchResult, len(keys))}
+    var wg sync.WaitGroup
+    for owner, idx := range parts {
+        wg.Add(1)
+        go func(owner string, idx []int) {
+            defer wg.Done()
+            var part BatchResponse
+            var err error
+            if owner == "" {
+                err = fn(req.subset(idx), &part)
+            } else if err = store.sharding.call(owner, "InMemoryStore."+method, req.subset(idx), &part); err != nil {
+                err = fmt.Errorf("shard %s: %w", owner, err)
+            }
+            for j, i := range idx {
+                switch {
+                case err != nil:
+                    resp.Results[i] = BatchResult{Key: keys[i], Error: err.Error()}
+                case !part.Success:
+                    resp.Results[i] = BatchResult{Key: keys[i], Error: part.Error}
+                default:
+                    resp.Results[i] = part.Results[j]
+                }
+            }
+        }(owner, idx)
+    }
+    wg.Wait()
+    return resp
+}
+
+// readBatch reads a batch from the key parameters of a GET or DELETE
+// request, or from the JSON body of a POST.
+func readBatch(r *http.Request) (*BatchRequest, error) {
+    if r.Method == http.MethodGet || r.Method == http.MethodDelete {
+        return &BatchRequest{Keys: r.URL.Query()["key"]}, nil
+    }
+    var req BatchRequest
+    err := json.NewDecoder(r.Body).Decode(&req)
+    return &req, err
+}
+
+// writeBatch answers an HTTP batch request with the result of each key, or
+// with the error that refused the whole batch.
+func writeBatch(w http.ResponseWriter, resp BatchResponse) {
+    if !resp.Success {
+        w.WriteHeader(errorStatus(resp.Error))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error})
+        return
+    }
+    if resp.Results == nil {
+        resp.Results = []BatchResult{}
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: resp.Results})
+}
+
+// mgetHandler serves GET /mget?key=a&key=b and POST /mget with
+// {"keys": ["a", "b"]}.
+func (store *InMemoryStore) mgetHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodPost {
+        methodNotAllowed(w, "GET, POST")
+        return
+    }
+    if err := store.checkRead(); err != nil {
+        if !store.redirectToLeader(w, r) {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        }
+        return
+    }
+    req, err := readBatch(r)
+    if err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCMGet", req) {
+        return
+    }
+    writeBatch(w, store.runBatch("RPCMGet", store.RPCMGet, req, req.Keys))
+}
+
+// msetHandler serves POST /mset with
+// {"items": [{"key": "a", "value": "1", "ttl": 60}]}.
+func (store *InMemoryStore) msetHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    req, err := readBatch(r)
+    if err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    for _, item := range req.Items {
+        if status, err := store.checkItem(item.Key, item.Value); err != nil {
+            httpError(w, status, err.Error())
+            return
+        }
+    }
+    if !authorized(w, r, "InMemoryStore.RPCMSet", req) {
+        return
+    }
+    writeBatch(w, store.runBatch("RPCMSet", store.RPCMSet, req, req.itemKeys()))
+}
+
+// mdelHandler serves DELETE /mdel?key=a&key=b and POST /mdel with
+// {"keys": ["a", "b"]}.
+func (store *InMemoryStore) mdelHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodDelete && r.Method != http.MethodPost {
+        methodNotAllowed(w, "DELETE, POST")
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    req, err := readBatch(r)
+    if err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCMDel", req) {
+        return
+    }
+    writeBatch(w, store.runBatch("RPCMDel", store.RPCMDel, req, req.Keys))
+}
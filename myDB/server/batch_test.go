@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestBatch(t *testing.T) {
+    s := NewInMemoryStore()
+    s.Set("a", "old", 0)
+
+    var set BatchResponse
+    s.RPCMSet(&BatchRequest{Items: []BatchItem{{Key: "a", Value: "1"}, {Key: "b", Value: "2", TTL: -1}, {Key: "c", Value: "3", TTL: 60}}}, &set)
+    if !set.Success || len(set.Results) != 3 {
+        t.Fatalf("mset: %+v", set)
+    }
+    // The invalid TTL fails only its own key.
+    if r := set.Results; !r[0].Success || r[0].Revision != 2 || r[1].Success || !r[2].Success {
+        t.Fatalf("mset results: %+v", r)
+    }
+
+    var del BatchResponse
+    s.RPCMDel(&BatchRequest{Keys: []string{"c"}}, &del)
+    var get BatchResponse
+    s.RPCMGet(&BatchRequest{Keys: []string{"a", "b", "c"}}, &get)
+    if !get.Success || len(get.Results) != 3 {
+        t.Fatalf("mget: %+v", get)
+    }
+    if r := get.Results; r[0].Data != "1" || r[1].Error != errKeyNotFound.Error() || r[2].Success {
+        t.Fatalf("mget results: %+v", r)
+    }
+
+    s.maxBatch.Store(2)
+    var big BatchResponse
+    s.RPCMGet(&BatchRequest{Keys: []string{"a", "b", "c"}}, &big)
+    if big.Success || big.Results != nil {
+        t.Fatalf("batch over max-batch: %+v", big)
+    }
+}
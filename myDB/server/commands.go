@@ -0,0 +1,798 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+var (
+    errBadSyntax   = errors.New("ERR syntax error")
+    errNotInteger  = errors.New("ERR value is not an integer or out of range")
+    errNotFloat    = errors.New("ERR value is not a valid float")
+    errHashNotInt  = errors.New("ERR hash value is not an integer")
+    errMinMaxFloat = errors.New("ERR min or max is not a float")
+)
+
+// ReplyKind says which field of a Reply holds the result.
+type ReplyKind uint8
+
+const (
+    ReplyNil ReplyKind = iota
+    ReplyInt
+    ReplyString
+    ReplyArray
+    ReplyMap // Elems holds alternating keys and values
+)
+
+// Reply is the result of a command in a form every protocol can render:
+// JSON over HTTP, gob over RPC and RESP for Redis clients.
+type Reply struct {
+    Kind  ReplyKind
+    Int   int64
+    Str   string
+    Elems []Reply
+}
+
+func intReply(n int) Reply           { return Reply{Kind: ReplyInt, Int: int64(n)} }
+func stringReply(s string) Reply     { return Reply{Kind: ReplyString, Str: s} }
+func nilReply() Reply                { return Reply{Kind: ReplyNil} }
+func arrayReply(elems []Reply) Reply { return Reply{Kind: ReplyArray, Elems: elems} }
+func stringsReply(ss []string) Reply { return arrayReply(stringReplies(ss)) }
+func stringReplies(ss []string) []Reply {
+    out := make([]Reply, len(ss))
+    for i, s := range ss {
+        out[i] = stringReply(s)
+    }
+    return out
+}
+
+// value converts r into what encoding/json should write for it.
+func (r Reply) value() interface{} {
+    switch r.Kind {
+    case ReplyInt:
+        return r.Int
+    case ReplyString:
+        return r.Str
+    case ReplyArray:
+        out := make([]interface{}, len(r.Elems))
+        for i, e := range r.Elems {
+            out[i] = e.value()
+        }
+        return out
+    case ReplyMap:
+        out := make(map[string]interface{}, len(r.Elems)/2)
+        for i := 0; i+1 < len(r.Elems); i += 2 {
+            out[r.Elems[i].Str] = r.Elems[i+1].value()
+        }
+        return out
+    default:
+        return nil
+    }
+}
+
+// storeCommand is a command on a list, hash, set or sorted set. arity
+// counts the command name, as in Redis; -n means at least n arguments.
+// args[1] is always the key.
+type storeCommand struct {
+    arity int
+    write bool
+    run   func(s *InMemoryStore, args []string) (Reply, error)
+}
+
+var storeCommands = map[string]storeCommand{
+    "LPUSH":  {-3, true, cmdPush},
+    "RPUSH":  {-3, true, cmdPush},
+    "LPOP":   {-2, true, cmdPop},
+    "RPOP":   {-2, true, cmdPop},
+    "LRANGE": {4, false, cmdLRange},
+    "LLEN":   {2, false, cmdLLen},
+    "LINDEX": {3, false, cmdLIndex},
+
+    "HSET":    {-4, true, cmdHSet},
+    "HGET":    {3, false, cmdHGet},
+    "HDEL":    {-3, true, cmdHDel},
+    "HGETALL": {2, false, cmdHGetAll},
+    "HINCRBY": {4, true, cmdHIncrBy},
+    "HEXISTS": {3, false, cmdHExists},
+    "HLEN":    {2, false, cmdHLen},
+
+    "SADD":      {-3, true, cmdSAdd},
+    "SREM":      {-3, true, cmdSRem},
+    "SISMEMBER": {3, false, cmdSIsMember},
+    "SMEMBERS":  {2, false, cmdSMembers},
+    "SCARD":     {2, false, cmdSCard},
+
+    "ZADD":          {-4, true, cmdZAdd},
+    "ZINCRBY":       {4, true, cmdZIncrBy},
+    "ZREM":          {-3, true, cmdZRem},
+    "ZSCORE":        {3, false, cmdZScore},
+    "ZCARD":         {2, false, cmdZCard},
+    "ZRANGE":        {-4, false, cmdZRange},
+    "ZRANGEBYSCORE": {-4, false, cmdZRangeByScore},
+}
+
+// lookupCommand finds the command args names and checks its arity.
+func lookupCommand(args []string) (storeCommand, error) {
+    if len(args) == 0 {
+        return storeCommand{}, errors.New("ERR empty command")
+    }
+    name := strings.ToUpper(args[0])
+    cmd, ok := storeCommands[name]
+    if !ok {
+        return cmd, fmt.Errorf("ERR unknown command '%s'", args[0])
+    }
+    if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+        return cmd, fmt.Errorf("ERR wrong number of arguments for '%s' command", strings.ToLower(name))
+    }
+    return cmd, nil
+}
+
+// readCollection returns the collection of type t stored under key, or nil
+// when the key does not exist.
+func (s *InMemoryStore) readCollection(key string, t ValueType) (collection, error) {
+    v, exists := s.entry(key)
+    metrics.read(exists)
+    if !exists {
+        return nil, nil
+    }
+    if v.Type != t {
+        return nil, errWrongType
+    }
+    return v.coll, nil
+}
+
+// updateCollection makes the element-level change fn returns (see
+// applyChange) to the collection of type t under key, atomically. fn gets
+// nil for a missing key and returns no change to leave the store alone; a
+// collection the change empties is deleted. Only the change is logged, not
+// the collection, so a write costs the size of its arguments. The key
+// keeps its expiration.
+func (s *InMemoryStore) updateCollection(key string, t ValueType, fn func(c collection) ([]string, error)) error {
+    return s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        var old collection
+        if exists {
+            if v.Type != t {
+                return nil, errWrongType
+            }
+            old = v.coll
+        }
+        change, err := fn(old)
+        if err != nil || change == nil {
+            return nil, err
+        }
+        c, err := applyChange(t, old, change)
+        if err != nil {
+            return nil, err
+        }
+        if c.len() == 0 {
+            if !exists {
+                return nil, nil
+            }
+            return &Mutation{Op: OpDelete, Key: key}, nil
+        }
+        return &Mutation{Op: OpUpdate, Key: key, Value: encodeStrings(change), Expiration: v.Expiration, Type: t, coll: c}, nil
+    })
+}
+
+// withArgs returns the change name followed by args.
+func withArgs(name string, args []string) []string {
+    return append([]string{name}, args...)
+}
+
+// Lists
+
+func cmdPush(s *InMemoryStore, args []string) (Reply, error) {
+    var n int
+    err := s.updateCollection(args[1], TypeList, func(c collection) ([]string, error) {
+        n = collectionLen(c) + len(args) - 2
+        return withArgs(strings.ToLower(args[0]), args[2:]), nil
+    })
+    return intReply(n), err
+}
+
+// cmdPop implements LPOP and RPOP key [count]. Without a count it returns
+// one value, with a count an array.
+func cmdPop(s *InMemoryStore, args []string) (Reply, error) {
+    if len(args) > 3 {
+        return Reply{}, errBadSyntax
+    }
+    count := 1
+    if len(args) == 3 {
+        n, err := strconv.Atoi(args[2])
+        if err != nil || n < 0 {
+            return Reply{}, errNotInteger
+        }
+        count = n
+    }
+    name := strings.ToLower(args[0])
+    var popped []string
+    err := s.updateCollection(args[1], TypeList, func(c collection) ([]string, error) {
+        old, _ := c.(*listValue)
+        n := min(count, old.len())
+        if n == 0 {
+            return nil, nil
+        }
+        if name == "lpop" {
+            popped = append(popped, old.items[:n]...)
+        } else {
+            for i := old.len() - 1; i >= old.len()-n; i-- {
+                popped = append(popped, old.items[i])
+            }
+        }
+        return []string{name, strconv.Itoa(n)}, nil
+    })
+    switch {
+    case err != nil:
+        return Reply{}, err
+    case popped == nil && (len(args) == 2 || count > 0):
+        return nilReply(), nil
+    case len(args) == 2:
+        return stringReply(popped[0]), nil
+    default:
+        return stringsReply(popped), nil
+    }
+}
+
+func cmdLRange(s *InMemoryStore, args []string) (Reply, error) {
+    start, err1 := strconv.Atoi(args[2])
+    stop, err2 := strconv.Atoi(args[3])
+    if err1 != nil || err2 != nil {
+        return Reply{}, errNotInteger
+    }
+    c, err := s.readCollection(args[1], TypeList)
+    if err != nil {
+        return Reply{}, err
+    }
+    l, _ := c.(*listValue)
+    lo, hi := indexRange(start, stop, l.len())
+    if lo == hi {
+        return stringsReply(nil), nil
+    }
+    return stringsReply(l.items[lo:hi]), nil
+}
+
+func cmdLLen(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeList)
+    if err != nil {
+        return Reply{}, err
+    }
+    return intReply(collectionLen(c)), nil
+}
+
+func cmdLIndex(s *InMemoryStore, args []string) (Reply, error) {
+    i, err := strconv.Atoi(args[2])
+    if err != nil {
+        return Reply{}, errNotInteger
+    }
+    c, err := s.readCollection(args[1], TypeList)
+    if err != nil {
+        return Reply{}, err
+    }
+    l, _ := c.(*listValue)
+    if i < 0 {
+        i += l.len()
+    }
+    if i < 0 || i >= l.len() {
+        return nilReply(), nil
+    }
+    return stringReply(l.items[i]), nil
+}
+
+// Hashes
+
+func cmdHSet(s *InMemoryStore, args []string) (Reply, error) {
+    if len(args)%2 != 0 {
+        return Reply{}, errors.New("ERR wrong number of arguments for 'hset' command")
+    }
+    var added int
+    err := s.updateCollection(args[1], TypeHash, func(c collection) ([]string, error) {
+        old, _ := c.(*hashValue)
+        seen := make(map[string]bool)
+        for i := 2; i < len(args); i += 2 {
+            if _, ok := old.field(args[i]); !ok && !seen[args[i]] {
+                added++
+            }
+            seen[args[i]] = true
+        }
+        return withArgs("hset", args[2:]), nil
+    })
+    return intReply(added), err
+}
+
+func cmdHGet(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeHash)
+    if err != nil {
+        return Reply{}, err
+    }
+    h, _ := c.(*hashValue)
+    if v, ok := h.field(args[2]); ok {
+        return stringReply(v), nil
+    }
+    return nilReply(), nil
+}
+
+func cmdHDel(s *InMemoryStore, args []string) (Reply, error) {
+    var removed int
+    err := s.updateCollection(args[1], TypeHash, func(c collection) ([]string, error) {
+        old, _ := c.(*hashValue)
+        seen := make(map[string]bool)
+        for _, f := range args[2:] {
+            if _, ok := old.field(f); ok && !seen[f] {
+                removed++
+            }
+            seen[f] = true
+        }
+        if removed == 0 {
+            return nil, nil
+        }
+        return withArgs("hdel", args[2:]), nil
+    })
+    return intReply(removed), err
+}
+
+func cmdHGetAll(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeHash)
+    if err != nil {
+        return Reply{}, err
+    }
+    h, _ := c.(*hashValue)
+    fields := make([]string, 0, h.len())
+    if h != nil {
+        for f := range h.fields {
+            fields = append(fields, f)
+        }
+    }
+    sort.Strings(fields)
+    elems := make([]Reply, 0, 2*len(fields))
+    for _, f := range fields {
+        elems = append(elems, stringReply(f), stringReply(h.fields[f]))
+    }
+    return Reply{Kind: ReplyMap, Elems: elems}, nil
+}
+
+func cmdHIncrBy(s *InMemoryStore, args []string) (Reply, error) {
+    incr, err := strconv.ParseInt(args[3], 10, 64)
+    if err != nil {
+        return Reply{}, errNotInteger
+    }
+    var result int64
+    err = s.updateCollection(args[1], TypeHash, func(c collection) ([]string, error) {
+        old, _ := c.(*hashValue)
+        var cur int64
+        if v, ok := old.field(args[2]); ok {
+            n, err := strconv.ParseInt(v, 10, 64)
+            if err != nil {
+                return nil, errHashNotInt
+            }
+            cur = n
+        }
+        if addOverflows(cur, incr) {
+            return nil, errOverflow
+        }
+        result = cur + incr
+        return []string{"hset", args[2], strconv.FormatInt(result, 10)}, nil
+    })
+    return Reply{Kind: ReplyInt, Int: result}, err
+}
+
+func cmdHExists(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeHash)
+    if err != nil {
+        return Reply{}, err
+    }
+    h, _ := c.(*hashValue)
+    _, ok := h.field(args[2])
+    return intReply(int(boolInt(ok))), nil
+}
+
+func cmdHLen(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeHash)
+    if err != nil {
+        return Reply{}, err
+    }
+    return intReply(collectionLen(c)), nil
+}
+
+// Sets
+
+func cmdSAdd(s *InMemoryStore, args []string) (Reply, error) {
+    var added int
+    err := s.updateCollection(args[1], TypeSet, func(c collection) ([]string, error) {
+        old, _ := c.(*setValue)
+        seen := make(map[string]bool)
+        for _, m := range args[2:] {
+            if !old.contains(m) && !seen[m] {
+                added++
+            }
+            seen[m] = true
+        }
+        if added == 0 {
+            return nil, nil
+        }
+        return withArgs("sadd", args[2:]), nil
+    })
+    return intReply(added), err
+}
+
+func cmdSRem(s *InMemoryStore, args []string) (Reply, error) {
+    var removed int
+    err := s.updateCollection(args[1], TypeSet, func(c collection) ([]string, error) {
+        old, _ := c.(*setValue)
+        seen := make(map[string]bool)
+        for _, m := range args[2:] {
+            if old.contains(m) && !seen[m] {
+                removed++
+            }
+            seen[m] = true
+        }
+        if removed == 0 {
+            return nil, nil
+        }
+        return withArgs("srem", args[2:]), nil
+    })
+    return intReply(removed), err
+}
+
+func cmdSIsMember(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    set, _ := c.(*setValue)
+    return intReply(int(boolInt(set.contains(args[2])))), nil
+}
+
+func cmdSMembers(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    set, _ := c.(*setValue)
+    members := make([]string, 0, set.len())
+    if set != nil {
+        for m := range set.members {
+            members = append(members, m)
+        }
+    }
+    sort.Strings(members)
+    return stringsReply(members), nil
+}
+
+func cmdSCard(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    return intReply(collectionLen(c)), nil
+}
+
+// Sorted sets
+
+func cmdZAdd(s *InMemoryStore, args []string) (Reply, error) {
+    if len(args)%2 != 0 {
+        return Reply{}, errBadSyntax
+    }
+    members := make(map[string]bool, (len(args)-2)/2)
+    for i := 2; i < len(args); i += 2 {
+        if _, err := parseScore(args[i]); err != nil {
+            return Reply{}, err
+        }
+        members[args[i+1]] = true
+    }
+    var added int
+    err := s.updateCollection(args[1], TypeZSet, func(c collection) ([]string, error) {
+        old, _ := c.(*zsetValue)
+        for m := range members {
+            if _, ok := old.score(m); !ok {
+                added++
+            }
+        }
+        return withArgs("zadd", args[2:]), nil
+    })
+    return intReply(added), err
+}
+
+func cmdZIncrBy(s *InMemoryStore, args []string) (Reply, error) {
+    incr, err := parseScore(args[2])
+    if err != nil {
+        return Reply{}, err
+    }
+    var score float64
+    err = s.updateCollection(args[1], TypeZSet, func(c collection) ([]string, error) {
+        old, _ := c.(*zsetValue)
+        cur, _ := old.score(args[3])
+        if score = cur + incr; math.IsNaN(score) {
+            return nil, errors.New("ERR resulting score is not a number (NaN)")
+        }
+        return []string{"zadd", formatScore(score), args[3]}, nil
+    })
+    return stringReply(formatScore(score)), err
+}
+
+func cmdZRem(s *InMemoryStore, args []string) (Reply, error) {
+    var removed []string
+    err := s.updateCollection(args[1], TypeZSet, func(c collection) ([]string, error) {
+        old, _ := c.(*zsetValue)
+        seen := make(map[string]bool)
+        for _, m := range args[2:] {
+            if _, ok := old.score(m); ok && !seen[m] {
+                removed = append(removed, m)
+            }
+            seen[m] = true
+        }
+        if len(removed) == 0 {
+            return nil, nil
+        }
+        return withArgs("zrem", removed), nil
+    })
+    return intReply(len(removed)), err
+}
+
+func cmdZScore(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeZSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    z, _ := c.(*zsetValue)
+    if score, ok := z.score(args[2]); ok {
+        return stringReply(formatScore(score)), nil
+    }
+    return nilReply(), nil
+}
+
+func cmdZCard(s *InMemoryStore, args []string) (Reply, error) {
+    c, err := s.readCollection(args[1], TypeZSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    return intReply(collectionLen(c)), nil
+}
+
+// cmdZRange implements ZRANGE key start stop [WITHSCORES] by rank.
+func cmdZRange(s *InMemoryStore, args []string) (Reply, error) {
+    start, err1 := strconv.Atoi(args[2])
+    stop, err2 := strconv.Atoi(args[3])
+    if err1 != nil || err2 != nil {
+        return Reply{}, errNotInteger
+    }
+    withScores := false
+    for _, opt := range args[4:] {
+        if strings.ToUpper(opt) != "WITHSCORES" {
+            return Reply{}, errBadSyntax
+        }
+        withScores = true
+    }
+    c, err := s.readCollection(args[1], TypeZSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    z, _ := c.(*zsetValue)
+    lo, hi := indexRange(start, stop, z.len())
+    if lo == hi {
+        return zsetReply(nil, withScores), nil
+    }
+    return zsetReply(z.sorted[lo:hi], withScores), nil
+}
+
+// cmdZRangeByScore implements ZRANGEBYSCORE key min max [WITHSCORES]
+// [LIMIT offset count]. Bounds may be -inf, +inf or start with ( to
+// exclude the bound itself.
+func cmdZRangeByScore(s *InMemoryStore, args []string) (Reply, error) {
+    from, err1 := parseScoreBound(args[2])
+    to, err2 := parseScoreBound(args[3])
+    if err1 != nil || err2 != nil {
+        return Reply{}, errMinMaxFloat
+    }
+    withScores, offset, count := false, 0, -1
+    for i := 4; i < len(args); i++ {
+        switch strings.ToUpper(args[i]) {
+        case "WITHSCORES":
+            withScores = true
+        case "LIMIT":
+            if i+2 >= len(args) {
+                return Reply{}, errBadSyntax
+            }
+            o, err1 := strconv.Atoi(args[i+1])
+            n, err2 := strconv.Atoi(args[i+2])
+            if err1 != nil || err2 != nil {
+                return Reply{}, errNotInteger
+            }
+            offset, count = o, n
+            i += 2
+        default:
+            return Reply{}, errBadSyntax
+        }
+    }
+    c, err := s.readCollection(args[1], TypeZSet)
+    if err != nil {
+        return Reply{}, err
+    }
+    z, _ := c.(*zsetValue)
+    if z == nil || offset < 0 {
+        return zsetReply(nil, withScores), nil
+    }
+
+    lo := sort.Search(len(z.sorted), func(i int) bool { return from.below(z.sorted[i].Score) })
+    var entries []zsetEntry
+    for i := lo + offset; i < len(z.sorted) && to.above(z.sorted[i].Score); i++ {
+        if count >= 0 && len(entries) == count {
+            break
+        }
+        entries = append(entries, z.sorted[i])
+    }
+    return zsetReply(entries, withScores), nil
+}
+
+func zsetReply(entries []zsetEntry, withScores bool) Reply {
+    elems := make([]Reply, 0, len(entries))
+    for _, e := range entries {
+        elems = append(elems, stringReply(e.Member))
+        if withScores {
+            elems = append(elems, stringReply(formatScore(e.Score)))
+        }
+    }
+    return arrayReply(elems)
+}
+
+// scoreBound is one end of a score range.
+type scoreBound struct {
+    value     float64
+    exclusive bool
+}
+
+// below reports whether score is on the inside of the bound used as minimum.
+func (b scoreBound) below(score float64) bool {
+    if b.exclusive {
+        return score > b.value
+    }
+    return score >= b.value
+}
+
+// above reports whether score is on the inside of the bound used as maximum.
+func (b scoreBound) above(score float64) bool {
+    if b.exclusive {
+        return score < b.value
+    }
+    return score <= b.value
+}
+
+func parseScoreBound(s string) (scoreBound, error) {
+    var b scoreBound
+    if strings.HasPrefix(s, "(") {
+        b.exclusive = true
+        s = s[1:]
+    }
+    v, err := parseScore(s)
+    b.value = v
+    return b, err
+}
+
+// parseScore parses a sorted set score; inf, +inf and -inf are allowed.
+func parseScore(s string) (float64, error) {
+    f, err := strconv.ParseFloat(s, 64)
+    if err != nil || math.IsNaN(f) {
+        return 0, errNotFloat
+    }
+    return f, nil
+}
+
+// indexRange turns Redis start and stop indexes, which count from the end
+// when negative and include stop, into slice bounds for n elements.
+func indexRange(start, stop, n int) (int, int) {
+    if start < 0 {
+        start += n
+    }
+    if stop < 0 {
+        stop += n
+    }
+    start = max(start, 0)
+    stop = min(stop, n-1)
+    if start > stop {
+        return 0, 0
+    }
+    return start, stop + 1
+}
+
+func collectionLen(c collection) int {
+    if c == nil {
+        return 0
+    }
+    return c.len()
+}
+
+// CommandRequest is a command on a list, hash, set or sorted set, written
+// as in Redis: the command name, the key and its arguments.
+type CommandRequest struct {
+    Args []string `json:"args"`
+}
+
+type CommandResponse struct {
+    Success bool   `json:"success"`
+    Reply   Reply  `json:"reply"`
+    Error   string `json:"error,omitempty"`
+    Leader  string `json:"leader,omitempty"`
+    Owner   string `json:"owner,omitempty"`
+}
+
+// RPCCommand runs a list, hash, set or sorted set command.
+func (s *InMemoryStore) RPCCommand(req *CommandRequest, resp *CommandResponse) error {
+    cmd, err := lookupCommand(req.Args)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
+    if owner, local := s.route(req.Args[1]); !local {
+        resp.Success = false
+        resp.Error = "MOVED " + owner
+        resp.Owner = owner
+        return nil
+    }
+    if !cmd.write {
+        err = s.checkRead()
+    }
+    if err == nil {
+        resp.Reply, err = cmd.run(s, req.Args)
+    }
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    return nil
+}
+
+// commandHandler runs a list, hash, set or sorted set command sent as
+// {"args": ["LPUSH", "key", "value"]}.
+func (store *InMemoryStore) commandHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    var req CommandRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    cmd, err := lookupCommand(req.Args)
+    if err != nil {
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCCommand", &req) {
+        return
+    }
+    if owner, local := store.route(req.Args[1]); !local {
+        store.sharding.proxyCommand(w, owner, &req)
+        return
+    }
+    if cmd.write && store.redirectToLeader(w, r) {
+        return
+    }
+    if !cmd.write {
+        if err := store.checkRead(); err != nil {
+            if !store.redirectToLeader(w, r) {
+                w.WriteHeader(http.StatusServiceUnavailable)
+                json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+            }
+            return
+        }
+    }
+
+    reply, err := cmd.run(store, req.Args)
+    if err != nil {
+        w.WriteHeader(errorStatus(err.Error()))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: reply.value()})
+}
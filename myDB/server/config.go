@@ -0,0 +1,559 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "flag"
+    "fmt"
+    "log"
+    "net"
+    "net/http"
+    "os"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+
+    "github.com/shafigh75/go_files/myDB/ring"
+)
+
+// Config is the configuration of the server. Every setting is a flag, and
+// can also be given in the config file (-config or MYDB_CONFIG) and as an
+// environment variable: flags win over the environment, which wins over
+// the file. See LoadConfig.
+type Config struct {
+    HTTPAddr string
+    RPCAddr  string
+    RESPAddr string
+    GRPCAddr string
+
+    MaxBatch     int
+    MaxPipeline  int
+    MaxKeySize   int
+    MaxValueSize string
+
+    WALDir           string
+    WALSync          bool
+    WALSegmentSize   int64
+    SnapshotDir      string
+    SnapshotInterval time.Duration
+    SnapshotRetain   int
+    ExpireInterval   time.Duration
+
+    ReplicaOf             string
+    ReplBacklog           int
+    AdvertiseHTTP         string
+    NodeID                string
+    RaftID                string
+    RaftPeers             string
+    RaftDir               string
+    RaftSnapshotThreshold uint64
+    ShardNodes            string
+    ShardSelf             string
+    ShardVNodes           int
+    ShardState            string
+
+    PubSubBuffer       int
+    PubSubSlow         string
+    PubSubReapInterval time.Duration
+    MaxMemory          string
+    MaxMemoryPolicy    string
+
+    ACLFile       string
+    ClusterToken  string
+    TLSCert       string
+    TLSKey        string
+    TLSCA         string
+    TLSClientAuth string
+
+    LogFile         string
+    ShutdownTimeout time.Duration
+}
+
+// configEnvPrefix starts the environment variables of the settings: -wal-dir
+// is MYDB_WAL_DIR.
+const configEnvPrefix = "MYDB_"
+
+// secretSettings are not shown by CONFIG GET.
+var secretSettings = map[string]bool{"cluster-token": true}
+
+func (c *Config) flags(fs *flag.FlagSet) {
+    fs.StringVar(&c.WALDir, "wal-dir", "data/wal", "directory for write-ahead log segments (empty disables persistence)")
+    fs.BoolVar(&c.WALSync, "wal-sync", true, "fsync the WAL after every write before acknowledging it")
+    fs.Int64Var(&c.WALSegmentSize, "wal-segment-size", 64<<20, "size in bytes at which a new WAL segment is started")
+    fs.StringVar(&c.SnapshotDir, "snapshot-dir", "data/snapshots", "directory for snapshots (empty disables snapshots)")
+    fs.DurationVar(&c.SnapshotInterval, "snapshot-interval", 5*time.Minute, "how often to take a background snapshot (0 disables)")
+    fs.IntVar(&c.SnapshotRetain, "snapshot-retain", 2, "number of snapshots to keep on disk")
+    fs.DurationVar(&c.ExpireInterval, "expire-interval", 10*time.Millisecond, "how often keys that came due are removed")
+    fs.StringVar(&c.HTTPAddr, "http-addr", ":6060", "address of the HTTP server")
+    fs.StringVar(&c.RPCAddr, "rpc-addr", ":1234", "address of the RPC server")
+    fs.StringVar(&c.RESPAddr, "resp-addr", ":6379", "address of the Redis protocol (RESP) server (empty disables it)")
+    fs.StringVar(&c.GRPCAddr, "grpc-addr", ":50051", "address of the gRPC server (empty disables it)")
+    fs.IntVar(&c.MaxBatch, "max-batch", defaultMaxBatch, "most keys one MGET, MSET or MDEL call over RPC, HTTP or gRPC may carry")
+    fs.IntVar(&c.MaxPipeline, "max-pipeline", 128, "most calls one RPC connection may have in progress; further pipelined calls wait to be read")
+    fs.IntVar(&c.MaxKeySize, "max-key-size", defaultMaxKeySize, "longest key in bytes the HTTP and gRPC APIs take")
+    fs.StringVar(&c.MaxValueSize, "max-value-size", "1mb", "largest value the HTTP and gRPC APIs take, such as 64kb or 1mb")
+    fs.StringVar(&c.ReplicaOf, "replicaof", "", "RPC address of a leader to follow (empty runs as leader)")
+    fs.IntVar(&c.ReplBacklog, "repl-backlog", 100000, "number of recent changes kept for followers and watchers to catch up")
+    fs.StringVar(&c.AdvertiseHTTP, "advertise-http", "", "HTTP address followers redirect writes to (defaults to -http-addr)")
+    fs.StringVar(&c.NodeID, "node-id", "", "name this node reports to its leader (defaults to hostname and HTTP address)")
+    fs.StringVar(&c.RaftID, "raft-id", "", "ID of this node in a Raft cluster (empty disables cluster mode)")
+    fs.StringVar(&c.RaftPeers, "raft-peers", "", "initial cluster members as id=host:rpcport,... (empty for a node that will be added later)")
+    fs.StringVar(&c.RaftDir, "raft-dir", "data/raft", "directory for the Raft log, state and snapshots")
+    fs.Uint64Var(&c.RaftSnapshotThreshold, "raft-snapshot-threshold", 10000, "compact the Raft log after this many applied entries")
+    fs.StringVar(&c.ShardNodes, "shard-nodes", "", "RPC addresses of all shard nodes, comma separated (empty disables sharding)")
+    fs.StringVar(&c.ShardSelf, "shard-self", "", "RPC address of this node as listed in -shard-nodes (defaults to -rpc-addr)")
+    fs.IntVar(&c.ShardVNodes, "shard-vnodes", ring.DefaultReplicas, "virtual nodes per shard node on the hash ring")
+    fs.StringVar(&c.ShardState, "shard-state", "data/shards.json", "file where the current shard membership is kept")
+    fs.IntVar(&c.PubSubBuffer, "pubsub-buffer", 1024, "messages buffered per pub/sub subscriber before the slow subscriber policy applies")
+    fs.StringVar(&c.PubSubSlow, "pubsub-slow", "drop", "what to do with a subscriber whose buffer is full: drop (the new message) or disconnect")
+    fs.DurationVar(&c.PubSubReapInterval, "pubsub-reap-interval", 10*time.Second, "how often RPC subscribers that stopped polling are dropped")
+    fs.StringVar(&c.MaxMemory, "maxmemory", "0", "memory limit for keys and values, such as 512mb or 2gb (0 for no limit)")
+    fs.StringVar(&c.MaxMemoryPolicy, "maxmemory-policy", "noeviction", "what to do with a write over -maxmemory: noeviction (reject it), allkeys-lru, allkeys-lfu, volatile-ttl or allkeys-random")
+    fs.StringVar(&c.ACLFile, "acl-file", "", "JSON file with the users, their passwords or API tokens and permissions (empty lets every client do anything)")
+    fs.StringVar(&c.ClusterToken, "cluster-token", "", "API token this node logs in to the other nodes with, when they use -acl-file")
+    fs.StringVar(&c.TLSCert, "tls-cert", "", "certificate (PEM) for TLS on the HTTP, RPC, RESP and gRPC ports and towards the other nodes (empty disables TLS)")
+    fs.StringVar(&c.TLSKey, "tls-key", "", "private key (PEM) of -tls-cert")
+    fs.StringVar(&c.TLSCA, "tls-ca", "", "CA certificates (PEM) that sign client certificates and the certificates of the other nodes")
+    fs.StringVar(&c.TLSClientAuth, "tls-client-auth", "optional", "client certificates signed by -tls-ca: none (not asked for), optional (verified when given) or require")
+    fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", 15*time.Second, "how long requests in progress get to finish on SIGTERM before their connections are closed")
+    fs.StringVar(&c.LogFile, "log-file", "", "file the server logs to, appending (empty logs to standard output)")
+}
+
+// LoadConfig reads the configuration from the command line args, the
+// environment and the config file, and checks it. All the problems found
+// are returned together.
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+    cfg := &Config{}
+    cfg.flags(fs)
+    path := fs.String("config", os.Getenv(configEnvPrefix+"CONFIG"), "TOML config file (settings are named like the flags, see the README)")
+    if err := fs.Parse(args); err != nil {
+        return nil, err
+    }
+    explicit := map[string]bool{"config": true}
+    fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+    var errs []error
+    if *path != "" {
+        data, err := os.ReadFile(*path)
+        if err != nil {
+            return nil, err
+        }
+        entries, err := parseTOML(data)
+        if err != nil {
+            return nil, fmt.Errorf("%s: %w", *path, err)
+        }
+        for _, e := range entries {
+            switch {
+            case fs.Lookup(e.name) == nil || e.name == "config":
+                errs = append(errs, fmt.Errorf("%s:%d: unknown setting %q", *path, e.line, e.name))
+            case explicit[e.name]:
+            default:
+                if err := fs.Set(e.name, e.value); err != nil {
+                    errs = append(errs, fmt.Errorf("%s:%d: %s: %v", *path, e.line, e.name, err))
+                }
+            }
+        }
+    }
+    fs.VisitAll(func(f *flag.Flag) {
+        env := settingEnv(f.Name)
+        if value, ok := os.LookupEnv(env); ok && !explicit[f.Name] && f.Name != "config" {
+            if err := fs.Set(f.Name, value); err != nil {
+                errs = append(errs, fmt.Errorf("%s: %v", env, err))
+            }
+        }
+    })
+    errs = append(errs, cfg.validate()...)
+    return cfg, errors.Join(errs...)
+}
+
+// settingEnv returns the environment variable of the setting name.
+func settingEnv(name string) string {
+    return configEnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// validate checks the settings that the flags alone cannot.
+func (c *Config) validate() []error {
+    var errs []error
+    check := func(ok bool, format string, args ...interface{}) {
+        if !ok {
+            errs = append(errs, fmt.Errorf(format, args...))
+        }
+    }
+    for _, l := range []struct{ name, addr string }{{"http-addr", c.HTTPAddr}, {"rpc-addr", c.RPCAddr}, {"resp-addr", c.RESPAddr}, {"grpc-addr", c.GRPCAddr}} {
+        if l.addr == "" && (l.name == "resp-addr" || l.name == "grpc-addr") {
+            continue
+        }
+        _, _, err := net.SplitHostPort(l.addr)
+        check(err == nil, "%s: invalid address %q, use host:port or :port", l.name, l.addr)
+    }
+    _, err := parseBytes(c.MaxMemory)
+    check(err == nil, "maxmemory: %v", err)
+    _, err = parseEvictionPolicy(c.MaxMemoryPolicy)
+    check(err == nil, "maxmemory-policy: %v", err)
+    _, err = parseSlowPolicy(c.PubSubSlow)
+    check(err == nil, "pubsub-slow: %v", err)
+    check(c.PubSubBuffer >= 1, "pubsub-buffer: must be at least 1")
+    check(c.WALSegmentSize > 0, "wal-segment-size: must be positive")
+    check(c.SnapshotInterval >= 0, "snapshot-interval: must not be negative")
+    check(c.SnapshotRetain >= 1, "snapshot-retain: must be at least 1")
+    check(c.ExpireInterval > 0, "expire-interval: must be positive")
+    check(c.ShutdownTimeout > 0, "shutdown-timeout: must be positive")
+    check(c.MaxBatch >= 1, "max-batch: must be at least 1")
+    check(c.MaxPipeline >= 1, "max-pipeline: must be at least 1")
+    check(c.MaxKeySize >= 1, "max-key-size: must be at least 1")
+    maxValue, err := parseBytes(c.MaxValueSize)
+    check(err == nil && maxValue >= 1, "max-value-size: must be a size of at least 1 byte, such as 1mb")
+    check(c.PubSubReapInterval > 0, "pubsub-reap-interval: must be positive")
+    check(c.ReplBacklog >= 1, "repl-backlog: must be at least 1")
+    check(c.ShardVNodes >= 1, "shard-vnodes: must be at least 1")
+    check(c.ShardNodes == "" || (c.RaftID == "" && c.ReplicaOf == ""), "shard-nodes: cannot be combined with raft-id or replicaof")
+    if c.RaftID != "" && c.RaftPeers != "" {
+        _, err = parseRaftPeers(c.RaftPeers)
+        check(err == nil, "raft-peers: %v", err)
+    }
+    check((c.TLSCert == "") == (c.TLSKey == ""), "tls-cert and tls-key: give both or neither")
+    _, ok := clientAuthModes[c.TLSClientAuth]
+    check(ok, "tls-client-auth: unknown mode %q, use none, optional or require", c.TLSClientAuth)
+    check(c.TLSClientAuth != "require" || c.TLSCA != "", "tls-client-auth: require needs tls-ca")
+    return errs
+}
+
+// openLog sends what the server prints to c.LogFile, if set.
+func (c *Config) openLog() error {
+    if c.LogFile == "" {
+        return nil
+    }
+    f, err := os.OpenFile(c.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return err
+    }
+    os.Stdout, os.Stderr = f, f
+    log.SetOutput(f)
+    return nil
+}
+
+// configEntry is one setting from the config file, named like its flag.
+type configEntry struct {
+    name  string
+    value string
+    line  int
+}
+
+// parseTOML reads the part of TOML a config file needs: [tables] and
+// key = value lines with strings, numbers, booleans and arrays of those on
+// one line. A key in a table is named table-key, so
+//
+//	[wal]
+//	dir = "data/wal"
+//
+// sets -wal-dir, as does wal-dir = "data/wal" at the top. Arrays become
+// comma separated lists, as for -shard-nodes.
+func parseTOML(data []byte) ([]configEntry, error) {
+    var entries []configEntry
+    table := ""
+    for i, line := range strings.Split(string(data), "\n") {
+        line = strings.TrimSpace(stripComment(line))
+        if line == "" {
+            continue
+        }
+        n := i + 1
+        if strings.HasPrefix(line, "[") {
+            if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+                return nil, fmt.Errorf("line %d: invalid table %s", n, line)
+            }
+            table = tomlKey(strings.TrimSpace(line[1 : len(line)-1]))
+            continue
+        }
+        key, raw, ok := strings.Cut(line, "=")
+        if !ok {
+            return nil, fmt.Errorf("line %d: expected key = value", n)
+        }
+        name := tomlKey(strings.TrimSpace(key))
+        if table != "" {
+            name = table + "-" + name
+        }
+        value, err := tomlValue(strings.TrimSpace(raw))
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %s: %w", n, name, err)
+        }
+        entries = append(entries, configEntry{name: name, value: value, line: n})
+    }
+    return entries, nil
+}
+
+// tomlKey turns a key or table name into flag style: quotes removed, dots
+// and underscores made dashes.
+func tomlKey(key string) string {
+    if unquoted, err := strconv.Unquote(key); err == nil {
+        key = unquoted
+    }
+    return strings.NewReplacer(".", "-", "_", "-").Replace(strings.ToLower(key))
+}
+
+func tomlValue(raw string) (string, error) {
+    switch {
+    case raw == "":
+        return "", errors.New("missing value")
+    case strings.HasPrefix(raw, `"""`), strings.HasPrefix(raw, "'''"):
+        return "", errors.New("multi-line strings are not supported")
+    case raw[0] == '"':
+        return strconv.Unquote(raw)
+    case raw[0] == '\'':
+        if len(raw) < 2 || raw[len(raw)-1] != '\'' {
+            return "", errors.New("unterminated string")
+        }
+        return raw[1 : len(raw)-1], nil
+    case raw[0] == '[':
+        if raw[len(raw)-1] != ']' {
+            return "", errors.New("arrays must be on one line")
+        }
+        var items []string
+        for _, item := range splitTOMLArray(raw[1 : len(raw)-1]) {
+            v, err := tomlValue(item)
+            if err != nil {
+                return "", err
+            }
+            items = append(items, v)
+        }
+        return strings.Join(items, ","), nil
+    default:
+        return strings.ReplaceAll(raw, "_", ""), nil // 64_000_000
+    }
+}
+
+// splitTOMLArray splits the inside of an array at the commas outside
+// strings, dropping a trailing comma.
+func splitTOMLArray(s string) []string {
+    var items []string
+    var quote byte
+    start := 0
+    for i := 0; i < len(s); i++ {
+        switch c := s[i]; {
+        case quote != 0:
+            if c == '\\' && quote == '"' {
+                i++
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == ',':
+            items = append(items, strings.TrimSpace(s[start:i]))
+            start = i + 1
+        }
+    }
+    if last := strings.TrimSpace(s[start:]); last != "" {
+        items = append(items, last)
+    }
+    return items
+}
+
+// stripComment removes a # comment that is not inside a string.
+func stripComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        switch c := line[i]; {
+        case quote != 0:
+            if c == '\\' && quote == '"' {
+                i++
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '#':
+            return line[:i]
+        }
+    }
+    return line
+}
+
+// Settings serves the configuration while the server runs. It is
+// registered as the "Config" RPC service, which needs admin access.
+type Settings struct {
+    mu      sync.Mutex
+    fs      *flag.FlagSet
+    runtime map[string]func(value string) error // the settings Set can change, and how
+}
+
+// ConfigRequest asks for the settings whose names match Pattern, a glob
+// such as "maxmemory*", or to set Name to Value.
+type ConfigRequest struct {
+    Pattern string `json:"pattern,omitempty"`
+    Name    string `json:"name,omitempty"`
+    Value   string `json:"value,omitempty"`
+}
+
+type ConfigResponse struct {
+    Settings map[string]string `json:"settings"`
+}
+
+// NewSettings serves the configuration of fs and lets CONFIG SET change
+// the settings that take effect without a restart: the memory limit and
+// policy, WAL fsyncs, snapshot retention and the pub/sub defaults.
+func NewSettings(fs *flag.FlagSet, cfg *Config, store *InMemoryStore, pubsub *PubSub) *Settings {
+    st := &Settings{fs: fs}
+    st.runtime = map[string]func(string) error{
+        "maxmemory": func(v string) error {
+            n, err := parseBytes(v)
+            if err == nil {
+                store.limit.set(n, store.limit.policy())
+            }
+            return err
+        },
+        "maxmemory-policy": func(v string) error {
+            p, err := parseEvictionPolicy(v)
+            if err == nil {
+                store.limit.set(store.limit.max(), p)
+            }
+            return err
+        },
+        "wal-sync": func(v string) error {
+            on, err := strconv.ParseBool(v)
+            if err == nil && store.wal != nil {
+                store.wal.SetSyncOnWrite(on)
+            }
+            return err
+        },
+        "snapshot-retain": func(v string) error {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                return errors.New("must be at least 1")
+            }
+            if store.snapshots != nil {
+                store.snapshots.SetRetain(n)
+            }
+            return nil
+        },
+        "max-batch": func(v string) error {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                return errors.New("must be at least 1")
+            }
+            store.maxBatch.Store(int64(n))
+            return nil
+        },
+        "max-key-size": func(v string) error {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                return errors.New("must be at least 1")
+            }
+            store.maxKeySize.Store(int64(n))
+            return nil
+        },
+        "max-value-size": func(v string) error {
+            n, err := parseBytes(v)
+            if err != nil || n < 1 {
+                return errors.New("must be a size of at least 1 byte, such as 1mb")
+            }
+            store.maxValueSize.Store(n)
+            return nil
+        },
+        "pubsub-buffer": func(v string) error {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                return errors.New("must be at least 1")
+            }
+            pubsub.setDefaults(n, slowPolicy(cfg.PubSubSlow))
+            return nil
+        },
+        "pubsub-slow": func(v string) error {
+            p, err := parseSlowPolicy(v)
+            if err == nil {
+                pubsub.setDefaults(cfg.PubSubBuffer, p)
+            }
+            return err
+        },
+    }
+    return st
+}
+
+// Get returns the current value of every setting matching req.Pattern.
+func (st *Settings) Get(req *ConfigRequest, resp *ConfigResponse) error {
+    pattern := req.Pattern
+    if pattern == "" {
+        pattern = "*"
+    }
+    st.mu.Lock()
+    defer st.mu.Unlock()
+    resp.Settings = make(map[string]string)
+    st.fs.VisitAll(func(f *flag.Flag) {
+        if !globMatch(strings.ToLower(pattern), f.Name) {
+            return
+        }
+        value := f.Value.String()
+        if secretSettings[f.Name] && value != "" {
+            value = "(hidden)"
+        }
+        resp.Settings[f.Name] = value
+    })
+    return nil
+}
+
+// Set changes one of the settings that can change at runtime. The others
+// need a restart with the new value.
+func (st *Settings) Set(req *ConfigRequest, resp *ConfigResponse) error {
+    name := strings.ToLower(req.Name)
+    apply, ok := st.runtime[name]
+    if !ok {
+        if st.fs.Lookup(name) == nil {
+            return fmt.Errorf("ERR unknown setting '%s'", req.Name)
+        }
+        return fmt.Errorf("ERR setting '%s' can only be changed with a restart, settings that can change at runtime: %s", name, strings.Join(st.runtimeNames(), ", "))
+    }
+    st.mu.Lock()
+    defer st.mu.Unlock()
+    if err := apply(req.Value); err != nil {
+        return fmt.Errorf("ERR invalid value %q for '%s': %s", req.Value, name, strings.TrimPrefix(err.Error(), "ERR "))
+    }
+    st.fs.Set(name, req.Value)
+    resp.Settings = map[string]string{name: st.fs.Lookup(name).Value.String()}
+    return nil
+}
+
+func (st *Settings) runtimeNames() []string {
+    names := make([]string, 0, len(st.runtime))
+    for name := range st.runtime {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// handler serves GET /config?pattern= with the settings and POST /config
+// with {"name", "value"} to change one.
+func (st *Settings) handler(w http.ResponseWriter, r *http.Request) {
+    var req ConfigRequest
+    method := "Config.Get"
+    switch r.Method {
+    case http.MethodGet:
+        req.Pattern = r.URL.Query().Get("pattern")
+    case http.MethodPost:
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+            httpError(w, http.StatusBadRequest, "Invalid request")
+            return
+        }
+        method = "Config.Set"
+    default:
+        methodNotAllowed(w, "GET, POST")
+        return
+    }
+    if !authorized(w, r, method, &req) {
+        return
+    }
+    var resp ConfigResponse
+    var err error
+    if method == "Config.Get" {
+        err = st.Get(&req, &resp)
+    } else {
+        err = st.Set(&req, &resp)
+    }
+    if err != nil {
+        w.WriteHeader(errorStatus(err.Error()))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: resp.Settings})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+    "flag"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestLoadConfig(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "mydb.toml")
+    os.WriteFile(path, []byte(`
+http-addr = ":7070"   # the top level takes flag names
+rpc_addr = ':7071'
+
+[wal]
+dir = "/var/lib/mydb/wal"
+segment_size = 1_048_576
+
+[shard]
+nodes = ["10.0.0.1:1234", "10.0.0.2:1234"]
+
+[maxmemory]
+policy = "allkeys-lru"
+`), 0600)
+    t.Setenv("MYDB_RPC_ADDR", ":8081")
+    t.Setenv("MYDB_EXPIRE_INTERVAL", "50ms")
+
+    cfg, err := LoadConfig(flag.NewFlagSet("mydb", flag.ContinueOnError), []string{"-config", path, "-expire-interval", "1s"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    switch {
+    case cfg.HTTPAddr != ":7070":
+        t.Errorf("http-addr from the file: got %q", cfg.HTTPAddr)
+    case cfg.RPCAddr != ":8081":
+        t.Errorf("rpc-addr from the environment over the file: got %q", cfg.RPCAddr)
+    case cfg.ExpireInterval != time.Second:
+        t.Errorf("expire-interval from the flag over the environment: got %v", cfg.ExpireInterval)
+    case cfg.WALDir != "/var/lib/mydb/wal" || cfg.WALSegmentSize != 1<<20:
+        t.Errorf("wal table: got %q %d", cfg.WALDir, cfg.WALSegmentSize)
+    case cfg.ShardNodes != "10.0.0.1:1234,10.0.0.2:1234":
+        t.Errorf("shard-nodes array: got %q", cfg.ShardNodes)
+    case cfg.MaxMemoryPolicy != "allkeys-lru":
+        t.Errorf("maxmemory-policy: got %q", cfg.MaxMemoryPolicy)
+    }
+
+    // Every problem is reported at once.
+    os.WriteFile(path, []byte("maxmemory = \"lots\"\nwal-dirr = \"x\"\nsnapshot-retain = 0\n"), 0600)
+    _, err = LoadConfig(flag.NewFlagSet("mydb", flag.ContinueOnError), []string{"-config", path})
+    if err == nil {
+        t.Fatal("invalid config accepted")
+    }
+    for _, want := range []string{`unknown setting "wal-dirr"`, "maxmemory:", "snapshot-retain:"} {
+        if !strings.Contains(err.Error(), want) {
+            t.Errorf("errors %q do not mention %s", err, want)
+        }
+    }
+}
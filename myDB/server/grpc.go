@@ -0,0 +1,576 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "path"
+    "strings"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/metadata"
+    "google.golang.org/grpc/peer"
+    "google.golang.org/grpc/stats"
+    "google.golang.org/grpc/status"
+)
+
+// grpcService serves the MyDB gRPC service of mydbpb. It answers like the
+// HTTP API: keys owned by another shard are served by calling their owner,
+// and every call is checked against the ACL as the RPC call it amounts to.
+type grpcService struct {
+    pb.UnimplementedMyDBServer
+    store    *InMemoryStore
+    pubsub   *PubSub
+    settings *Settings
+    acl      *ACL
+    requests context.Context // cancelled on shutdown, which ends the streams
+}
+
+// newGRPCServer returns a gRPC server for svc, over TLS when files is set.
+func newGRPCServer(svc *grpcService, files *tlsFiles) *grpc.Server {
+    opts := []grpc.ServerOption{
+        grpc.UnaryInterceptor(svc.unary),
+        grpc.StreamInterceptor(svc.stream),
+        grpc.StatsHandler(grpcConns{}),
+    }
+    if files != nil {
+        opts = append(opts, grpc.Creds(credentials.NewTLS(files.serverConfig())))
+    }
+    s := grpc.NewServer(opts...)
+    pb.RegisterMyDBServer(s, svc)
+    return s
+}
+
+// grpcCode picks the gRPC code for an error message from the store, as
+// errorStatus does for HTTP.
+func grpcCode(msg string) codes.Code {
+    switch {
+    case strings.HasPrefix(msg, "ERR "), strings.HasPrefix(msg, "WRONGTYPE"), strings.HasPrefix(msg, "CROSSSHARD"):
+        return codes.InvalidArgument
+    case msg == errKeyExists.Error():
+        return codes.AlreadyExists
+    case strings.HasPrefix(msg, "CONFLICT"):
+        return codes.Aborted
+    case msg == errKeyNotFound.Error():
+        return codes.NotFound
+    case strings.HasPrefix(msg, "NOAUTH"), strings.HasPrefix(msg, "WRONGPASS"):
+        return codes.Unauthenticated
+    case strings.HasPrefix(msg, "NOPERM"):
+        return codes.PermissionDenied
+    case strings.HasPrefix(msg, "OOM"):
+        return codes.ResourceExhausted
+    case strings.HasPrefix(msg, "COMPACTED"):
+        return codes.OutOfRange
+    case strings.HasPrefix(msg, "READONLY"), strings.HasPrefix(msg, "NOTLEADER"):
+        return codes.Unavailable
+    default:
+        return codes.Internal
+    }
+}
+
+func grpcError(msg string) error {
+    return status.Error(grpcCode(msg), msg)
+}
+
+// Authentication
+
+type grpcUserKey struct{}
+
+// authenticate finds out who makes a call, like the HTTP middleware: from
+// the authorization metadata, "Basic" with a user and password or "Bearer"
+// with an API token, or from the client certificate.
+func (g *grpcService) authenticate(ctx context.Context) (context.Context, error) {
+    if g.acl == nil {
+        return ctx, nil
+    }
+    var auth string
+    if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("authorization")) > 0 {
+        auth = md.Get("authorization")[0]
+    }
+    var u *ACLUser
+    var err error
+    if name, password, ok := (&http.Request{Header: http.Header{"Authorization": {auth}}}).BasicAuth(); ok {
+        u, err = g.acl.Login(name, password)
+    } else if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+        u, err = g.acl.Token(token)
+    } else if p, ok := peer.FromContext(ctx); ok {
+        if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+            u = g.acl.certUser(&info.State)
+        }
+    }
+    if err == nil && u == nil {
+        err = errNoAuth
+    }
+    if err != nil {
+        return ctx, grpcError(err.Error())
+    }
+    return context.WithValue(ctx, grpcUserKey{}, u), nil
+}
+
+// allowed is authorized for gRPC: it fails unless the user of ctx may make
+// the RPC call of method with args.
+func (g *grpcService) allowed(ctx context.Context, method string, args interface{}) error {
+    u, _ := ctx.Value(grpcUserKey{}).(*ACLUser)
+    if err := g.acl.callAllowed(u, method, args); err != nil {
+        return grpcError(err.Error())
+    }
+    return nil
+}
+
+// unary authenticates and times every call but Login, which checks the
+// credentials it is given itself.
+func (g *grpcService) unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+    start := time.Now()
+    var err error
+    if info.FullMethod != pb.MyDB_Login_FullMethodName {
+        ctx, err = g.authenticate(ctx)
+    }
+    var resp interface{}
+    if err == nil {
+        resp, err = handler(ctx, req)
+    }
+    metrics.observe("grpc", path.Base(info.FullMethod), time.Since(start), err != nil && !expected(err))
+    return resp, err
+}
+
+func (g *grpcService) stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+    ctx, err := g.authenticate(ss.Context())
+    if err != nil {
+        return err
+    }
+    return handler(srv, &authedStream{ServerStream: ss, ctx: ctx})
+}
+
+// expected tells the answers that are outcomes rather than failures, such
+// as a missing key, apart for the metrics.
+func expected(err error) bool {
+    switch status.Code(err) {
+    case codes.NotFound, codes.AlreadyExists, codes.Aborted:
+        return true
+    }
+    return false
+}
+
+// authedStream is a stream with the user found by authenticate.
+type authedStream struct {
+    grpc.ServerStream
+    ctx context.Context
+}
+
+func (s *authedStream) Context() context.Context { return s.ctx }
+
+// grpcConns counts the open gRPC connections for INFO.
+type grpcConns struct{}
+
+func (grpcConns) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (grpcConns) HandleRPC(context.Context, stats.RPCStats)                         {}
+func (grpcConns) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+
+func (grpcConns) HandleConn(_ context.Context, s stats.ConnStats) {
+    switch s.(type) {
+    case *stats.ConnBegin:
+        metrics.grpcClients.Add(1)
+    case *stats.ConnEnd:
+        metrics.grpcClients.Add(-1)
+    }
+}
+
+// Keys
+
+func (g *grpcService) Login(ctx context.Context, in *pb.LoginRequest) (*pb.LoginReply, error) {
+    if g.acl == nil {
+        return nil, grpcError(errNoUsers.Error())
+    }
+    req := &LoginRequest{Name: in.Name, Password: in.Password, Token: in.Token}
+    u, err := g.acl.authenticate(req.Name, req.secret())
+    if err != nil {
+        return nil, grpcError(err.Error())
+    }
+    return &pb.LoginReply{User: u.Name}, nil
+}
+
+// checkItem is checkItem of the store with a gRPC status.
+func (g *grpcService) checkItem(key, value string) error {
+    code, err := g.store.checkItem(key, value)
+    switch {
+    case err == nil:
+        return nil
+    case code == http.StatusRequestEntityTooLarge:
+        return status.Error(codes.ResourceExhausted, err.Error())
+    default:
+        return status.Error(codes.InvalidArgument, err.Error())
+    }
+}
+
+// key runs the RPC method fn for in on the node owning its key, after
+// checking the key and value against the limits of the HTTP API and the
+// caller against the ACL.
+func (g *grpcService) key(ctx context.Context, method string, fn func(*RPCRequest, *RPCResponse) error, in *pb.KeyRequest) (RPCResponse, error) {
+    if err := g.checkItem(in.Key, in.Value); err != nil {
+        return RPCResponse{}, err
+    }
+    req := &RPCRequest{Key: in.Key, Value: in.Value, TTL: in.Ttl, Delta: in.Delta, Revision: in.Revision}
+    if err := g.allowed(ctx, "InMemoryStore."+method, req); err != nil {
+        return RPCResponse{}, err
+    }
+    resp, err := g.store.invoke(method, fn, req)
+    if err != nil {
+        return resp, status.Error(codes.Unavailable, err.Error())
+    }
+    if !resp.Success {
+        return resp, grpcError(resp.Error)
+    }
+    return resp, nil
+}
+
+func (g *grpcService) Get(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCGet", g.store.RPCGet, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Value: resp.Data, Revision: resp.Revision, Exists: true}, nil
+}
+
+func (g *grpcService) Set(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCSet", g.store.RPCSet, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Revision: resp.Revision}, nil
+}
+
+func (g *grpcService) Delete(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCDelete", g.store.RPCDelete, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Exists: resp.Exists}, nil
+}
+
+func (g *grpcService) Expire(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    if _, err := g.key(ctx, "RPCExpire", g.store.RPCExpire, in); err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{}, nil
+}
+
+func (g *grpcService) Persist(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCPersist", g.store.RPCPersist, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Exists: resp.Data == "1"}, nil
+}
+
+func (g *grpcService) TTL(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCTTL", g.store.RPCTTL, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Value: resp.Data, Exists: true}, nil
+}
+
+func (g *grpcService) Incr(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCIncr", g.store.RPCIncr, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Value: resp.Data, Revision: resp.Revision, Exists: true}, nil
+}
+
+func (g *grpcService) SetNX(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCSetNX", g.store.RPCSetNX, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Revision: resp.Revision}, nil
+}
+
+func (g *grpcService) GetSet(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCGetSet", g.store.RPCGetSet, in)
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Value: resp.Data, Revision: resp.Revision, Exists: resp.Exists}, nil
+}
+
+func (g *grpcService) CompareAndSwap(ctx context.Context, in *pb.KeyRequest) (*pb.KeyReply, error) {
+    resp, err := g.key(ctx, "RPCCompareAndSwap", g.store.RPCCompareAndSwap, in)
+    if status.Code(err) == codes.Aborted {
+        st, _ := status.New(codes.Aborted, resp.Error).WithDetails(&pb.KeyReply{Revision: resp.Revision, Exists: resp.Revision != 0})
+        return nil, st.Err()
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &pb.KeyReply{Revision: resp.Revision}, nil
+}
+
+// Batches and transactions
+
+// batch runs the batch method fn for in like the HTTP handlers do: split
+// by the node owning each key.
+func (g *grpcService) batch(ctx context.Context, method string, fn func(*BatchRequest, *BatchResponse) error, in *pb.BatchRequest) (*pb.BatchReply, error) {
+    req := &BatchRequest{Keys: in.Keys}
+    for _, item := range in.Items {
+        if err := g.checkItem(item.Key, item.Value); err != nil {
+            return nil, err
+        }
+        req.Items = append(req.Items, BatchItem{Key: item.Key, Value: item.Value, TTL: item.Ttl})
+    }
+    keys := req.Keys
+    if method == "RPCMSet" {
+        keys = req.itemKeys()
+    }
+    if err := g.allowed(ctx, "InMemoryStore."+method, req); err != nil {
+        return nil, err
+    }
+    resp := g.store.runBatch(method, fn, req, keys)
+    if !resp.Success {
+        return nil, grpcError(resp.Error)
+    }
+    out := &pb.BatchReply{Results: make([]*pb.BatchResult, len(resp.Results))}
+    for i, r := range resp.Results {
+        out.Results[i] = &pb.BatchResult{Key: r.Key, Success: r.Success, Value: r.Data, Error: r.Error, Revision: r.Revision}
+    }
+    return out, nil
+}
+
+func (g *grpcService) MGet(ctx context.Context, in *pb.BatchRequest) (*pb.BatchReply, error) {
+    return g.batch(ctx, "RPCMGet", g.store.RPCMGet, in)
+}
+
+func (g *grpcService) MSet(ctx context.Context, in *pb.BatchRequest) (*pb.BatchReply, error) {
+    return g.batch(ctx, "RPCMSet", g.store.RPCMSet, in)
+}
+
+func (g *grpcService) MDel(ctx context.Context, in *pb.BatchRequest) (*pb.BatchReply, error) {
+    return g.batch(ctx, "RPCMDel", g.store.RPCMDel, in)
+}
+
+func (g *grpcService) Txn(ctx context.Context, in *pb.TxnRequest) (*pb.TxnReply, error) {
+    req := &TxnRequest{}
+    for _, c := range in.Conditions {
+        req.Conditions = append(req.Conditions, TxnCondition{Key: c.Key, Revision: c.Revision})
+    }
+    for _, op := range in.Ops {
+        req.Ops = append(req.Ops, TxnOp{Op: op.Op, Key: op.Key, Value: op.Value, TTL: op.Ttl})
+    }
+    if err := g.allowed(ctx, "InMemoryStore.RPCTxn", req); err != nil {
+        return nil, err
+    }
+    var resp TxnResponse
+    owner, local, err := g.store.txnOwner(req)
+    switch {
+    case err != nil:
+        return nil, grpcError(err.Error())
+    case local:
+        g.store.RPCTxn(req, &resp)
+    default:
+        if err := g.store.sharding.call(owner, "InMemoryStore.RPCTxn", req, &resp); err != nil {
+            return nil, status.Errorf(codes.Unavailable, "shard %s: %v", owner, err)
+        }
+    }
+    if !resp.Success && resp.Failed == nil {
+        return nil, grpcError(resp.Error)
+    }
+    out := &pb.TxnReply{Revisions: resp.Revisions}
+    for _, f := range resp.Failed {
+        out.Failed = append(out.Failed, &pb.TxnFailure{Index: int32(f.Index), Key: f.Key, Expected: f.Expected, Revision: f.Revision})
+    }
+    if !resp.Success {
+        st, _ := status.New(codes.Aborted, resp.Error).WithDetails(out)
+        return nil, st.Err()
+    }
+    return out, nil
+}
+
+func (g *grpcService) Command(ctx context.Context, in *pb.CommandRequest) (*pb.CommandReply, error) {
+    req := &CommandRequest{Args: in.Args}
+    if _, err := lookupCommand(req.Args); err != nil {
+        return nil, grpcError(err.Error())
+    }
+    if err := g.allowed(ctx, "InMemoryStore.RPCCommand", req); err != nil {
+        return nil, err
+    }
+    var resp CommandResponse
+    if owner, local := g.store.route(req.Args[1]); !local {
+        if err := g.store.sharding.call(owner, "InMemoryStore.RPCCommand", req, &resp); err != nil {
+            return nil, status.Errorf(codes.Unavailable, "shard %s: %v", owner, err)
+        }
+    } else {
+        g.store.RPCCommand(req, &resp)
+    }
+    if !resp.Success {
+        return nil, grpcError(resp.Error)
+    }
+    return &pb.CommandReply{Reply: replyProto(resp.Reply)}, nil
+}
+
+func replyProto(r Reply) *pb.Reply {
+    out := &pb.Reply{Kind: pb.Reply_Kind(r.Kind), Int: r.Int, Str: r.Str}
+    for _, e := range r.Elems {
+        out.Elems = append(out.Elems, replyProto(e))
+    }
+    return out
+}
+
+// Scans and watches
+
+func scanRequestFrom(in *pb.ScanRequest) *ScanRequest {
+    return &ScanRequest{Prefix: in.Prefix, Start: in.Start, End: in.End, Cursor: in.Cursor, Count: int(in.Count), Values: in.Values}
+}
+
+func (g *grpcService) Scan(ctx context.Context, in *pb.ScanRequest) (*pb.ScanReply, error) {
+    req := scanRequestFrom(in)
+    if err := g.allowed(ctx, "InMemoryStore.RPCScan", req); err != nil {
+        return nil, err
+    }
+    var resp ScanResponse
+    g.store.RPCScan(req, &resp)
+    if !resp.Success {
+        return nil, grpcError(resp.Error)
+    }
+    out := &pb.ScanReply{Keys: resp.Keys, Cursor: resp.Cursor}
+    for _, e := range resp.Entries {
+        out.Entries = append(out.Entries, &pb.KeyEntry{Key: e.Key, Value: e.Value, Type: e.Type})
+    }
+    return out, nil
+}
+
+func (g *grpcService) Count(ctx context.Context, in *pb.ScanRequest) (*pb.ScanReply, error) {
+    req := scanRequestFrom(in)
+    if err := g.allowed(ctx, "InMemoryStore.RPCCount", req); err != nil {
+        return nil, err
+    }
+    var resp ScanResponse
+    g.store.RPCCount(req, &resp)
+    if !resp.Success {
+        return nil, grpcError(resp.Error)
+    }
+    return &pb.ScanReply{Count: int64(resp.Count)}, nil
+}
+
+// Watch streams the events like the /watch endpoint, until the client goes
+// away or the server shuts down. Only the keys stored on this node are
+// watched.
+func (g *grpcService) Watch(in *pb.WatchRequest, stream pb.MyDB_WatchServer) error {
+    if err := g.allowed(stream.Context(), "InMemoryStore.RPCWatch", &WatchRequest{Prefix: in.Prefix}); err != nil {
+        return err
+    }
+    from, err := g.store.watchStart(in.From)
+    if err != nil {
+        return grpcError(err.Error())
+    }
+    ctx, cancel := context.WithCancel(stream.Context())
+    defer cancel()
+    defer context.AfterFunc(g.requests, cancel)()
+    for {
+        events, next, err := g.store.Watch(ctx, in.Prefix, from)
+        if err := stream.Context().Err(); err != nil {
+            return err
+        }
+        if ctx.Err() != nil {
+            return status.Error(codes.Unavailable, "the server is shutting down")
+        }
+        if err != nil {
+            return grpcError(err.Error())
+        }
+        for _, e := range events {
+            err := stream.Send(&pb.WatchEvent{Rev: e.Rev, Type: e.Type, Key: e.Key, Value: e.Value, ValueType: e.ValueType, Expiration: e.Expiration})
+            if err != nil {
+                return err
+            }
+        }
+        from = next
+    }
+}
+
+// Pub/sub
+
+func (g *grpcService) Publish(ctx context.Context, in *pb.PublishRequest) (*pb.PublishReply, error) {
+    req := &PublishRequest{Channel: in.Channel, Message: in.Message}
+    if req.Channel == "" {
+        return nil, status.Error(codes.InvalidArgument, "ERR no channel to publish on")
+    }
+    if err := g.allowed(ctx, "PubSub.Publish", req); err != nil {
+        return nil, err
+    }
+    return &pb.PublishReply{Receivers: int64(g.pubsub.publish(req.Channel, req.Message))}, nil
+}
+
+// Subscribe streams the messages like the /subscribe endpoint. A message
+// with only Dropped set reports the messages this subscriber lost so far.
+func (g *grpcService) Subscribe(in *pb.SubscribeRequest, stream pb.MyDB_SubscribeServer) error {
+    req := &SubscribeRequest{Channels: in.Channels, Patterns: in.Patterns, Policy: in.Policy}
+    if err := g.allowed(stream.Context(), "PubSub.Subscribe", req); err != nil {
+        return err
+    }
+    sub, err := g.pubsub.subscribe(req.Channels, req.Patterns, req.Policy, nil, false)
+    if err != nil {
+        return grpcError(err.Error())
+    }
+    defer g.pubsub.unsubscribe(sub, "client went away")
+
+    var dropped uint64
+    for {
+        select {
+        case m := <-sub.buf:
+            for _, m := range drain(sub.buf, []Message{m}, receiveBatchSize) {
+                if err := stream.Send(&pb.Message{Channel: m.Channel, Pattern: m.Pattern, Payload: m.Payload}); err != nil {
+                    return err
+                }
+            }
+            if d := sub.dropped.Load(); d != dropped {
+                dropped = d
+                if err := stream.Send(&pb.Message{Dropped: d}); err != nil {
+                    return err
+                }
+            }
+        case <-sub.done:
+            return status.Error(codes.Aborted, sub.reason)
+        case <-stream.Context().Done():
+            return stream.Context().Err()
+        case <-g.requests.Done():
+            return status.Error(codes.Unavailable, "the server is shutting down")
+        }
+    }
+}
+
+// Settings and statistics
+
+func (g *grpcService) GetConfig(ctx context.Context, in *pb.ConfigRequest) (*pb.ConfigReply, error) {
+    req := &ConfigRequest{Pattern: in.Pattern}
+    if err := g.allowed(ctx, "Config.Get", req); err != nil {
+        return nil, err
+    }
+    var resp ConfigResponse
+    if err := g.settings.Get(req, &resp); err != nil {
+        return nil, grpcError(err.Error())
+    }
+    return &pb.ConfigReply{Settings: resp.Settings}, nil
+}
+
+func (g *grpcService) SetConfig(ctx context.Context, in *pb.ConfigRequest) (*pb.ConfigReply, error) {
+    req := &ConfigRequest{Name: in.Name, Value: in.Value}
+    if err := g.allowed(ctx, "Config.Set", req); err != nil {
+        return nil, err
+    }
+    var resp ConfigResponse
+    if err := g.settings.Set(req, &resp); err != nil {
+        return nil, grpcError(err.Error())
+    }
+    return &pb.ConfigReply{Settings: resp.Settings}, nil
+}
+
+func (g *grpcService) Info(ctx context.Context, in *pb.InfoRequest) (*pb.InfoReply, error) {
+    if err := g.allowed(ctx, "Stats.Info", nil); err != nil {
+        return nil, err
+    }
+    var resp InfoResponse
+    (&statsService{g.store}).Info(&InfoRequest{Section: in.Section}, &resp)
+    return &pb.InfoReply{Text: resp.Text}, nil
+}
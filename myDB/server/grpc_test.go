@@ -0,0 +1,65 @@
+package main
+
+import (
+    "context"
+    "net"
+    "testing"
+    "time"
+
+    pb "github.com/shafigh75/go_files/myDB/mydbpb"
+    "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials/insecure"
+    "google.golang.org/grpc/status"
+)
+
+func TestGRPCService(t *testing.T) {
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    s := NewInMemoryStore()
+    s.changes = newChangeLog(0, 100)
+    srv := newGRPCServer(&grpcService{store: s, pubsub: NewPubSub(16, policyDrop), requests: context.Background()}, nil)
+    go srv.Serve(l)
+    defer srv.Stop()
+    conn, err := grpc.NewClient(l.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer conn.Close()
+    c := pb.NewMyDBClient(conn)
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+
+    watch, err := c.Watch(ctx, &pb.WatchRequest{Prefix: "a", From: 1})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := c.Get(ctx, &pb.KeyRequest{Key: "a"}); status.Code(err) != codes.NotFound {
+        t.Fatalf("missing key: %v", err)
+    }
+    set, err := c.Set(ctx, &pb.KeyRequest{Key: "a", Value: "1"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := c.Get(ctx, &pb.KeyRequest{Key: "a"})
+    if err != nil || got.Value != "1" || got.Revision == 0 || got.Revision != set.Revision {
+        t.Fatalf("get: %v %v, set gave revision %d", got, err, set.Revision)
+    }
+    if _, err := c.SetNX(ctx, &pb.KeyRequest{Key: "a", Value: "2"}); status.Code(err) != codes.AlreadyExists {
+        t.Fatalf("setnx on an existing key: %v", err)
+    }
+
+    // A failed compare-and-swap carries the current revision.
+    _, err = c.CompareAndSwap(ctx, &pb.KeyRequest{Key: "a", Value: "2", Revision: got.Revision + 1})
+    st := status.Convert(err)
+    if st.Code() != codes.Aborted || len(st.Details()) != 1 || st.Details()[0].(*pb.KeyReply).Revision != got.Revision {
+        t.Fatalf("conflict: %v %v", err, st.Details())
+    }
+
+    e, err := watch.Recv()
+    if err != nil || e.Type != "set" || e.Key != "a" || e.Rev != got.Revision {
+        t.Fatalf("watch: %v %v", e, err)
+    }
+}
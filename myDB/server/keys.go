@@ -0,0 +1,371 @@
+package main
+
+import (
+    "encoding/base64"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const (
+    scanMaxCount = 10000 // keys per scan or range call at most
+    scanDone     = "0"   // cursor that starts a scan and marks its end
+)
+
+var errBadCursor = errors.New("ERR invalid cursor")
+
+// KeyEntry is a key found by a scan. Value is set for string keys when
+// values were asked for, Type for the other types.
+type KeyEntry struct {
+    Key   string `json:"key"`
+    Value string `json:"value,omitempty"`
+    Type  string `json:"type,omitempty"`
+}
+
+// ScanRequest selects the keys starting with Prefix and lying in [Start,
+// End), where an empty End has no upper bound. Keys come in order, Count
+// at a time, and Cursor is the one returned by the previous call ("0" or
+// empty for the first).
+type ScanRequest struct {
+    Prefix string `json:"prefix,omitempty"`
+    Start  string `json:"start,omitempty"`
+    End    string `json:"end,omitempty"`
+    Cursor string `json:"cursor,omitempty"`
+    Count  int    `json:"count,omitempty"`
+    Values bool   `json:"values,omitempty"` // return the values too
+    Local  bool   `json:"local,omitempty"`  // only the keys on this node, used between shards
+}
+
+// ScanResponse carries one page of keys (or entries, with Values) and the
+// cursor for the next page, which is "0" after the last one. RPCCount
+// answers with Count instead.
+type ScanResponse struct {
+    Success bool       `json:"success"`
+    Error   string     `json:"error,omitempty"`
+    Leader  string     `json:"leader,omitempty"`
+    Keys    []string   `json:"keys,omitempty"`
+    Entries []KeyEntry `json:"entries,omitempty"`
+    Cursor  string     `json:"cursor,omitempty"`
+    Count   int        `json:"count,omitempty"`
+}
+
+// keyRange returns the bounds of the keys req selects: those starting with
+// the prefix and lying in [start, end).
+func (req *ScanRequest) keyRange() (start, end string) {
+    start, end = req.Start, req.End
+    if req.Prefix != "" {
+        start = max(start, req.Prefix)
+        if pe := prefixEnd(req.Prefix); pe != "" && (end == "" || pe < end) {
+            end = pe
+        }
+    }
+    return start, end
+}
+
+// prefixEnd returns the first key after all keys starting with prefix, or
+// "" when there is none.
+func prefixEnd(prefix string) string {
+    b := []byte(prefix)
+    for i := len(b) - 1; i >= 0; i-- {
+        if b[i] < 0xff {
+            b[i]++
+            return string(b[:i+1])
+        }
+    }
+    return ""
+}
+
+// encodeCursor turns the last key of a page into the cursor of the next
+// one. Cursors name a key rather than a position, so keys added or removed
+// in between do not shift them: a scan returns every key that exists for
+// its whole duration exactly once.
+func encodeCursor(last string) string {
+    return base64.RawURLEncoding.EncodeToString([]byte(last))
+}
+
+// decodeCursor returns the key a cursor continues after, or ok == false
+// for a scan that starts from the beginning.
+func decodeCursor(cursor string) (after string, ok bool, err error) {
+    if cursor == "" || cursor == scanDone {
+        return "", false, nil
+    }
+    b, err := base64.RawURLEncoding.DecodeString(cursor)
+    if err != nil {
+        return "", false, errBadCursor
+    }
+    return string(b), true, nil
+}
+
+// Scan returns, in order, up to count live keys in [start, end) that come
+// after the key the cursor points to, and the cursor of the next page.
+func (s *InMemoryStore) Scan(start, end, cursor string, count int, values bool) ([]KeyEntry, string, error) {
+    after, ok, err := decodeCursor(cursor)
+    if err != nil {
+        return nil, "", err
+    }
+    if ok && after >= start {
+        start = after + "\x00" // the first key after it
+    }
+    entries, more := s.scanLocal(start, end, count, values)
+    next := scanDone
+    if more {
+        next = encodeCursor(entries[len(entries)-1].Key)
+    }
+    return entries, next, nil
+}
+
+// scanLocal returns up to count live keys in [start, end) and whether
+// there are more. Like a Get, it reads each key under the lock of its
+// shard only, so writes go on while it runs.
+func (s *InMemoryStore) scanLocal(start, end string, count int, values bool) ([]KeyEntry, bool) {
+    s.indexMu.RLock()
+    defer s.indexMu.RUnlock()
+    now := time.Now().UnixMilli()
+    var entries []KeyEntry
+    more := false
+    s.index.Ascend(start, func(key string) bool {
+        if end != "" && key >= end {
+            return false
+        }
+        v, ok := s.store.read(key, false)
+        if !ok || v.expired(now) {
+            return true // indexed but not set yet, or expired
+        }
+        if len(entries) == count {
+            more = true
+            return false
+        }
+        e := KeyEntry{Key: key}
+        if v.Type != TypeString {
+            e.Type = v.Type.String()
+        } else if values {
+            e.Value = v.Value
+        }
+        entries = append(entries, e)
+        return true
+    })
+    return entries, more
+}
+
+// CountKeys returns the number of keys in [start, end) in O(log n). Keys
+// whose TTL passed but that were not removed yet are still counted.
+func (s *InMemoryStore) CountKeys(start, end string) int {
+    s.indexMu.RLock()
+    defer s.indexMu.RUnlock()
+    n := s.index.Len()
+    if end != "" {
+        n = s.index.Rank(end)
+    }
+    return max(0, n-s.index.Rank(start))
+}
+
+// scanShards runs a scan on every shard node and merges the pages, so a
+// sharded cluster is scanned as one keyspace.
+func (s *InMemoryStore) scanShards(req *ScanRequest, resp *ScanResponse) error {
+    start, end := req.keyRange()
+    after, ok, err := decodeCursor(req.Cursor)
+    if err != nil {
+        return err
+    }
+    if ok && after >= start {
+        start = after + "\x00"
+    }
+
+    local := ScanRequest{Start: start, End: end, Count: req.Count, Values: req.Values, Local: true}
+    var all []KeyEntry
+    more := false
+    for _, node := range s.sharding.status().Nodes {
+        var page ScanResponse
+        if node == s.sharding.self {
+            err = s.RPCScan(&local, &page)
+        } else {
+            err = s.sharding.call(node, "InMemoryStore.RPCScan", &local, &page)
+        }
+        if err == nil && !page.Success {
+            err = errors.New(page.Error)
+        }
+        if err != nil {
+            return fmt.Errorf("shard %s: %w", node, err)
+        }
+        all = append(all, page.Entries...)
+        more = more || page.Cursor != scanDone
+    }
+
+    // While keys move between shards a key can be on two nodes at once.
+    sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+    merged := all[:0]
+    for _, e := range all {
+        if len(merged) == 0 || e.Key != merged[len(merged)-1].Key {
+            merged = append(merged, e)
+        }
+    }
+    if len(merged) > req.Count {
+        merged, more = merged[:req.Count], true
+    }
+    resp.Entries = merged
+    resp.Cursor = scanDone
+    if more && len(merged) > 0 {
+        resp.Cursor = encodeCursor(merged[len(merged)-1].Key)
+    }
+    return nil
+}
+
+// RPCScan returns one page of a prefix scan or range query.
+func (s *InMemoryStore) RPCScan(req *ScanRequest, resp *ScanResponse) error {
+    if err := s.checkRead(); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    if req.Count <= 0 {
+        req.Count = scanDefault
+    }
+    req.Count = min(req.Count, scanMaxCount)
+
+    var err error
+    if s.sharding != nil && !req.Local {
+        err = s.scanShards(req, resp)
+    } else {
+        start, end := req.keyRange()
+        resp.Entries, resp.Cursor, err = s.Scan(start, end, req.Cursor, req.Count, req.Values)
+    }
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
+    if !req.Values && !req.Local {
+        resp.Keys = make([]string, len(resp.Entries))
+        for i, e := range resp.Entries {
+            resp.Keys[i] = e.Key
+        }
+        resp.Entries = nil
+    }
+    resp.Success = true
+    return nil
+}
+
+// RPCCount returns the number of keys req selects in Count.
+func (s *InMemoryStore) RPCCount(req *ScanRequest, resp *ScanResponse) error {
+    if err := s.checkRead(); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    start, end := req.keyRange()
+    resp.Count = s.CountKeys(start, end)
+    if s.sharding != nil && !req.Local {
+        local := ScanRequest{Start: start, End: end, Local: true}
+        for _, node := range s.sharding.status().Nodes {
+            if node == s.sharding.self {
+                continue
+            }
+            var page ScanResponse
+            err := s.sharding.call(node, "InMemoryStore.RPCCount", &local, &page)
+            if err == nil && !page.Success {
+                err = errors.New(page.Error)
+            }
+            if err != nil {
+                resp.Success = false
+                resp.Error = fmt.Sprintf("shard %s: %v", node, err)
+                return nil
+            }
+            resp.Count += page.Count
+        }
+    }
+    resp.Success = true
+    return nil
+}
+
+// scanRequest reads a ScanRequest from the query string of r.
+func scanRequest(r *http.Request) (ScanRequest, error) {
+    q := r.URL.Query()
+    req := ScanRequest{Prefix: q.Get("prefix"), Start: q.Get("start"), End: q.Get("end"), Cursor: q.Get("cursor")}
+    if c := q.Get("count"); c != "" {
+        n, err := strconv.Atoi(c)
+        if err != nil || n < 1 {
+            return req, fmt.Errorf("ERR count must be a positive integer")
+        }
+        req.Count = n
+    }
+    return req, nil
+}
+
+// scanHandler serves GET /scan?prefix=&cursor=&count= with the keys, and
+// GET /range?start=&end=&cursor=&count= with the keys and their values.
+func (store *InMemoryStore) scanHandler(values bool) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if store.checkRead() != nil && store.redirectToLeader(w, r) {
+            return
+        }
+        req, err := scanRequest(r)
+        if err != nil {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+            return
+        }
+        req.Values = values
+        if !authorized(w, r, "InMemoryStore.RPCScan", &req) {
+            return
+        }
+        var resp ScanResponse
+        store.RPCScan(&req, &resp)
+        if !resp.Success {
+            w.WriteHeader(scanStatus(resp.Error))
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error})
+            return
+        }
+        data := map[string]interface{}{"cursor": resp.Cursor}
+        if values {
+            if resp.Entries == nil {
+                resp.Entries = []KeyEntry{}
+            }
+            data["entries"] = resp.Entries
+        } else {
+            if resp.Keys == nil {
+                resp.Keys = []string{}
+            }
+            data["keys"] = resp.Keys
+        }
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: data})
+    }
+}
+
+// countHandler serves GET /count?prefix= or ?start=&end=.
+func (store *InMemoryStore) countHandler(w http.ResponseWriter, r *http.Request) {
+    if store.checkRead() != nil && store.redirectToLeader(w, r) {
+        return
+    }
+    req, _ := scanRequest(r)
+    if !authorized(w, r, "InMemoryStore.RPCCount", &req) {
+        return
+    }
+    var resp ScanResponse
+    store.RPCCount(&req, &resp)
+    if !resp.Success {
+        w.WriteHeader(scanStatus(resp.Error))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: resp.Count})
+}
+
+// scanStatus picks the HTTP status for a failed scan: a bad request, or a
+// node that cannot serve reads or reach the other shards.
+func scanStatus(msg string) int {
+    switch {
+    case strings.HasPrefix(msg, "ERR "):
+        return http.StatusBadRequest
+    case strings.HasPrefix(msg, "shard "):
+        return http.StatusBadGateway
+    default:
+        return http.StatusServiceUnavailable
+    }
+}
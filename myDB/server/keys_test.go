@@ -0,0 +1,66 @@
+package main
+
+import (
+    "fmt"
+    "sync"
+    "testing"
+)
+
+func TestScanConcurrentWrites(t *testing.T) {
+    s := NewInMemoryStore()
+    for i := 0; i < 300; i++ {
+        s.Set(fmt.Sprintf("k%03d", i), "v", 0)
+    }
+
+    // Other clients keep adding and removing keys all through the scan.
+    stop := make(chan struct{})
+    var writers sync.WaitGroup
+    for w := 0; w < 4; w++ {
+        writers.Add(1)
+        go func(w int) {
+            defer writers.Done()
+            for i := 0; ; i++ {
+                select {
+                case <-stop:
+                    return
+                default:
+                }
+                key := fmt.Sprintf("k%03d-%d", i%300, w)
+                s.Set(key, "v", 0)
+                s.Delete(key)
+                s.Set(fmt.Sprintf("k%03d", i%300), "w", 0)
+            }
+        }(w)
+    }
+
+    // Every key that is there all along comes back exactly once, in order.
+    seen := make(map[string]int)
+    last := ""
+    for cursor := ""; cursor != scanDone; {
+        entries, next, err := s.Scan("k", "l", cursor, 7, false)
+        if err != nil {
+            t.Fatal(err)
+        }
+        for _, e := range entries {
+            if e.Key <= last {
+                t.Fatalf("%s came after %s", e.Key, last)
+            }
+            last = e.Key
+            seen[e.Key]++
+        }
+        cursor = next
+    }
+    close(stop)
+    writers.Wait()
+    for i := 0; i < 300; i++ {
+        if key := fmt.Sprintf("k%03d", i); seen[key] != 1 {
+            t.Fatalf("%s returned %d times", key, seen[key])
+        }
+    }
+    if n := s.CountKeys("k", "l"); n != 300 {
+        t.Fatalf("counted %d keys", n)
+    }
+    if _, _, err := s.Scan("", "", "not a cursor!", 10, false); err != errBadCursor {
+        t.Fatalf("bad cursor: %v", err)
+    }
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+    "context"
+    "flag"
+    "fmt"
+    "net"
+    "os"
+    "os/user"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// every calls fn every interval in its own goroutine until stop is called.
+// stop waits for a call in progress to return.
+func every(interval time.Duration, fn func()) (stop func()) {
+    done := make(chan struct{})
+    finished := make(chan struct{})
+    go func() {
+        defer close(finished)
+        ticker := time.NewTicker(interval)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-done:
+                return
+            case <-ticker.C:
+                fn()
+            }
+        }
+    }()
+    var once sync.Once
+    return func() {
+        once.Do(func() { close(done) })
+        <-finished
+    }
+}
+
+// connSet keeps track of the open connections of a listener, so shutdown
+// can stop them from taking new requests and wait for the requests they
+// are already serving.
+type connSet struct {
+    mu      sync.Mutex
+    conns   map[net.Conn]struct{}
+    closing bool
+    active  sync.WaitGroup
+}
+
+func newConnSet() *connSet {
+    return &connSet{conns: make(map[net.Conn]struct{})}
+}
+
+// serve runs serve on conn, unless the set is being drained.
+func (cs *connSet) serve(conn net.Conn, serve func(net.Conn)) {
+    cs.mu.Lock()
+    if cs.closing {
+        cs.mu.Unlock()
+        conn.Close()
+        return
+    }
+    cs.conns[conn] = struct{}{}
+    cs.active.Add(1)
+    cs.mu.Unlock()
+
+    defer func() {
+        cs.mu.Lock()
+        delete(cs.conns, conn)
+        cs.mu.Unlock()
+        cs.active.Done()
+    }()
+    serve(conn)
+}
+
+// drain ends reading on every connection, so each one finishes the
+// requests it has already read, answers them and closes. Connections still
+// open when ctx is done are closed in the middle of what they do.
+func (cs *connSet) drain(ctx context.Context) error {
+    cs.mu.Lock()
+    cs.closing = true
+    for conn := range cs.conns {
+        conn.SetReadDeadline(time.Now())
+    }
+    cs.mu.Unlock()
+
+    drained := make(chan struct{})
+    go func() {
+        cs.active.Wait()
+        close(drained)
+    }()
+    select {
+    case <-drained:
+        return nil
+    case <-ctx.Done():
+        cs.mu.Lock()
+        for conn := range cs.conns {
+            conn.Close()
+        }
+        cs.mu.Unlock()
+        return ctx.Err()
+    }
+}
+
+// systemdUnit writes a systemd service for running the server with args,
+// the flags it would be started with. The flags are checked the way the
+// server checks them, a relative -config and MYDB_CONFIG are made
+// absolute, the MYDB_ variables of settings set now are kept and relative
+// data directories stay relative to the current directory. Unit files are
+// world-readable, so secret settings such as -cluster-token go to
+// secretEnvFile in the current directory, readable by root only, instead.
+func systemdUnit(args []string) (string, error) {
+    fs := flag.NewFlagSet("mydb", flag.ContinueOnError)
+    cfg, err := LoadConfig(fs, args)
+    if err != nil {
+        return "", err
+    }
+    exe, err := os.Executable()
+    if err != nil {
+        return "", err
+    }
+    dir, err := os.Getwd()
+    if err != nil {
+        return "", err
+    }
+    owner := os.Getenv("SUDO_USER")
+    if owner == "" {
+        if u, err := user.Current(); err == nil {
+            owner = u.Username
+        }
+    }
+
+    abs := func(path string) string {
+        if p, err := filepath.Abs(path); err == nil {
+            return p
+        }
+        return path
+    }
+    secrets := make(map[string]string)
+    command := []string{systemdQuote(exe)}
+    for i := 0; i < len(args); i++ {
+        arg := args[i]
+        name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+        if secretSettings[name] && strings.HasPrefix(arg, "-") {
+            if !hasValue && i+1 < len(args) {
+                i++
+                value = args[i]
+            }
+            secrets[settingEnv(name)] = value
+            continue
+        }
+        if name == "config" && strings.HasPrefix(arg, "-") {
+            if hasValue {
+                arg = arg[:len(arg)-len(value)] + abs(value)
+            } else if i+1 < len(args) {
+                command = append(command, arg)
+                i++
+                arg = abs(args[i])
+            }
+        }
+        command = append(command, systemdQuote(arg))
+    }
+    settings := map[string]string{settingEnv("config"): "config"}
+    fs.VisitAll(func(f *flag.Flag) { settings[settingEnv(f.Name)] = f.Name })
+    var env []string
+    for _, kv := range os.Environ() {
+        name, value, _ := strings.Cut(kv, "=")
+        setting, ok := settings[name]
+        switch {
+        case !ok:
+            // not ours, and it may well be a password
+        case secretSettings[setting]:
+            if _, given := secrets[name]; !given {
+                secrets[name] = value
+            }
+        default:
+            if setting == "config" && value != "" {
+                value = abs(value)
+            }
+            env = append(env, "Environment="+systemdQuote(name+"="+value)+"\n")
+        }
+    }
+    sort.Strings(env)
+    if len(secrets) > 0 {
+        path := abs(secretEnvFile)
+        if err := writeSecretEnv(path, secrets); err != nil {
+            return "", err
+        }
+        env = append(env, "EnvironmentFile="+systemdQuote(path)+"\n")
+    }
+
+    var b strings.Builder
+    b.WriteString("[Unit]\n")
+    b.WriteString("Description=myDB in-memory key-value store\n")
+    b.WriteString("After=network-online.target\n")
+    b.WriteString("Wants=network-online.target\n\n")
+    b.WriteString("[Service]\n")
+    b.WriteString("Type=simple\n")
+    if owner != "" {
+        fmt.Fprintf(&b, "User=%s\n", owner)
+    }
+    fmt.Fprintf(&b, "WorkingDirectory=%s\n", dir)
+    b.WriteString(strings.Join(env, ""))
+    fmt.Fprintf(&b, "ExecStart=%s\n", strings.Join(command, " "))
+    b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+    b.WriteString("KillSignal=SIGTERM\n")
+    // Leave the server time to drain before systemd kills it
+    fmt.Fprintf(&b, "TimeoutStopSec=%d\n", int((cfg.ShutdownTimeout+5*time.Second)/time.Second))
+    b.WriteString("Restart=on-failure\n")
+    b.WriteString("RestartSec=2\n")
+    b.WriteString("LimitNOFILE=65536\n\n")
+    b.WriteString("[Install]\n")
+    b.WriteString("WantedBy=multi-user.target\n")
+    return b.String(), nil
+}
+
+// secretEnvFile holds the secret settings of the unit systemdUnit writes.
+const secretEnvFile = "mydb.env"
+
+// writeSecretEnv writes vars to path as a systemd environment file that
+// only its owner can read. systemd reads it as root before starting the
+// server as its user.
+func writeSecretEnv(path string, vars map[string]string) error {
+    names := make([]string, 0, len(vars))
+    for name := range vars {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    var b strings.Builder
+    r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+    for _, name := range names {
+        fmt.Fprintf(&b, "%s=\"%s\"\n", name, r.Replace(vars[name]))
+    }
+    f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+    if err != nil {
+        return err
+    }
+    // The file may have been there with a wider mode.
+    if err := f.Chmod(0o600); err != nil {
+        f.Close()
+        return err
+    }
+    if _, err := f.WriteString(b.String()); err != nil {
+        f.Close()
+        return err
+    }
+    return f.Close()
+}
+
+// systemdQuote quotes an argument of ExecStart or Environment when it has
+// characters systemd would split at or expand.
+func systemdQuote(s string) string {
+    if s != "" && !strings.ContainsAny(s, " \t\"'\\$%;") {
+        return s
+    }
+    r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", "$$", "%", "%%")
+    return `"` + r.Replace(s) + `"`
+}
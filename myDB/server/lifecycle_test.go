@@ -0,0 +1,124 @@
+package main
+
+import (
+    "context"
+    "net"
+    "net/rpc"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+type Sleeper struct{}
+
+func (Sleeper) Sleep(d time.Duration, done *bool) error {
+    time.Sleep(d)
+    *done = true
+    return nil
+}
+
+func TestConnSetDrain(t *testing.T) {
+    srv := rpc.NewServer()
+    srv.Register(Sleeper{})
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer l.Close()
+    conns := newConnSet()
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            go conns.serve(conn, func(c net.Conn) { srv.ServeConn(c) })
+        }
+    }()
+
+    busy, err := rpc.Dial("tcp", l.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer busy.Close()
+    idle, err := rpc.Dial("tcp", l.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer idle.Close()
+    var done bool
+    if err := idle.Call("Sleeper.Sleep", time.Duration(0), &done); err != nil {
+        t.Fatal(err)
+    }
+    call := busy.Go("Sleeper.Sleep", 200*time.Millisecond, new(bool), nil)
+    time.Sleep(50 * time.Millisecond)
+
+    // The call in progress is answered, then every connection closes.
+    ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+    defer cancel()
+    if err := conns.drain(ctx); err != nil {
+        t.Fatal(err)
+    }
+    if res := <-call.Done; res.Error != nil || !*res.Reply.(*bool) {
+        t.Fatalf("call in progress: got %v", res.Error)
+    }
+    if err := idle.Call("Sleeper.Sleep", time.Duration(0), &done); err == nil {
+        t.Fatal("call after drain succeeded")
+    }
+
+    // Connections made while draining are turned away.
+    late, err := rpc.Dial("tcp", l.Addr().String())
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer late.Close()
+    if err := late.Call("Sleeper.Sleep", time.Duration(0), &done); err == nil {
+        t.Fatal("call on a new connection after drain succeeded")
+    }
+}
+
+func TestSystemdUnitSecrets(t *testing.T) {
+    dir := t.TempDir()
+    wd, err := os.Getwd()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chdir(dir); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { os.Chdir(wd) })
+    t.Setenv("MYDB_WAL_DIR", "data/wal")
+    t.Setenv("MYDB_CLUSTER_TOKEN", "env-token")
+    t.Setenv("MYDB_ADMIN_PASSWORD", "not-a-setting")
+
+    unit, err := systemdUnit([]string{"-cluster-token", "flag-token", "-http-addr", ":6501"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, secret := range []string{"flag-token", "env-token", "not-a-setting"} {
+        if strings.Contains(unit, secret) {
+            t.Fatalf("the unit holds %q:\n%s", secret, unit)
+        }
+    }
+    path := filepath.Join(dir, secretEnvFile)
+    for _, line := range []string{"Environment=MYDB_WAL_DIR=data/wal\n", "EnvironmentFile=" + path + "\n", " -http-addr :6501\n"} {
+        if !strings.Contains(unit, line) {
+            t.Fatalf("the unit lacks %q:\n%s", line, unit)
+        }
+    }
+
+    // The token given as a flag wins over the environment, as it would
+    // when starting the server.
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(data) != "MYDB_CLUSTER_TOKEN=\"flag-token\"\n" {
+        t.Fatalf("%s holds %q", secretEnvFile, data)
+    }
+    if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+        t.Fatalf("%s has mode %v", secretEnvFile, info.Mode())
+    }
+}
@@ -1,199 +1,1374 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
+    "flag"
     "fmt"
     "net"
     "net/http"
     "net/rpc"
+    "os"
+    "os/signal"
+    "strings"
     "sync"
+    "sync/atomic"
+    "syscall"
     "time"
+
+    "github.com/shafigh75/go_files/myDB/skiplist"
+    "github.com/shafigh75/go_files/myDB/timingwheel"
+    "google.golang.org/grpc"
 )
 
 // ValueWithTTL represents a value with its expiration time.
 type ValueWithTTL struct {
     Value      string
-    Expiration int64 // Unix timestamp in seconds
+    Expiration int64     // Unix time in milliseconds, 0 means no expiry
+    Type       ValueType // TypeString unless the key holds a collection
+    Revision   uint64    // bumped by every write to the key, starting at 1
+    coll       collection
+}
+
+// expired reports whether v has an expiration that lies before now.
+func (v ValueWithTTL) expired(now int64) bool {
+    return v.Expiration > 0 && now > v.Expiration
 }
 
+// expireBatchSize is the number of expired keys removed per lock hold.
+const expireBatchSize = 1000
+
+// Defaults of -max-batch, -max-key-size and -max-value-size.
+const (
+    defaultMaxBatch     = 1000
+    defaultMaxKeySize   = 1024
+    defaultMaxValueSize = 1 << 20
+)
+
 // InMemoryStore represents a simple in-memory key-value store with TTL.
 type InMemoryStore struct {
-    mu    sync.RWMutex
-    store map[string]ValueWithTTL
+    mu        sync.RWMutex       // read-locked by writes of one key, write-locked by work over all keys, see shardedMap
+    proposeMu sync.Mutex         // serializes writes in Raft mode, see update
+    commitMu  sync.Mutex         // orders the WAL, rev and changes, see log
+    store     *shardedMap        // the keys; single-key reads take only their shard's lock
+    indexMu   sync.RWMutex       // guards index, which writes of different shards change at once
+    index     *skiplist.List     // the keys of store in order, for scans
+    expiry    *timingwheel.Wheel // expiration of the keys with a TTL, in Unix milliseconds
+    rev       uint64             // bumped by every committed mutation, under commitMu
+    used      atomic.Int64       // estimated bytes held by the keys, see entrySize
+    limit     *memoryLimit       // memory limit and eviction policy
+    wal       *WAL               // nil when persistence is disabled
+    snapshots *Snapshotter       // nil when snapshots are disabled
+    changes   *changeLog         // recent changes for followers and watchers
+    follower  *Follower          // non-nil when this node replicates from a leader
+    raft      *Raft              // non-nil in cluster mode, where writes go through consensus
+    sharding  *Sharding          // non-nil when keys are spread over several nodes
+    maxBatch  atomic.Int64       // most keys one RPCMGet, RPCMSet or RPCMDel may carry
+
+    // Largest keys and values the HTTP and gRPC APIs take, see checkItem.
+    maxKeySize   atomic.Int64
+    maxValueSize atomic.Int64
 }
 
 // NewInMemoryStore creates a new instance of InMemoryStore.
 func NewInMemoryStore() *InMemoryStore {
-    return &InMemoryStore{
-        store: make(map[string]ValueWithTTL),
+    s := &InMemoryStore{
+        store:  newShardedMap(),
+        index:  skiplist.New(),
+        expiry: timingwheel.New(time.Now().UnixMilli()),
+        limit:  newMemoryLimit(0, evictNone),
     }
+    s.maxBatch.Store(defaultMaxBatch)
+    s.maxKeySize.Store(defaultMaxKeySize)
+    s.maxValueSize.Store(defaultMaxValueSize)
+    return s
 }
 
-// Set adds a key-value pair to the store with an optional TTL.
-func (s *InMemoryStore) Set(key, value string, ttl int64) {
-    s.mu.Lock()
-    defer s.mu.Unlock()
-    expiration := time.Now().Add(time.Duration(ttl) * time.Second).Unix()
-    s.store[key] = ValueWithTTL{Value: value, Expiration: expiration}
+// Set adds a key-value pair to the store with an optional TTL in seconds,
+// where 0 means the key does not expire.
+// The change is written to the WAL before it becomes visible.
+func (s *InMemoryStore) Set(key, value string, ttl int64) error {
+    _, err := s.setRevision(key, value, ttl)
+    return err
 }
 
-// Get retrieves a value by key from the store, checking for expiration.
-func (s *InMemoryStore) Get(key string) (string, bool) {
-    s.mu.RLock()
-    valueWithTTL, exists := s.store[key]
-    s.mu.RUnlock() // Unlock before potentially deleting
+// setRevision is Set, returning the revision the write gave key.
+func (s *InMemoryStore) setRevision(key, value string, ttl int64) (uint64, error) {
+    if err := checkTTL(ttl); err != nil {
+        return 0, err
+    }
+    m := &Mutation{Op: OpSet, Key: key, Value: value, Expiration: expirationAfter(ttl)}
+    err := s.update(key, func(ValueWithTTL, bool) (*Mutation, error) { return m, nil })
+    if err != nil {
+        return 0, err
+    }
+    return m.Revision, nil // stamped by update
+}
+
+// expirationAfter returns the expiration of a key set now with ttl seconds
+// to live, or noExpiration when ttl is 0. ttl must have passed checkTTL.
+func expirationAfter(ttl int64) int64 {
+    if ttl == 0 {
+        return noExpiration
+    }
+    return time.Now().UnixMilli() + ttl*1000
+}
+
+// Get retrieves a value by key from the store, checking for expiration,
+// together with the revision of the key.
+func (s *InMemoryStore) Get(key string) (string, uint64, bool) {
+    valueWithTTL, exists := s.entry(key)
+    return valueWithTTL.Value, valueWithTTL.Revision, exists
+}
 
-    if !exists || (valueWithTTL.Expiration > 0 && time.Now().Unix() > valueWithTTL.Expiration) {
+// entry returns the value of key together with its expiration. It only
+// takes the lock of the key's shard, so reads do not wait for each other
+// or for writes to other keys.
+func (s *InMemoryStore) entry(key string) (ValueWithTTL, bool) {
+    valueWithTTL, exists := s.store.read(key, s.limit.tracksAccess())
+
+    if !exists || valueWithTTL.expired(time.Now().UnixMilli()) {
         // If the key does not exist or has expired, attempt to delete it
         if exists {
-            s.Delete(key) // Delete the expired key
+            s.expire(key) // Delete the expired key
         }
-        return "", false
+        return ValueWithTTL{}, false
     }
 
-    return valueWithTTL.Value, true
+    return valueWithTTL, true
+}
+
+// keyStats counts the live keys and how many of them have an expiration.
+func (s *InMemoryStore) keyStats() (keys, expires int) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    now := time.Now().UnixMilli()
+    s.store.each(func(_ string, v ValueWithTTL) bool {
+        if !v.expired(now) {
+            keys++
+            if v.Expiration > 0 {
+                expires++
+            }
+        }
+        return true
+    })
+    return keys, expires
 }
 
 // Delete removes a key-value pair from the store.
-func (s *InMemoryStore) Delete(key string) {
+// The change is written to the WAL before it becomes visible.
+func (s *InMemoryStore) Delete(key string) error {
+    if s.sharding != nil {
+        s.sharding.tombstone(key)
+    }
+    if err := s.write(Mutation{Op: OpDelete, Key: key}); err != nil {
+        return err
+    }
+    if s.sharding != nil {
+        s.sharding.forgetPrevious(key)
+    }
+    return nil
+}
+
+// remove deletes key and reports whether it existed.
+func (s *InMemoryStore) remove(key string) (bool, error) {
+    if s.sharding != nil {
+        s.sharding.tombstone(key)
+    }
+    existed := false
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if !exists {
+            return nil, nil
+        }
+        existed = true
+        return &Mutation{Op: OpDelete, Key: key}, nil
+    })
+    if err == nil && s.sharding != nil {
+        s.sharding.forgetPrevious(key)
+    }
+    return existed, err
+}
+
+// lookup is Get for string values: keys holding a list, hash, set or
+// sorted set return errWrongType. While keys move between shards a key
+// not found here is also looked up on the node that owned it before.
+func (s *InMemoryStore) lookup(key string) (ValueWithTTL, bool, error) {
+    v, exists := s.entry(key)
+    if exists && v.Type != TypeString {
+        return ValueWithTTL{}, false, errWrongType
+    }
+    if !exists && s.sharding != nil {
+        v, exists = s.sharding.lookupPrevious(key)
+    }
+    metrics.read(exists)
+    return v, exists, nil
+}
+
+// write commits m locally, or through the cluster in Raft mode.
+// Followers of a leader reject writes.
+func (s *InMemoryStore) write(m Mutation) error {
+    if s.raft != nil {
+        s.proposeMu.Lock()
+        defer s.proposeMu.Unlock()
+        return s.propose(m)
+    }
+    if m.Op == OpBatch {
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        if s.follower != nil {
+            return errReadOnly
+        }
+        return s.commit(m)
+    }
+    unlock, shared := s.lockWrite(m.Key)
+    defer unlock()
+    if s.follower != nil {
+        return errReadOnly
+    }
+    return s.commitKey(m, shared)
+}
+
+// lockWrite takes the locks for a write of key alone: s.mu for reading and
+// the writer lock of the key's shard, so writes to other shards are not
+// held up, or s.mu for writing while there is a memory limit, as making
+// room for the write looks at every shard. It reports which.
+func (s *InMemoryStore) lockWrite(key string) (unlock func(), shared bool) {
+    if s.limit != nil && s.limit.max() > 0 {
+        s.mu.Lock()
+        return s.mu.Unlock, false
+    }
+    s.mu.RLock()
+    unlockShard := s.store.lockWrites(key)
+    return func() {
+        unlockShard()
+        s.mu.RUnlock()
+    }, true
+}
+
+// commitKey commits m, a write of the key lockWrite locked. A limit set
+// after lockWrite took the shared locks holds from the next write on.
+func (s *InMemoryStore) commitKey(m Mutation, shared bool) error {
+    if shared {
+        return s.sequence(m)
+    }
+    return s.commit(m)
+}
+
+// update reads key, lets fn turn its current value into a mutation of key
+// and commits that mutation with no other write to key in between. fn gets
+// exists == false for a missing or expired key and returns nil to change
+// nothing.
+func (s *InMemoryStore) update(key string, fn func(v ValueWithTTL, exists bool) (*Mutation, error)) error {
+    if s.raft != nil {
+        // Raft entries are made from what this node has applied, so the
+        // read and the proposal must not interleave with other writes. Propose only
+        // returns once the entry is applied here, which the next read sees.
+        s.proposeMu.Lock()
+        defer s.proposeMu.Unlock()
+        if err := s.raft.CheckRead(); err != nil {
+            return err
+        }
+        v, exists := s.entry(key)
+        m, err := fn(v, exists)
+        if err != nil || m == nil {
+            return err
+        }
+        if err := s.makeRoom(*m); err != nil {
+            return err
+        }
+        s.mu.Lock()
+        s.stamp(m)
+        s.mu.Unlock()
+        return s.raft.Propose(*m)
+    }
+
+    unlock, shared := s.lockWrite(key)
+    defer unlock()
+    if s.follower != nil {
+        return errReadOnly
+    }
+    v, exists := s.store.get(key)
+    if exists && v.expired(time.Now().UnixMilli()) {
+        v, exists = ValueWithTTL{}, false
+    }
+    m, err := fn(v, exists)
+    if err != nil || m == nil {
+        return err
+    }
+    s.stamp(m)
+    return s.commitKey(*m, shared)
+}
+
+// propose stamps m and sends it through Raft. The caller must hold
+// s.proposeMu, so the revision cannot be taken by another write.
+func (s *InMemoryStore) propose(m Mutation) error {
+    if err := s.makeRoom(m); err != nil {
+        return err
+    }
+    s.mu.Lock()
+    s.stamp(&m)
+    s.mu.Unlock()
+    return s.raft.Propose(m)
+}
+
+// stamp gives a set or update the next revision of its key, unless it already has
+// one, as keys moved from another shard do. Revisions are assigned where
+// the write is made and travel with the mutation, so replicas, raft peers
+// and WAL replay all end up with the same revision. The caller must hold
+// the locks get needs.
+func (s *InMemoryStore) stamp(m *Mutation) {
+    if (m.Op != OpSet && m.Op != OpUpdate) || m.Revision != 0 {
+        return
+    }
+    m.Revision = 1
+    if v, ok := s.store.get(m.Key); ok {
+        m.Revision = v.Revision + 1
+    }
+}
+
+// commit evicts keys to make room for m if needed and then sequences it.
+// The caller must hold s.mu for writing.
+func (s *InMemoryStore) commit(m Mutation) error {
+    if err := s.makeRoom(m); err != nil {
+        return err
+    }
+    return s.sequence(m)
+}
+
+// sequence stamps m, logs it and then applies it, so a change is in the
+// WAL before it becomes visible. The caller must hold s.mu for writing,
+// or for reading together with lockWrites of the key of m.
+func (s *InMemoryStore) sequence(m Mutation) error {
+    s.stamp(&m)
+    if err := s.log(m); err != nil {
+        return err
+    }
+    s.apply(m)
+    return nil
+}
+
+// log writes m to the WAL and records it. It is the only part of a write
+// that writes to other shards wait for: the WAL, the revisions and the
+// change log need the mutations in one order.
+func (s *InMemoryStore) log(m Mutation) error {
+    s.commitMu.Lock()
+    defer s.commitMu.Unlock()
+    if s.wal != nil {
+        if err := s.wal.Append(m); err != nil {
+            return fmt.Errorf("write WAL: %w", err)
+        }
+    }
+    s.record(m)
+    return nil
+}
+
+// record bumps the revision and hands m to the followers. The caller must
+// hold s.commitMu.
+func (s *InMemoryStore) record(m Mutation) {
+    s.rev++
+    if s.changes != nil {
+        s.changes.append(Change{Rev: s.rev, Mutation: m})
+    }
+}
+
+// applyCommitted applies a mutation the Raft cluster has committed.
+func (s *InMemoryStore) applyCommitted(m Mutation) {
     s.mu.Lock()
     defer s.mu.Unlock()
-    delete(s.store, key)
+    s.apply(m)
+    s.commitMu.Lock()
+    s.record(m)
+    s.commitMu.Unlock()
 }
 
-// Cleanup removes expired keys from the store concurrently.
+// apply changes the map according to m. The caller must hold the locks
+// sequence needs.
+func (s *InMemoryStore) apply(m Mutation) {
+    switch m.Op {
+    case OpSet, OpUpdate:
+        old, ok := s.store.get(m.Key)
+        v, err := m.result(old, ok, time.Now().UnixMilli())
+        if err != nil {
+            fmt.Printf("Error applying %s change to %q: %v\n", m.Type, m.Key, err)
+            return
+        }
+        if v.coll != nil && v.coll.len() == 0 {
+            s.deleteKey(m.Key)
+            return
+        }
+        if ok {
+            s.used.Add(-entrySize(m.Key, old))
+        } else {
+            s.indexMu.Lock()
+            s.index.Insert(m.Key)
+            s.indexMu.Unlock()
+        }
+        if v.Expiration > 0 && (!ok || v.Expiration != old.Expiration) {
+            s.expiry.Add(m.Key, v.Expiration)
+        }
+        s.store.set(m.Key, v, s.limit.tracksAccess())
+        s.used.Add(entrySize(m.Key, v))
+    case OpDelete, OpExpire, OpEvict:
+        s.deleteKey(m.Key)
+    case OpBatch:
+        for _, op := range m.ops() {
+            s.apply(op)
+        }
+    }
+}
+
+// deleteKey removes key from the map, the index and the memory accounting.
+// The caller must hold the locks sequence needs.
+func (s *InMemoryStore) deleteKey(key string) {
+    if v, ok := s.store.get(key); ok {
+        s.store.del(key)
+        s.indexMu.Lock()
+        s.index.Delete(key)
+        s.indexMu.Unlock()
+        s.used.Add(-entrySize(key, v))
+    }
+}
+
+// replay applies a mutation read back from the WAL, skipping sets whose
+// expiration has already passed. Every record counts as one revision, the
+// way record counted it when it was written.
+func (s *InMemoryStore) replay(m Mutation) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.replayLocked(m, time.Now().UnixMilli())
+    s.commitMu.Lock()
+    s.rev++
+    s.commitMu.Unlock()
+}
+
+func (s *InMemoryStore) replayLocked(m Mutation, now int64) {
+    if m.Op == OpBatch {
+        for _, op := range m.ops() {
+            s.replayLocked(op, now)
+        }
+        return
+    }
+    if (m.Op == OpSet || m.Op == OpUpdate) && m.Expiration > 0 && now > m.Expiration {
+        m = Mutation{Op: OpDelete, Key: m.Key}
+    }
+    s.apply(m)
+}
+
+// setIfAbsent commits m unless its key already holds a live value or was
+// deleted, either of which is then newer than m. It reports whether m was
+// applied.
+func (s *InMemoryStore) setIfAbsent(m Mutation, deleted func(key string) bool) (bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if v, ok := s.store.get(m.Key); ok && (v.Expiration == 0 || time.Now().UnixMilli() <= v.Expiration) {
+        return false, nil
+    }
+    if deleted(m.Key) {
+        return false, nil
+    }
+    return true, s.commit(m)
+}
+
+// dropIfUnchanged deletes the key of m if it still holds the value of m, so
+// a write made while the key was being moved is not lost.
+func (s *InMemoryStore) dropIfUnchanged(m Mutation) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if v, ok := s.store.get(m.Key); !ok || v != m.entry() {
+        return nil
+    }
+    return s.commit(Mutation{Op: OpDelete, Key: m.Key})
+}
+
+// capture returns a copy of every live key and the revision it reflects,
+// together with the WAL segment that holds all mutations made after the
+// copy. Holding the lock across the rotation and the copy makes them line
+// up exactly.
+func (s *InMemoryStore) capture() (uint64, uint64, map[string]ValueWithTTL, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var walSeq uint64
+    if s.wal != nil {
+        seq, err := s.wal.Rotate()
+        if err != nil {
+            return 0, 0, nil, fmt.Errorf("rotate WAL: %w", err)
+        }
+        walSeq = seq
+    }
+
+    return walSeq, s.rev, s.liveEntries(), nil
+}
+
+// copyEntries returns a copy of every live key and the revision it reflects.
+func (s *InMemoryStore) copyEntries() (uint64, map[string]ValueWithTTL) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.rev, s.liveEntries()
+}
+
+// liveEntries copies the keys that have not expired. The caller must hold
+// s.mu for writing.
+func (s *InMemoryStore) liveEntries() map[string]ValueWithTTL {
+    now := time.Now().UnixMilli()
+    entries := make(map[string]ValueWithTTL, s.store.len())
+    s.store.each(func(key string, v ValueWithTTL) bool {
+        if !v.expired(now) {
+            entries[key] = v
+        }
+        return true
+    })
+    return entries
+}
+
+// restore replaces the store contents with a snapshot taken at rev. Watchers
+// cannot resume from before rev anymore.
+func (s *InMemoryStore) restore(rev uint64, entries map[string]ValueWithTTL) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.store.reset(entries, s.limit.tracksAccess())
+    index := skiplist.New()
+    var used int64
+    for key, v := range entries {
+        index.Insert(key)
+        used += entrySize(key, v)
+        if v.Expiration > 0 {
+            s.expiry.Add(key, v.Expiration)
+        }
+    }
+    s.indexMu.Lock()
+    s.index = index
+    s.indexMu.Unlock()
+    s.used.Store(used)
+    s.commitMu.Lock()
+    defer s.commitMu.Unlock()
+    s.rev = rev
+    if s.changes != nil {
+        s.changes.reset(rev)
+    }
+}
+
+// applyChanges applies changes streamed from the leader, in order.
+func (s *InMemoryStore) applyChanges(changes []Change) {
+    if len(changes) == 0 {
+        return
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.commitMu.Lock()
+    defer s.commitMu.Unlock()
+    for _, c := range changes {
+        s.apply(c.Mutation)
+        s.rev = c.Rev
+        if s.changes != nil {
+            s.changes.append(c)
+        }
+    }
+}
+
+// revision returns the revision of the last applied mutation.
+func (s *InMemoryStore) revision() uint64 {
+    s.commitMu.Lock()
+    defer s.commitMu.Unlock()
+    return s.rev
+}
+
+// expire removes key if it is still expired once the write locks are held.
+// The removal is committed as an OpExpire so watchers and followers see it.
+// Followers drop the key silently and wait for the leader's OpExpire, and
+// Raft nodes leave it to the leader's Cleanup, since an expiration applied
+// on one node only would put the nodes out of step.
+func (s *InMemoryStore) expire(key string) {
+    if s.raft != nil {
+        return
+    }
+    unlock, shared := s.lockWrite(key)
+    defer unlock()
+    if v, ok := s.store.get(key); !ok || !v.expired(time.Now().UnixMilli()) {
+        return
+    }
+    if s.follower != nil {
+        s.deleteKey(key)
+        metrics.expired.Add(1)
+        return
+    }
+    if err := s.commitKey(Mutation{Op: OpExpire, Key: key}, shared); err != nil {
+        fmt.Println("Error expiring key:", err)
+        return
+    }
+    metrics.expired.Add(1)
+}
+
+// Cleanup removes the keys whose TTL has run out since the last call. The
+// timing wheel hands out only those keys, so the work is proportional to
+// the keys that expire rather than to the size of the store, and they are
+// removed expireBatchSize at a time so writers never wait long for the
+// lock. Each batch is committed as one batch of OpExpire mutations (see
+// expire). On Raft nodes only the leader removes keys; the others keep
+// the deadlines that are still current in case they become leader.
 func (s *InMemoryStore) Cleanup() {
+    start := time.Now()
+    defer func() { metrics.cleanup.observe(time.Since(start)) }()
+    // A key expires once the time is past its expiration, see expired.
+    due := s.expiry.Advance(time.Now().UnixMilli() - 1)
+    if s.raft != nil && s.raft.CheckRead() != nil {
+        s.keepDue(due) // not the leader
+        return
+    }
+    for len(due) > 0 {
+        n := min(len(due), expireBatchSize)
+        s.expireDue(due[:n])
+        due = due[n:]
+    }
+}
+
+// expireDue removes the keys of timers that are still expired. Keys whose
+// removal could not be committed are put back in the wheel for the next
+// Cleanup.
+func (s *InMemoryStore) expireDue(timers []timingwheel.Timer) {
+    var err error
+    var n int
+    if s.raft != nil {
+        s.proposeMu.Lock()
+        s.mu.Lock()
+        ms := s.expiredKeys(timers)
+        s.mu.Unlock()
+        if len(ms) > 0 {
+            err = s.raft.Propose(batchMutation(ms))
+        }
+        s.proposeMu.Unlock()
+        n = len(ms)
+    } else {
+        s.mu.Lock()
+        ms := s.expiredKeys(timers)
+        switch {
+        case len(ms) == 0:
+        case s.follower != nil:
+            for _, m := range ms {
+                s.deleteKey(m.Key)
+            }
+        default:
+            err = s.commit(batchMutation(ms))
+        }
+        s.mu.Unlock()
+        n = len(ms)
+    }
+    if err != nil {
+        fmt.Println("Error expiring keys:", err)
+        for _, t := range timers {
+            s.expiry.Add(t.Key, t.At)
+        }
+        return
+    }
+    metrics.expired.Add(uint64(n))
+}
+
+// keepDue puts the timers whose key still has that expiration back in the
+// wheel, to be handed out again by the next Cleanup.
+func (s *InMemoryStore) keepDue(timers []timingwheel.Timer) {
     s.mu.Lock()
     defer s.mu.Unlock()
-    now := time.Now().Unix()
-    for key, valueWithTTL := range s.store {
-        if valueWithTTL.Expiration > 0 && now > valueWithTTL.Expiration {
-            delete(s.store, key)
+    for _, t := range timers {
+        if v, ok := s.store.get(t.Key); ok && v.Expiration == t.At {
+            s.expiry.Add(t.Key, t.At)
         }
     }
 }
 
-// StartCleanupRoutine starts a background goroutine to periodically clean up expired keys.
-func (s *InMemoryStore) StartCleanupRoutine(interval time.Duration) {
-    go func() {
-        ticker := time.NewTicker(interval)
-        defer ticker.Stop()
-        for {
-            <-ticker.C
-            s.Cleanup() // Perform cleanup at regular intervals
+// expiredKeys returns an OpExpire for every key of timers that still has
+// the expiration of its timer and is expired. The caller must hold s.mu
+// for writing.
+func (s *InMemoryStore) expiredKeys(timers []timingwheel.Timer) []Mutation {
+    var ms []Mutation
+    now := time.Now().UnixMilli()
+    seen := make(map[string]struct{}, len(timers))
+    for _, t := range timers {
+        v, ok := s.store.get(t.Key)
+        if !ok || v.Expiration != t.At || !v.expired(now) {
+            continue // changed or removed since the timer was set
         }
-    }()
+        if _, dup := seen[t.Key]; !dup {
+            seen[t.Key] = struct{}{}
+            ms = append(ms, Mutation{Op: OpExpire, Key: t.Key})
+        }
+    }
+    return ms
+}
+
+// StartCleanupRoutine starts a background goroutine to periodically clean up expired keys.
+// Reads never return an expired key, so interval only bounds how long one stays in memory.
+// The returned stop ends it.
+func (s *InMemoryStore) StartCleanupRoutine(interval time.Duration) (stop func()) {
+    return every(interval, s.Cleanup)
 }
 
 // APIResponse represents a standard API response.
 type APIResponse struct {
-    Success bool        `json:"success"`
-    Data    interface{} `json:"data,omitempty"`
-    Error   string      `json:"error,omitempty"`
+    Success  bool        `json:"success"`
+    Data     interface{} `json:"data,omitempty"`
+    Error    string      `json:"error,omitempty"`
+    Revision uint64      `json:"revision,omitempty"`
 }
 
 // RPC request and response structures
 type RPCRequest struct {
-    Key   string `json:"key"`
-    Value string `json:"value,omitempty"`
-    TTL   int64  `json:"ttl"` // TTL in seconds
+    Key      string `json:"key"`
+    Value    string `json:"value,omitempty"`
+    TTL      int64  `json:"ttl"`                // TTL in seconds, 0 for no expiry
+    Delta    int64  `json:"delta,omitempty"`    // amount to add, for RPCIncr
+    Revision uint64 `json:"revision,omitempty"` // revision the key must have, for RPCCompareAndSwap
 }
 
 type RPCResponse struct {
-    Success bool   `json:"success"`
-    Data    string `json:"data,omitempty"`
-    Error   string `json:"error,omitempty"`
+    Success  bool   `json:"success"`
+    Data     string `json:"data,omitempty"`
+    Error    string `json:"error,omitempty"`
+    Leader   string `json:"leader,omitempty"`   // where to send writes rejected by a follower
+    Owner    string `json:"owner,omitempty"`    // node owning the key when it is not this one
+    Revision uint64 `json:"revision,omitempty"` // revision of the key after the call
+    Exists   bool   `json:"exists,omitempty"`   // whether the key held a value before the call
 }
 
 // RPC methods
 func (s *InMemoryStore) RPCSet(req *RPCRequest, resp *RPCResponse) error {
-    s.Set(req.Key, req.Value, req.TTL)
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    rev, err := s.setRevision(req.Key, req.Value, req.TTL)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
     resp.Success = true
+    resp.Revision = rev
     return nil
 }
 
 func (s *InMemoryStore) RPCGet(req *RPCRequest, resp *RPCResponse) error {
-    if value, exists := s.Get(req.Key); exists {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    if err := s.checkRead(); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    if v, exists, err := s.lookup(req.Key); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+    } else if exists {
         resp.Success = true
-        resp.Data = value
+        resp.Data = v.Value
+        resp.Revision = v.Revision
     } else {
         resp.Success = false
-        resp.Error = "Key not found or expired"
+        resp.Error = errKeyNotFound.Error()
     }
     return nil
 }
 
+// RPCDelete sets Exists when the key was there to delete.
 func (s *InMemoryStore) RPCDelete(req *RPCRequest, resp *RPCResponse) error {
-    s.Delete(req.Key)
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    existed, err := s.remove(req.Key)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    resp.Exists = existed
+    return nil
+}
+
+func (s *InMemoryStore) RPCSnapshot(req *RPCRequest, resp *RPCResponse) error {
+    if s.snapshots == nil {
+        resp.Success = false
+        resp.Error = "Snapshots are disabled"
+        return nil
+    }
+    info, err := s.snapshots.Take()
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
     resp.Success = true
+    resp.Data = info.File
+    return nil
+}
+
+// leaderAddr returns the RPC address of the node that takes writes when it
+// is not this one.
+func (s *InMemoryStore) leaderAddr() string {
+    addr, _, ok := s.leader()
+    if ok {
+        return ""
+    }
+    return addr
+}
+
+// leader returns the RPC and HTTP address of the node that takes writes and
+// whether that is this node.
+func (s *InMemoryStore) leader() (addr, httpAddr string, self bool) {
+    switch {
+    case s.raft != nil:
+        return s.raft.Leader()
+    case s.follower != nil:
+        return s.follower.leaderAddr, s.follower.LeaderHTTP(), false
+    default:
+        return "", "", true
+    }
+}
+
+// checkRead returns an error when reads must not be served here: in Raft
+// mode only a leader that still holds a majority serves them, so clients
+// never read a stale value. Followers of a plain leader serve reads.
+func (s *InMemoryStore) checkRead() error {
+    if s.raft != nil {
+        return s.raft.CheckRead()
+    }
     return nil
 }
 
+// route returns the node owning key and whether that is this node.
+func (s *InMemoryStore) route(key string) (owner string, local bool) {
+    if s.sharding == nil {
+        return "", true
+    }
+    owner = s.sharding.Owner(key)
+    return owner, owner == "" || owner == s.sharding.self
+}
+
+// movedTo answers an RPC for a key owned by another node with a MOVED error
+// naming the owner, and reports whether it did so.
+func (s *InMemoryStore) movedTo(key string, resp *RPCResponse) bool {
+    owner, local := s.route(key)
+    if local {
+        return false
+    }
+    resp.Success = false
+    resp.Error = "MOVED " + owner
+    resp.Owner = owner
+    return true
+}
+
 // HTTP handlers
+
+// redirectToLeader answers a request this node cannot serve with a redirect
+// to the leader and reports whether it did so.
+func (store *InMemoryStore) redirectToLeader(w http.ResponseWriter, r *http.Request) bool {
+    _, leader, self := store.leader()
+    if self {
+        return false
+    }
+    if leader == "" {
+        msg := errReadOnly.Error()
+        if store.raft != nil {
+            msg = (&NotLeaderError{}).Error()
+        }
+        w.WriteHeader(http.StatusServiceUnavailable)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: msg})
+        return true
+    }
+    // 307 keeps the method and body, so clients can simply follow it.
+    http.Redirect(w, r, scheme(r)+"://"+leader+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+    return true
+}
+
+// scheme returns the URL scheme r came in with, which the other nodes use
+// too.
+func scheme(r *http.Request) string {
+    if r.TLS != nil {
+        return "https"
+    }
+    return "http"
+}
+
+// setHandler serves /set, which PUT /keys/{key} replaces. Like it always
+// did, it takes any method.
 func (store *InMemoryStore) setHandler(w http.ResponseWriter, r *http.Request) {
+    if store.redirectToLeader(w, r) {
+        return
+    }
     var req struct {
         Key   string `json:"key"`
         Value string `json:"value"`
-        TTL   int64  `json:"ttl"` // TTL in seconds
+        TTL   int64  `json:"ttl"` // TTL in seconds, 0 or absent for no expiry
     }
+    store.limitBody(w, r, false)
     if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-        http.Error(w, "Invalid request", http.StatusBadRequest)
+        bodyError(w, err)
         return
     }
-    store.Set(req.Key, req.Value, req.TTL)
-    json.NewEncoder(w).Encode(APIResponse{Success: true})
+    deprecated(w, req.Key)
+    store.setKey(w, r, req.Key, req.Value, req.TTL)
 }
 
+// getHandler serves /get?key=, which GET /keys/{key} replaces. Like it
+// always did, it takes any method and answers a missing key with 200 and
+// success false.
 func (store *InMemoryStore) getHandler(w http.ResponseWriter, r *http.Request) {
     key := r.URL.Query().Get("key")
-    if value, exists := store.Get(key); exists {
-        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: value})
-    } else {
-        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: "Key not found or expired"})
-    }
+    deprecated(w, key)
+    store.readKey(w, r, key, false)
 }
 
+// deleteHandler serves /delete?key=, which DELETE /keys/{key} replaces.
+// Like it always did, it takes any method and answers success whether or
+// not the key existed.
 func (store *InMemoryStore) deleteHandler(w http.ResponseWriter, r *http.Request) {
     key := r.URL.Query().Get("key")
-    store.Delete(key)
-    json.NewEncoder(w).Encode(APIResponse{Success: true})
+    deprecated(w, key)
+    store.removeKey(w, r, key, false)
+}
+
+// snapshotHandler takes an on-demand snapshot (admin endpoint).
+func (store *InMemoryStore) snapshotHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCSnapshot", nil) {
+        return
+    }
+    if store.snapshots == nil {
+        w.WriteHeader(http.StatusServiceUnavailable)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: "Snapshots are disabled"})
+        return
+    }
+    info, err := store.snapshots.Take()
+    if err != nil {
+        w.WriteHeader(http.StatusInternalServerError)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: info})
 }
 
 func main() {
+    // mydb systemd-unit [flags] prints a service that runs mydb [flags]
+    if len(os.Args) > 1 && os.Args[1] == "systemd-unit" {
+        unit, err := systemdUnit(os.Args[2:])
+        if err != nil {
+            fmt.Println("Error in the configuration:")
+            fmt.Println(err)
+            os.Exit(2)
+        }
+        fmt.Print(unit)
+        return
+    }
+
+    cfg, err := LoadConfig(flag.CommandLine, os.Args[1:])
+    if err != nil {
+        fmt.Println("Error in the configuration:")
+        fmt.Println(err)
+        os.Exit(2)
+    }
+    if err := cfg.openLog(); err != nil {
+        fmt.Println("Error opening -log-file:", err)
+        os.Exit(1)
+    }
+
     store := NewInMemoryStore()
 
-    // Start the cleanup routine every 10 seconds
-    store.StartCleanupRoutine(10 * time.Second)
+    limit, _ := parseBytes(cfg.MaxMemory)
+    eviction, _ := parseEvictionPolicy(cfg.MaxMemoryPolicy)
+    store.limit = newMemoryLimit(limit, eviction)
+    store.maxBatch.Store(int64(cfg.MaxBatch))
+    store.maxKeySize.Store(int64(cfg.MaxKeySize))
+    maxValue, _ := parseBytes(cfg.MaxValueSize)
+    store.maxValueSize.Store(maxValue)
+    policy, _ := parseSlowPolicy(cfg.PubSubSlow)
+
+    var acl *ACL
+    if cfg.ACLFile != "" {
+        if acl, err = LoadACL(cfg.ACLFile); err != nil {
+            fmt.Println("Error loading -acl-file:", err)
+            return
+        }
+    }
+    if cfg.ClusterToken != "" {
+        rpcLogin = &LoginRequest{Token: cfg.ClusterToken}
+    }
+    var tlsConfig *tlsFiles
+    if cfg.TLSCert != "" || cfg.TLSKey != "" {
+        tlsConfig, err = newTLSFiles(TLSOptions{CertFile: cfg.TLSCert, KeyFile: cfg.TLSKey, CAFile: cfg.TLSCA, ClientAuth: cfg.TLSClientAuth})
+        if err != nil {
+            fmt.Println("Error loading TLS certificates:", err)
+            return
+        }
+        clusterTLS = tlsConfig
+    }
+    // Pick up renewed certificates on SIGHUP
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for range hup {
+            if tlsConfig == nil {
+                fmt.Println("Received SIGHUP, nothing to reload")
+            } else if err := tlsConfig.reload(); err != nil {
+                fmt.Println("Error reloading TLS certificates, keeping the old ones:", err)
+            } else {
+                fmt.Println("Reloaded TLS certificates")
+            }
+        }
+    }()
+
+    // A follower gets its data from the leader and a Raft node from its log,
+    // so both skip the standalone WAL and snapshots
+    replicaOf, walDir, snapshotDir := cfg.ReplicaOf, cfg.WALDir, cfg.SnapshotDir
+    if cfg.RaftID != "" {
+        replicaOf = ""
+    }
+    if replicaOf != "" || cfg.RaftID != "" {
+        walDir, snapshotDir = "", ""
+    }
+
+    // Load the newest snapshot, then replay the WAL written after it
+    var walFrom uint64
+    if snapshotDir != "" {
+        snapshots, err := NewSnapshotter(snapshotDir, cfg.SnapshotRetain, store)
+        if err != nil {
+            fmt.Println("Error opening snapshot directory:", err)
+            return
+        }
+        if walFrom, err = snapshots.LoadLatest(); err != nil {
+            fmt.Println("Error loading snapshot:", err)
+            return
+        }
+        store.snapshots = snapshots
+    }
+    if walDir != "" {
+        wal, err := OpenWAL(walDir, WALOptions{SegmentSize: cfg.WALSegmentSize, SyncOnWrite: cfg.WALSync}, walFrom, store.replay)
+        if err != nil {
+            fmt.Println("Error opening WAL:", err)
+            return
+        }
+        store.wal = wal
+    }
+    if store.wal != nil || store.snapshots != nil {
+        fmt.Printf("Recovered %d keys at revision %d\n", store.store.len(), store.rev)
+    }
+    store.changes = newChangeLog(store.rev, cfg.ReplBacklog)
+
+    stopSnapshots := func() {}
+    if store.snapshots != nil && cfg.SnapshotInterval > 0 {
+        stopSnapshots = store.snapshots.StartSnapshotRoutine(cfg.SnapshotInterval)
+    }
+
+    // Remove expired keys, taking only the keys that came due
+    stopCleanup := store.StartCleanupRoutine(cfg.ExpireInterval)
+
+    // Work out the commands per second for INFO
+    stopSampling := every(time.Second, metrics.sample)
 
     // Register the RPC service
     rpc.Register(store)
+    rpc.RegisterName("Auth", &authService{acl})
+    rpc.RegisterName("Stats", &statsService{store})
+
+    // Set up replication: run as a Raft member, follow a leader or serve followers
+    var repl *Replication
+    var follower *Follower
+    var raft *Raft
+    if cfg.RaftID != "" {
+        peers, err := parseRaftPeers(cfg.RaftPeers)
+        if err != nil {
+            fmt.Println("Error parsing -raft-peers:", err)
+            return
+        }
+        addr := cfg.RPCAddr
+        for _, p := range peers {
+            if p.ID == cfg.RaftID {
+                addr = p.Addr
+            }
+        }
+        advertise := cfg.AdvertiseHTTP
+        if advertise == "" {
+            advertise = cfg.HTTPAddr
+        }
+        raft, err = NewRaft(store, RaftOptions{
+            ID:                cfg.RaftID,
+            Addr:              addr,
+            HTTPAddr:          advertise,
+            Dir:               cfg.RaftDir,
+            Peers:             peers,
+            SnapshotThreshold: cfg.RaftSnapshotThreshold,
+        })
+        if err != nil {
+            fmt.Println("Error starting Raft:", err)
+            return
+        }
+        rpc.Register(raft)
+        raft.Start()
+        fmt.Printf("Raft node %s started with %d peers\n", cfg.RaftID, len(peers))
+    } else if replicaOf != "" {
+        id := cfg.NodeID
+        if id == "" {
+            host, _ := os.Hostname()
+            id = host + cfg.HTTPAddr
+        }
+        follower = NewFollower(store, id, replicaOf)
+        go follower.Run()
+        fmt.Println("Following leader at", replicaOf)
+    } else {
+        advertise := cfg.AdvertiseHTTP
+        if advertise == "" {
+            advertise = cfg.HTTPAddr
+        }
+        repl = NewReplication(store, advertise)
+        rpc.Register(repl)
+    }
+
+    // Spread keys over the shard nodes
+    var sharding *Sharding
+    if cfg.ShardNodes != "" {
+        self := cfg.ShardSelf
+        if self == "" {
+            self = cfg.RPCAddr
+        }
+        var nodes []string
+        for _, n := range strings.Split(cfg.ShardNodes, ",") {
+            if n = strings.TrimSpace(n); n != "" {
+                nodes = append(nodes, n)
+            }
+        }
+        var err error
+        sharding, err = NewSharding(store, self, nodes, cfg.ShardVNodes, cfg.ShardState)
+        if err != nil {
+            fmt.Println("Error starting sharding:", err)
+            return
+        }
+        rpc.Register(sharding)
+        fmt.Printf("Sharding as %s over %v\n", self, sharding.status().Nodes)
+    }
+
+    // Channels for publish/subscribe, independent of the keys
+    pubsub := NewPubSub(cfg.PubSubBuffer, policy)
+    stopReaper := pubsub.StartReaperRoutine(cfg.PubSubReapInterval)
+    rpc.Register(pubsub)
+
+    // Settings shown and changed with CONFIG GET and CONFIG SET
+    settings := NewSettings(flag.CommandLine, cfg, store, pubsub)
+    rpc.RegisterName("Config", settings)
 
     // Start the HTTP server
+    http.HandleFunc("/keys/", store.keysHandler)
+    http.HandleFunc("/openapi.json", openAPIHandler)
     http.HandleFunc("/set", store.setHandler)
     http.HandleFunc("/get", store.getHandler)
     http.HandleFunc("/delete", store.deleteHandler)
+    http.HandleFunc("/mget", store.mgetHandler)
+    http.HandleFunc("/mset", store.msetHandler)
+    http.HandleFunc("/mdel", store.mdelHandler)
+    http.HandleFunc("/expire", store.expireHandler)
+    http.HandleFunc("/persist", store.persistHandler)
+    http.HandleFunc("/ttl", store.ttlHandler)
+    http.HandleFunc("/incr", store.incrHandler(1))
+    http.HandleFunc("/decr", store.incrHandler(-1))
+    http.HandleFunc("/setnx", store.setNXHandler)
+    http.HandleFunc("/getset", store.getSetHandler)
+    http.HandleFunc("/cas", store.casHandler)
+    http.HandleFunc("/txn", store.txnHandler)
+    http.HandleFunc("/command", store.commandHandler)
+    http.HandleFunc("/scan", store.scanHandler(false))
+    http.HandleFunc("/range", store.scanHandler(true))
+    http.HandleFunc("/count", store.countHandler)
+    http.HandleFunc("/watch", store.watchHandler)
+    http.HandleFunc("/publish", pubsub.publishHandler)
+    http.HandleFunc("/subscribe", pubsub.subscribeHandler)
+    http.HandleFunc("/pubsub/stats", pubsub.statsHandler)
+    http.HandleFunc("/memory/stats", store.memoryStatsHandler)
+    http.HandleFunc("/snapshot", store.snapshotHandler)
+    http.HandleFunc("/config", settings.handler)
+    http.HandleFunc("/info", store.infoHandler)
+    http.HandleFunc("/metrics", store.metricsHandler)
+    http.HandleFunc("/replication/status", replicationStatusHandler(repl, follower))
+    if raft != nil {
+        http.HandleFunc("/raft/status", raft.statusHandler)
+        http.HandleFunc("/raft/members", raft.membersHandler)
+    }
+    if sharding != nil {
+        http.HandleFunc("/shards", sharding.statusHandler)
+        http.HandleFunc("/shards/nodes", sharding.nodesHandler)
+    }
+
+    // Stop on SIGTERM or Ctrl-C, see below
+    stop := make(chan os.Signal, 2)
+    signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
 
     // Start the RPC server
+    rpcListener, err := listen(cfg.RPCAddr, tlsConfig)
+    if err != nil {
+        fmt.Println("Error starting RPC server:", err)
+        return
+    }
+    rpcConns := newConnSet()
+    serveRPC := func(conn net.Conn) { acl.serveRPC(conn, cfg.MaxPipeline) }
     go func() {
-        rpcListener, err := net.Listen("tcp", ":1234")
-        if err != nil {
-            fmt.Println("Error starting RPC server:", err)
-            return
-        }
-        defer rpcListener.Close()
-        fmt.Println("RPC server is listening on port 1234...")
+        fmt.Printf("RPC server is listening on %s...\n", cfg.RPCAddr)
         for {
             conn, err := rpcListener.Accept()
+            if errors.Is(err, net.ErrClosed) {
+                return
+            }
             if err != nil {
                 fmt.Println("Error accepting connection:", err)
                 continue
             }
-            go rpc.ServeConn(conn) // Handle each RPC connection in a new goroutine
+            go rpcConns.serve(conn, serveRPC) // Handle each RPC connection in a new goroutine
         }
     }()
 
-    fmt.Println("Starting HTTP server on :6060")
-    if err := http.ListenAndServe(":6060", nil); err != nil {
+    // Start the RESP server for Redis clients
+    var respServer *RESPServer
+    if cfg.RESPAddr != "" {
+        respListener, err := listen(cfg.RESPAddr, tlsConfig)
+        if err != nil {
+            fmt.Println("Error starting RESP server:", err)
+            return
+        }
+        respServer = NewRESPServer(store, acl)
+        respServer.settings = settings
+        go func() {
+            fmt.Printf("RESP server is listening on %s...\n", cfg.RESPAddr)
+            if err := respServer.Serve(respListener); err != nil {
+                fmt.Println("Error serving RESP:", err)
+            }
+        }()
+    }
+
+    // Streams such as /watch and /subscribe, and their gRPC counterparts,
+    // end when requests is cancelled
+    requests, cancelRequests := context.WithCancel(context.Background())
+
+    // Start the gRPC server
+    var grpcServer *grpc.Server
+    if cfg.GRPCAddr != "" {
+        grpcListener, err := net.Listen("tcp", cfg.GRPCAddr)
+        if err != nil {
+            fmt.Println("Error starting gRPC server:", err)
+            return
+        }
+        grpcServer = newGRPCServer(&grpcService{store: store, pubsub: pubsub, settings: settings, acl: acl, requests: requests}, tlsConfig)
+        go func() {
+            fmt.Printf("gRPC server is listening on %s...\n", cfg.GRPCAddr)
+            if err := grpcServer.Serve(grpcListener); err != nil {
+                fmt.Println("Error serving gRPC:", err)
+            }
+        }()
+    }
+
+    var handler http.Handler = http.DefaultServeMux
+    if acl != nil {
+        handler = acl.protect(handler)
+    }
+    handler = metrics.instrument(http.DefaultServeMux, jsonByDefault(handler))
+    httpListener, err := listen(cfg.HTTPAddr, tlsConfig)
+    if err != nil {
         fmt.Println("Error starting server:", err)
+        return
+    }
+    httpServer := &http.Server{
+        Handler:     handler,
+        BaseContext: func(net.Listener) context.Context { return requests },
+        ConnState:   metrics.countHTTPClients,
+    }
+    go func() {
+        fmt.Println("Starting HTTP server on", cfg.HTTPAddr)
+        if err := httpServer.Serve(httpListener); err != http.ErrServerClosed {
+            fmt.Println("Error serving HTTP:", err)
+            stop <- syscall.SIGTERM
+        }
+    }()
+
+    // Shut down in order: stop taking connections and requests, let the
+    // requests in progress finish, stop the background work and flush the
+    // WAL. A second signal exits at once.
+    sig := <-stop
+    fmt.Printf("Received %v, shutting down (at most %v)...\n", sig, cfg.ShutdownTimeout)
+    go func() {
+        <-stop
+        fmt.Println("Received a second signal, exiting now")
+        os.Exit(1)
+    }()
+    ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+    defer cancel()
+    rpcListener.Close()
+    if respServer != nil {
+        respServer.Close()
+    }
+    cancelRequests()
+    var drain sync.WaitGroup
+    drain.Add(4)
+    go func() {
+        defer drain.Done()
+        if err := httpServer.Shutdown(ctx); err != nil {
+            fmt.Println("HTTP requests still running were cut off:", err)
+        }
+    }()
+    go func() {
+        defer drain.Done()
+        if err := rpcConns.drain(ctx); err != nil {
+            fmt.Println("RPC calls still running were cut off:", err)
+        }
+    }()
+    go func() {
+        defer drain.Done()
+        if respServer == nil {
+            return
+        }
+        if err := respServer.conns.drain(ctx); err != nil {
+            fmt.Println("RESP commands still running were cut off:", err)
+        }
+    }()
+    go func() {
+        defer drain.Done()
+        if grpcServer == nil {
+            return
+        }
+        stopped := make(chan struct{})
+        go func() {
+            grpcServer.GracefulStop()
+            close(stopped)
+        }()
+        select {
+        case <-stopped:
+        case <-ctx.Done():
+            grpcServer.Stop()
+            fmt.Println("gRPC calls still running were cut off:", ctx.Err())
+        }
+    }()
+    drain.Wait()
+
+    stopCleanup()
+    stopSampling()
+    stopSnapshots()
+    stopReaper()
+    if sharding != nil {
+        sharding.Stop()
+    }
+    if follower != nil {
+        follower.Stop()
+    }
+    if raft != nil {
+        if err := raft.Stop(); err != nil {
+            fmt.Println("Error closing the Raft log:", err)
+        }
+    }
+    if store.wal != nil {
+        if err := store.wal.Close(); err != nil {
+            fmt.Println("Error closing WAL:", err)
+            os.Exit(1)
+        }
     }
+    fmt.Println("Shutdown complete")
 }
@@ -0,0 +1,332 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/rand"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    entryOverhead    = 96 // rough bytes a key costs beyond its key and value: map slot, ValueWithTTL, index node
+    elementOverhead  = 16 // rough bytes each element of a collection costs beyond its contents
+    evictionSamples  = 5  // keys compared to pick each one to evict
+    lfuInitialCount  = 5  // counter of a new key, so it is not evicted right away
+    lfuLogFactor     = 10 // the higher, the more hits it takes to raise the counter
+    lfuDecayInterval = time.Minute
+)
+
+// errOOM is returned for writes that do not fit in the memory limit.
+var errOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'")
+
+// evictionPolicy decides which keys go when a write would take the store
+// over its memory limit.
+type evictionPolicy string
+
+const (
+    evictNone   evictionPolicy = "noeviction"     // reject the write
+    evictLRU    evictionPolicy = "allkeys-lru"    // the least recently used keys
+    evictLFU    evictionPolicy = "allkeys-lfu"    // the least frequently used keys
+    evictTTL    evictionPolicy = "volatile-ttl"   // the keys with a TTL that expire soonest
+    evictRandom evictionPolicy = "allkeys-random" // any keys
+)
+
+func parseEvictionPolicy(s string) (evictionPolicy, error) {
+    switch p := evictionPolicy(strings.ToLower(s)); p {
+    case evictNone, evictLRU, evictLFU, evictTTL, evictRandom:
+        return p, nil
+    }
+    return "", fmt.Errorf("ERR unknown eviction policy %q, use noeviction, allkeys-lru, allkeys-lfu, volatile-ttl or allkeys-random", s)
+}
+
+// parseBytes parses a memory size such as 1048576, 512kb, 100mb or 2gb.
+func parseBytes(s string) (int64, error) {
+    s = strings.ToLower(strings.TrimSpace(s))
+    unit := int64(1)
+    for _, u := range []struct {
+        suffix string
+        size   int64
+    }{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1}} {
+        if strings.HasSuffix(s, u.suffix) {
+            s, unit = strings.TrimSuffix(s, u.suffix), u.size
+            break
+        }
+    }
+    n, err := strconv.ParseInt(s, 10, 64)
+    if err != nil || n < 0 {
+        return 0, fmt.Errorf("invalid memory size %q", s)
+    }
+    return n * unit, nil
+}
+
+// formatBytes renders n the way Redis renders used_memory_human.
+func formatBytes(n int64) string {
+    switch {
+    case n >= 1<<30:
+        return fmt.Sprintf("%.2fG", float64(n)/(1<<30))
+    case n >= 1<<20:
+        return fmt.Sprintf("%.2fM", float64(n)/(1<<20))
+    case n >= 1<<10:
+        return fmt.Sprintf("%.2fK", float64(n)/(1<<10))
+    default:
+        return fmt.Sprintf("%dB", n)
+    }
+}
+
+// keyAccess records how a key is used, for the LRU and LFU policies. It is
+// updated by readers holding only the read lock of the key's shard, hence
+// the atomics.
+type keyAccess struct {
+    last  atomic.Int64  // Unix nanoseconds of the last read or write
+    count atomic.Uint32 // logarithmic access counter, see touch
+}
+
+// counter returns the access counter decayed by one for every
+// lfuDecayInterval the key went unused.
+func (a *keyAccess) counter(now int64) uint32 {
+    c := a.count.Load()
+    idle := uint32((now - a.last.Load()) / int64(lfuDecayInterval))
+    if idle >= c {
+        return 0
+    }
+    return c - idle
+}
+
+// touch records an access. Like the Redis LFU counter, the counter grows
+// with the logarithm of the number of accesses, so it tells hot keys from
+// cold ones without overflowing, and it decays while the key is unused.
+func (a *keyAccess) touch(now int64) {
+    c := a.counter(now)
+    base := float64(0)
+    if c > lfuInitialCount {
+        base = float64(c - lfuInitialCount)
+    }
+    if c < 255 && rand.Float64() < 1/(base*lfuLogFactor+1) {
+        c++
+    }
+    a.count.Store(c)
+    a.last.Store(now)
+}
+
+// memoryLimit keeps the store within max bytes, as estimated by entrySize,
+// by rejecting or evicting according to policy. A max of 0 means no limit.
+// Both can be changed while the server runs (CONFIG SET); the next write
+// that needs room goes by the new ones.
+type memoryLimit struct {
+    maxBytes atomic.Int64
+    evict    atomic.Value // evictionPolicy
+
+    evicted  atomic.Uint64 // keys evicted to make room
+    rejected atomic.Uint64 // writes rejected with errOOM
+}
+
+func newMemoryLimit(max int64, policy evictionPolicy) *memoryLimit {
+    l := &memoryLimit{}
+    l.set(max, policy)
+    return l
+}
+
+func (l *memoryLimit) max() int64 {
+    return l.maxBytes.Load()
+}
+
+func (l *memoryLimit) policy() evictionPolicy {
+    return l.evict.Load().(evictionPolicy)
+}
+
+// set changes the limit and the policy. Keys written while neither LRU nor
+// LFU was in use have no record of their use and go first under them.
+func (l *memoryLimit) set(max int64, policy evictionPolicy) {
+    l.maxBytes.Store(max)
+    l.evict.Store(policy)
+}
+
+// tracksAccess reports whether the policy needs to know how each key is
+// used, which the store then records next to the key (see shardedMap).
+func (l *memoryLimit) tracksAccess() bool {
+    policy := l.policy()
+    return l.max() > 0 && (policy == evictLRU || policy == evictLFU)
+}
+
+// entrySize estimates the bytes key and v take in the store.
+func entrySize(key string, v ValueWithTTL) int64 {
+    size := int64(len(key) + len(v.Value) + entryOverhead)
+    if v.coll != nil {
+        size += int64(v.coll.size())
+    }
+    return size
+}
+
+// growth estimates by how many bytes applying m changes the memory used.
+// The caller must hold s.mu for writing.
+func (s *InMemoryStore) growth(m Mutation) int64 {
+    var n int64
+    switch m.Op {
+    case OpSet, OpUpdate:
+        old, ok := s.store.get(m.Key)
+        v, _ := m.result(old, ok, time.Now().UnixMilli())
+        n = entrySize(m.Key, v)
+        if ok {
+            n -= entrySize(m.Key, old)
+        }
+    case OpDelete, OpExpire, OpEvict:
+        if v, ok := s.store.get(m.Key); ok {
+            n = -entrySize(m.Key, v)
+        }
+    case OpBatch:
+        for _, op := range m.ops() {
+            n += s.growth(op)
+        }
+    }
+    return n
+}
+
+// makeRoom evicts keys so that m fits in the memory limit, or returns
+// errOOM when the policy is noeviction or nothing more can be evicted.
+// Evictions are made like any other write, as one batch of OpEvict, so
+// followers, raft peers and watchers see them. In standalone mode the
+// caller holds s.mu for writing and the batch is committed right before m;
+// in Raft mode the caller holds s.proposeMu and the batch is proposed.
+func (s *InMemoryStore) makeRoom(m Mutation) error {
+    if s.limit == nil || s.limit.max() == 0 {
+        return nil
+    }
+    if s.raft != nil {
+        s.mu.Lock()
+    }
+    victims, err := s.victims(m)
+    if s.raft != nil {
+        s.mu.Unlock()
+    }
+    if err != nil || len(victims) == 0 {
+        return err
+    }
+    evict := batchMutation(victims)
+    if s.raft != nil {
+        err = s.raft.Propose(evict)
+    } else {
+        err = s.commit(evict)
+    }
+    if err == nil {
+        s.limit.evicted.Add(uint64(len(victims)))
+    }
+    return err
+}
+
+// victims returns an OpEvict for each key to evict before m. Writes that
+// do not grow the store, such as deletes, always go through. The caller
+// must hold s.mu for writing.
+func (s *InMemoryStore) victims(m Mutation) ([]Mutation, error) {
+    grow := s.growth(m)
+    need := s.used.Load() + grow - s.limit.max()
+    if grow <= 0 || need <= 0 {
+        return nil, nil
+    }
+    policy := s.limit.policy()
+    if policy == evictNone {
+        s.limit.rejected.Add(1)
+        return nil, errOOM
+    }
+    // The keys m writes are never evicted for it.
+    skip := make(map[string]struct{})
+    if m.Op == OpBatch {
+        for _, op := range m.ops() {
+            skip[op.Key] = struct{}{}
+        }
+    } else {
+        skip[m.Key] = struct{}{}
+    }
+    var ms []Mutation
+    for need > 0 {
+        key, ok := s.pickVictim(policy, skip)
+        if !ok {
+            s.limit.rejected.Add(1)
+            return nil, errOOM
+        }
+        skip[key] = struct{}{}
+        v, _ := s.store.get(key)
+        need -= entrySize(key, v)
+        ms = append(ms, Mutation{Op: OpEvict, Key: key})
+    }
+    return ms, nil
+}
+
+// pickVictim picks the key to evict next: like Redis, it samples a few keys
+// and takes the best candidate among them rather than keeping the keys
+// sorted. The keys are visited from a random place, which makes the sample.
+// volatile-ttl samples only the keys with a TTL, which the shards keep
+// apart, so it does not walk past the others. The caller must hold s.mu
+// for writing.
+func (s *InMemoryStore) pickVictim(policy evictionPolicy, skip map[string]struct{}) (string, bool) {
+    now := time.Now().UnixNano()
+    var best string
+    var bestScore int64
+    found := 0
+    visit := func(key string, v ValueWithTTL) bool {
+        if _, ok := skip[key]; ok {
+            return true
+        }
+        var score int64 // lowest goes first
+        switch policy {
+        case evictLRU:
+            if a, ok := s.store.access(key); ok {
+                score = a.last.Load()
+            }
+        case evictLFU:
+            if a, ok := s.store.access(key); ok {
+                score = int64(a.counter(now))
+            }
+        case evictTTL:
+            score = v.Expiration
+        }
+        if found == 0 || score < bestScore {
+            best, bestScore = key, score
+        }
+        found++
+        return found < evictionSamples && policy != evictRandom
+    }
+    if policy == evictTTL {
+        s.store.eachVolatile(visit)
+    } else {
+        s.store.each(visit)
+    }
+    return best, found > 0
+}
+
+// MemoryStats reports the memory used by the keys and what the limit did
+// since the server started.
+type MemoryStats struct {
+    UsedMemory     int64          `json:"used_memory"`
+    MaxMemory      int64          `json:"maxmemory"` // 0 when there is no limit
+    Policy         evictionPolicy `json:"maxmemory_policy"`
+    EvictedKeys    uint64         `json:"evicted_keys"`
+    RejectedWrites uint64         `json:"rejected_writes"` // writes refused with an OOM error
+}
+
+func (s *InMemoryStore) memoryStats() MemoryStats {
+    return MemoryStats{
+        UsedMemory:     s.used.Load(),
+        MaxMemory:      s.limit.max(),
+        Policy:         s.limit.policy(),
+        EvictedKeys:    s.limit.evicted.Load(),
+        RejectedWrites: s.limit.rejected.Load(),
+    }
+}
+
+func (s *InMemoryStore) RPCMemoryStats(req *struct{}, resp *MemoryStats) error {
+    *resp = s.memoryStats()
+    return nil
+}
+
+// memoryStatsHandler serves GET /memory/stats.
+func (store *InMemoryStore) memoryStatsHandler(w http.ResponseWriter, r *http.Request) {
+    if !authorized(w, r, "InMemoryStore.RPCMemoryStats", nil) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: store.memoryStats()})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+    "fmt"
+    "strings"
+    "testing"
+)
+
+func TestEviction(t *testing.T) {
+    value := strings.Repeat("v", 100)
+    size := entrySize("k0", ValueWithTTL{Value: value})
+    for _, tt := range []struct {
+        policy  evictionPolicy
+        prepare func(s *InMemoryStore) // after k0 to k3 are set
+        evicted string                 // "" for any key, "-" for none
+    }{
+        {evictNone, nil, "-"},
+        {evictLRU, func(s *InMemoryStore) {
+            for _, key := range []string{"k3", "k0", "k2"} {
+                s.Get(key)
+            }
+        }, "k1"},
+        {evictLFU, func(s *InMemoryStore) {
+            for i := 0; i < 200; i++ {
+                for _, key := range []string{"k0", "k1", "k3"} {
+                    s.Get(key)
+                }
+            }
+        }, "k2"},
+        {evictTTL, func(s *InMemoryStore) {
+            s.Expire("k0", 200)
+            s.Expire("k3", 100)
+        }, "k3"},
+        {evictRandom, nil, ""},
+    } {
+        t.Run(string(tt.policy), func(t *testing.T) {
+            // Room for four keys: the keys sampled for the fifth are all
+            // there are, so the policy alone picks the one to evict.
+            s := NewInMemoryStore()
+            s.limit = newMemoryLimit(4*size+size/2, tt.policy)
+            for i := 0; i < 4; i++ {
+                if err := s.Set(fmt.Sprint("k", i), value, 0); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            if tt.prepare != nil {
+                tt.prepare(s)
+            }
+
+            err := s.Set("k4", value, 0)
+            var gone []string
+            for i := 0; i < 5; i++ {
+                if _, _, ok := s.Get(fmt.Sprint("k", i)); !ok {
+                    gone = append(gone, fmt.Sprint("k", i))
+                }
+            }
+            stats := s.memoryStats()
+            if stats.UsedMemory > stats.MaxMemory {
+                t.Fatalf("using %d bytes of %d", stats.UsedMemory, stats.MaxMemory)
+            }
+            switch tt.evicted {
+            case "-":
+                if err != errOOM || len(gone) != 1 || gone[0] != "k4" || stats.RejectedWrites != 1 {
+                    t.Fatalf("write over the limit: %v, missing %v, %+v", err, gone, stats)
+                }
+                // Writes that free memory still go through.
+                if err := s.Delete("k0"); err != nil {
+                    t.Fatal(err)
+                }
+                if err := s.Set("k4", value, 0); err != nil {
+                    t.Fatalf("write after a delete: %v", err)
+                }
+            default:
+                if err != nil || len(gone) != 1 || stats.EvictedKeys != 1 {
+                    t.Fatalf("write over the limit: %v, evicted %v, %+v", err, gone, stats)
+                }
+                if gone[0] == "k4" || tt.evicted != "" && gone[0] != tt.evicted {
+                    t.Fatalf("evicted %s, want %s", gone[0], tt.evicted)
+                }
+            }
+        })
+    }
+
+    // Under volatile-ttl, keys without a TTL are never evicted.
+    s := NewInMemoryStore()
+    s.limit = newMemoryLimit(size+size/2, evictTTL)
+    s.Set("k0", value, 0)
+    if err := s.Set("k1", value, 0); err != errOOM {
+        t.Fatalf("volatile-ttl with no key to evict: %v", err)
+    }
+
+    // It samples only the keys with a TTL, which are tracked as they gain
+    // and lose one.
+    s = NewInMemoryStore()
+    for i := 0; i < 1000; i++ {
+        s.Set(fmt.Sprint("k", i), value, 0)
+    }
+    s.Set("ttl", value, 100)
+    s.Set("persisted", value, 100)
+    s.Persist("persisted")
+    s.Set("overwritten", value, 100)
+    s.Set("overwritten", value, 0)
+    s.Set("deleted", value, 100)
+    s.Delete("deleted")
+    if keys := volatileKeys(s); len(keys) != 1 || keys[0] != "ttl" {
+        t.Fatalf("keys with a TTL: %v", keys)
+    }
+    s.limit.set(s.memoryStats().UsedMemory+size/2, evictTTL)
+    if err := s.Set("new", value, 0); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, ok := s.Get("ttl"); ok || len(volatileKeys(s)) != 0 {
+        t.Fatalf("the key with a TTL was not evicted: %v", volatileKeys(s))
+    }
+}
+
+// volatileKeys returns the keys volatile-ttl eviction samples from.
+func volatileKeys(s *InMemoryStore) []string {
+    var keys []string
+    s.store.eachVolatile(func(key string, _ ValueWithTTL) bool {
+        keys = append(keys, key)
+        return true
+    })
+    return keys
+}
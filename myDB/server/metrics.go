@@ -0,0 +1,595 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "math"
+    "net"
+    "net/http"
+    "os"
+    "runtime"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// metrics counts what the server does. It is read by /metrics (Prometheus
+// text format), /info (JSON), INFO over RESP and the Stats.Info RPC call.
+var metrics = newMetricsRegistry()
+
+// startTime is when the process started, for the uptime.
+var startTime = time.Now()
+
+// latencyBuckets are the upper bounds, in seconds, of the buckets of the
+// command and cleanup duration histograms.
+var latencyBuckets = []float64{0.0001, 0.00025, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// histogram counts durations into latencyBuckets.
+type histogram struct {
+    buckets []atomic.Uint64 // observations up to each bound, not cumulative
+    count   atomic.Uint64
+    sum     atomic.Int64 // nanoseconds
+}
+
+func newHistogram() *histogram {
+    return &histogram{buckets: make([]atomic.Uint64, len(latencyBuckets))}
+}
+
+func (h *histogram) observe(d time.Duration) {
+    i := sort.SearchFloat64s(latencyBuckets, d.Seconds())
+    if i < len(h.buckets) {
+        h.buckets[i].Add(1)
+    }
+    h.count.Add(1)
+    h.sum.Add(int64(d))
+}
+
+// commandKey names a command: protocol is rpc, resp or http, and command
+// the RPC method, RESP command or HTTP path.
+type commandKey struct {
+    protocol string
+    command  string
+}
+
+type commandStats struct {
+    calls    atomic.Uint64
+    failed   atomic.Uint64 // answered with an error, including refused ones
+    duration *histogram
+    rate     atomic.Uint64 // calls per second in the last sample, as float64 bits
+    sampled  uint64        // calls at the last sample, used by sample only
+}
+
+type metricsRegistry struct {
+    mu       sync.RWMutex
+    commands map[commandKey]*commandStats
+
+    hits    atomic.Uint64 // reads that found their key
+    misses  atomic.Uint64 // reads that did not
+    expired atomic.Uint64 // keys removed because their TTL ran out
+    cleanup *histogram    // duration of each Cleanup pass
+
+    rpcClients  atomic.Int64
+    respClients atomic.Int64
+    httpClients atomic.Int64
+    grpcClients atomic.Int64
+
+    sampleMu  sync.Mutex
+    sampledAt time.Time
+    opsPerSec atomic.Uint64 // float64 bits, see sample
+}
+
+func newMetricsRegistry() *metricsRegistry {
+    return &metricsRegistry{
+        commands:  make(map[commandKey]*commandStats),
+        cleanup:   newHistogram(),
+        sampledAt: time.Now(),
+    }
+}
+
+// observe records one command that took d.
+func (m *metricsRegistry) observe(protocol, command string, d time.Duration, failed bool) {
+    key := commandKey{protocol, command}
+    m.mu.RLock()
+    cs := m.commands[key]
+    m.mu.RUnlock()
+    if cs == nil {
+        m.mu.Lock()
+        if cs = m.commands[key]; cs == nil {
+            cs = &commandStats{duration: newHistogram()}
+            m.commands[key] = cs
+        }
+        m.mu.Unlock()
+    }
+    cs.calls.Add(1)
+    if failed {
+        cs.failed.Add(1)
+    }
+    cs.duration.observe(d)
+}
+
+// read counts a read of a key for the hit ratio.
+func (m *metricsRegistry) read(found bool) {
+    if found {
+        m.hits.Add(1)
+    } else {
+        m.misses.Add(1)
+    }
+}
+
+// sample works out the commands per second since the last sample, in
+// total and per command. It runs every second, see main.
+func (m *metricsRegistry) sample() {
+    m.sampleMu.Lock()
+    defer m.sampleMu.Unlock()
+    now := time.Now()
+    elapsed := now.Sub(m.sampledAt).Seconds()
+    m.sampledAt = now
+    if elapsed <= 0 {
+        return
+    }
+    total := 0.0
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    for _, cs := range m.commands {
+        calls := cs.calls.Load()
+        rate := float64(calls-cs.sampled) / elapsed
+        cs.sampled = calls
+        cs.rate.Store(math.Float64bits(rate))
+        total += rate
+    }
+    m.opsPerSec.Store(math.Float64bits(total))
+}
+
+// sorted returns the commands seen so far in a stable order.
+func (m *metricsRegistry) sorted() ([]commandKey, []*commandStats) {
+    m.mu.RLock()
+    defer m.mu.RUnlock()
+    keys := make([]commandKey, 0, len(m.commands))
+    for k := range m.commands {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool {
+        if keys[i].protocol != keys[j].protocol {
+            return keys[i].protocol < keys[j].protocol
+        }
+        return keys[i].command < keys[j].command
+    })
+    stats := make([]*commandStats, len(keys))
+    for i, k := range keys {
+        stats[i] = m.commands[k]
+    }
+    return keys, stats
+}
+
+// instrument records every request to mux by the pattern that serves it,
+// as failed when the status is 400 or more. next is mux with whatever
+// wraps it, such as the ACL check.
+func (m *metricsRegistry) instrument(mux *http.ServeMux, next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        _, pattern := mux.Handler(r)
+        if pattern == "" {
+            pattern = "other" // keeps unknown paths from making up labels
+        }
+        rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+        start := time.Now()
+        next.ServeHTTP(rec, r)
+        m.observe("http", pattern, time.Since(start), rec.status >= 400)
+    })
+}
+
+// countHTTPClients is the ConnState hook of the HTTP server.
+func (m *metricsRegistry) countHTTPClients(_ net.Conn, state http.ConnState) {
+    switch state {
+    case http.StateNew:
+        m.httpClients.Add(1)
+    case http.StateClosed, http.StateHijacked:
+        m.httpClients.Add(-1)
+    }
+}
+
+// statusRecorder remembers the status a handler answered with. It passes
+// Flush on, which the /watch and /subscribe streams need.
+type statusRecorder struct {
+    http.ResponseWriter
+    status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+    r.status = status
+    r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Flush() {
+    if f, ok := r.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+    return r.ResponseWriter
+}
+
+// Info is the state of the server as /info reports it.
+type Info struct {
+    Server      ServerInfo      `json:"server"`
+    Clients     ClientsInfo     `json:"clients"`
+    Memory      MemoryInfo      `json:"memory"`
+    Stats       StatsInfo       `json:"stats"`
+    Persistence PersistenceInfo `json:"persistence"`
+    Replication ReplicationInfo `json:"replication"`
+    Keyspace    KeyspaceInfo    `json:"keyspace"`
+    Commands    []CommandInfo   `json:"commands"`
+}
+
+type ServerInfo struct {
+    PID           int    `json:"process_id"`
+    UptimeSeconds int64  `json:"uptime_in_seconds"`
+    GoVersion     string `json:"go_version"`
+    Goroutines    int    `json:"goroutines"`
+    port          string // of the RESP server, for INFO
+}
+
+type ClientsInfo struct {
+    RPC  int64 `json:"rpc"`
+    RESP int64 `json:"resp"`
+    HTTP int64 `json:"http"`
+    GRPC int64 `json:"grpc"`
+}
+
+type MemoryInfo struct {
+    MemoryStats
+    HeapBytes uint64 `json:"heap_bytes"` // Go heap in use, keys and everything else
+    SysBytes  uint64 `json:"sys_bytes"`  // memory obtained from the OS
+}
+
+type StatsInfo struct {
+    TotalCommands  uint64  `json:"total_commands_processed"`
+    OpsPerSec      float64 `json:"instantaneous_ops_per_sec"`
+    KeyspaceHits   uint64  `json:"keyspace_hits"`
+    KeyspaceMisses uint64  `json:"keyspace_misses"`
+    ExpiredKeys    uint64  `json:"expired_keys"`
+    CleanupRuns    uint64  `json:"cleanup_runs"`
+    CleanupSeconds float64 `json:"cleanup_seconds"` // spent in all runs together
+}
+
+// PersistenceInfo tells how far the disk is behind memory: WAL records
+// written but not yet fsynced (with -wal-sync=false), and the changes a
+// restart would replay on top of the last snapshot.
+type PersistenceInfo struct {
+    WAL                  bool   `json:"wal_enabled"`
+    WALUnsyncedBytes     int64  `json:"wal_unsynced_bytes"`
+    Snapshots            bool   `json:"snapshots_enabled"`
+    ChangesSinceSnapshot uint64 `json:"changes_since_last_snapshot"`
+    LastSnapshot         int64  `json:"last_snapshot_time,omitempty"` // Unix seconds
+}
+
+// ReplicationInfo gives the role of the node and, on a follower or Raft
+// member, how many changes it has yet to apply.
+type ReplicationInfo struct {
+    Role     string `json:"role"` // leader, follower or the Raft role
+    Revision uint64 `json:"revision"`
+    Leader   string `json:"leader,omitempty"`
+    Lag      uint64 `json:"lag"`
+}
+
+type KeyspaceInfo struct {
+    Keys    int `json:"keys"`
+    Expires int `json:"expires"`
+}
+
+type CommandInfo struct {
+    Protocol    string  `json:"protocol"`
+    Command     string  `json:"command"`
+    Calls       uint64  `json:"calls"`
+    Failed      uint64  `json:"failed_calls"`
+    OpsPerSec   float64 `json:"ops_per_sec"`
+    UsecPerCall float64 `json:"usec_per_call"`
+}
+
+// info gathers the Info of the server.
+func (s *InMemoryStore) info() Info {
+    var mem runtime.MemStats
+    runtime.ReadMemStats(&mem)
+    info := Info{
+        Server: ServerInfo{
+            PID:           os.Getpid(),
+            UptimeSeconds: int64(time.Since(startTime).Seconds()),
+            GoVersion:     runtime.Version(),
+            Goroutines:    runtime.NumGoroutine(),
+        },
+        Clients: ClientsInfo{
+            RPC:  metrics.rpcClients.Load(),
+            RESP: metrics.respClients.Load(),
+            HTTP: metrics.httpClients.Load(),
+            GRPC: metrics.grpcClients.Load(),
+        },
+        Memory: MemoryInfo{MemoryStats: s.memoryStats(), HeapBytes: mem.HeapAlloc, SysBytes: mem.Sys},
+        Stats: StatsInfo{
+            OpsPerSec:      math.Float64frombits(metrics.opsPerSec.Load()),
+            KeyspaceHits:   metrics.hits.Load(),
+            KeyspaceMisses: metrics.misses.Load(),
+            ExpiredKeys:    metrics.expired.Load(),
+            CleanupRuns:    metrics.cleanup.count.Load(),
+            CleanupSeconds: time.Duration(metrics.cleanup.sum.Load()).Seconds(),
+        },
+        Persistence: s.persistenceInfo(),
+        Replication: s.replicationInfo(),
+    }
+    info.Keyspace.Keys, info.Keyspace.Expires = s.keyStats()
+    keys, stats := metrics.sorted()
+    for i, k := range keys {
+        calls := stats[i].calls.Load()
+        ci := CommandInfo{
+            Protocol:  k.protocol,
+            Command:   k.command,
+            Calls:     calls,
+            Failed:    stats[i].failed.Load(),
+            OpsPerSec: math.Float64frombits(stats[i].rate.Load()),
+        }
+        if calls > 0 {
+            ci.UsecPerCall = float64(stats[i].duration.sum.Load()) / 1e3 / float64(calls)
+        }
+        info.Stats.TotalCommands += calls
+        info.Commands = append(info.Commands, ci)
+    }
+    return info
+}
+
+func (s *InMemoryStore) persistenceInfo() PersistenceInfo {
+    p := PersistenceInfo{WAL: s.wal != nil, Snapshots: s.snapshots != nil}
+    if s.wal != nil {
+        p.WALUnsyncedBytes = s.wal.unsyncedBytes()
+    }
+    if s.snapshots != nil {
+        rev, at := s.snapshots.last()
+        if now := s.revision(); now > rev {
+            p.ChangesSinceSnapshot = now - rev
+        }
+        if !at.IsZero() {
+            p.LastSnapshot = at.Unix()
+        }
+    }
+    return p
+}
+
+func (s *InMemoryStore) replicationInfo() ReplicationInfo {
+    switch {
+    case s.raft != nil:
+        st := s.raft.Status()
+        return ReplicationInfo{Role: st.Role, Revision: s.revision(), Leader: st.LeaderAddr, Lag: st.CommitIndex - st.LastApplied}
+    case s.follower != nil:
+        st := s.follower.status()
+        return ReplicationInfo{Role: st.Role, Revision: st.Rev, Leader: st.Leader, Lag: st.Lag}
+    default:
+        return ReplicationInfo{Role: "leader", Revision: s.revision()}
+    }
+}
+
+// text renders info the way the INFO command of Redis does: sections of
+// name:value lines. The default section leaves out commandstats.
+func (info Info) text(section string) string {
+    section = strings.ToLower(section)
+    all := section == "all" || section == "everything"
+    var b strings.Builder
+    add := func(name string, lines ...string) {
+        if !all && section != strings.ToLower(name) && (section != "default" || name == "Commandstats") {
+            return
+        }
+        if b.Len() > 0 {
+            b.WriteString("\r\n")
+        }
+        b.WriteString("# " + name + "\r\n")
+        for _, l := range lines {
+            b.WriteString(l + "\r\n")
+        }
+    }
+    u := func(n uint64) string { return strconv.FormatUint(n, 10) }
+    i := func(n int64) string { return strconv.FormatInt(n, 10) }
+    f := func(n float64) string { return strconv.FormatFloat(n, 'f', 2, 64) }
+
+    server := []string{
+        "redis_version:" + respRedisVer,
+        "redis_mode:standalone",
+        "go_version:" + info.Server.GoVersion,
+        "process_id:" + strconv.Itoa(info.Server.PID),
+    }
+    if info.Server.port != "" {
+        server = append(server, "tcp_port:"+info.Server.port)
+    }
+    add("Server", append(server, "uptime_in_seconds:"+i(info.Server.UptimeSeconds))...)
+    add("Clients",
+        "connected_clients:"+i(info.Clients.RESP),
+        "rpc_clients:"+i(info.Clients.RPC),
+        "http_clients:"+i(info.Clients.HTTP),
+        "grpc_clients:"+i(info.Clients.GRPC),
+    )
+    mem := info.Memory
+    add("Memory",
+        "used_memory:"+i(mem.UsedMemory),
+        "used_memory_human:"+formatBytes(mem.UsedMemory),
+        "used_memory_heap:"+u(mem.HeapBytes),
+        "used_memory_rss:"+u(mem.SysBytes),
+        "maxmemory:"+i(mem.MaxMemory),
+        "maxmemory_human:"+formatBytes(mem.MaxMemory),
+        "maxmemory_policy:"+string(mem.Policy),
+    )
+    st := info.Stats
+    add("Stats",
+        "total_commands_processed:"+u(st.TotalCommands),
+        "instantaneous_ops_per_sec:"+strconv.FormatInt(int64(math.Round(st.OpsPerSec)), 10),
+        "keyspace_hits:"+u(st.KeyspaceHits),
+        "keyspace_misses:"+u(st.KeyspaceMisses),
+        "expired_keys:"+u(st.ExpiredKeys),
+        "evicted_keys:"+u(mem.EvictedKeys),
+        "rejected_writes:"+u(mem.RejectedWrites),
+        "cleanup_runs:"+u(st.CleanupRuns),
+        "cleanup_usec:"+i(int64(st.CleanupSeconds*1e6)),
+    )
+    p := info.Persistence
+    add("Persistence",
+        "aof_enabled:"+i(boolInt(p.WAL)),
+        "aof_unsynced_bytes:"+i(p.WALUnsyncedBytes),
+        "rdb_enabled:"+i(boolInt(p.Snapshots)),
+        "rdb_changes_since_last_save:"+u(p.ChangesSinceSnapshot),
+        "rdb_last_save_time:"+i(p.LastSnapshot),
+    )
+    repl := info.Replication
+    role := "slave"
+    if repl.Role == "leader" {
+        role = "master"
+    }
+    replication := []string{"role:" + role, "master_repl_offset:" + u(repl.Revision)}
+    if repl.Leader != "" && role == "slave" {
+        replication = append(replication, "master_rpc_addr:"+repl.Leader)
+    }
+    add("Replication", append(replication, "repl_lag:"+u(repl.Lag))...)
+    var commands []string
+    for _, c := range info.Commands {
+        name := c.Command
+        if c.Protocol != "resp" {
+            name = c.Protocol + "_" + name
+        }
+        commands = append(commands, fmt.Sprintf("cmdstat_%s:calls=%d,usec=%d,usec_per_call=%s,failed_calls=%d",
+            strings.ToLower(name), c.Calls, int64(c.UsecPerCall*float64(c.Calls)), f(c.UsecPerCall), c.Failed))
+    }
+    add("Commandstats", commands...)
+    add("Keyspace", fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=0", info.Keyspace.Keys, info.Keyspace.Expires))
+    return b.String()
+}
+
+// InfoRequest asks for one section of the INFO text, such as "stats" or
+// "commandstats", or "all". Empty is the default sections.
+type InfoRequest struct {
+    Section string `json:"section,omitempty"`
+}
+
+type InfoResponse struct {
+    Text string `json:"text"`
+}
+
+// statsService is the "Stats" RPC service.
+type statsService struct {
+    store *InMemoryStore
+}
+
+// Info returns the INFO text, as the RESP command does.
+func (st *statsService) Info(req *InfoRequest, resp *InfoResponse) error {
+    section := req.Section
+    if section == "" {
+        section = "default"
+    }
+    resp.Text = st.store.info().text(section)
+    return nil
+}
+
+// infoHandler serves GET /info with the Info of the server as JSON.
+func (store *InMemoryStore) infoHandler(w http.ResponseWriter, r *http.Request) {
+    if !authorized(w, r, "Stats.Info", nil) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: store.info()})
+}
+
+// metricsHandler serves GET /metrics in the Prometheus text format.
+func (store *InMemoryStore) metricsHandler(w http.ResponseWriter, r *http.Request) {
+    if !authorized(w, r, "Stats.Info", nil) {
+        return
+    }
+    w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+    info := store.info()
+    var b strings.Builder
+    metric := func(name, typ, help string) {
+        fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+    }
+    value := func(name string, v float64, labels ...string) {
+        b.WriteString(name)
+        if len(labels) > 0 {
+            b.WriteString("{")
+            for i := 0; i < len(labels); i += 2 {
+                if i > 0 {
+                    b.WriteString(",")
+                }
+                fmt.Fprintf(&b, "%s=%s", labels[i], strconv.Quote(labels[i+1]))
+            }
+            b.WriteString("}")
+        }
+        b.WriteString(" " + strconv.FormatFloat(v, 'g', -1, 64) + "\n")
+    }
+    hist := func(name string, h *histogram, labels ...string) {
+        cumulative := uint64(0)
+        for i, bound := range latencyBuckets {
+            cumulative += h.buckets[i].Load()
+            value(name+"_bucket", float64(cumulative), append(labels, "le", strconv.FormatFloat(bound, 'g', -1, 64))...)
+        }
+        value(name+"_bucket", float64(h.count.Load()), append(labels, "le", "+Inf")...)
+        value(name+"_sum", time.Duration(h.sum.Load()).Seconds(), labels...)
+        value(name+"_count", float64(h.count.Load()), labels...)
+    }
+
+    metric("mydb_uptime_seconds", "gauge", "Seconds since the server started.")
+    value("mydb_uptime_seconds", float64(info.Server.UptimeSeconds))
+    metric("mydb_connected_clients", "gauge", "Open client connections by protocol.")
+    value("mydb_connected_clients", float64(info.Clients.RPC), "protocol", "rpc")
+    value("mydb_connected_clients", float64(info.Clients.RESP), "protocol", "resp")
+    value("mydb_connected_clients", float64(info.Clients.HTTP), "protocol", "http")
+    value("mydb_connected_clients", float64(info.Clients.GRPC), "protocol", "grpc")
+
+    keys, stats := metrics.sorted()
+    metric("mydb_commands_total", "counter", "Commands processed by protocol and command.")
+    for i, k := range keys {
+        value("mydb_commands_total", float64(stats[i].calls.Load()), "protocol", k.protocol, "command", k.command)
+    }
+    metric("mydb_command_errors_total", "counter", "Commands answered with an error, refused ones included.")
+    for i, k := range keys {
+        value("mydb_command_errors_total", float64(stats[i].failed.Load()), "protocol", k.protocol, "command", k.command)
+    }
+    metric("mydb_command_duration_seconds", "histogram", "Time taken to serve a command.")
+    for i, k := range keys {
+        hist("mydb_command_duration_seconds", stats[i].duration, "protocol", k.protocol, "command", k.command)
+    }
+
+    metric("mydb_keyspace_hits_total", "counter", "Reads that found their key.")
+    value("mydb_keyspace_hits_total", float64(info.Stats.KeyspaceHits))
+    metric("mydb_keyspace_misses_total", "counter", "Reads that did not find their key.")
+    value("mydb_keyspace_misses_total", float64(info.Stats.KeyspaceMisses))
+    metric("mydb_expired_keys_total", "counter", "Keys removed because their TTL ran out.")
+    value("mydb_expired_keys_total", float64(info.Stats.ExpiredKeys))
+    metric("mydb_evicted_keys_total", "counter", "Keys evicted to stay under maxmemory.")
+    value("mydb_evicted_keys_total", float64(info.Memory.EvictedKeys))
+    metric("mydb_rejected_writes_total", "counter", "Writes refused with an OOM error.")
+    value("mydb_rejected_writes_total", float64(info.Memory.RejectedWrites))
+    metric("mydb_cleanup_duration_seconds", "histogram", "Time taken by each pass removing expired keys.")
+    hist("mydb_cleanup_duration_seconds", metrics.cleanup)
+
+    metric("mydb_keys", "gauge", "Keys in the store.")
+    value("mydb_keys", float64(info.Keyspace.Keys))
+    metric("mydb_expiring_keys", "gauge", "Keys in the store that have a TTL.")
+    value("mydb_expiring_keys", float64(info.Keyspace.Expires))
+    metric("mydb_memory_used_bytes", "gauge", "Estimated bytes held by keys and values.")
+    value("mydb_memory_used_bytes", float64(info.Memory.UsedMemory))
+    metric("mydb_memory_max_bytes", "gauge", "The maxmemory limit, 0 for none.")
+    value("mydb_memory_max_bytes", float64(info.Memory.MaxMemory))
+    metric("mydb_go_heap_bytes", "gauge", "Bytes of the Go heap in use.")
+    value("mydb_go_heap_bytes", float64(info.Memory.HeapBytes))
+    metric("mydb_go_goroutines", "gauge", "Goroutines running.")
+    value("mydb_go_goroutines", float64(info.Server.Goroutines))
+
+    metric("mydb_revision", "gauge", "Revision of the store, bumped by every change.")
+    value("mydb_revision", float64(info.Replication.Revision))
+    if info.Persistence.WAL {
+        metric("mydb_wal_unsynced_bytes", "gauge", "WAL bytes written but not yet fsynced.")
+        value("mydb_wal_unsynced_bytes", float64(info.Persistence.WALUnsyncedBytes))
+    }
+    if info.Persistence.Snapshots {
+        metric("mydb_changes_since_snapshot", "gauge", "Changes made since the last snapshot, replayed from the WAL on restart.")
+        value("mydb_changes_since_snapshot", float64(info.Persistence.ChangesSinceSnapshot))
+        metric("mydb_last_snapshot_timestamp_seconds", "gauge", "Unix time of the last snapshot.")
+        value("mydb_last_snapshot_timestamp_seconds", float64(info.Persistence.LastSnapshot))
+    }
+    metric("mydb_replication_lag", "gauge", "Changes a follower or Raft member has yet to apply.")
+    value("mydb_replication_lag", float64(info.Replication.Lag), "role", info.Replication.Role)
+    w.Write([]byte(b.String()))
+}
@@ -0,0 +1,556 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/binary"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    subscriberIdle   = 30 * time.Second // RPC subscriptions not polled for this long are dropped
+    pubsubHeartbeat  = 15 * time.Second // how often an idle SSE subscription sends a comment
+    receiveBatchSize = 1000             // max messages returned by one Receive call
+)
+
+// slowPolicy decides what happens when a subscriber's buffer is full.
+type slowPolicy string
+
+const (
+    policyDrop       slowPolicy = "drop"       // drop the new message for that subscriber
+    policyDisconnect slowPolicy = "disconnect" // end the subscription
+)
+
+func parseSlowPolicy(s string) (slowPolicy, error) {
+    switch p := slowPolicy(strings.ToLower(s)); p {
+    case policyDrop, policyDisconnect:
+        return p, nil
+    }
+    return "", fmt.Errorf("ERR unknown slow subscriber policy %q, use drop or disconnect", s)
+}
+
+var (
+    errNoSubscription = errors.New("ERR no such subscription")
+    errNoChannels     = errors.New("ERR subscribe to at least one channel or pattern")
+)
+
+// Message is a message published on a channel. Pattern is the pattern the
+// subscriber matched it with, empty for a plain channel subscription.
+type Message struct {
+    Channel string `json:"channel"`
+    Pattern string `json:"pattern,omitempty"`
+    Payload string `json:"message"`
+}
+
+// subscriber is one subscription to a set of channels and patterns. Its
+// buffer holds the messages that were published but not yet read.
+type subscriber struct {
+    id       uint64
+    owner    *ACLUser // who subscribed over RPC, nil without an ACL
+    channels []string
+    patterns []string
+    policy   slowPolicy
+    remote   bool // held by an RPC client, dropped when it stops polling
+    buf      chan Message
+    dropped  atomic.Uint64 // messages dropped because the buffer was full
+    lastSeen atomic.Int64  // Unix nanoseconds of the last Receive, for remote subscribers
+
+    done   chan struct{} // closed when the subscription ends
+    once   sync.Once
+    reason string // why the subscription ended, set before done is closed
+}
+
+// close ends the subscription. The buffer is left open, so a publisher
+// that still holds the subscriber cannot panic on it.
+func (sub *subscriber) close(reason string) {
+    sub.once.Do(func() {
+        sub.reason = reason
+        close(sub.done)
+    })
+}
+
+// PubSub delivers messages published on channels to the subscribers of
+// those channels and of patterns matching them. Messages are not stored:
+// only the subscribers connected to this node at the time get them. It is
+// registered as the "PubSub" RPC service.
+type PubSub struct {
+    bufferSize int
+    policy     slowPolicy
+
+    mu       sync.RWMutex
+    subs     map[uint64]*subscriber // active subscriptions
+    remote   map[uint64]*subscriber // RPC subscriptions, kept until the client saw them end
+    channels map[string]map[*subscriber]struct{}
+    patterns map[string]map[*subscriber]struct{}
+
+    published    atomic.Uint64
+    delivered    atomic.Uint64
+    dropped      atomic.Uint64
+    disconnected atomic.Uint64
+}
+
+// NewPubSub creates a PubSub that buffers up to bufferSize messages per
+// subscriber and applies policy to subscribers that fall further behind,
+// unless they ask for another policy.
+func NewPubSub(bufferSize int, policy slowPolicy) *PubSub {
+    return &PubSub{
+        bufferSize: bufferSize,
+        policy:     policy,
+        subs:       make(map[uint64]*subscriber),
+        remote:     make(map[uint64]*subscriber),
+        channels:   make(map[string]map[*subscriber]struct{}),
+        patterns:   make(map[string]map[*subscriber]struct{}),
+    }
+}
+
+// subscribe registers a subscriber for channels and patterns. An empty
+// policy stands for the server's default. The ID is random, so one RPC
+// client cannot guess the subscriptions of another.
+func (ps *PubSub) subscribe(channels, patterns []string, policy string, owner *ACLUser, remote bool) (*subscriber, error) {
+    if len(channels) == 0 && len(patterns) == 0 {
+        return nil, errNoChannels
+    }
+    var p slowPolicy
+    if policy != "" {
+        var err error
+        if p, err = parseSlowPolicy(policy); err != nil {
+            return nil, err
+        }
+    }
+
+    ps.mu.Lock()
+    defer ps.mu.Unlock()
+    if p == "" {
+        p = ps.policy
+    }
+    sub := &subscriber{
+        id:       ps.newID(),
+        owner:    owner,
+        channels: channels,
+        patterns: patterns,
+        policy:   p,
+        remote:   remote,
+        buf:      make(chan Message, ps.bufferSize),
+        done:     make(chan struct{}),
+    }
+    sub.lastSeen.Store(time.Now().UnixNano())
+    ps.subs[sub.id] = sub
+    if remote {
+        ps.remote[sub.id] = sub
+    }
+    for _, c := range channels {
+        addSubscriber(ps.channels, c, sub)
+    }
+    for _, pat := range patterns {
+        addSubscriber(ps.patterns, pat, sub)
+    }
+    return sub, nil
+}
+
+// newID returns an unused random subscription ID. The caller must hold ps.mu.
+func (ps *PubSub) newID() uint64 {
+    var b [8]byte
+    for {
+        rand.Read(b[:])
+        id := binary.BigEndian.Uint64(b[:])
+        if _, ok := ps.remote[id]; id != 0 && !ok && ps.subs[id] == nil {
+            return id
+        }
+    }
+}
+
+func addSubscriber(m map[string]map[*subscriber]struct{}, name string, sub *subscriber) {
+    if m[name] == nil {
+        m[name] = make(map[*subscriber]struct{})
+    }
+    m[name][sub] = struct{}{}
+}
+
+// unsubscribe ends sub and removes it from its channels and patterns.
+func (ps *PubSub) unsubscribe(sub *subscriber, reason string) {
+    sub.close(reason)
+    ps.mu.Lock()
+    defer ps.mu.Unlock()
+    if _, ok := ps.subs[sub.id]; !ok {
+        return
+    }
+    delete(ps.subs, sub.id)
+    for _, c := range sub.channels {
+        removeSubscriber(ps.channels, c, sub)
+    }
+    for _, pat := range sub.patterns {
+        removeSubscriber(ps.patterns, pat, sub)
+    }
+}
+
+func removeSubscriber(m map[string]map[*subscriber]struct{}, name string, sub *subscriber) {
+    delete(m[name], sub)
+    if len(m[name]) == 0 {
+        delete(m, name)
+    }
+}
+
+// publish sends payload to every subscriber of channel and of the patterns
+// matching it, and returns how many of them got it. It never blocks: a
+// subscriber whose buffer is full loses the message or, with the disconnect
+// policy, its subscription.
+func (ps *PubSub) publish(channel, payload string) int {
+    ps.published.Add(1)
+    n := 0
+    slow := make(map[*subscriber]struct{})
+    deliver := func(sub *subscriber, m Message) {
+        select {
+        case sub.buf <- m:
+            n++
+            ps.delivered.Add(1)
+            return
+        default:
+        }
+        ps.dropped.Add(1)
+        sub.dropped.Add(1)
+        if sub.policy == policyDisconnect {
+            slow[sub] = struct{}{}
+        }
+    }
+
+    ps.mu.RLock()
+    for sub := range ps.channels[channel] {
+        deliver(sub, Message{Channel: channel, Payload: payload})
+    }
+    for pat, subs := range ps.patterns {
+        if !globMatch(pat, channel) {
+            continue
+        }
+        for sub := range subs {
+            deliver(sub, Message{Channel: channel, Pattern: pat, Payload: payload})
+        }
+    }
+    ps.mu.RUnlock()
+
+    for sub := range slow {
+        ps.disconnected.Add(1)
+        ps.unsubscribe(sub, fmt.Sprintf("SLOW subscriber disconnected, its buffer of %d messages was full", cap(sub.buf)))
+    }
+    return n
+}
+
+// lookup returns the RPC subscription with the given ID, which may have
+// ended already, if caller opened it. The subscriptions of other users
+// look like they do not exist.
+func (ps *PubSub) lookup(id uint64, caller *ACLUser) (*subscriber, bool) {
+    ps.mu.RLock()
+    defer ps.mu.RUnlock()
+    sub, ok := ps.remote[id]
+    if !ok || sub.owner != caller {
+        return nil, false
+    }
+    return sub, true
+}
+
+// forget drops an RPC subscription once its client is done with it.
+func (ps *PubSub) forget(sub *subscriber, reason string) {
+    ps.unsubscribe(sub, reason)
+    ps.mu.Lock()
+    defer ps.mu.Unlock()
+    delete(ps.remote, sub.id)
+}
+
+// drain appends the messages waiting in buf to out, up to max in total.
+func drain(buf chan Message, out []Message, max int) []Message {
+    for len(out) < max {
+        select {
+        case m := <-buf:
+            out = append(out, m)
+        default:
+            return out
+        }
+    }
+    return out
+}
+
+// StartReaperRoutine drops RPC subscriptions whose client has not called
+// Receive for subscriberIdle, checking every interval. The returned stop
+// ends it.
+func (ps *PubSub) StartReaperRoutine(interval time.Duration) (stop func()) {
+    return every(interval, ps.reap)
+}
+
+func (ps *PubSub) reap() {
+    cutoff := time.Now().Add(-subscriberIdle).UnixNano()
+    var idle []*subscriber
+    ps.mu.RLock()
+    for _, sub := range ps.remote {
+        if sub.lastSeen.Load() < cutoff {
+            idle = append(idle, sub)
+        }
+    }
+    ps.mu.RUnlock()
+    for _, sub := range idle {
+        ps.forget(sub, "subscription expired")
+    }
+}
+
+// PublishRequest publishes Message on Channel.
+type PublishRequest struct {
+    Channel string `json:"channel"`
+    Message string `json:"message"`
+}
+
+// PublishResponse tells how many subscribers got the message.
+type PublishResponse struct {
+    Receivers int `json:"receivers"`
+}
+
+// SubscribeRequest opens a subscription. Policy overrides the server's
+// slow subscriber policy, "drop" or "disconnect".
+type SubscribeRequest struct {
+    Channels []string `json:"channels"`
+    Patterns []string `json:"patterns"`
+    Policy   string   `json:"policy,omitempty"`
+
+    caller *ACLUser
+}
+
+// SubscribeResponse carries the ID to pass to Receive and Unsubscribe.
+type SubscribeResponse struct {
+    ID uint64 `json:"id"`
+}
+
+// ReceiveRequest asks for the next messages of subscription ID.
+type ReceiveRequest struct {
+    ID uint64 `json:"id"`
+
+    caller *ACLUser
+}
+
+// setCaller records who makes the call, see callerArgs.
+func (req *SubscribeRequest) setCaller(u *ACLUser) { req.caller = u }
+func (req *ReceiveRequest) setCaller(u *ACLUser)   { req.caller = u }
+
+// ReceiveResponse carries the next messages. Dropped counts the messages
+// this subscriber lost to a full buffer so far. Closed is set once the
+// subscription has ended, with the reason in Error.
+type ReceiveResponse struct {
+    Messages []Message `json:"messages,omitempty"`
+    Dropped  uint64    `json:"dropped,omitempty"`
+    Closed   bool      `json:"closed,omitempty"`
+    Error    string    `json:"error,omitempty"`
+}
+
+func (ps *PubSub) Publish(req *PublishRequest, resp *PublishResponse) error {
+    resp.Receivers = ps.publish(req.Channel, req.Message)
+    return nil
+}
+
+// Subscribe opens a subscription for an RPC client, which then calls
+// Receive in a loop. A subscription that is not polled for subscriberIdle
+// is dropped.
+func (ps *PubSub) Subscribe(req *SubscribeRequest, resp *SubscribeResponse) error {
+    sub, err := ps.subscribe(req.Channels, req.Patterns, req.Policy, req.caller, true)
+    if err != nil {
+        return err
+    }
+    resp.ID = sub.id
+    return nil
+}
+
+// Receive returns the buffered messages of a subscription, waiting up to
+// streamWait for the first one. The messages that were still buffered when
+// a subscription ended are returned before Closed is reported.
+func (ps *PubSub) Receive(req *ReceiveRequest, resp *ReceiveResponse) error {
+    sub, ok := ps.lookup(req.ID, req.caller)
+    if !ok {
+        resp.Closed = true
+        resp.Error = errNoSubscription.Error()
+        return nil
+    }
+    sub.lastSeen.Store(time.Now().UnixNano())
+    defer func() { sub.lastSeen.Store(time.Now().UnixNano()) }()
+
+    timeout := time.NewTimer(streamWait)
+    defer timeout.Stop()
+    select {
+    case m := <-sub.buf:
+        resp.Messages = drain(sub.buf, []Message{m}, receiveBatchSize)
+    case <-sub.done:
+        resp.Messages = drain(sub.buf, nil, receiveBatchSize)
+        if len(resp.Messages) == 0 {
+            resp.Closed = true
+            resp.Error = sub.reason
+            ps.forget(sub, sub.reason)
+        }
+    case <-timeout.C:
+    }
+    resp.Dropped = sub.dropped.Load()
+    return nil
+}
+
+func (ps *PubSub) Unsubscribe(req *ReceiveRequest, resp *ReceiveResponse) error {
+    sub, ok := ps.lookup(req.ID, req.caller)
+    if !ok {
+        return errNoSubscription
+    }
+    ps.forget(sub, "unsubscribed")
+    resp.Closed = true
+    return nil
+}
+
+// PubSubStats reports the subscriptions and how messages were delivered
+// since the server started.
+type PubSubStats struct {
+    Channels     int               `json:"channels"`
+    Patterns     int               `json:"patterns"`
+    Published    uint64            `json:"published"`
+    Delivered    uint64            `json:"delivered"`
+    Dropped      uint64            `json:"dropped"`
+    Disconnected uint64            `json:"disconnected"` // slow subscribers cut off
+    BufferSize   int               `json:"buffer_size"`
+    Policy       slowPolicy        `json:"policy"`
+    Subscribers  []SubscriberStats `json:"subscribers"`
+}
+
+// SubscriberStats describes one subscription.
+type SubscriberStats struct {
+    ID       uint64     `json:"id"`
+    Channels []string   `json:"channels,omitempty"`
+    Patterns []string   `json:"patterns,omitempty"`
+    Policy   slowPolicy `json:"policy"`
+    Remote   bool       `json:"remote,omitempty"`
+    Pending  int        `json:"pending"`
+    Dropped  uint64     `json:"dropped"`
+}
+
+// setDefaults changes the buffer size and slow subscriber policy of the
+// subscriptions made from now on.
+func (ps *PubSub) setDefaults(bufferSize int, policy slowPolicy) {
+    ps.mu.Lock()
+    defer ps.mu.Unlock()
+    ps.bufferSize, ps.policy = bufferSize, policy
+}
+
+func (ps *PubSub) stats() PubSubStats {
+    ps.mu.RLock()
+    defer ps.mu.RUnlock()
+    st := PubSubStats{
+        Channels:     len(ps.channels),
+        Patterns:     len(ps.patterns),
+        Published:    ps.published.Load(),
+        Delivered:    ps.delivered.Load(),
+        Dropped:      ps.dropped.Load(),
+        Disconnected: ps.disconnected.Load(),
+        BufferSize:   ps.bufferSize,
+        Policy:       ps.policy,
+        Subscribers:  make([]SubscriberStats, 0, len(ps.subs)),
+    }
+    for _, sub := range ps.subs {
+        st.Subscribers = append(st.Subscribers, SubscriberStats{
+            ID:       sub.id,
+            Channels: sub.channels,
+            Patterns: sub.patterns,
+            Policy:   sub.policy,
+            Remote:   sub.remote,
+            Pending:  len(sub.buf),
+            Dropped:  sub.dropped.Load(),
+        })
+    }
+    sort.Slice(st.Subscribers, func(i, j int) bool { return st.Subscribers[i].ID < st.Subscribers[j].ID })
+    return st
+}
+
+func (ps *PubSub) Stats(req *struct{}, resp *PubSubStats) error {
+    *resp = ps.stats()
+    return nil
+}
+
+// publishHandler serves POST /publish with a PublishRequest and returns the
+// number of subscribers that got the message.
+func (ps *PubSub) publishHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    var req PublishRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Channel == "" {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    if !authorized(w, r, "PubSub.Publish", &req) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: ps.publish(req.Channel, req.Message)})
+}
+
+// subscribeHandler streams messages as server-sent events on GET
+// /subscribe?channel=a&channel=b&pattern=orders.*&policy=drop. Each message
+// is a "message" event with a JSON Message. When messages were dropped for
+// this subscriber a "dropped" event reports the total, and a subscription
+// ended by the server gets an "error" event before the stream closes.
+func (ps *PubSub) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        methodNotAllowed(w, "GET")
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        httpError(w, http.StatusInternalServerError, "Streaming not supported")
+        return
+    }
+    q := r.URL.Query()
+    if !authorized(w, r, "PubSub.Subscribe", &SubscribeRequest{Channels: q["channel"], Patterns: q["pattern"]}) {
+        return
+    }
+    sub, err := ps.subscribe(q["channel"], q["pattern"], q.Get("policy"), nil, false)
+    if err != nil {
+        w.WriteHeader(http.StatusBadRequest)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    defer ps.unsubscribe(sub, "client went away")
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    heartbeat := time.NewTicker(pubsubHeartbeat)
+    defer heartbeat.Stop()
+    var dropped uint64
+    for {
+        select {
+        case m := <-sub.buf:
+            // Write out whatever else is buffered before flushing.
+            for _, m := range drain(sub.buf, []Message{m}, receiveBatchSize) {
+                data, _ := json.Marshal(m)
+                fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+            }
+            if d := sub.dropped.Load(); d != dropped {
+                dropped = d
+                fmt.Fprintf(w, "event: dropped\ndata: {\"count\":%d}\n\n", d)
+            }
+        case <-sub.done:
+            fmt.Fprintf(w, "event: error\ndata: %s\n\n", sub.reason)
+            flusher.Flush()
+            return
+        case <-heartbeat.C:
+            fmt.Fprint(w, ": heartbeat\n\n")
+        case <-r.Context().Done():
+            return
+        }
+        flusher.Flush()
+    }
+}
+
+// statsHandler serves GET /pubsub/stats.
+func (ps *PubSub) statsHandler(w http.ResponseWriter, r *http.Request) {
+    if !authorized(w, r, "PubSub.Stats", nil) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: ps.stats()})
+}
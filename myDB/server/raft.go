@@ -0,0 +1,1288 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math/rand"
+    "net/http"
+    "net/rpc"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    raftHeartbeat      = 50 * time.Millisecond
+    raftElectionMin    = 300 * time.Millisecond
+    raftElectionMax    = 600 * time.Millisecond
+    raftRPCTimeout     = 500 * time.Millisecond
+    raftProposeTimeout = 5 * time.Second
+    raftMaxBatch       = 512 // max entries in one AppendEntries call
+
+    // raftLease is how long after sending a heartbeat that a majority
+    // accepted the leader still serves reads. Followers refuse votes for
+    // raftElectionMin after hearing from it (see RequestVote), and the
+    // difference allows for clocks running at different rates.
+    raftLease = raftElectionMin * 9 / 10
+)
+
+var (
+    errProposalDropped = errors.New("raft: leadership changed before the write was committed, its outcome is unknown")
+    errProposeTimeout  = errors.New("raft: timed out waiting for the write to commit")
+    errConfigPending   = errors.New("raft: another membership change is still in progress")
+    errConfigNotReady  = errors.New("raft: the leader has not committed an entry of its term yet, try again")
+)
+
+// NotLeaderError is returned when a request needs the Raft leader but hit
+// another node. Leader and LeaderHTTP are empty while no leader is known.
+type NotLeaderError struct {
+    Leader     string // RPC address
+    LeaderHTTP string
+}
+
+func (e *NotLeaderError) Error() string {
+    if e.Leader == "" {
+        return "NOTLEADER no raft leader is known yet"
+    }
+    return "NOTLEADER this node is not the raft leader, the leader is " + e.Leader
+}
+
+type raftRole int
+
+const (
+    roleFollower raftRole = iota
+    roleCandidate
+    roleLeader
+)
+
+func (r raftRole) String() string {
+    switch r {
+    case roleCandidate:
+        return "candidate"
+    case roleLeader:
+        return "leader"
+    default:
+        return "follower"
+    }
+}
+
+type raftEntryType uint8
+
+const (
+    entryCommand raftEntryType = iota + 1
+    entryConfig
+    entryNoop
+)
+
+// RaftPeer is a member of the cluster.
+type RaftPeer struct {
+    ID   string `json:"id"`
+    Addr string `json:"addr"` // RPC address
+}
+
+// RaftEntry is one slot of the replicated log.
+type RaftEntry struct {
+    Index    uint64
+    Term     uint64
+    Type     raftEntryType
+    Mutation Mutation   // entryCommand
+    Peers    []RaftPeer // entryConfig: the full new membership
+}
+
+// RPC arguments and replies of the "Raft" service.
+
+type RequestVoteArgs struct {
+    Term         uint64
+    CandidateID  string
+    LastLogIndex uint64
+    LastLogTerm  uint64
+}
+
+type RequestVoteReply struct {
+    Term        uint64
+    VoteGranted bool
+}
+
+type AppendEntriesArgs struct {
+    Term         uint64
+    LeaderID     string
+    LeaderAddr   string
+    LeaderHTTP   string
+    PrevLogIndex uint64
+    PrevLogTerm  uint64
+    Entries      []RaftEntry
+    LeaderCommit uint64
+}
+
+type AppendEntriesReply struct {
+    Term          uint64
+    Success       bool
+    ConflictIndex uint64 // where the leader should retry from on failure
+}
+
+type InstallSnapshotArgs struct {
+    Term       uint64
+    LeaderID   string
+    LeaderAddr string
+    LeaderHTTP string
+    Meta       raftSnapshotMeta
+    Data       []byte
+}
+
+type InstallSnapshotReply struct {
+    Term uint64
+}
+
+type MembershipArgs struct {
+    ID   string
+    Addr string
+}
+
+type MembershipReply struct {
+    Leader string
+}
+
+// raftResult is handed back to the caller of Propose once its entry is applied.
+type raftResult struct {
+    err error
+}
+
+type raftWaiter struct {
+    term uint64
+    ch   chan raftResult
+}
+
+// RaftOptions configures a Raft node.
+type RaftOptions struct {
+    ID                string
+    Addr              string     // RPC address of this node
+    HTTPAddr          string     // HTTP address handed to followers for redirects
+    Dir               string     // where the log, state and snapshots live
+    Peers             []RaftPeer // initial membership, used only on a fresh node
+    SnapshotThreshold uint64     // compact the log after this many applied entries
+}
+
+// Raft replicates store mutations to a majority of the cluster before they
+// are applied, following the Raft consensus algorithm: leader election, log
+// replication, single-server membership changes and snapshot-based log
+// compaction. It is registered as the "Raft" RPC service.
+type Raft struct {
+    opts    RaftOptions
+    store   *InMemoryStore
+    storage *raftStorage
+
+    // applyMu serializes applying entries with installing snapshots, so a
+    // snapshot never lands in the middle of a batch being applied.
+    applyMu sync.Mutex
+
+    mu        sync.Mutex
+    term      uint64
+    votedFor  string
+    log       []RaftEntry // entries after the snapshot
+    snapIndex uint64
+    snapTerm  uint64
+    snapPeers []RaftPeer
+    peers     []RaftPeer // latest membership in the log
+
+    role        raftRole
+    leaderID    string
+    leaderAddr  string
+    leaderHTTP  string
+    commitIndex uint64
+    lastApplied uint64
+    deadline    time.Time // election timeout
+    lastHeard   time.Time // last AppendEntries or InstallSnapshot from a leader
+
+    nextIndex  map[string]uint64
+    matchIndex map[string]uint64
+    lastAck    map[string]time.Time // when the last request a member accepted was sent
+    triggers   map[string]chan struct{}
+    stopLead   chan struct{} // closed when this node stops leading
+    noopIndex  uint64        // the no-op entry this leader appended
+    ready      chan struct{} // closed once the no-op is applied, then nil
+    waiters    map[uint64]raftWaiter
+    commitCh   chan struct{}
+
+    clientsMu sync.Mutex
+    clients   map[string]*rpc.Client
+    dial      func(addr string, timeout time.Duration) (*rpc.Client, error)
+
+    done chan struct{} // closed by Stop
+}
+
+// NewRaft loads the Raft state from opts.Dir, restores the store from the
+// latest Raft snapshot and returns a node that is ready to Start.
+func NewRaft(store *InMemoryStore, opts RaftOptions) (*Raft, error) {
+    storage, state, entries, err := openRaftStorage(opts.Dir)
+    if err != nil {
+        return nil, err
+    }
+    r := &Raft{
+        opts:     opts,
+        store:    store,
+        storage:  storage,
+        term:     state.Term,
+        votedFor: state.VotedFor,
+        waiters:  make(map[uint64]raftWaiter),
+        commitCh: make(chan struct{}, 1),
+        clients:  make(map[string]*rpc.Client),
+        dial:     dialTimeout,
+        done:     make(chan struct{}),
+    }
+
+    if meta, rev, data, ok := storage.latestSnapshot(); ok {
+        store.restore(rev, data)
+        r.snapIndex, r.snapTerm, r.snapPeers = meta.Index, meta.Term, meta.Peers
+        r.commitIndex, r.lastApplied = meta.Index, meta.Index
+        fmt.Printf("raft: restored snapshot at index %d with %d keys\n", meta.Index, len(data))
+    } else {
+        r.snapPeers = opts.Peers
+    }
+    for _, e := range entries {
+        if e.Index > r.snapIndex {
+            r.log = append(r.log, e)
+        }
+    }
+    if len(r.log) != len(entries) {
+        // The snapshot already covers part of the log on disk.
+        if err := storage.rewrite(r.log); err != nil {
+            return nil, err
+        }
+    }
+    r.peers = r.latestConfig()
+    r.resetDeadline()
+    store.raft = r
+    return r, nil
+}
+
+// Start runs the election timer and the applier in the background.
+func (r *Raft) Start() {
+    go r.tickLoop()
+    go r.applyLoop()
+}
+
+// Stop ends the election timer, the applier and, on the leader, the
+// replication to the other members, which then elect a new leader, and
+// closes the log. Entries are synced as they are appended, so there is
+// nothing left to flush.
+func (r *Raft) Stop() error {
+    r.applyMu.Lock() // let a batch being applied finish first
+    defer r.applyMu.Unlock()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    select {
+    case <-r.done:
+        return nil
+    default:
+    }
+    close(r.done)
+    r.stepDown(r.term)
+    r.clientsMu.Lock()
+    for addr, c := range r.clients {
+        c.Close()
+        delete(r.clients, addr)
+    }
+    r.clientsMu.Unlock()
+    return r.storage.close()
+}
+
+// Propose replicates m and returns once a majority has it and it has been
+// applied to the local store.
+func (r *Raft) Propose(m Mutation) error {
+    r.mu.Lock()
+    if r.role != roleLeader {
+        err := r.notLeader()
+        r.mu.Unlock()
+        return err
+    }
+    e := RaftEntry{Index: r.lastIndex() + 1, Term: r.term, Type: entryCommand, Mutation: m}
+    if err := r.appendLocal(e); err != nil {
+        r.mu.Unlock()
+        return err
+    }
+    ch := make(chan raftResult, 1)
+    r.waiters[e.Index] = raftWaiter{term: e.Term, ch: ch}
+    r.triggerAll()
+    r.advanceCommit()
+    r.mu.Unlock()
+
+    select {
+    case res := <-ch:
+        return res.err
+    case <-time.After(raftProposeTimeout):
+        r.mu.Lock()
+        delete(r.waiters, e.Index)
+        r.mu.Unlock()
+        return errProposeTimeout
+    }
+}
+
+// CheckRead makes sure reads served by this node are up to date, and so are
+// the reads behind conditional writes. It must be the leader, have applied
+// the no-op of its term, before which entries committed by earlier leaders
+// may be missing from the store, and hold the lease: a majority accepted a
+// request sent within raftLease, and those members vote for no one else
+// until the election timeout has passed since, so no other leader can have
+// been elected in the meantime.
+func (r *Raft) CheckRead() error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.role != roleLeader {
+        return r.notLeader()
+    }
+    if ready := r.ready; ready != nil {
+        stop := r.stopLead
+        r.mu.Unlock()
+        select {
+        case <-ready:
+        case <-stop:
+        case <-time.After(raftProposeTimeout):
+        }
+        r.mu.Lock()
+        if r.role != roleLeader {
+            return r.notLeader()
+        }
+        if r.ready != nil {
+            return &NotLeaderError{}
+        }
+    }
+    if !r.holdsLease() {
+        return &NotLeaderError{}
+    }
+    return nil
+}
+
+// holdsLease reports whether a majority, counting this node, accepted a
+// request sent within raftLease. The caller must hold r.mu.
+func (r *Raft) holdsLease() bool {
+    acks := 0
+    for _, p := range r.peers {
+        if p.ID == r.opts.ID || time.Since(r.lastAck[p.ID]) < raftLease {
+            acks++
+        }
+    }
+    return acks*2 > len(r.peers)
+}
+
+// hearsLeader reports whether this node knows of a live leader: it is one
+// holding the lease, or a follower that heard from one within the minimum
+// election timeout. The caller must hold r.mu.
+func (r *Raft) hearsLeader() bool {
+    if r.role == roleLeader {
+        return r.holdsLease()
+    }
+    return r.role == roleFollower && time.Since(r.lastHeard) < raftElectionMin
+}
+
+// AddMember adds a server to the cluster. It must be called on the leader.
+func (r *Raft) AddMember(id, addr string) error {
+    return r.changeConfig(func(peers []RaftPeer) ([]RaftPeer, error) {
+        for _, p := range peers {
+            if p.ID == id {
+                return nil, fmt.Errorf("raft: %s is already a member", id)
+            }
+        }
+        return append(peers, RaftPeer{ID: id, Addr: addr}), nil
+    })
+}
+
+// RemoveMember removes a server from the cluster. It must be called on the leader.
+func (r *Raft) RemoveMember(id string) error {
+    return r.changeConfig(func(peers []RaftPeer) ([]RaftPeer, error) {
+        var out []RaftPeer
+        for _, p := range peers {
+            if p.ID != id {
+                out = append(out, p)
+            }
+        }
+        if len(out) == len(peers) {
+            return nil, fmt.Errorf("raft: %s is not a member", id)
+        }
+        if len(out) == 0 {
+            return nil, errors.New("raft: cannot remove the last member")
+        }
+        return out, nil
+    })
+}
+
+// changeConfig appends a membership change and waits for it to commit.
+// Only one change may be in flight, which keeps every pair of consecutive
+// configurations overlapping in a majority. A new leader must first commit
+// an entry of its term: until then a change its predecessor appended may
+// still commit, and a second one would not overlap it.
+func (r *Raft) changeConfig(change func([]RaftPeer) ([]RaftPeer, error)) error {
+    r.mu.Lock()
+    if r.role != roleLeader {
+        err := r.notLeader()
+        r.mu.Unlock()
+        return err
+    }
+    if r.termAt(r.commitIndex) != r.term {
+        r.mu.Unlock()
+        return errConfigNotReady
+    }
+    for i := r.commitIndex + 1; i <= r.lastIndex(); i++ {
+        if r.entry(i).Type == entryConfig {
+            r.mu.Unlock()
+            return errConfigPending
+        }
+    }
+    peers, err := change(append([]RaftPeer(nil), r.peers...))
+    if err != nil {
+        r.mu.Unlock()
+        return err
+    }
+    e := RaftEntry{Index: r.lastIndex() + 1, Term: r.term, Type: entryConfig, Peers: peers}
+    if err := r.appendLocal(e); err != nil {
+        r.mu.Unlock()
+        return err
+    }
+    ch := make(chan raftResult, 1)
+    r.waiters[e.Index] = raftWaiter{term: e.Term, ch: ch}
+    r.triggerAll()
+    r.advanceCommit()
+    r.mu.Unlock()
+
+    select {
+    case res := <-ch:
+        return res.err
+    case <-time.After(raftProposeTimeout):
+        r.mu.Lock()
+        delete(r.waiters, e.Index)
+        r.mu.Unlock()
+        return errProposeTimeout
+    }
+}
+
+// RaftStatus is returned by the /raft/status endpoint.
+type RaftStatus struct {
+    ID          string            `json:"id"`
+    Role        string            `json:"role"`
+    Term        uint64            `json:"term"`
+    Leader      string            `json:"leader,omitempty"`
+    LeaderAddr  string            `json:"leader_addr,omitempty"`
+    CommitIndex uint64            `json:"commit_index"`
+    LastApplied uint64            `json:"last_applied"`
+    LastIndex   uint64            `json:"last_index"`
+    SnapIndex   uint64            `json:"snapshot_index"`
+    Peers       []RaftPeer        `json:"peers"`
+    MatchIndex  map[string]uint64 `json:"match_index,omitempty"`
+}
+
+// Status returns a summary of this node's view of the cluster.
+func (r *Raft) Status() RaftStatus {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    st := RaftStatus{
+        ID:          r.opts.ID,
+        Role:        r.role.String(),
+        Term:        r.term,
+        Leader:      r.leaderID,
+        LeaderAddr:  r.leaderAddr,
+        CommitIndex: r.commitIndex,
+        LastApplied: r.lastApplied,
+        LastIndex:   r.lastIndex(),
+        SnapIndex:   r.snapIndex,
+        Peers:       r.peers,
+    }
+    if r.role == roleLeader {
+        st.MatchIndex = make(map[string]uint64, len(r.matchIndex))
+        for id, idx := range r.matchIndex {
+            st.MatchIndex[id] = idx
+        }
+    }
+    return st
+}
+
+// Leader returns the RPC and HTTP address of the current leader and whether
+// it is this node.
+func (r *Raft) Leader() (addr, httpAddr string, self bool) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.leaderAddr, r.leaderHTTP, r.role == roleLeader
+}
+
+// RequestVote is called by candidates to gather votes. While this node
+// knows of a live leader it ignores them, without even taking their term,
+// so a member that lost touch with the leader cannot depose it and the
+// leader's lease holds (see CheckRead).
+func (r *Raft) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    if r.hearsLeader() {
+        reply.Term = r.term
+        return nil
+    }
+    if args.Term > r.term {
+        r.stepDown(args.Term)
+    }
+    reply.Term = r.term
+    if args.Term < r.term {
+        return nil
+    }
+    upToDate := args.LastLogTerm > r.lastTerm() ||
+        (args.LastLogTerm == r.lastTerm() && args.LastLogIndex >= r.lastIndex())
+    if (r.votedFor == "" || r.votedFor == args.CandidateID) && upToDate {
+        r.votedFor = args.CandidateID
+        if err := r.persistState(); err != nil {
+            return err
+        }
+        reply.VoteGranted = true
+        r.resetDeadline()
+    }
+    return nil
+}
+
+// AppendEntries is called by the leader to replicate entries and as a heartbeat.
+func (r *Raft) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    reply.Term = r.term
+    if args.Term < r.term {
+        return nil
+    }
+    if args.Term > r.term || r.role != roleFollower {
+        r.stepDown(args.Term)
+        reply.Term = r.term
+    }
+    r.followLeader(args.LeaderID, args.LeaderAddr, args.LeaderHTTP)
+    r.lastHeard = time.Now()
+    r.resetDeadline()
+
+    // The entry before the new ones must match, otherwise the leader backs up.
+    if args.PrevLogIndex > r.lastIndex() {
+        reply.ConflictIndex = r.lastIndex() + 1
+        return nil
+    }
+    if args.PrevLogIndex > r.snapIndex && r.termAt(args.PrevLogIndex) != args.PrevLogTerm {
+        conflictTerm := r.termAt(args.PrevLogIndex)
+        idx := args.PrevLogIndex
+        for idx > r.snapIndex+1 && r.termAt(idx-1) == conflictTerm {
+            idx--
+        }
+        reply.ConflictIndex = idx
+        return nil
+    }
+
+    var fresh []RaftEntry
+    for i, e := range args.Entries {
+        if e.Index <= r.snapIndex {
+            continue
+        }
+        if e.Index <= r.lastIndex() {
+            if r.termAt(e.Index) == e.Term {
+                continue
+            }
+            // Conflicting suffix: drop it and everything after it.
+            if err := r.truncateFrom(e.Index); err != nil {
+                return err
+            }
+        }
+        fresh = args.Entries[i:]
+        break
+    }
+    if len(fresh) > 0 {
+        if err := r.storage.append(fresh); err != nil {
+            return err
+        }
+        r.log = append(r.log, fresh...)
+        r.peers = r.latestConfig()
+    }
+
+    if args.LeaderCommit > r.commitIndex {
+        r.commitIndex = min(args.LeaderCommit, args.PrevLogIndex+uint64(len(args.Entries)))
+        r.notifyCommit()
+    }
+    reply.Success = true
+    return nil
+}
+
+// InstallSnapshot is called by the leader when a follower is so far behind
+// that the entries it needs have been compacted away.
+func (r *Raft) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+    r.applyMu.Lock()
+    defer r.applyMu.Unlock()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    reply.Term = r.term
+    if args.Term < r.term {
+        return nil
+    }
+    if args.Term > r.term || r.role != roleFollower {
+        r.stepDown(args.Term)
+        reply.Term = r.term
+    }
+    r.followLeader(args.LeaderID, args.LeaderAddr, args.LeaderHTTP)
+    r.lastHeard = time.Now()
+    r.resetDeadline()
+
+    meta := args.Meta
+    if meta.Index <= r.snapIndex {
+        return nil
+    }
+    index, rev, entries, err := readSnapshotBytes(args.Data)
+    if err != nil || index != meta.Index {
+        return fmt.Errorf("raft: bad snapshot from leader: %v", err)
+    }
+    if err := r.storage.saveSnapshotData(meta, args.Data); err != nil {
+        return err
+    }
+
+    // Keep the part of the log after the snapshot if it agrees with it.
+    var rest []RaftEntry
+    if meta.Index < r.lastIndex() && r.termAt(meta.Index) == meta.Term {
+        rest = append(rest, r.log[meta.Index-r.snapIndex:]...)
+    }
+    if err := r.storage.rewrite(rest); err != nil {
+        return err
+    }
+    r.log = rest
+    r.snapIndex, r.snapTerm, r.snapPeers = meta.Index, meta.Term, meta.Peers
+    r.peers = r.latestConfig()
+
+    r.store.restore(rev, entries)
+    r.commitIndex = max(r.commitIndex, meta.Index)
+    r.lastApplied = meta.Index
+    fmt.Printf("raft: installed snapshot at index %d from %s\n", meta.Index, args.LeaderID)
+    return nil
+}
+
+// AddServer is the RPC form of AddMember.
+func (r *Raft) AddServer(args *MembershipArgs, reply *MembershipReply) error {
+    reply.Leader, _, _ = r.Leader()
+    return r.AddMember(args.ID, args.Addr)
+}
+
+// RemoveServer is the RPC form of RemoveMember.
+func (r *Raft) RemoveServer(args *MembershipArgs, reply *MembershipReply) error {
+    reply.Leader, _, _ = r.Leader()
+    return r.RemoveMember(args.ID)
+}
+
+// statusHandler reports this node's view of the cluster.
+func (r *Raft) statusHandler(w http.ResponseWriter, req *http.Request) {
+    if !authorized(w, req, "Raft.Status", nil) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: r.Status()})
+}
+
+// membersHandler changes the cluster membership: POST with {"id", "addr"}
+// adds a server, DELETE ?id= removes one. Other nodes redirect to the leader.
+func (r *Raft) membersHandler(w http.ResponseWriter, req *http.Request) {
+    method := "Raft.Status"
+    if req.Method != http.MethodGet {
+        method = "Raft.AddServer"
+    }
+    if !authorized(w, req, method, nil) {
+        return
+    }
+    var err error
+    switch req.Method {
+    case http.MethodGet:
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: r.Status().Peers})
+        return
+    case http.MethodPost:
+        var body MembershipArgs
+        if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.ID == "" || body.Addr == "" {
+            httpError(w, http.StatusBadRequest, "Invalid request")
+            return
+        }
+        err = r.AddMember(body.ID, body.Addr)
+    case http.MethodDelete:
+        err = r.RemoveMember(req.URL.Query().Get("id"))
+    default:
+        methodNotAllowed(w, "GET, POST, DELETE")
+        return
+    }
+
+    var nle *NotLeaderError
+    if errors.As(err, &nle) && nle.LeaderHTTP != "" {
+        http.Redirect(w, req, scheme(req)+"://"+nle.LeaderHTTP+req.URL.RequestURI(), http.StatusTemporaryRedirect)
+        return
+    }
+    if err != nil {
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: r.Status().Peers})
+}
+
+// tickLoop starts an election whenever the leader has been silent for too long.
+func (r *Raft) tickLoop() {
+    ticker := time.NewTicker(10 * time.Millisecond)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-r.done:
+            return
+        case <-ticker.C:
+        }
+        r.mu.Lock()
+        if r.role != roleLeader && time.Now().After(r.deadline) && r.isMember(r.opts.ID) {
+            r.startElection()
+        }
+        r.mu.Unlock()
+    }
+}
+
+// startElection becomes a candidate for the next term and asks every other
+// member for its vote. The caller must hold r.mu.
+func (r *Raft) startElection() {
+    r.role = roleCandidate
+    r.term++
+    r.votedFor = r.opts.ID
+    r.leaderID, r.leaderAddr, r.leaderHTTP = "", "", ""
+    r.resetDeadline()
+    if err := r.persistState(); err != nil {
+        fmt.Println("raft: error saving state:", err)
+        return
+    }
+
+    term := r.term
+    args := RequestVoteArgs{Term: term, CandidateID: r.opts.ID, LastLogIndex: r.lastIndex(), LastLogTerm: r.lastTerm()}
+    peers := r.peers
+    votes := 1
+    if votes*2 > len(peers) {
+        r.becomeLeader()
+        return
+    }
+
+    for _, p := range peers {
+        if p.ID == r.opts.ID {
+            continue
+        }
+        go func(p RaftPeer) {
+            var reply RequestVoteReply
+            if err := r.call(p.Addr, "Raft.RequestVote", &args, &reply); err != nil {
+                return
+            }
+            r.mu.Lock()
+            defer r.mu.Unlock()
+            if reply.Term > r.term {
+                r.stepDown(reply.Term)
+                return
+            }
+            if r.role != roleCandidate || r.term != term || !reply.VoteGranted {
+                return
+            }
+            votes++
+            if votes*2 > len(peers) {
+                r.becomeLeader()
+            }
+        }(p)
+    }
+}
+
+// becomeLeader takes over leadership. The caller must hold r.mu.
+func (r *Raft) becomeLeader() {
+    r.role = roleLeader
+    r.followLeader(r.opts.ID, r.opts.Addr, r.opts.HTTPAddr)
+    r.nextIndex = make(map[string]uint64)
+    r.matchIndex = make(map[string]uint64)
+    r.lastAck = make(map[string]time.Time)
+    r.triggers = make(map[string]chan struct{})
+    r.stopLead = make(chan struct{})
+    fmt.Printf("raft: %s is the leader for term %d\n", r.opts.ID, r.term)
+
+    // A no-op entry from the new term lets earlier entries commit. Reads
+    // wait until it is applied, see CheckRead.
+    r.noopIndex = r.lastIndex() + 1
+    r.ready = make(chan struct{})
+    if err := r.appendLocal(RaftEntry{Index: r.noopIndex, Term: r.term, Type: entryNoop}); err != nil {
+        fmt.Println("raft: error appending no-op entry:", err)
+    }
+    r.startReplicators()
+    r.advanceCommit()
+}
+
+// stepDown returns to follower in term, failing writes still waiting for a
+// commit this node can no longer promise. The caller must hold r.mu.
+func (r *Raft) stepDown(term uint64) {
+    if term > r.term {
+        r.term = term
+        r.votedFor = ""
+        if err := r.persistState(); err != nil {
+            fmt.Println("raft: error saving state:", err)
+        }
+    }
+    if r.role == roleLeader {
+        close(r.stopLead)
+        for idx, w := range r.waiters {
+            w.ch <- raftResult{err: errProposalDropped}
+            delete(r.waiters, idx)
+        }
+        r.leaderID, r.leaderAddr, r.leaderHTTP = "", "", ""
+    }
+    r.role = roleFollower
+}
+
+// startReplicators starts one replication goroutine per member that does not
+// have one yet. The caller must hold r.mu.
+func (r *Raft) startReplicators() {
+    for _, p := range r.peers {
+        if p.ID == r.opts.ID {
+            continue
+        }
+        if _, ok := r.triggers[p.ID]; ok {
+            continue
+        }
+        trigger := make(chan struct{}, 1)
+        r.triggers[p.ID] = trigger
+        r.nextIndex[p.ID] = r.lastIndex() + 1
+        r.matchIndex[p.ID] = 0
+        go r.replicate(p, r.term, trigger, r.stopLead)
+    }
+}
+
+// replicate keeps one follower up to date for as long as this node leads in
+// term and the follower stays a member.
+func (r *Raft) replicate(p RaftPeer, term uint64, trigger chan struct{}, stop chan struct{}) {
+    ticker := time.NewTicker(raftHeartbeat)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-stop:
+            return
+        case <-ticker.C:
+        case <-trigger:
+        }
+        if !r.sendAppend(p, term) {
+            return
+        }
+    }
+}
+
+// sendAppend sends the entries p is missing (or a snapshot when they are
+// gone) and processes the reply. It returns false once p should no longer
+// be replicated to.
+func (r *Raft) sendAppend(p RaftPeer, term uint64) bool {
+    r.mu.Lock()
+    if r.role != roleLeader || r.term != term {
+        r.mu.Unlock()
+        return false
+    }
+    if !r.isMember(p.ID) {
+        delete(r.triggers, p.ID)
+        r.mu.Unlock()
+        return false
+    }
+
+    next := r.nextIndex[p.ID]
+    if next <= r.snapIndex {
+        args := InstallSnapshotArgs{
+            Term: term, LeaderID: r.opts.ID, LeaderAddr: r.opts.Addr, LeaderHTTP: r.opts.HTTPAddr,
+            Meta: raftSnapshotMeta{Index: r.snapIndex, Term: r.snapTerm, Peers: r.snapPeers},
+        }
+        r.mu.Unlock()
+        data, err := r.storage.snapshotData(args.Meta.Index)
+        if err != nil {
+            fmt.Println("raft: error reading snapshot:", err)
+            return true
+        }
+        args.Data = data
+        var reply InstallSnapshotReply
+        sent := time.Now()
+        if err := r.call(p.Addr, "Raft.InstallSnapshot", &args, &reply); err != nil {
+            return true
+        }
+        r.mu.Lock()
+        defer r.mu.Unlock()
+        if reply.Term > r.term {
+            r.stepDown(reply.Term)
+            return false
+        }
+        if r.role != roleLeader || r.term != term {
+            return false
+        }
+        r.matchIndex[p.ID] = max(r.matchIndex[p.ID], args.Meta.Index)
+        r.nextIndex[p.ID] = r.matchIndex[p.ID] + 1
+        r.ack(p.ID, sent)
+        return true
+    }
+
+    prev := next - 1
+    args := AppendEntriesArgs{
+        Term: term, LeaderID: r.opts.ID, LeaderAddr: r.opts.Addr, LeaderHTTP: r.opts.HTTPAddr,
+        PrevLogIndex: prev, PrevLogTerm: r.termAt(prev), LeaderCommit: r.commitIndex,
+    }
+    if last := r.lastIndex(); next <= last {
+        end := min(last, next+raftMaxBatch-1)
+        args.Entries = append([]RaftEntry(nil), r.log[next-r.snapIndex-1:end-r.snapIndex]...)
+    }
+    r.mu.Unlock()
+
+    var reply AppendEntriesReply
+    sent := time.Now()
+    if err := r.call(p.Addr, "Raft.AppendEntries", &args, &reply); err != nil {
+        return true
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if reply.Term > r.term {
+        r.stepDown(reply.Term)
+        return false
+    }
+    if r.role != roleLeader || r.term != term {
+        return false
+    }
+    r.ack(p.ID, sent)
+    if reply.Success {
+        match := args.PrevLogIndex + uint64(len(args.Entries))
+        r.matchIndex[p.ID] = max(r.matchIndex[p.ID], match)
+        r.nextIndex[p.ID] = r.matchIndex[p.ID] + 1
+        r.advanceCommit()
+        if r.nextIndex[p.ID] <= r.lastIndex() {
+            r.trigger(p.ID)
+        }
+        return true
+    }
+    r.nextIndex[p.ID] = max(1, min(reply.ConflictIndex, next-1))
+    r.trigger(p.ID)
+    return true
+}
+
+// ack records that p accepted this node as leader in a request sent at
+// sent. The lease counts from the send time, as p may have promised not to
+// vote from any time after it. The caller must hold r.mu.
+func (r *Raft) ack(id string, sent time.Time) {
+    if sent.After(r.lastAck[id]) {
+        r.lastAck[id] = sent
+    }
+}
+
+// advanceCommit commits the newest entry of the current term that a
+// majority of members has stored. The caller must hold r.mu.
+func (r *Raft) advanceCommit() {
+    if r.role != roleLeader {
+        return
+    }
+    for n := r.lastIndex(); n > r.commitIndex && n > r.snapIndex; n-- {
+        if r.termAt(n) != r.term {
+            break
+        }
+        count := 0
+        for _, p := range r.peers {
+            if p.ID == r.opts.ID || r.matchIndex[p.ID] >= n {
+                count++
+            }
+        }
+        if count*2 > len(r.peers) {
+            r.commitIndex = n
+            r.notifyCommit()
+            return
+        }
+    }
+}
+
+// applyLoop applies committed entries to the store in log order until Stop.
+func (r *Raft) applyLoop() {
+    for {
+        select {
+        case <-r.done:
+            return
+        case <-r.commitCh:
+        }
+        r.applyCommitted()
+    }
+}
+
+func (r *Raft) applyCommitted() {
+    r.applyMu.Lock()
+    defer r.applyMu.Unlock()
+
+    r.mu.Lock()
+    if r.lastApplied >= r.commitIndex || r.stopped() {
+        r.mu.Unlock()
+        return
+    }
+    entries := make([]RaftEntry, 0, r.commitIndex-r.lastApplied)
+    for i := r.lastApplied + 1; i <= r.commitIndex; i++ {
+        entries = append(entries, r.entry(i))
+    }
+    r.mu.Unlock()
+
+    for _, e := range entries {
+        if e.Type == entryCommand {
+            r.store.applyCommitted(e.Mutation)
+        }
+    }
+
+    r.mu.Lock()
+    for _, e := range entries {
+        r.lastApplied = e.Index
+        if w, ok := r.waiters[e.Index]; ok {
+            delete(r.waiters, e.Index)
+            if w.term == e.Term {
+                w.ch <- raftResult{}
+            } else {
+                w.ch <- raftResult{err: errProposalDropped}
+            }
+        }
+        if e.Type == entryConfig && r.role == roleLeader && !r.isMember(r.opts.ID) {
+            // We were removed from the cluster: hand over once committed.
+            fmt.Printf("raft: %s was removed from the cluster, stepping down\n", r.opts.ID)
+            r.stepDown(r.term)
+        }
+    }
+    if r.ready != nil && r.role == roleLeader && r.lastApplied >= r.noopIndex {
+        close(r.ready)
+        r.ready = nil
+    }
+    compact := r.opts.SnapshotThreshold > 0 && r.lastApplied-r.snapIndex >= r.opts.SnapshotThreshold
+    r.mu.Unlock()
+
+    if compact {
+        r.compact()
+    }
+}
+
+// compact snapshots the store at the last applied entry and drops the log
+// up to it. It runs on the apply goroutine, so the store cannot move on
+// while it is being copied.
+func (r *Raft) compact() {
+    r.mu.Lock()
+    meta := raftSnapshotMeta{Index: r.lastApplied, Term: r.termAt(r.lastApplied), Peers: r.configAt(r.lastApplied)}
+    r.mu.Unlock()
+
+    rev, entries := r.store.copyEntries()
+    if err := r.storage.saveSnapshot(meta, rev, entries); err != nil {
+        fmt.Println("raft: error saving snapshot:", err)
+        return
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if meta.Index <= r.snapIndex {
+        return
+    }
+    rest := append([]RaftEntry(nil), r.log[meta.Index-r.snapIndex:]...)
+    if err := r.storage.rewrite(rest); err != nil {
+        fmt.Println("raft: error compacting log:", err)
+        return
+    }
+    r.log = rest
+    r.snapIndex, r.snapTerm, r.snapPeers = meta.Index, meta.Term, meta.Peers
+    fmt.Printf("raft: compacted log up to index %d\n", meta.Index)
+}
+
+// appendLocal appends an entry to the leader's own log. The caller must hold r.mu.
+func (r *Raft) appendLocal(e RaftEntry) error {
+    if err := r.storage.append([]RaftEntry{e}); err != nil {
+        return err
+    }
+    r.log = append(r.log, e)
+    if e.Type == entryConfig {
+        r.peers = e.Peers
+        r.startReplicators()
+    }
+    return nil
+}
+
+// truncateFrom drops the log from index on. The caller must hold r.mu.
+func (r *Raft) truncateFrom(index uint64) error {
+    pos := int(index - r.snapIndex - 1)
+    if err := r.storage.truncate(pos); err != nil {
+        return err
+    }
+    r.log = r.log[:pos]
+    r.peers = r.latestConfig()
+    return nil
+}
+
+func (r *Raft) lastIndex() uint64 {
+    return r.snapIndex + uint64(len(r.log))
+}
+
+func (r *Raft) lastTerm() uint64 {
+    return r.termAt(r.lastIndex())
+}
+
+// termAt returns the term of the entry at index, which must not be older
+// than the snapshot.
+func (r *Raft) termAt(index uint64) uint64 {
+    if index == r.snapIndex {
+        return r.snapTerm
+    }
+    if index < r.snapIndex || index > r.lastIndex() {
+        return 0
+    }
+    return r.log[index-r.snapIndex-1].Term
+}
+
+func (r *Raft) entry(index uint64) RaftEntry {
+    return r.log[index-r.snapIndex-1]
+}
+
+// latestConfig returns the newest membership in the log, committed or not,
+// as Raft uses a configuration as soon as it is appended.
+func (r *Raft) latestConfig() []RaftPeer {
+    return r.configAt(r.lastIndex())
+}
+
+// configAt returns the membership in effect at index.
+func (r *Raft) configAt(index uint64) []RaftPeer {
+    for i := index; i > r.snapIndex; i-- {
+        if e := r.entry(i); e.Type == entryConfig {
+            return e.Peers
+        }
+    }
+    return r.snapPeers
+}
+
+func (r *Raft) isMember(id string) bool {
+    for _, p := range r.peers {
+        if p.ID == id {
+            return true
+        }
+    }
+    return false
+}
+
+func (r *Raft) followLeader(id, addr, httpAddr string) {
+    r.leaderID, r.leaderAddr = id, addr
+    r.leaderHTTP = resolveHTTPAddr(httpAddr, addr)
+}
+
+func (r *Raft) notLeader() error {
+    return &NotLeaderError{Leader: r.leaderAddr, LeaderHTTP: r.leaderHTTP}
+}
+
+func (r *Raft) persistState() error {
+    return r.storage.saveState(raftState{Term: r.term, VotedFor: r.votedFor})
+}
+
+func (r *Raft) resetDeadline() {
+    timeout := raftElectionMin + time.Duration(rand.Int63n(int64(raftElectionMax-raftElectionMin)))
+    r.deadline = time.Now().Add(timeout)
+}
+
+func (r *Raft) stopped() bool {
+    select {
+    case <-r.done:
+        return true
+    default:
+        return false
+    }
+}
+
+func (r *Raft) notifyCommit() {
+    select {
+    case r.commitCh <- struct{}{}:
+    default:
+    }
+}
+
+func (r *Raft) trigger(id string) {
+    if ch, ok := r.triggers[id]; ok {
+        select {
+        case ch <- struct{}{}:
+        default:
+        }
+    }
+}
+
+func (r *Raft) triggerAll() {
+    for id := range r.triggers {
+        r.trigger(id)
+    }
+}
+
+// call invokes method on the peer at addr, giving up after raftRPCTimeout.
+// Broken connections are dropped and redialed on the next call.
+func (r *Raft) call(addr, method string, args, reply interface{}) error {
+    client, err := r.client(addr)
+    if err != nil {
+        return err
+    }
+    call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+    timeout := raftRPCTimeout
+    if method == "Raft.InstallSnapshot" {
+        timeout = raftProposeTimeout
+    }
+    select {
+    case <-call.Done:
+        if call.Error == rpc.ErrShutdown || isConnError(call.Error) {
+            r.dropClient(addr, client)
+        }
+        return call.Error
+    case <-time.After(timeout):
+        r.dropClient(addr, client)
+        return fmt.Errorf("raft: %s to %s timed out", method, addr)
+    }
+}
+
+func (r *Raft) client(addr string) (*rpc.Client, error) {
+    r.clientsMu.Lock()
+    defer r.clientsMu.Unlock()
+    if c, ok := r.clients[addr]; ok {
+        return c, nil
+    }
+    c, err := r.dial(addr, raftRPCTimeout)
+    if err != nil {
+        return nil, err
+    }
+    r.clients[addr] = c
+    return c, nil
+}
+
+func (r *Raft) dropClient(addr string, c *rpc.Client) {
+    r.clientsMu.Lock()
+    defer r.clientsMu.Unlock()
+    if r.clients[addr] == c {
+        delete(r.clients, addr)
+        c.Close()
+    }
+}
+
+// dialTimeout connects to an RPC server and logs in with the cluster
+// credentials, giving up after timeout.
+func dialTimeout(addr string, timeout time.Duration) (*rpc.Client, error) {
+    conn, err := dialRPC(addr, timeout)
+    if err != nil {
+        return nil, err
+    }
+    client := rpc.NewClient(conn)
+    conn.SetDeadline(time.Now().Add(timeout))
+    if err := login(client); err != nil {
+        client.Close()
+        return nil, err
+    }
+    conn.SetDeadline(time.Time{})
+    return client, nil
+}
+
+// isConnError reports whether err came from the connection rather than
+// from the remote method.
+func isConnError(err error) bool {
+    if err == nil {
+        return false
+    }
+    _, remote := err.(rpc.ServerError)
+    return !remote
+}
+
+// parseRaftPeers parses "id=host:port,id=host:port".
+func parseRaftPeers(s string) ([]RaftPeer, error) {
+    var peers []RaftPeer
+    for _, part := range strings.Split(s, ",") {
+        part = strings.TrimSpace(part)
+        if part == "" {
+            continue
+        }
+        id, addr, ok := strings.Cut(part, "=")
+        if !ok || id == "" || addr == "" {
+            return nil, fmt.Errorf("invalid raft peer %q, want id=host:port", part)
+        }
+        peers = append(peers, RaftPeer{ID: id, Addr: addr})
+    }
+    sort.Slice(peers, func(i, j int) bool { return peers[i].ID < peers[j].ID })
+    return peers, nil
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+    "bufio"
+    "encoding/binary"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+const (
+    raftLogMagic   = "MYDBRAFT"
+    raftLogVersion = 1
+    raftLogFile    = "raft.log"
+    raftStateFile  = "state.json"
+)
+
+// raftState is the part of the Raft state that must survive a restart
+// besides the log itself.
+type raftState struct {
+    Term     uint64 `json:"term"`
+    VotedFor string `json:"voted_for"`
+}
+
+// raftSnapshotMeta describes a compacted prefix of the log. It is stored next
+// to the snapshot data written by writeSnapshotFile.
+type raftSnapshotMeta struct {
+    Index uint64     `json:"index"`
+    Term  uint64     `json:"term"`
+    Peers []RaftPeer `json:"peers"`
+}
+
+// raftStorage persists the Raft term, vote, log and snapshots in one
+// directory. The log file uses the same checksummed framing as the WAL.
+type raftStorage struct {
+    dir     string
+    file    *os.File
+    offsets []int64 // file offset of every entry currently in the log
+    size    int64
+}
+
+// openRaftStorage opens (or creates) the Raft directory and returns the saved
+// state and log entries. A torn tail of the log is cut off, like in the WAL.
+func openRaftStorage(dir string) (*raftStorage, raftState, []RaftEntry, error) {
+    var state raftState
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, state, nil, err
+    }
+    data, err := os.ReadFile(filepath.Join(dir, raftStateFile))
+    if err == nil {
+        if err := json.Unmarshal(data, &state); err != nil {
+            return nil, state, nil, fmt.Errorf("read raft state: %w", err)
+        }
+    } else if !os.IsNotExist(err) {
+        return nil, state, nil, err
+    }
+
+    rs := &raftStorage{dir: dir}
+    entries, err := rs.load()
+    if err != nil {
+        return nil, state, nil, err
+    }
+    return rs, state, entries, nil
+}
+
+// load reads the log file, truncating a torn tail, and leaves it open for appends.
+func (rs *raftStorage) load() ([]RaftEntry, error) {
+    path := filepath.Join(rs.dir, raftLogFile)
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o644)
+    if err != nil {
+        return nil, err
+    }
+
+    r := bufio.NewReader(f)
+    header := make([]byte, len(raftLogMagic)+1)
+    var entries []RaftEntry
+    offset := int64(0)
+    if _, err := io.ReadFull(r, header); err == nil {
+        if string(header[:len(raftLogMagic)]) != raftLogMagic || header[len(raftLogMagic)] != raftLogVersion {
+            f.Close()
+            return nil, fmt.Errorf("raft: %s is not a raft log", path)
+        }
+        offset = int64(len(header))
+        for {
+            payload, n, err := readFrame(r)
+            if err == io.EOF {
+                break
+            }
+            if err == nil {
+                var e RaftEntry
+                if e, err = decodeRaftEntry(payload); err == nil {
+                    entries = append(entries, e)
+                    rs.offsets = append(rs.offsets, offset)
+                    offset += n
+                    continue
+                }
+            }
+            fmt.Printf("raft: %v in %s at offset %d, truncating\n", err, path, offset)
+            break
+        }
+    }
+
+    if offset == 0 {
+        header = append([]byte(raftLogMagic), raftLogVersion)
+        if _, err := f.WriteAt(header, 0); err != nil {
+            f.Close()
+            return nil, err
+        }
+        offset = int64(len(header))
+    }
+    if err := f.Truncate(offset); err != nil {
+        f.Close()
+        return nil, err
+    }
+    if _, err := f.Seek(offset, io.SeekStart); err != nil {
+        f.Close()
+        return nil, err
+    }
+    rs.file = f
+    rs.size = offset
+    return entries, f.Sync()
+}
+
+// saveState atomically replaces the saved term and vote.
+func (rs *raftStorage) saveState(state raftState) error {
+    data, err := json.Marshal(state)
+    if err != nil {
+        return err
+    }
+    return writeFileAtomic(filepath.Join(rs.dir, raftStateFile), data)
+}
+
+// append writes entries to the end of the log and fsyncs them.
+func (rs *raftStorage) append(entries []RaftEntry) error {
+    w := bufio.NewWriter(rs.file)
+    for _, e := range entries {
+        n, err := writeFrame(w, encodeRaftEntry(e))
+        if err != nil {
+            return err
+        }
+        rs.offsets = append(rs.offsets, rs.size)
+        rs.size += n
+    }
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    return rs.file.Sync()
+}
+
+// truncate drops the entries from position pos (0-based within the log) on.
+func (rs *raftStorage) truncate(pos int) error {
+    if pos >= len(rs.offsets) {
+        return nil
+    }
+    offset := rs.offsets[pos]
+    if err := rs.file.Truncate(offset); err != nil {
+        return err
+    }
+    if _, err := rs.file.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    rs.offsets = rs.offsets[:pos]
+    rs.size = offset
+    return rs.file.Sync()
+}
+
+// rewrite replaces the whole log with entries, used after compaction.
+func (rs *raftStorage) rewrite(entries []RaftEntry) error {
+    path := filepath.Join(rs.dir, raftLogFile)
+    tmp := path + ".tmp"
+    f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0o644)
+    if err != nil {
+        return err
+    }
+    header := append([]byte(raftLogMagic), raftLogVersion)
+    w := bufio.NewWriter(f)
+    w.Write(header)
+    size := int64(len(header))
+    offsets := make([]int64, 0, len(entries))
+    for _, e := range entries {
+        n, err := writeFrame(w, encodeRaftEntry(e))
+        if err != nil {
+            f.Close()
+            os.Remove(tmp)
+            return err
+        }
+        offsets = append(offsets, size)
+        size += n
+    }
+    if err := w.Flush(); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    rs.file.Close()
+    rs.file = f
+    rs.offsets = offsets
+    rs.size = size
+    return syncDir(rs.dir)
+}
+
+// saveSnapshot writes the snapshot data and its metadata, then removes older
+// snapshots. The data goes first so a crash never leaves metadata without data.
+func (rs *raftStorage) saveSnapshot(meta raftSnapshotMeta, rev uint64, entries map[string]ValueWithTTL) error {
+    base := filepath.Join(rs.dir, fmt.Sprintf("%s%020d", snapshotPrefix, meta.Index))
+    if _, err := writeSnapshotFile(base+snapshotSuffix, meta.Index, rev, entries); err != nil {
+        return err
+    }
+    data, err := json.Marshal(meta)
+    if err != nil {
+        return err
+    }
+    if err := writeFileAtomic(base+".json", data); err != nil {
+        return err
+    }
+    return rs.pruneSnapshots(meta.Index)
+}
+
+// saveSnapshotData is saveSnapshot for data that arrived already encoded
+// from the leader.
+func (rs *raftStorage) saveSnapshotData(meta raftSnapshotMeta, data []byte) error {
+    base := filepath.Join(rs.dir, fmt.Sprintf("%s%020d", snapshotPrefix, meta.Index))
+    if err := writeFileAtomic(base+snapshotSuffix, data); err != nil {
+        return err
+    }
+    metaData, err := json.Marshal(meta)
+    if err != nil {
+        return err
+    }
+    if err := writeFileAtomic(base+".json", metaData); err != nil {
+        return err
+    }
+    return rs.pruneSnapshots(meta.Index)
+}
+
+// latestSnapshot returns the newest snapshot whose metadata and data are
+// both intact, together with the store revision it was taken at, or
+// ok == false when there is none.
+func (rs *raftStorage) latestSnapshot() (meta raftSnapshotMeta, rev uint64, entries map[string]ValueWithTTL, ok bool) {
+    bases, err := rs.snapshotBases()
+    if err != nil {
+        return meta, 0, nil, false
+    }
+    for i := len(bases) - 1; i >= 0; i-- {
+        data, err := os.ReadFile(bases[i] + ".json")
+        if err != nil || json.Unmarshal(data, &meta) != nil {
+            continue
+        }
+        index, rev, entries, err := readSnapshotFile(bases[i] + snapshotSuffix)
+        if err != nil || index != meta.Index {
+            fmt.Printf("raft: skipping snapshot %s: %v\n", bases[i], err)
+            continue
+        }
+        return meta, rev, entries, true
+    }
+    return raftSnapshotMeta{}, 0, nil, false
+}
+
+// snapshotData returns the encoded snapshot at index, for sending to a follower.
+func (rs *raftStorage) snapshotData(index uint64) ([]byte, error) {
+    return os.ReadFile(filepath.Join(rs.dir, fmt.Sprintf("%s%020d%s", snapshotPrefix, index, snapshotSuffix)))
+}
+
+// pruneSnapshots removes every snapshot older than index.
+func (rs *raftStorage) pruneSnapshots(index uint64) error {
+    bases, err := rs.snapshotBases()
+    if err != nil {
+        return err
+    }
+    keep := filepath.Join(rs.dir, fmt.Sprintf("%s%020d", snapshotPrefix, index))
+    for _, base := range bases {
+        if base >= keep {
+            continue
+        }
+        os.Remove(base + ".json")
+        os.Remove(base + snapshotSuffix)
+    }
+    return nil
+}
+
+// snapshotBases lists snapshot paths without extension, oldest first.
+func (rs *raftStorage) snapshotBases() ([]string, error) {
+    entries, err := os.ReadDir(rs.dir)
+    if err != nil {
+        return nil, err
+    }
+    var bases []string
+    for _, e := range entries {
+        name := e.Name()
+        if strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+            bases = append(bases, filepath.Join(rs.dir, strings.TrimSuffix(name, snapshotSuffix)))
+        }
+    }
+    sort.Strings(bases)
+    return bases, nil
+}
+
+func (rs *raftStorage) close() error {
+    return rs.file.Close()
+}
+
+// encodeRaftEntry serializes e as
+//
+//	[index uvarint][term uvarint][type byte][body]
+//
+// where body is an encoded Mutation for commands and the peer list for
+// configuration changes.
+func encodeRaftEntry(e RaftEntry) []byte {
+    buf := make([]byte, 0, 32)
+    buf = binary.AppendUvarint(buf, e.Index)
+    buf = binary.AppendUvarint(buf, e.Term)
+    buf = append(buf, byte(e.Type))
+    switch e.Type {
+    case entryCommand:
+        buf = append(buf, encodeMutation(e.Mutation)...)
+    case entryConfig:
+        buf = binary.AppendUvarint(buf, uint64(len(e.Peers)))
+        for _, p := range e.Peers {
+            buf = binary.AppendUvarint(buf, uint64(len(p.ID)))
+            buf = append(buf, p.ID...)
+            buf = binary.AppendUvarint(buf, uint64(len(p.Addr)))
+            buf = append(buf, p.Addr...)
+        }
+    }
+    return buf
+}
+
+func decodeRaftEntry(buf []byte) (RaftEntry, error) {
+    var e RaftEntry
+    var n int
+    if e.Index, n = binary.Uvarint(buf); n <= 0 {
+        return e, errCorruptEntry
+    }
+    buf = buf[n:]
+    if e.Term, n = binary.Uvarint(buf); n <= 0 {
+        return e, errCorruptEntry
+    }
+    buf = buf[n:]
+    if len(buf) < 1 {
+        return e, errCorruptEntry
+    }
+    e.Type = raftEntryType(buf[0])
+    buf = buf[1:]
+
+    switch e.Type {
+    case entryCommand:
+        m, err := decodeMutation(buf)
+        if err != nil {
+            return e, err
+        }
+        e.Mutation = m
+    case entryConfig:
+        count, n := binary.Uvarint(buf)
+        if n <= 0 {
+            return e, errCorruptEntry
+        }
+        buf = buf[n:]
+        for i := uint64(0); i < count; i++ {
+            var p RaftPeer
+            var ok bool
+            if p.ID, buf, ok = readString(buf); !ok {
+                return e, errCorruptEntry
+            }
+            if p.Addr, buf, ok = readString(buf); !ok {
+                return e, errCorruptEntry
+            }
+            e.Peers = append(e.Peers, p)
+        }
+    case entryNoop:
+    default:
+        return e, fmt.Errorf("unknown raft entry type %d: %w", e.Type, errCorruptEntry)
+    }
+    return e, nil
+}
+
+// writeFileAtomic replaces path with data through a fsynced temporary file.
+func writeFileAtomic(path string, data []byte) error {
+    tmp := path + ".tmp"
+    f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+    if err != nil {
+        return err
+    }
+    if _, err := f.Write(data); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := f.Sync(); err != nil {
+        f.Close()
+        os.Remove(tmp)
+        return err
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return err
+    }
+    return syncDir(filepath.Dir(path))
+}
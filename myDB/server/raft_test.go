@@ -0,0 +1,223 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "net"
+    "net/rpc"
+    "sync"
+    "testing"
+    "time"
+)
+
+// raftNet connects in-process Raft nodes over pipes and can cut the links
+// between them.
+type raftNet struct {
+    mu    sync.Mutex
+    nodes map[string]*raftNode // by address
+    cut   map[[2]string]bool
+    conns map[[2]string][]net.Conn
+}
+
+type raftNode struct {
+    id, addr string
+    store    *InMemoryStore
+    raft     *Raft
+    server   *rpc.Server
+}
+
+func newRaftNet() *raftNet {
+    return &raftNet{nodes: make(map[string]*raftNode), cut: make(map[[2]string]bool), conns: make(map[[2]string][]net.Conn)}
+}
+
+// start runs a node with the given initial membership.
+func (n *raftNet) start(t *testing.T, id string, peers []RaftPeer) *raftNode {
+    node := &raftNode{id: id, addr: id + ":1", store: NewInMemoryStore(), server: rpc.NewServer()}
+    r, err := NewRaft(node.store, RaftOptions{ID: id, Addr: node.addr, Dir: t.TempDir(), Peers: peers, SnapshotThreshold: 8})
+    if err != nil {
+        t.Fatal(err)
+    }
+    r.dial = func(addr string, _ time.Duration) (*rpc.Client, error) { return n.dial(node.addr, addr) }
+    node.raft = r
+    node.server.RegisterName("Raft", r)
+    n.mu.Lock()
+    n.nodes[node.addr] = node
+    n.mu.Unlock()
+    r.Start()
+    t.Cleanup(func() { r.Stop() })
+    return node
+}
+
+func (n *raftNet) dial(from, to string) (*rpc.Client, error) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    node, ok := n.nodes[to]
+    if !ok || n.cut[[2]string{from, to}] {
+        return nil, fmt.Errorf("%s cannot reach %s", from, to)
+    }
+    c1, c2 := net.Pipe()
+    link := [2]string{from, to}
+    n.conns[link] = append(n.conns[link], c1, c2)
+    go node.server.ServeConn(c2)
+    return rpc.NewClient(c1), nil
+}
+
+// isolate cuts every link to and from addr.
+func (n *raftNet) isolate(addr string) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    for other := range n.nodes {
+        for _, link := range [][2]string{{addr, other}, {other, addr}} {
+            n.cut[link] = true
+            for _, c := range n.conns[link] {
+                c.Close()
+            }
+            delete(n.conns, link)
+        }
+    }
+}
+
+func (n *raftNet) heal() {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    n.cut = make(map[[2]string]bool)
+}
+
+// waitFor polls cond until it holds, failing the test after a while.
+func waitFor(t *testing.T, what string, cond func() bool) {
+    t.Helper()
+    for deadline := time.Now().Add(10 * time.Second); !cond(); time.Sleep(10 * time.Millisecond) {
+        if time.Now().After(deadline) {
+            t.Fatalf("timed out waiting for %s", what)
+        }
+    }
+}
+
+// leaderOf waits until one of nodes serves reads and returns it.
+func leaderOf(t *testing.T, nodes ...*raftNode) *raftNode {
+    t.Helper()
+    var leader *raftNode
+    waitFor(t, "a leader", func() bool {
+        for _, node := range nodes {
+            if node.raft.CheckRead() == nil {
+                leader = node
+                return true
+            }
+        }
+        return false
+    })
+    return leader
+}
+
+// hasValue waits until every node has key set to value.
+func hasValue(t *testing.T, key, value string, nodes ...*raftNode) {
+    t.Helper()
+    waitFor(t, key+" = "+value, func() bool {
+        for _, node := range nodes {
+            if v, _, _ := node.store.Get(key); v != value {
+                return false
+            }
+        }
+        return true
+    })
+}
+
+func TestRaftCluster(t *testing.T) {
+    n := newRaftNet()
+    peers := []RaftPeer{{"n1", "n1:1"}, {"n2", "n2:1"}, {"n3", "n3:1"}}
+    nodes := []*raftNode{n.start(t, "n1", peers), n.start(t, "n2", peers), n.start(t, "n3", peers)}
+
+    old := leaderOf(t, nodes...)
+    for i := 0; i < 20; i++ {
+        if err := old.store.Set(fmt.Sprint("k", i), "1", 0); err != nil {
+            t.Fatal(err)
+        }
+    }
+    hasValue(t, "k19", "1", nodes...)
+    for _, node := range nodes {
+        if err := node.store.checkRead(); node != old && err == nil {
+            t.Fatalf("follower %s serves reads", node.id)
+        }
+    }
+
+    // Cut the leader off. Its write cannot commit, and once the others
+    // have elected a leader and changed k0 it must not serve reads.
+    n.isolate(old.addr)
+    lost := make(chan error, 1)
+    go func() { lost <- old.store.Set("lost", "1", 0) }()
+    var rest []*raftNode
+    for _, node := range nodes {
+        if node != old {
+            rest = append(rest, node)
+        }
+    }
+    leader := leaderOf(t, rest...)
+    for i := 0; i < 20; i++ {
+        if err := leader.store.Set(fmt.Sprint("k", i), "2", 0); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := old.store.checkRead(); err == nil {
+        v, _, _ := old.store.Get("k0")
+        t.Fatalf("the old leader serves reads after a new leader was elected, k0 = %s", v)
+    }
+    if leader.raft.Status().SnapIndex == 0 {
+        t.Fatal("the log was not compacted")
+    }
+
+    // Back together, the old leader catches up from a snapshot and its
+    // write is reported as not committed.
+    n.heal()
+    if err := <-lost; !errors.Is(err, errProposalDropped) && !errors.Is(err, errProposeTimeout) {
+        t.Fatalf("write on the isolated leader: %v", err)
+    }
+    hasValue(t, "k19", "2", nodes...)
+    for _, node := range nodes {
+        if _, _, ok := node.store.Get("lost"); ok {
+            t.Fatalf("%s has the write that was not committed", node.id)
+        }
+    }
+
+    // Membership: n4 joins and gets everything, then n1 leaves.
+    n4 := n.start(t, "n4", nil)
+    onLeader := func(what string, op func(r *Raft) error) {
+        t.Helper()
+        waitFor(t, what, func() bool { return op(leaderOf(t, nodes...).raft) == nil })
+    }
+    onLeader("n4 to join", func(r *Raft) error { return r.AddMember("n4", "n4:1") })
+    nodes = append(nodes, n4)
+    hasValue(t, "k19", "2", n4)
+    onLeader("n1 to leave", func(r *Raft) error { return r.RemoveMember("n1") })
+    nodes = nodes[1:]
+    onLeader("a write after n1 left", func(r *Raft) error { return r.store.Set("after", "1", 0) })
+    hasValue(t, "after", "1", nodes...)
+    if peers := leaderOf(t, nodes...).raft.Status().Peers; len(peers) != 3 {
+        t.Fatalf("members: %+v", peers)
+    }
+}
+
+func TestRaftNewLeader(t *testing.T) {
+    stop := make(chan struct{})
+    close(stop)
+    r := &Raft{
+        role: roleLeader, term: 2, log: []RaftEntry{{Index: 1, Term: 1}, {Index: 2, Term: 2, Type: entryNoop}},
+        commitIndex: 1, lastApplied: 1, noopIndex: 2, ready: make(chan struct{}), stopLead: stop,
+    }
+    // Until its no-op is applied, the leader neither serves reads nor
+    // changes the membership.
+    var nle *NotLeaderError
+    if err := r.CheckRead(); !errors.As(err, &nle) {
+        t.Fatalf("read before the no-op was applied: %v", err)
+    }
+    if err := r.AddMember("n2", "n2:1"); err != errConfigNotReady {
+        t.Fatalf("membership change before the no-op was committed: %v", err)
+    }
+
+    // A follower that just heard from its leader ignores candidates.
+    f := &Raft{role: roleFollower, term: 2, lastHeard: time.Now()}
+    var reply RequestVoteReply
+    f.RequestVote(&RequestVoteArgs{Term: 3, CandidateID: "n2", LastLogIndex: 5, LastLogTerm: 2}, &reply)
+    if reply.VoteGranted || reply.Term != 2 || f.term != 2 {
+        t.Fatalf("vote while the leader is alive: %+v, term %d", reply, f.term)
+    }
+}
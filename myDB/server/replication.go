@@ -0,0 +1,482 @@
+package main
+
+import (
+    "bytes"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net"
+    "net/http"
+    "net/rpc"
+    "strings"
+    "sync"
+    "time"
+)
+
+const (
+    streamWait      = 5 * time.Second  // how long a Stream call waits for new changes
+    streamBatchSize = 1000             // max changes returned by one Stream call
+    followerRetry   = time.Second      // pause before a follower reconnects
+    followerTimeout = 10 * time.Second // dial deadline, and how much longer than streamWait a Stream call may take
+    syncTimeout     = 5 * time.Minute  // deadline of a full sync, which sends the whole store
+)
+
+// errReadOnly is returned for writes sent to a follower.
+var errReadOnly = errors.New("READONLY this node is a follower, send writes to the leader")
+
+// Change is a mutation tagged with the store revision it produced.
+type Change struct {
+    Rev uint64
+    Mutation
+}
+
+// changeLog keeps the most recent changes in memory so followers and
+// watchers can catch up without a full sync. Waiters block on notify until
+// the next append.
+type changeLog struct {
+    mu      sync.Mutex
+    changes []Change
+    base    uint64 // revision the log starts after
+    limit   int
+    notify  chan struct{}
+}
+
+// newChangeLog returns an empty log for a store at revision base.
+func newChangeLog(base uint64, limit int) *changeLog {
+    return &changeLog{base: base, limit: limit, notify: make(chan struct{})}
+}
+
+// append records a change and wakes up everyone waiting for one.
+func (l *changeLog) append(c Change) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.changes = append(l.changes, c)
+    if len(l.changes) > 2*l.limit {
+        // Drop the oldest half in one go instead of shifting on every append.
+        l.changes = append([]Change(nil), l.changes[len(l.changes)-l.limit:]...)
+    }
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+// reset empties the log after the store was replaced by a snapshot taken
+// at rev. Waiters are woken up so they notice.
+func (l *changeLog) reset(rev uint64) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    l.changes = nil
+    l.base = rev
+    close(l.notify)
+    l.notify = make(chan struct{})
+}
+
+// since returns up to max changes after rev. ok is false when rev is older
+// than the log, meaning the caller has to start over from a full sync.
+func (l *changeLog) since(rev uint64, max int) (changes []Change, wait <-chan struct{}, ok bool) {
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    first := l.base + 1
+    if len(l.changes) > 0 {
+        first = l.changes[0].Rev
+    }
+    if rev+1 >= first {
+        for i, c := range l.changes {
+            if c.Rev > rev {
+                end := min(len(l.changes), i+max)
+                return append([]Change(nil), l.changes[i:end]...), l.notify, true
+            }
+        }
+        return nil, l.notify, true
+    }
+    return nil, l.notify, false
+}
+
+// SyncRequest asks the leader for a full copy of the store.
+type SyncRequest struct {
+    FollowerID string
+}
+
+// SyncResponse carries a snapshot of the leader taken at revision Rev.
+type SyncResponse struct {
+    RunID      string
+    Rev        uint64
+    Snapshot   []byte
+    LeaderHTTP string
+}
+
+// StreamRequest asks for the changes after From, the last revision the
+// follower has applied.
+type StreamRequest struct {
+    FollowerID string
+    RunID      string
+    From       uint64
+}
+
+// StreamResponse carries the next batch of changes. Resync tells the
+// follower that the leader cannot serve From anymore (it restarted or the
+// changes fell out of its backlog) and a full sync is needed.
+type StreamResponse struct {
+    RunID   string
+    Rev     uint64
+    Changes []Change
+    Resync  bool
+}
+
+// followerState is what the leader knows about one follower.
+type followerState struct {
+    ID       string    `json:"id"`
+    AckedRev uint64    `json:"acked_rev"`
+    Lag      uint64    `json:"lag"`
+    LastSeen time.Time `json:"last_seen"`
+}
+
+// Replication is the leader side of replication, registered as the
+// "Replication" RPC service next to InMemoryStore.
+type Replication struct {
+    store      *InMemoryStore
+    runID      string // changes on every boot, since a restart can lose the last revisions
+    leaderHTTP string
+
+    mu        sync.Mutex
+    followers map[string]*followerState
+}
+
+// NewReplication returns the leader side of replication, which serves
+// followers from the change log of store. leaderHTTP is handed to followers
+// for redirects.
+func NewReplication(store *InMemoryStore, leaderHTTP string) *Replication {
+    return &Replication{
+        store:      store,
+        runID:      newRunID(),
+        leaderHTTP: leaderHTTP,
+        followers:  make(map[string]*followerState),
+    }
+}
+
+// Sync sends a snapshot of the whole store to a (re)connecting follower.
+func (r *Replication) Sync(req *SyncRequest, resp *SyncResponse) error {
+    rev, entries := r.store.copyEntries()
+
+    var buf bytes.Buffer
+    if err := writeSnapshot(&buf, 0, rev, entries); err != nil {
+        return err
+    }
+    resp.RunID = r.runID
+    resp.Rev = rev
+    resp.Snapshot = buf.Bytes()
+    resp.LeaderHTTP = r.leaderHTTP
+    r.seen(req.FollowerID, rev)
+    return nil
+}
+
+// Stream returns the changes after req.From, waiting up to streamWait for
+// new ones so an idle follower is not busy polling.
+func (r *Replication) Stream(req *StreamRequest, resp *StreamResponse) error {
+    resp.RunID = r.runID
+    r.seen(req.FollowerID, req.From)
+    if req.RunID != r.runID {
+        resp.Resync = true
+        return nil
+    }
+
+    timeout := time.NewTimer(streamWait)
+    defer timeout.Stop()
+    for {
+        changes, wait, ok := r.store.changes.since(req.From, streamBatchSize)
+        resp.Rev = r.store.revision()
+        if !ok {
+            resp.Resync = true
+            return nil
+        }
+        if len(changes) > 0 {
+            resp.Changes = changes
+            return nil
+        }
+        select {
+        case <-wait:
+        case <-timeout.C:
+            return nil
+        }
+    }
+}
+
+// seen records the progress of a follower for the status endpoint.
+func (r *Replication) seen(id string, acked uint64) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    f, ok := r.followers[id]
+    if !ok {
+        f = &followerState{ID: id}
+        r.followers[id] = f
+    }
+    f.AckedRev = acked
+    f.LastSeen = time.Now()
+}
+
+// Follower keeps a local copy of a leader's store up to date and serves
+// reads from it.
+type Follower struct {
+    store      *InMemoryStore
+    id         string
+    leaderAddr string        // leader RPC address
+    timeout    time.Duration // followerTimeout, shorter in tests
+    stop       chan struct{} // closed by Stop
+    stopped    chan struct{} // closed when Run returns
+
+    mu          sync.Mutex
+    conn        net.Conn // to the leader, closed by Stop
+    leaderHTTP  string
+    runID       string
+    leaderRev   uint64
+    connected   bool
+    lastContact time.Time
+    lastError   string
+}
+
+// NewFollower puts store in read-only follower mode for the leader at leaderAddr.
+func NewFollower(store *InMemoryStore, id, leaderAddr string) *Follower {
+    f := &Follower{store: store, id: id, leaderAddr: leaderAddr, timeout: followerTimeout, stop: make(chan struct{}), stopped: make(chan struct{})}
+    store.mu.Lock()
+    store.follower = f
+    store.mu.Unlock()
+    return f
+}
+
+// Run replicates from the leader until Stop, reconnecting after any error.
+func (f *Follower) Run() {
+    defer close(f.stopped)
+    for {
+        err := f.replicate()
+        f.mu.Lock()
+        f.connected = false
+        f.lastError = err.Error()
+        f.mu.Unlock()
+        select {
+        case <-f.stop:
+            return
+        default:
+        }
+        fmt.Println("Replication error, reconnecting:", err)
+        select {
+        case <-f.stop:
+            return
+        case <-time.After(followerRetry):
+        }
+    }
+}
+
+// Stop ends Run and waits for it, so no change is applied after Stop
+// returns. Run must have been started.
+func (f *Follower) Stop() {
+    f.mu.Lock()
+    select {
+    case <-f.stop:
+    default:
+        close(f.stop)
+        if f.conn != nil {
+            f.conn.Close()
+        }
+    }
+    f.mu.Unlock()
+    <-f.stopped
+}
+
+// leaderConn is a follower's connection to its leader.
+type leaderConn struct {
+    conn   net.Conn
+    client *rpc.Client
+}
+
+// call invokes method with a deadline, so a leader that stopped answering
+// or a link that went dead fails the call instead of hanging it.
+func (c *leaderConn) call(method string, args, reply interface{}, timeout time.Duration) error {
+    c.conn.SetDeadline(time.Now().Add(timeout))
+    return c.client.Call(method, args, reply)
+}
+
+// replicate does one connection's worth of work: a full sync if needed,
+// then streaming changes until something goes wrong. Stream answers within
+// streamWait even when nothing changes, which doubles as the heartbeat.
+func (f *Follower) replicate() error {
+    conn, err := dialRPC(f.leaderAddr, f.timeout)
+    if err != nil {
+        return err
+    }
+    c := &leaderConn{conn: conn, client: rpc.NewClient(conn)}
+    defer c.client.Close()
+    f.mu.Lock()
+    f.conn = conn
+    f.mu.Unlock()
+    select {
+    case <-f.stop:
+        return errors.New("replication stopped")
+    default:
+    }
+    conn.SetDeadline(time.Now().Add(f.timeout))
+    if err := login(c.client); err != nil {
+        return err
+    }
+
+    f.mu.Lock()
+    runID := f.runID
+    f.mu.Unlock()
+    if runID == "" {
+        if err := f.fullSync(c); err != nil {
+            return err
+        }
+    }
+
+    for {
+        req := StreamRequest{FollowerID: f.id, RunID: f.currentRunID(), From: f.store.revision()}
+        var resp StreamResponse
+        if err := c.call("Replication.Stream", &req, &resp, streamWait+f.timeout); err != nil {
+            return err
+        }
+        if resp.Resync {
+            if err := f.fullSync(c); err != nil {
+                return err
+            }
+            continue
+        }
+        f.store.applyChanges(resp.Changes)
+
+        f.mu.Lock()
+        f.connected = true
+        f.leaderRev = resp.Rev
+        f.lastContact = time.Now()
+        f.lastError = ""
+        f.mu.Unlock()
+    }
+}
+
+// fullSync replaces the local store with a snapshot from the leader.
+func (f *Follower) fullSync(c *leaderConn) error {
+    var resp SyncResponse
+    if err := c.call("Replication.Sync", &SyncRequest{FollowerID: f.id}, &resp, syncTimeout); err != nil {
+        return err
+    }
+    _, _, entries, err := readSnapshotBytes(resp.Snapshot)
+    if err != nil {
+        return fmt.Errorf("read leader snapshot: %w", err)
+    }
+    f.store.restore(resp.Rev, entries)
+
+    leaderHTTP := resolveHTTPAddr(resp.LeaderHTTP, f.leaderAddr)
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.runID = resp.RunID
+    f.leaderRev = resp.Rev
+    f.leaderHTTP = leaderHTTP
+    f.connected = true
+    f.lastContact = time.Now()
+    fmt.Printf("Synced %d keys from leader %s at revision %d\n", len(entries), f.leaderAddr, resp.Rev)
+    return nil
+}
+
+func (f *Follower) currentRunID() string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.runID
+}
+
+// LeaderHTTP returns the leader's HTTP address, or "" before the first sync.
+func (f *Follower) LeaderHTTP() string {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.leaderHTTP
+}
+
+// ReplicationStatus is returned by the /replication/status endpoint.
+type ReplicationStatus struct {
+    Role         string           `json:"role"`
+    Rev          uint64           `json:"rev"`
+    Leader       string           `json:"leader,omitempty"`
+    LeaderRev    uint64           `json:"leader_rev,omitempty"`
+    Lag          uint64           `json:"lag"`
+    SinceContact float64          `json:"seconds_since_contact,omitempty"`
+    Connected    bool             `json:"connected,omitempty"`
+    LastContact  *time.Time       `json:"last_contact,omitempty"`
+    LastError    string           `json:"last_error,omitempty"`
+    Followers    []*followerState `json:"followers,omitempty"`
+}
+
+func (f *Follower) status() ReplicationStatus {
+    rev := f.store.revision()
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    st := ReplicationStatus{
+        Role:      "follower",
+        Rev:       rev,
+        Leader:    f.leaderAddr,
+        LeaderRev: f.leaderRev,
+        Connected: f.connected,
+        LastError: f.lastError,
+    }
+    if f.leaderRev > rev {
+        st.Lag = f.leaderRev - rev
+    }
+    if !f.lastContact.IsZero() {
+        last := f.lastContact
+        st.LastContact = &last
+        st.SinceContact = time.Since(last).Seconds()
+    }
+    return st
+}
+
+func (r *Replication) status() ReplicationStatus {
+    rev := r.store.revision()
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    st := ReplicationStatus{Role: "leader", Rev: rev}
+    for _, f := range r.followers {
+        c := *f
+        if rev > c.AckedRev {
+            c.Lag = rev - c.AckedRev
+        }
+        st.Followers = append(st.Followers, &c)
+    }
+    return st
+}
+
+// replicationStatusHandler reports the role of this node and how far behind
+// its followers (or it, as a follower) are.
+func replicationStatusHandler(repl *Replication, follower *Follower) http.HandlerFunc {
+    return func(w http.ResponseWriter, r *http.Request) {
+        if !authorized(w, r, "Replication.Status", nil) {
+            return
+        }
+        var st ReplicationStatus
+        switch {
+        case follower != nil:
+            st = follower.status()
+        case repl != nil:
+            st = repl.status()
+        default:
+            st = ReplicationStatus{Role: "standalone"}
+        }
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: st})
+    }
+}
+
+// resolveHTTPAddr turns an HTTP address like ":6060" into one reachable from
+// here, using the host of the RPC address we reached that node on.
+func resolveHTTPAddr(httpAddr, rpcAddr string) string {
+    if !strings.HasPrefix(httpAddr, ":") {
+        return httpAddr
+    }
+    host, _, err := net.SplitHostPort(rpcAddr)
+    if err != nil || host == "" {
+        return httpAddr
+    }
+    return net.JoinHostPort(host, httpAddr[1:])
+}
+
+// newRunID returns a random identifier for this run of the leader.
+func newRunID() string {
+    b := make([]byte, 8)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+    "io"
+    "net"
+    "testing"
+    "time"
+)
+
+// hungLeader listens for followers and never answers them.
+func hungLeader(t *testing.T) string {
+    t.Helper()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { l.Close() })
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            go io.Copy(io.Discard, conn)
+        }
+    }()
+    return l.Addr().String()
+}
+
+func TestFollowerLeaderHangs(t *testing.T) {
+    f := NewFollower(NewInMemoryStore(), "f1", hungLeader(t))
+    f.timeout = 100 * time.Millisecond
+    f.runID = "synced before"
+    done := make(chan error, 1)
+    go func() { done <- f.replicate() }()
+    select {
+    case err := <-done:
+        if err == nil {
+            t.Fatal("replicate returned without an error")
+        }
+    case <-time.After(streamWait + 5*time.Second):
+        t.Fatal("the follower waits forever for a leader that does not answer")
+    }
+}
+
+func TestFollowerStop(t *testing.T) {
+    f := NewFollower(NewInMemoryStore(), "f1", hungLeader(t))
+    go f.Run()
+    time.Sleep(50 * time.Millisecond)
+    stopped := make(chan struct{})
+    go func() {
+        f.Stop()
+        close(stopped)
+    }()
+    select {
+    case <-stopped:
+    case <-time.After(2 * time.Second):
+        t.Fatal("Stop waits for the call to the leader")
+    }
+}
@@ -0,0 +1,463 @@
+package main
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "net"
+    "slices"
+    "strconv"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    respBulkChunk = 64 << 10 // bulks are read this much at a time, see readBulk
+    respRedisVer  = "7.0.0"  // reported to clients, which pick features by it
+)
+
+var errRESPProtocol = errors.New("Protocol error")
+
+// respLimits bound the size of one command.
+type respLimits struct {
+    args   int // elements in one command
+    bulk   int // bytes in one argument
+    inline int // bytes in an inline command or a header line
+}
+
+var (
+    respLimitsUser = respLimits{args: 1 << 20, bulk: 512 << 20, inline: 64 << 10}
+    // Before logging in on a server with an ACL a client can only AUTH or
+    // HELLO, which need a few short arguments.
+    respLimitsAnon = respLimits{args: 16, bulk: 4 << 10, inline: 4 << 10}
+)
+
+// RESPServer serves the store over the Redis protocol, RESP2 and RESP3, so
+// stock Redis clients and tools such as redis-benchmark can talk to it.
+type RESPServer struct {
+    store    *InMemoryStore
+    started  time.Time
+    port     string
+    clients  atomic.Int64 // connected clients
+    lastID   atomic.Int64
+    commands map[string]respCommand
+    acl      *ACL      // nil when every client may do anything
+    settings *Settings // served by CONFIG, nil to serve none
+    cursors  scanCursors
+
+    mu       sync.Mutex
+    listener net.Listener
+    conns    *connSet
+}
+
+// NewRESPServer creates a RESP server for store. With an acl, clients have
+// to log in with AUTH or HELLO first.
+func NewRESPServer(store *InMemoryStore, acl *ACL) *RESPServer {
+    srv := &RESPServer{store: store, started: time.Now(), acl: acl, conns: newConnSet()}
+    srv.commands = respCommands()
+    return srv
+}
+
+// Serve accepts connections on l and handles each in its own goroutine,
+// until Close.
+func (srv *RESPServer) Serve(l net.Listener) error {
+    if _, port, err := net.SplitHostPort(l.Addr().String()); err == nil {
+        srv.port = port
+    }
+    srv.mu.Lock()
+    srv.listener = l
+    srv.mu.Unlock()
+    for {
+        conn, err := l.Accept()
+        if err != nil {
+            var ne net.Error
+            if errors.As(err, &ne) && ne.Timeout() {
+                continue
+            }
+            if errors.Is(err, net.ErrClosed) {
+                return nil
+            }
+            return err
+        }
+        go srv.conns.serve(conn, srv.serveConn)
+    }
+}
+
+// Close stops accepting connections. The open ones are ended with
+// srv.conns.drain.
+func (srv *RESPServer) Close() error {
+    srv.mu.Lock()
+    defer srv.mu.Unlock()
+    if srv.listener == nil {
+        return nil
+    }
+    return srv.listener.Close()
+}
+
+// respConn is one client connection.
+type respConn struct {
+    srv  *RESPServer
+    id   int64
+    name string
+    user *ACLUser // who logged in with AUTH or HELLO
+    r    *bufio.Reader
+    w    *respWriter
+    quit bool
+}
+
+func (srv *RESPServer) serveConn(conn net.Conn) {
+    defer conn.Close()
+    user, err := srv.acl.handshake(conn)
+    if err != nil {
+        return
+    }
+    srv.clients.Add(1)
+    defer srv.clients.Add(-1)
+    metrics.respClients.Add(1)
+    defer metrics.respClients.Add(-1)
+
+    c := &respConn{
+        srv:  srv,
+        id:   srv.lastID.Add(1),
+        user: user,
+        r:    bufio.NewReader(conn),
+        w:    &respWriter{w: bufio.NewWriter(conn), proto: 2},
+    }
+    for !c.quit {
+        args, err := readCommand(c.r, c.limits())
+        if err != nil {
+            if errors.Is(err, errRESPProtocol) {
+                c.w.error("ERR " + err.Error())
+                c.w.flush()
+            }
+            return
+        }
+        if len(args) > 0 {
+            c.dispatch(args)
+        }
+        // Pipelined commands are answered in one write once the input
+        // buffer has been drained.
+        if c.r.Buffered() == 0 || c.quit {
+            if err := c.w.flush(); err != nil {
+                return
+            }
+        }
+    }
+}
+
+// limits returns the limits of the next command: the small ones until the
+// client has logged in, when the server has an ACL.
+func (c *respConn) limits() respLimits {
+    if c.srv.acl != nil && c.user == nil {
+        return respLimitsAnon
+    }
+    return respLimitsUser
+}
+
+// dispatch looks up and runs one command.
+func (c *respConn) dispatch(args []string) {
+    name := strings.ToUpper(args[0])
+    cmd, ok := c.srv.commands[name]
+    if !ok {
+        c.w.error(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+        return
+    }
+    if (cmd.arity > 0 && len(args) != cmd.arity) || (cmd.arity < 0 && len(args) < -cmd.arity) {
+        c.w.error(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+        return
+    }
+    start, failed := time.Now(), c.w.errors
+    defer func() { metrics.observe("resp", strings.ToLower(name), time.Since(start), c.w.errors > failed) }()
+    if c.srv.acl != nil && name != "AUTH" && name != "HELLO" && name != "QUIT" {
+        var needs []need
+        if cmd.needs != nil {
+            needs = cmd.needs(args)
+        }
+        if err := c.srv.acl.authorize(c.user, needs); err != nil {
+            c.w.error(err.Error())
+            return
+        }
+    }
+    cmd.handler(c, args)
+}
+
+// readCommand reads one command, either as an array of bulk strings (what
+// client libraries send) or as an inline line of words (what people type
+// into telnet), within limits.
+func readCommand(r *bufio.Reader, limits respLimits) ([]string, error) {
+    b, err := r.Peek(1)
+    if err != nil {
+        return nil, err
+    }
+    if b[0] != '*' {
+        line, err := readLine(r, limits.inline)
+        if err != nil {
+            return nil, err
+        }
+        return strings.Fields(line), nil
+    }
+
+    line, err := readLine(r, limits.inline)
+    if err != nil {
+        return nil, err
+    }
+    n, err := strconv.Atoi(line[1:])
+    if err != nil || n > limits.args {
+        return nil, fmt.Errorf("%w: invalid multibulk length", errRESPProtocol)
+    }
+    args := make([]string, 0, min(max(n, 0), 64))
+    for i := 0; i < n; i++ {
+        line, err := readLine(r, limits.inline)
+        if err != nil {
+            return nil, err
+        }
+        if len(line) == 0 || line[0] != '$' {
+            return nil, fmt.Errorf("%w: expected '$', got '%s'", errRESPProtocol, line[:min(len(line), 1)])
+        }
+        size, err := strconv.Atoi(line[1:])
+        if err != nil || size < 0 || size > limits.bulk {
+            return nil, fmt.Errorf("%w: invalid bulk length", errRESPProtocol)
+        }
+        arg, err := readBulk(r, size)
+        if err != nil {
+            return nil, err
+        }
+        args = append(args, arg)
+    }
+    return args, nil
+}
+
+// readBulk reads a bulk string of size bytes and the CRLF after it. The
+// buffer grows with the data that arrived rather than being made for size
+// up front, so a client cannot make the server allocate a large bulk by
+// only announcing it.
+func readBulk(r *bufio.Reader, size int) (string, error) {
+    buf := make([]byte, 0, min(size, respBulkChunk))
+    for len(buf) < size {
+        n := min(size-len(buf), max(len(buf), respBulkChunk))
+        buf = slices.Grow(buf, n)[:len(buf)+n]
+        if _, err := io.ReadFull(r, buf[len(buf)-n:]); err != nil {
+            return "", err
+        }
+    }
+    var crlf [2]byte
+    if _, err := io.ReadFull(r, crlf[:]); err != nil {
+        return "", err
+    }
+    if crlf != [2]byte{'\r', '\n'} {
+        return "", fmt.Errorf("%w: bulk string not terminated by CRLF", errRESPProtocol)
+    }
+    return string(buf), nil
+}
+
+// readLine reads a line ending in \r\n (or a bare \n) without the terminator.
+func readLine(r *bufio.Reader, limit int) (string, error) {
+    var line []byte
+    for {
+        chunk, err := r.ReadSlice('\n')
+        line = append(line, chunk...)
+        if err == nil {
+            break
+        }
+        if err != bufio.ErrBufferFull {
+            return "", err
+        }
+        if len(line) > limit {
+            return "", fmt.Errorf("%w: too big inline request", errRESPProtocol)
+        }
+    }
+    line = line[:len(line)-1]
+    if len(line) > 0 && line[len(line)-1] == '\r' {
+        line = line[:len(line)-1]
+    }
+    return string(line), nil
+}
+
+// respWriter encodes replies. proto is the protocol version the client
+// chose with HELLO; RESP3 has its own null and map types.
+type respWriter struct {
+    w      *bufio.Writer
+    proto  int
+    err    error
+    errors int // error replies written, for the metrics
+}
+
+func (w *respWriter) write(s string) {
+    if w.err == nil {
+        _, w.err = w.w.WriteString(s)
+    }
+}
+
+func (w *respWriter) flush() error {
+    if w.err == nil {
+        w.err = w.w.Flush()
+    }
+    return w.err
+}
+
+func (w *respWriter) simple(s string) {
+    w.write("+" + s + "\r\n")
+}
+
+// error writes an error reply. msg starts with an error code such as ERR.
+func (w *respWriter) error(msg string) {
+    w.errors++
+    w.write("-" + strings.NewReplacer("\r", " ", "\n", " ").Replace(msg) + "\r\n")
+}
+
+func (w *respWriter) integer(n int64) {
+    w.write(":" + strconv.FormatInt(n, 10) + "\r\n")
+}
+
+func (w *respWriter) bulk(s string) {
+    w.write("$" + strconv.Itoa(len(s)) + "\r\n" + s + "\r\n")
+}
+
+func (w *respWriter) null() {
+    if w.proto == 3 {
+        w.write("_\r\n")
+        return
+    }
+    w.write("$-1\r\n")
+}
+
+func (w *respWriter) array(n int) {
+    w.write("*" + strconv.Itoa(n) + "\r\n")
+}
+
+// mapHeader starts a map of n pairs, sent as a flat array to RESP2 clients.
+func (w *respWriter) mapHeader(n int) {
+    if w.proto == 3 {
+        w.write("%" + strconv.Itoa(n) + "\r\n")
+        return
+    }
+    w.array(2 * n)
+}
+
+func (w *respWriter) bulks(values []string) {
+    w.array(len(values))
+    for _, v := range values {
+        w.bulk(v)
+    }
+}
+
+// reply writes a command result. Maps are sent as maps to RESP3 clients
+// and as flat arrays to RESP2 clients.
+func (w *respWriter) reply(r Reply) {
+    switch r.Kind {
+    case ReplyInt:
+        w.integer(r.Int)
+    case ReplyString:
+        w.bulk(r.Str)
+    case ReplyArray:
+        w.array(len(r.Elems))
+    case ReplyMap:
+        w.mapHeader(len(r.Elems) / 2)
+    default:
+        w.null()
+    }
+    for _, e := range r.Elems {
+        w.reply(e)
+    }
+}
+
+// storeError turns an error from the store into a RESP error reply, adding
+// the generic ERR code unless the message already starts with a code.
+func (w *respWriter) storeError(err error) {
+    msg := err.Error()
+    code, _, _ := strings.Cut(msg, " ")
+    if code == "" || strings.ToUpper(code) != code {
+        msg = "ERR " + msg
+    }
+    w.error(msg)
+}
+
+// globMatch reports whether s matches the Redis-style glob pattern, which
+// supports *, ?, [abc], [^abc], [a-z] and backslash escapes. It does not
+// recurse: on a mismatch it only goes back to the last *, letting it take
+// one more byte, so it runs in O(len(pattern) * len(s)) however many *s
+// the pattern has.
+func globMatch(pattern, s string) bool {
+    p, i := 0, 0
+    star, mark := -1, 0 // pattern after the last *, and where in s it matched from
+    for i < len(s) {
+        if p < len(pattern) && pattern[p] == '*' {
+            for p < len(pattern) && pattern[p] == '*' {
+                p++
+            }
+            star, mark = p, i
+            continue
+        }
+        if p < len(pattern) {
+            if n, ok := matchOne(pattern[p:], s[i]); ok {
+                p += n
+                i++
+                continue
+            }
+        }
+        if star < 0 {
+            return false
+        }
+        mark++
+        p, i = star, mark
+    }
+    for p < len(pattern) && pattern[p] == '*' {
+        p++
+    }
+    return p == len(pattern)
+}
+
+// matchOne matches c against the element the pattern starts with, other
+// than *, and returns the length of that element.
+func matchOne(pattern string, c byte) (int, bool) {
+    switch pattern[0] {
+    case '?':
+        return 1, true
+    case '[':
+        end := 1
+        for end < len(pattern) && pattern[end] != ']' {
+            if pattern[end] == '\\' {
+                end++
+            }
+            end++
+        }
+        if end >= len(pattern) {
+            return len(pattern), matchClass(pattern[1:], c) // unterminated class: use the rest
+        }
+        return end + 1, matchClass(pattern[1:end], c)
+    case '\\':
+        if len(pattern) > 1 {
+            return 2, pattern[1] == c
+        }
+    }
+    return 1, pattern[0] == c
+}
+
+// matchClass matches c against the inside of a [...] glob class.
+func matchClass(class string, c byte) bool {
+    negate := len(class) > 0 && class[0] == '^'
+    if negate {
+        class = class[1:]
+    }
+    match := false
+    for i := 0; i < len(class); i++ {
+        switch {
+        case class[i] == '\\' && i+1 < len(class):
+            i++
+            match = match || class[i] == c
+        case i+2 < len(class) && class[i+1] == '-':
+            lo, hi := class[i], class[i+2]
+            if lo > hi {
+                lo, hi = hi, lo
+            }
+            match = match || (c >= lo && c <= hi)
+            i += 2
+        default:
+            match = match || class[i] == c
+        }
+    }
+    return match != negate
+}
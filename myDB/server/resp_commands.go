@@ -0,0 +1,813 @@
+package main
+
+import (
+    "crypto/rand"
+    "encoding/binary"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+    "strings"
+    "sync"
+    "time"
+)
+
+// respCommand is one entry of the RESP command table. arity counts the
+// command name too; a negative arity -n means at least n arguments. needs
+// returns what the command asks of the user for the ACL, see auth.go; a nil
+// needs only asks for a user that is logged in.
+type respCommand struct {
+    arity   int
+    handler func(c *respConn, args []string)
+    needs   func(args []string) []need
+}
+
+func respCommands() map[string]respCommand {
+    table := map[string]respCommand{
+        "PING":    {-1, cmdPing, nil},
+        "ECHO":    {2, cmdEcho, nil},
+        "QUIT":    {1, cmdQuit, nil},
+        "AUTH":    {-2, cmdAuth, nil},
+        "HELLO":   {-1, cmdHello, nil},
+        "SELECT":  {2, cmdSelect, nil},
+        "COMMAND": {-1, cmdCommand, nil},
+        "CLIENT":  {-2, cmdClient, nil},
+        "CONFIG":  {-2, cmdConfig, func([]string) []need { return adminNeed }},
+        "INFO":    {-1, cmdInfo, nil},
+        "DBSIZE":  {1, cmdDBSize, nil},
+        "GET":     {2, cmdGet, keyArgs(accessRead)},
+        "SET":     {-3, cmdSet, firstKeyArg(accessWrite)},
+        "DEL":     {-2, cmdDel, keyArgs(accessWrite)},
+        "EXISTS":  {-2, cmdExists, keyArgs(accessRead)},
+        "TYPE":    {2, cmdType, keyArgs(accessRead)},
+        "EXPIRE":  {3, cmdExpire, firstKeyArg(accessWrite)},
+        "PEXPIRE": {3, cmdExpire, firstKeyArg(accessWrite)},
+        "TTL":     {2, cmdTTL, keyArgs(accessRead)},
+        "PTTL":    {2, cmdTTL, keyArgs(accessRead)},
+        "PERSIST": {2, cmdPersist, keyArgs(accessWrite)},
+        "KEYS":    {2, cmdKeys, keysNeeds},
+        "SCAN":    {-2, cmdScan, respScanNeeds},
+        "MGET":    {-2, cmdMGet, keyArgs(accessRead)},
+        "MSET":    {-3, cmdMSet, msetNeeds},
+        "INCR":    {2, cmdIncr, firstKeyArg(accessWrite)},
+        "DECR":    {2, cmdIncr, firstKeyArg(accessWrite)},
+        "INCRBY":  {3, cmdIncr, firstKeyArg(accessWrite)},
+        "DECRBY":  {3, cmdIncr, firstKeyArg(accessWrite)},
+        "SETNX":   {3, cmdSetNX, firstKeyArg(accessWrite)},
+        "GETSET":  {3, cmdGetSet, firstKeyArg(accessWrite)},
+    }
+    for name, cmd := range storeCommands {
+        table[name] = respCommand{cmd.arity, func(c *respConn, args []string) { c.run(cmd, args) }, commandNeeds}
+    }
+    return table
+}
+
+// keyArgs is for commands whose arguments are all keys.
+func keyArgs(a access) func(args []string) []need {
+    return func(args []string) []need { return keyNeeds(a, args[1:]...) }
+}
+
+// firstKeyArg is for commands with one key, followed by other arguments.
+func firstKeyArg(a access) func(args []string) []need {
+    return func(args []string) []need { return keyNeeds(a, args[1]) }
+}
+
+func msetNeeds(args []string) []need {
+    var needs []need
+    for i := 1; i < len(args); i += 2 {
+        needs = append(needs, need{access: accessWrite, key: args[i]})
+    }
+    return needs
+}
+
+func keysNeeds(args []string) []need {
+    return []need{prefixNeed(accessRead, globPrefix(args[1]))}
+}
+
+// respScanNeeds asks for the keys the MATCH pattern of a SCAN can return.
+func respScanNeeds(args []string) []need {
+    pattern := "*"
+    for i := 2; i+1 < len(args); i += 2 {
+        if strings.EqualFold(args[i], "MATCH") {
+            pattern = args[i+1]
+        }
+    }
+    return []need{prefixNeed(accessRead, globPrefix(pattern))}
+}
+
+// run runs one of the list, hash, set and sorted set commands.
+func (c *respConn) run(cmd storeCommand, args []string) {
+    if !c.owns(args[1]) || (!cmd.write && !c.readable()) {
+        return
+    }
+    reply, err := cmd.run(c.srv.store, args)
+    if err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.reply(reply)
+}
+
+const (
+    errSyntax        = "ERR syntax error"
+    errNotInt        = "ERR value is not an integer or out of range"
+    errBadScanCursor = "ERR invalid cursor"
+    scanDefault      = 10    // keys per SCAN call when COUNT is not given
+    keysPage         = 1000  // keys KEYS reads under one lock
+    maxScanCursors   = 10000 // SCAN cursors remembered, see scanCursors
+    noExpiration     = 0
+)
+
+// owns writes a MOVED error and returns false unless every key lives on
+// this node.
+func (c *respConn) owns(keys ...string) bool {
+    for _, key := range keys {
+        if owner, local := c.srv.store.route(key); !local {
+            c.w.error("MOVED " + owner)
+            return false
+        }
+    }
+    return true
+}
+
+// readable writes an error and returns false when reads may not be served here.
+func (c *respConn) readable() bool {
+    if err := c.srv.store.checkRead(); err != nil {
+        c.w.storeError(err)
+        return false
+    }
+    return true
+}
+
+func cmdPing(c *respConn, args []string) {
+    switch len(args) {
+    case 1:
+        c.w.simple("PONG")
+    case 2:
+        c.w.bulk(args[1])
+    default:
+        c.w.error("ERR wrong number of arguments for 'ping' command")
+    }
+}
+
+func cmdEcho(c *respConn, args []string) {
+    c.w.bulk(args[1])
+}
+
+func cmdQuit(c *respConn, args []string) {
+    c.w.simple("OK")
+    c.quit = true
+}
+
+// cmdHello switches between RESP2 and RESP3 and describes the server.
+func cmdHello(c *respConn, args []string) {
+    proto := c.w.proto
+    if len(args) > 1 {
+        n, err := strconv.Atoi(args[1])
+        if err != nil || n < 2 || n > 3 {
+            c.w.error("NOPROTO unsupported protocol version")
+            return
+        }
+        proto = n
+    }
+    for i := 2; i < len(args); i++ {
+        switch strings.ToUpper(args[i]) {
+        case "SETNAME":
+            if i+1 == len(args) {
+                c.w.error(errSyntax)
+                return
+            }
+            c.name = args[i+1]
+            i++
+        case "AUTH":
+            if i+2 >= len(args) {
+                c.w.error(errSyntax)
+                return
+            }
+            if !c.login(args[i+1], args[i+2]) {
+                return
+            }
+            i += 2
+        default:
+            c.w.error(errSyntax)
+            return
+        }
+    }
+    if c.srv.acl != nil && c.user == nil {
+        c.w.error(errNoAuth.Error())
+        return
+    }
+    c.w.proto = proto
+
+    c.w.mapHeader(7)
+    c.w.bulk("server")
+    c.w.bulk("mydb")
+    c.w.bulk("version")
+    c.w.bulk(respRedisVer)
+    c.w.bulk("proto")
+    c.w.integer(int64(proto))
+    c.w.bulk("id")
+    c.w.integer(c.id)
+    c.w.bulk("mode")
+    c.w.bulk("standalone")
+    c.w.bulk("role")
+    c.w.bulk(c.srv.role())
+    c.w.bulk("modules")
+    c.w.array(0)
+}
+
+// cmdAuth implements AUTH token and AUTH username password.
+func cmdAuth(c *respConn, args []string) {
+    switch len(args) {
+    case 2:
+        if c.login("", args[1]) {
+            c.w.simple("OK")
+        }
+    case 3:
+        if c.login(args[1], args[2]) {
+            c.w.simple("OK")
+        }
+    default:
+        c.w.error(errSyntax)
+    }
+}
+
+// login authenticates the connection as name, or with an API token when
+// name is empty, and writes an error unless that worked.
+func (c *respConn) login(name, secret string) bool {
+    if c.srv.acl == nil {
+        c.w.error(errNoUsers.Error())
+        return false
+    }
+    u, err := c.srv.acl.authenticate(name, secret)
+    if err != nil {
+        c.w.error(err.Error())
+        return false
+    }
+    c.user = u
+    return true
+}
+
+func cmdSelect(c *respConn, args []string) {
+    if args[1] != "0" {
+        c.w.error("ERR DB index is out of range")
+        return
+    }
+    c.w.simple("OK")
+}
+
+// cmdCommand answers the introspection calls clients make on connect. The
+// command docs are left empty.
+func cmdCommand(c *respConn, args []string) {
+    if len(args) > 1 && strings.ToUpper(args[1]) == "COUNT" {
+        c.w.integer(int64(len(c.srv.commands)))
+        return
+    }
+    c.w.array(0)
+}
+
+func cmdClient(c *respConn, args []string) {
+    switch strings.ToUpper(args[1]) {
+    case "SETNAME":
+        if len(args) != 3 {
+            c.w.error(errSyntax)
+            return
+        }
+        c.name = args[2]
+        c.w.simple("OK")
+    case "GETNAME":
+        if c.name == "" {
+            c.w.null()
+            return
+        }
+        c.w.bulk(c.name)
+    case "ID":
+        c.w.integer(c.id)
+    case "SETINFO":
+        c.w.simple("OK")
+    default:
+        c.w.error(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+    }
+}
+
+// cmdConfig answers CONFIG GET pattern... with the matching settings and
+// CONFIG SET name value by changing a setting that can change at runtime.
+// Without settings, as in tests, CONFIG GET returns nothing, which is what
+// tools like redis-benchmark expect from a server they cannot configure.
+func cmdConfig(c *respConn, args []string) {
+    st := c.srv.settings
+    switch sub := strings.ToUpper(args[1]); {
+    case sub == "GET" && len(args) > 2:
+        found := make(map[string]string)
+        for _, pattern := range args[2:] {
+            var resp ConfigResponse
+            if st != nil {
+                st.Get(&ConfigRequest{Pattern: pattern}, &resp)
+            }
+            for name, value := range resp.Settings {
+                found[name] = value
+            }
+        }
+        names := make([]string, 0, len(found))
+        for name := range found {
+            names = append(names, name)
+        }
+        sort.Strings(names)
+        c.w.mapHeader(len(names))
+        for _, name := range names {
+            c.w.bulk(name)
+            c.w.bulk(found[name])
+        }
+    case sub == "SET" && len(args) == 4:
+        if st == nil {
+            c.w.error("ERR settings cannot be changed on this server")
+            return
+        }
+        if err := st.Set(&ConfigRequest{Name: args[2], Value: args[3]}, &ConfigResponse{}); err != nil {
+            c.w.storeError(err)
+            return
+        }
+        c.w.simple("OK")
+    case sub == "GET" || sub == "SET":
+        c.w.error(fmt.Sprintf("ERR wrong number of arguments for 'config|%s' command", strings.ToLower(sub)))
+    default:
+        c.w.error(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+    }
+}
+
+func cmdInfo(c *respConn, args []string) {
+    section := "default"
+    if len(args) > 1 {
+        section = strings.ToLower(args[1])
+    }
+    c.w.bulk(c.srv.info(section))
+}
+
+func cmdDBSize(c *respConn, args []string) {
+    keys, _ := c.srv.store.keyStats()
+    c.w.integer(int64(keys))
+}
+
+func cmdGet(c *respConn, args []string) {
+    if !c.owns(args[1]) || !c.readable() {
+        return
+    }
+    v, exists, err := c.srv.store.lookup(args[1])
+    switch {
+    case err != nil:
+        c.w.storeError(err)
+    case exists:
+        c.w.bulk(v.Value)
+    default:
+        c.w.null()
+    }
+}
+
+// cmdSet implements SET key value [NX|XX] [GET] [EX s|PX ms|EXAT ts|PXAT ts|KEEPTTL].
+func cmdSet(c *respConn, args []string) {
+    key, value := args[1], args[2]
+    var nx, xx, get, keepTTL, hasExp bool
+    expiration := int64(noExpiration)
+    for i := 3; i < len(args); i++ {
+        switch opt := strings.ToUpper(args[i]); opt {
+        case "NX":
+            nx = true
+        case "XX":
+            xx = true
+        case "GET":
+            get = true
+        case "KEEPTTL":
+            keepTTL = true
+        case "EX", "PX", "EXAT", "PXAT":
+            if hasExp || i+1 == len(args) {
+                c.w.error(errSyntax)
+                return
+            }
+            n, err := strconv.ParseInt(args[i+1], 10, 64)
+            if err != nil {
+                c.w.error(errNotInt)
+                return
+            }
+            exp, ok := expirationFor(opt, n)
+            if n <= 0 || !ok {
+                c.w.error("ERR invalid expire time in 'set' command")
+                return
+            }
+            expiration = exp
+            hasExp = true
+            i++
+        default:
+            c.w.error(errSyntax)
+            return
+        }
+    }
+    if (nx && xx) || (keepTTL && hasExp) {
+        c.w.error(errSyntax)
+        return
+    }
+    if !c.owns(key) {
+        return
+    }
+
+    var old string
+    var existed, applied bool
+    err := c.srv.store.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if get && exists && v.Type != TypeString {
+            return nil, errWrongType
+        }
+        old, existed = v.Value, exists
+        if (nx && exists) || (xx && !exists) {
+            return nil, nil
+        }
+        m := Mutation{Op: OpSet, Key: key, Value: value, Expiration: expiration}
+        if keepTTL {
+            m.Expiration = v.Expiration
+        }
+        applied = true
+        return &m, nil
+    })
+    switch {
+    case err != nil:
+        c.w.storeError(err)
+    case get && existed:
+        c.w.bulk(old)
+    case get || !applied:
+        c.w.null()
+    default:
+        c.w.simple("OK")
+    }
+}
+
+func cmdDel(c *respConn, args []string) {
+    if !c.owns(args[1:]...) {
+        return
+    }
+    var deleted int64
+    for _, key := range args[1:] {
+        existed, err := c.srv.store.remove(key)
+        if err != nil {
+            c.w.storeError(err)
+            return
+        }
+        if existed {
+            deleted++
+        }
+    }
+    c.w.integer(deleted)
+}
+
+func cmdExists(c *respConn, args []string) {
+    if !c.owns(args[1:]...) || !c.readable() {
+        return
+    }
+    var n int64
+    for _, key := range args[1:] {
+        if _, exists := c.srv.store.entry(key); exists {
+            n++
+        }
+    }
+    c.w.integer(n)
+}
+
+func cmdType(c *respConn, args []string) {
+    if !c.owns(args[1]) || !c.readable() {
+        return
+    }
+    if v, exists := c.srv.store.entry(args[1]); exists {
+        c.w.simple(v.Type.String())
+    } else {
+        c.w.simple("none")
+    }
+}
+
+// cmdExpire implements EXPIRE and PEXPIRE. A time that is not in the future
+// deletes the key, as in Redis.
+func cmdExpire(c *respConn, args []string) {
+    n, err := strconv.ParseInt(args[2], 10, 64)
+    if err != nil {
+        c.w.error(errNotInt)
+        return
+    }
+    if !c.owns(args[1]) {
+        return
+    }
+    unit := "EX"
+    if strings.ToUpper(args[0]) == "PEXPIRE" {
+        unit = "PX"
+    }
+    expiration, ok := expirationFor(unit, n)
+    if !ok {
+        c.w.error(fmt.Sprintf("ERR invalid expire time in '%s' command", strings.ToLower(args[0])))
+        return
+    }
+    var found bool
+    if n <= 0 {
+        found, err = c.srv.store.remove(args[1])
+    } else {
+        found, err = c.srv.store.expireAt(args[1], expiration)
+    }
+    if err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.integer(boolInt(found))
+}
+
+// cmdTTL implements TTL and PTTL: -2 for a missing key, -1 for a key
+// without an expiration.
+func cmdTTL(c *respConn, args []string) {
+    if !c.owns(args[1]) || !c.readable() {
+        return
+    }
+    v, exists := c.srv.store.entry(args[1])
+    switch {
+    case !exists:
+        c.w.integer(-2)
+    case v.Expiration == noExpiration:
+        c.w.integer(-1)
+    default:
+        ms := max(v.Expiration-time.Now().UnixMilli(), 0)
+        if strings.ToUpper(args[0]) == "TTL" {
+            ms = (ms + 500) / 1000
+        }
+        c.w.integer(ms)
+    }
+}
+
+func cmdPersist(c *respConn, args []string) {
+    if !c.owns(args[1]) {
+        return
+    }
+    _, changed, err := c.srv.store.Persist(args[1])
+    if err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.integer(boolInt(changed))
+}
+
+// cmdKeys walks, in order, only the keys starting with the literal part of
+// the pattern, a page at a time so writers get the lock in between.
+func cmdKeys(c *respConn, args []string) {
+    if !c.readable() {
+        return
+    }
+    prefix := globPrefix(args[1])
+    start, end := prefix, prefixEnd(prefix)
+    keys := []string{}
+    for {
+        entries, more := c.srv.store.scanLocal(start, end, keysPage, false)
+        for _, e := range entries {
+            if globMatch(args[1], e.Key) {
+                keys = append(keys, e.Key)
+            }
+        }
+        if !more {
+            break
+        }
+        start = entries[len(entries)-1].Key + "\x00"
+    }
+    c.w.bulks(keys)
+}
+
+// cmdScan implements SCAN cursor [MATCH pattern] [COUNT n] [TYPE type].
+// Like Scan it pages through the key index in order, visiting COUNT keys
+// that start with the literal part of the pattern, and continues after the
+// last key of the previous page, so every key present for the whole scan
+// is returned once even when other keys come and go in between. See
+// scanCursors for how that key becomes a numeric cursor.
+func cmdScan(c *respConn, args []string) {
+    cursor, err := strconv.ParseUint(args[1], 10, 64)
+    if err != nil {
+        c.w.error(errBadScanCursor)
+        return
+    }
+    pattern, count, typ := "*", scanDefault, ""
+    for i := 2; i < len(args); i++ {
+        if i+1 == len(args) {
+            c.w.error(errSyntax)
+            return
+        }
+        switch strings.ToUpper(args[i]) {
+        case "MATCH":
+            pattern = args[i+1]
+        case "COUNT":
+            n, err := strconv.Atoi(args[i+1])
+            if err != nil || n < 1 {
+                c.w.error(errSyntax)
+                return
+            }
+            count = n
+        case "TYPE":
+            typ = strings.ToLower(args[i+1])
+        default:
+            c.w.error(errSyntax)
+            return
+        }
+        i++
+    }
+    if !c.readable() {
+        return
+    }
+
+    prefix := globPrefix(pattern)
+    start, end := prefix, prefixEnd(prefix)
+    if cursor != 0 {
+        after, ok := c.srv.cursors.get(cursor)
+        if !ok {
+            c.w.error(errBadScanCursor)
+            return
+        }
+        start = max(start, after+"\x00")
+    }
+    entries, more := c.srv.store.scanLocal(start, end, count, false)
+    keys := []string{}
+    for _, e := range entries {
+        t := e.Type
+        if t == "" {
+            t = TypeString.String()
+        }
+        if globMatch(pattern, e.Key) && (typ == "" || typ == t) {
+            keys = append(keys, e.Key)
+        }
+    }
+    var next uint64
+    if more {
+        next = c.srv.cursors.put(entries[len(entries)-1].Key)
+    }
+
+    c.w.array(2)
+    c.w.bulk(strconv.FormatUint(next, 10))
+    c.w.bulks(keys)
+}
+
+// scanCursors keeps the last key of every SCAN page under a random number,
+// which is the cursor handed to the client: Redis clients parse cursors as
+// integers, so the key cannot be the cursor itself as it is for Scan. The
+// cursors are shared by all connections, as pooled clients may continue a
+// scan on another one, and the oldest are forgotten beyond maxScanCursors.
+type scanCursors struct {
+    mu    sync.Mutex
+    after map[uint64]string
+    order []uint64 // oldest first
+}
+
+func (sc *scanCursors) put(key string) uint64 {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+    if sc.after == nil {
+        sc.after = make(map[uint64]string)
+    }
+    var b [8]byte
+    var id uint64
+    for id == 0 || sc.after[id] != "" {
+        rand.Read(b[:])
+        id = binary.BigEndian.Uint64(b[:]) >> 1 // fits an int64 for clients that parse it as one
+    }
+    sc.after[id] = key
+    sc.order = append(sc.order, id)
+    if len(sc.order) > maxScanCursors {
+        delete(sc.after, sc.order[0])
+        sc.order = sc.order[1:]
+    }
+    return id
+}
+
+func (sc *scanCursors) get(id uint64) (string, bool) {
+    sc.mu.Lock()
+    defer sc.mu.Unlock()
+    key, ok := sc.after[id]
+    return key, ok
+}
+
+func cmdMGet(c *respConn, args []string) {
+    if !c.owns(args[1:]...) || !c.readable() {
+        return
+    }
+    c.w.array(len(args) - 1)
+    for _, key := range args[1:] {
+        if v, exists, err := c.srv.store.lookup(key); err == nil && exists {
+            c.w.bulk(v.Value)
+        } else {
+            c.w.null()
+        }
+    }
+}
+
+func cmdMSet(c *respConn, args []string) {
+    if len(args)%2 != 1 {
+        c.w.error("ERR wrong number of arguments for 'mset' command")
+        return
+    }
+    ops := make([]TxnOp, 0, len(args)/2)
+    keys := make([]string, 0, len(args)/2)
+    for i := 1; i < len(args); i += 2 {
+        ops = append(ops, TxnOp{Op: "set", Key: args[i], Value: args[i+1]})
+        keys = append(keys, args[i])
+    }
+    if !c.owns(keys...) {
+        return
+    }
+    // A transaction without conditions, so the keys are logged and
+    // applied as one batch and no one ever sees only some of them set.
+    if _, err := c.srv.store.Txn(nil, ops); err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.simple("OK")
+}
+
+// cmdIncr implements INCR, DECR, INCRBY and DECRBY.
+func cmdIncr(c *respConn, args []string) {
+    delta := int64(1)
+    if len(args) == 3 {
+        n, err := strconv.ParseInt(args[2], 10, 64)
+        if err != nil {
+            c.w.error(errNotInt)
+            return
+        }
+        delta = n
+    }
+    if strings.HasPrefix(strings.ToUpper(args[0]), "DECR") {
+        if delta == math.MinInt64 {
+            c.w.storeError(errOverflow)
+            return
+        }
+        delta = -delta
+    }
+    if !c.owns(args[1]) {
+        return
+    }
+    n, err := c.srv.store.IncrBy(args[1], delta)
+    if err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.integer(n)
+}
+
+func cmdSetNX(c *respConn, args []string) {
+    if !c.owns(args[1]) {
+        return
+    }
+    set, err := c.srv.store.setNX(args[1], args[2], noExpiration)
+    if err != nil {
+        c.w.storeError(err)
+        return
+    }
+    c.w.integer(boolInt(set))
+}
+
+func cmdGetSet(c *respConn, args []string) {
+    if !c.owns(args[1]) {
+        return
+    }
+    old, existed, err := c.srv.store.getSet(args[1], args[2], noExpiration)
+    switch {
+    case err != nil:
+        c.w.storeError(err)
+    case existed:
+        c.w.bulk(old)
+    default:
+        c.w.null()
+    }
+}
+
+// role returns the replication role in Redis terms.
+func (srv *RESPServer) role() string {
+    if _, _, self := srv.store.leader(); self {
+        return "master"
+    }
+    return "replica"
+}
+
+// info renders the INFO reply for section.
+func (srv *RESPServer) info(section string) string {
+    info := srv.store.info()
+    info.Server.port = srv.port
+    return info.text(section)
+}
+
+// expirationFor converts a SET/EXPIRE time argument into the store's
+// expiration, in Unix milliseconds. It reports false when that does not
+// fit in an int64.
+func expirationFor(unit string, n int64) (int64, bool) {
+    now := time.Now().UnixMilli()
+    switch unit {
+    case "EX":
+        return now + n*1000, n <= (math.MaxInt64-now)/1000
+    case "PX":
+        return now + n, n <= math.MaxInt64-now
+    case "EXAT":
+        return n * 1000, n <= math.MaxInt64/1000
+    default: // PXAT
+        return n, true
+    }
+}
+
+func boolInt(b bool) int64 {
+    if b {
+        return 1
+    }
+    return 0
+}
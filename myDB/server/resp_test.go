@@ -0,0 +1,251 @@
+package main
+
+import (
+    "bufio"
+    "fmt"
+    "io"
+    "net"
+    "strconv"
+    "strings"
+    "testing"
+    "time"
+)
+
+// respTestConn talks to a RESP server over a pipe.
+type respTestConn struct {
+    t    *testing.T
+    conn net.Conn
+    r    *bufio.Reader
+}
+
+func dialRESP(t *testing.T, srv *RESPServer) *respTestConn {
+    client, server := net.Pipe()
+    go srv.serveConn(server)
+    t.Cleanup(func() { client.Close() })
+    return &respTestConn{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+// do sends a command and returns its reply: a string for simple strings
+// and bulks, "-ERR ..." for errors, an int64, a []interface{} or nil.
+func (c *respTestConn) do(args ...string) interface{} {
+    c.t.Helper()
+    var b strings.Builder
+    fmt.Fprintf(&b, "*%d\r\n", len(args))
+    for _, a := range args {
+        fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+    }
+    go c.conn.Write([]byte(b.String()))
+    v, err := c.read()
+    if err != nil {
+        c.t.Fatalf("%v: %v", args, err)
+    }
+    return v
+}
+
+func (c *respTestConn) read() (interface{}, error) {
+    line, err := c.r.ReadString('\n')
+    if err != nil {
+        return nil, err
+    }
+    line = strings.TrimSuffix(line, "\r\n")
+    switch line[0] {
+    case '+':
+        return line[1:], nil
+    case '-':
+        return line, nil
+    case ':':
+        return strconv.ParseInt(line[1:], 10, 64)
+    case '$':
+        n, _ := strconv.Atoi(line[1:])
+        if n < 0 {
+            return nil, nil
+        }
+        buf := make([]byte, n+2)
+        if _, err := io.ReadFull(c.r, buf); err != nil {
+            return nil, err
+        }
+        return string(buf[:n]), nil
+    case '*':
+        n, _ := strconv.Atoi(line[1:])
+        if n < 0 {
+            return nil, nil
+        }
+        items := make([]interface{}, n)
+        for i := range items {
+            if items[i], err = c.read(); err != nil {
+                return nil, err
+            }
+        }
+        return items, nil
+    }
+    return nil, fmt.Errorf("unexpected reply %q", line)
+}
+
+func TestRESPScan(t *testing.T) {
+    s := NewInMemoryStore()
+    for i := 0; i < 50; i++ {
+        s.Set(fmt.Sprintf("user:%02d", i), "v", 0)
+        s.Set(fmt.Sprintf("other:%02d", i), "v", 0)
+    }
+    c := dialRESP(t, NewRESPServer(s, nil))
+
+    if keys := c.do("KEYS", "user:1*").([]interface{}); len(keys) != 10 || keys[0] != "user:10" {
+        t.Fatalf("keys: %v", keys)
+    }
+
+    // Keys written between the pages do not make the scan skip or repeat
+    // the keys that were there all along.
+    seen := make(map[string]int)
+    cursor := "0"
+    for page := 0; ; page++ {
+        reply := c.do("SCAN", cursor, "MATCH", "user:*", "COUNT", "7").([]interface{})
+        for _, k := range reply[1].([]interface{}) {
+            seen[k.(string)]++
+        }
+        if cursor = reply[0].(string); cursor == "0" {
+            break
+        }
+        s.Set(fmt.Sprintf("user:%02da", page), "v", 0)
+        s.Delete(fmt.Sprintf("user:%02da", page-1))
+    }
+    for i := 0; i < 50; i++ {
+        if key := fmt.Sprintf("user:%02d", i); seen[key] != 1 {
+            t.Fatalf("%s returned %d times", key, seen[key])
+        }
+    }
+    if reply := c.do("SCAN", "12345"); reply != "-"+errBadScanCursor {
+        t.Fatalf("unknown cursor: %v", reply)
+    }
+}
+
+func TestRESPLimitsBeforeAuth(t *testing.T) {
+    acl, err := NewACL(ACLConfig{Users: []ACLUser{{Name: "app", Password: "secret", Permissions: []Permission{{Access: accessWrite}}}}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    c := dialRESP(t, NewRESPServer(NewInMemoryStore(), acl))
+
+    // A bulk over the limit before AUTH ends the connection, and a large
+    // announced one does not have to be sent or allocated for that.
+    go c.conn.Write([]byte("*2\r\n$3\r\nGET\r\n$100000\r\n"))
+    if reply, _ := c.read(); reply != "-ERR Protocol error: invalid bulk length" {
+        t.Fatalf("large bulk before AUTH: %v", reply)
+    }
+
+    c = dialRESP(t, NewRESPServer(NewInMemoryStore(), acl))
+    if reply := c.do("AUTH", "app", "secret"); reply != "OK" {
+        t.Fatalf("auth: %v", reply)
+    }
+    value := strings.Repeat("v", 100000)
+    if reply := c.do("SET", "k", value); reply != "OK" {
+        t.Fatalf("large value after AUTH: %v", reply)
+    }
+    if reply := c.do("GET", "k"); reply != value {
+        t.Fatal("large value did not round trip")
+    }
+}
+
+func TestRESPSetChecks(t *testing.T) {
+    s := NewInMemoryStore()
+    c := dialRESP(t, NewRESPServer(s, nil))
+
+    // Times that would overflow the expiration are rejected, not wrapped
+    // around into the past.
+    for _, args := range [][]string{
+        {"SET", "k", "v", "EX", "9223372036854775"},
+        {"SET", "k", "v", "PX", "9223372036854775807"},
+        {"SET", "k", "v", "EXAT", "9223372036854775807"},
+    } {
+        if reply := c.do(args...); reply != "-ERR invalid expire time in 'set' command" {
+            t.Fatalf("%v: %v", args, reply)
+        }
+    }
+    c.do("SET", "k", "v")
+    if reply := c.do("EXPIRE", "k", "9223372036854775"); reply != "-ERR invalid expire time in 'expire' command" {
+        t.Fatalf("expire: %v", reply)
+    }
+    if reply := c.do("TTL", "k"); reply != int64(-1) {
+        t.Fatalf("ttl after a rejected expire: %v", reply)
+    }
+
+    // SET ... GET on another type fails and leaves the key alone.
+    c.do("RPUSH", "list", "a")
+    if reply, _ := c.do("SET", "list", "v", "GET").(string); !strings.HasPrefix(reply, "-WRONGTYPE") {
+        t.Fatalf("set get on a list: %v", reply)
+    }
+    if reply := c.do("LLEN", "list"); reply != int64(1) {
+        t.Fatalf("the list was changed: %v", reply)
+    }
+    if reply := c.do("SET", "k", "w", "GET"); reply != "v" {
+        t.Fatalf("set get: %v", reply)
+    }
+}
+
+func TestGlobMatch(t *testing.T) {
+    for _, tt := range []struct {
+        pattern, s string
+        match      bool
+    }{
+        {"*", "", true},
+        {"user:*", "user:1", true},
+        {"user:*", "use", false},
+        {"h?llo", "hello", true},
+        {"h?llo", "hllo", false},
+        {"h*llo", "hllo", true},
+        {"h[ae]llo", "hallo", true},
+        {"h[^e]llo", "hello", false},
+        {"h[a-b]llo", "hbllo", true},
+        {"h\\*llo", "h*llo", true},
+        {"h\\*llo", "hello", false},
+        {"*a*b", "xaxxbxb", true},
+        {"*a*b", "xaxxbx", false},
+        {"[abc", "c", true},
+        {"[", "x", false},
+    } {
+        if got := globMatch(tt.pattern, tt.s); got != tt.match {
+            t.Errorf("globMatch(%q, %q) = %v", tt.pattern, tt.s, got)
+        }
+    }
+
+    // Many *s against a long key that does not match take linear, not
+    // exponential, time.
+    done := make(chan bool)
+    go func() { done <- globMatch(strings.Repeat("a*", 20)+"b", strings.Repeat("a", 1000)) }()
+    select {
+    case match := <-done:
+        if match {
+            t.Fatal("matched a key without b")
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("globMatch backtracks exponentially")
+    }
+}
+
+func TestRESPMSetIsAtomic(t *testing.T) {
+    dir := t.TempDir()
+    s := NewInMemoryStore()
+    w, err := OpenWAL(dir, WALOptions{}, 0, s.replay)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s.wal = w
+    c := dialRESP(t, NewRESPServer(s, nil))
+    if reply := c.do("MSET", "a", "1", "b", "2", "a", "3"); reply != "OK" {
+        t.Fatalf("mset: %v", reply)
+    }
+    w.Close()
+
+    // The keys are logged as one record, so recovery never finds only
+    // some of them.
+    var records []Mutation
+    if w, err = OpenWAL(dir, WALOptions{}, 0, func(m Mutation) { records = append(records, m) }); err != nil {
+        t.Fatal(err)
+    }
+    w.Close()
+    if len(records) != 1 || records[0].Op != OpBatch || len(records[0].ops()) != 3 {
+        t.Fatalf("logged %+v", records)
+    }
+    if v, _, _ := s.Get("a"); v != "3" {
+        t.Fatalf("a = %s", v)
+    }
+}
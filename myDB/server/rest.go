@@ -0,0 +1,257 @@
+package main
+
+import (
+    _ "embed"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "mime"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+)
+
+var errEmptyKey = errors.New("ERR empty key")
+
+// openAPI describes the HTTP API, served at /openapi.json.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// httpError answers with status and msg as a JSON APIResponse.
+func httpError(w http.ResponseWriter, status int, msg string) {
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(APIResponse{Success: false, Error: msg})
+}
+
+// methodNotAllowed answers with 405 and the methods that are allowed.
+func methodNotAllowed(w http.ResponseWriter, allow string) {
+    w.Header().Set("Allow", allow)
+    httpError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// jsonByDefault answers every request in JSON unless its handler sets
+// another Content-Type, as the raw values and the event streams do.
+func jsonByDefault(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/json")
+        next.ServeHTTP(w, r)
+    })
+}
+
+// checkKey rejects a key an HTTP request may not use: an empty one, or one
+// longer than -max-key-size.
+func (store *InMemoryStore) checkKey(key string) error {
+    if key == "" {
+        return errEmptyKey
+    }
+    if max := store.maxKeySize.Load(); int64(len(key)) > max {
+        return fmt.Errorf("ERR key of %d bytes is over max-key-size %d", len(key), max)
+    }
+    return nil
+}
+
+// checkItem is checkKey for a key to be set to value, and answers with the
+// status to reject them with: 413 for a value over -max-value-size.
+func (store *InMemoryStore) checkItem(key, value string) (int, error) {
+    if err := store.checkKey(key); err != nil {
+        return http.StatusBadRequest, err
+    }
+    if max := store.maxValueSize.Load(); int64(len(value)) > max {
+        return http.StatusRequestEntityTooLarge, fmt.Errorf("ERR value of %d bytes is over max-value-size %d", len(value), max)
+    }
+    return http.StatusOK, nil
+}
+
+// limitBody caps the body of a request that carries one value. JSON may
+// escape the value, so it gets twice -max-value-size; the value itself is
+// checked after decoding.
+func (store *InMemoryStore) limitBody(w http.ResponseWriter, r *http.Request, raw bool) {
+    max := store.maxValueSize.Load()
+    if !raw {
+        max = 2*max + 4096
+    }
+    r.Body = http.MaxBytesReader(w, r.Body, max)
+}
+
+// bodyError answers a request whose body could not be read: 413 when it
+// is over the limit of limitBody, 400 otherwise.
+func bodyError(w http.ResponseWriter, err error) {
+    var tooLarge *http.MaxBytesError
+    if errors.As(err, &tooLarge) {
+        httpError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("ERR request body is over %d bytes", tooLarge.Limit))
+        return
+    }
+    httpError(w, http.StatusBadRequest, "Invalid request")
+}
+
+// deprecated marks the response of an old route with the /keys/{key}
+// route that replaces it.
+func deprecated(w http.ResponseWriter, key string) {
+    w.Header().Set("Deprecation", "true")
+    w.Header().Set("Link", "</keys/"+url.PathEscape(key)+`>; rel="successor-version"`)
+}
+
+// keysHandler serves the keys as resources at /keys/{key}, where the key
+// is path escaped: GET reads a key, HEAD tells whether it exists, PUT sets
+// it and DELETE removes it.
+func (store *InMemoryStore) keysHandler(w http.ResponseWriter, r *http.Request) {
+    key, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), "/keys/"))
+    if err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid key")
+        return
+    }
+    switch r.Method {
+    case http.MethodGet, http.MethodHead:
+        store.readKey(w, r, key, true)
+    case http.MethodPut:
+        store.putKey(w, r, key)
+    case http.MethodDelete:
+        store.removeKey(w, r, key, true)
+    default:
+        methodNotAllowed(w, "GET, HEAD, PUT, DELETE")
+    }
+}
+
+// readKey answers with the value of key, as JSON or, when the request
+// accepts application/octet-stream, as the raw bytes. The ETag is the
+// revision of the key. Missing keys are answered with 404 when notFound
+// is set, and with 200 and success false otherwise.
+func (store *InMemoryStore) readKey(w http.ResponseWriter, r *http.Request, key string, notFound bool) {
+    if err := store.checkKey(key); err != nil {
+        httpError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if err := store.checkRead(); err != nil {
+        if !store.redirectToLeader(w, r) {
+            httpError(w, http.StatusServiceUnavailable, err.Error())
+        }
+        return
+    }
+    req := &RPCRequest{Key: key}
+    if !authorized(w, r, "InMemoryStore.RPCGet", req) {
+        return
+    }
+    resp, err := store.invoke("RPCGet", store.RPCGet, req)
+    if err != nil {
+        httpError(w, http.StatusBadGateway, err.Error())
+        return
+    }
+    if !resp.Success {
+        status := errorStatus(resp.Error)
+        if status == http.StatusNotFound && !notFound {
+            status = http.StatusOK
+        }
+        httpError(w, status, resp.Error)
+        return
+    }
+    w.Header().Set("ETag", `"`+strconv.FormatUint(resp.Revision, 10)+`"`)
+    if !strings.Contains(r.Header.Get("Accept"), "application/octet-stream") {
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: resp.Data, Revision: resp.Revision})
+        return
+    }
+    w.Header().Set("Content-Type", "application/octet-stream")
+    w.Header().Set("Content-Length", strconv.Itoa(len(resp.Data)))
+    io.WriteString(w, resp.Data)
+}
+
+// putKey sets key from the body of a PUT: the raw bytes for
+// application/octet-stream, with the TTL in the ttl parameter, and
+// {"value": "...", "ttl": 60} for any other Content-Type.
+func (store *InMemoryStore) putKey(w http.ResponseWriter, r *http.Request, key string) {
+    if err := store.checkKey(key); err != nil {
+        httpError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req struct {
+        Value string `json:"value"`
+        TTL   int64  `json:"ttl"` // TTL in seconds, 0 or absent for no expiry
+    }
+    if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/octet-stream" {
+        if ttl := r.URL.Query().Get("ttl"); ttl != "" {
+            n, err := strconv.ParseInt(ttl, 10, 64)
+            if err != nil {
+                httpError(w, http.StatusBadRequest, "Invalid ttl")
+                return
+            }
+            req.TTL = n
+        }
+        store.limitBody(w, r, true)
+        data, err := io.ReadAll(r.Body)
+        if err != nil {
+            bodyError(w, err)
+            return
+        }
+        req.Value = string(data)
+    } else {
+        store.limitBody(w, r, false)
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            bodyError(w, err)
+            return
+        }
+    }
+    store.setKey(w, r, key, req.Value, req.TTL)
+}
+
+// setKey sets key for PUT /keys/{key} and POST /set.
+func (store *InMemoryStore) setKey(w http.ResponseWriter, r *http.Request, key, value string, ttl int64) {
+    if status, err := store.checkItem(key, value); err != nil {
+        httpError(w, status, err.Error())
+        return
+    }
+    req := &RPCRequest{Key: key, Value: value, TTL: ttl}
+    if !authorized(w, r, "InMemoryStore.RPCSet", req) {
+        return
+    }
+    resp, err := store.invoke("RPCSet", store.RPCSet, req)
+    if err != nil {
+        httpError(w, http.StatusBadGateway, err.Error())
+        return
+    }
+    if !resp.Success {
+        httpError(w, errorStatus(resp.Error), resp.Error)
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true})
+}
+
+// removeKey deletes key. When notFound is set, a key that did not exist
+// is answered with 404.
+func (store *InMemoryStore) removeKey(w http.ResponseWriter, r *http.Request, key string, notFound bool) {
+    if err := store.checkKey(key); err != nil {
+        httpError(w, http.StatusBadRequest, err.Error())
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    req := &RPCRequest{Key: key}
+    if !authorized(w, r, "InMemoryStore.RPCDelete", req) {
+        return
+    }
+    resp, err := store.invoke("RPCDelete", store.RPCDelete, req)
+    switch {
+    case err != nil:
+        httpError(w, http.StatusBadGateway, err.Error())
+    case !resp.Success:
+        httpError(w, errorStatus(resp.Error), resp.Error)
+    case !resp.Exists && notFound:
+        httpError(w, http.StatusNotFound, errKeyNotFound.Error())
+    default:
+        json.NewEncoder(w).Encode(APIResponse{Success: true})
+    }
+}
+
+// openAPIHandler serves GET /openapi.json.
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet && r.Method != http.MethodHead {
+        methodNotAllowed(w, "GET, HEAD")
+        return
+    }
+    w.Write(openAPI)
+}
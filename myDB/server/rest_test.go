@@ -0,0 +1,76 @@
+package main
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestKeysHandler(t *testing.T) {
+    s := NewInMemoryStore()
+    s.maxValueSize.Store(4)
+    do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+        r := httptest.NewRequest(method, path, strings.NewReader(body))
+        if contentType != "" {
+            r.Header.Set("Content-Type", contentType)
+        }
+        w := httptest.NewRecorder()
+        s.keysHandler(w, r)
+        return w
+    }
+
+    if w := do("GET", "/keys/a", "", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("missing key: %d %s", w.Code, w.Body)
+    }
+    if w := do("PUT", "/keys/a%2Fb", "application/octet-stream", "\x00\xff"); w.Code != http.StatusOK {
+        t.Fatalf("put raw: %d %s", w.Code, w.Body)
+    }
+    if v, _, ok := s.Get("a/b"); !ok || v != "\x00\xff" {
+        t.Fatalf("raw value: %q", v)
+    }
+    if w := do("PUT", "/keys/a", "", `{"value": "12345"}`); w.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("value over max-value-size: %d %s", w.Code, w.Body)
+    }
+    if w := do("PUT", "/keys/a", "", "1"); w.Code != http.StatusBadRequest {
+        t.Fatalf("body that is not JSON: %d %s", w.Code, w.Body)
+    }
+    if w := do("PUT", "/keys/", "", `{"value": "1"}`); w.Code != http.StatusBadRequest {
+        t.Fatalf("empty key: %d %s", w.Code, w.Body)
+    }
+    if w := do("POST", "/keys/a", "", ""); w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") == "" {
+        t.Fatalf("post: %d %v", w.Code, w.Header())
+    }
+    if w := do("DELETE", "/keys/a%2Fb", "", ""); w.Code != http.StatusOK {
+        t.Fatalf("delete: %d %s", w.Code, w.Body)
+    }
+    if w := do("DELETE", "/keys/a%2Fb", "", ""); w.Code != http.StatusNotFound {
+        t.Fatalf("delete missing key: %d %s", w.Code, w.Body)
+    }
+}
+
+func TestDeprecatedRoutes(t *testing.T) {
+    s := NewInMemoryStore()
+    do := func(handler http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+        w := httptest.NewRecorder()
+        handler(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+        return w
+    }
+
+    // The old routes keep the methods and status codes they always had.
+    if w := do(s.setHandler, "GET", "/set", `{"key": "a", "value": "1"}`); w.Code != http.StatusOK || w.Header().Get("Deprecation") != "true" {
+        t.Fatalf("set: %d %s", w.Code, w.Body)
+    }
+    if w := do(s.getHandler, "POST", "/get?key=a", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"data":"1"`) {
+        t.Fatalf("get: %d %s", w.Code, w.Body)
+    }
+    if w := do(s.deleteHandler, "GET", "/delete?key=a", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":true`) {
+        t.Fatalf("delete: %d %s", w.Code, w.Body)
+    }
+    if w := do(s.getHandler, "GET", "/get?key=a", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":false`) {
+        t.Fatalf("get of a missing key: %d %s", w.Code, w.Body)
+    }
+    if w := do(s.deleteHandler, "DELETE", "/delete?key=a", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"success":true`) {
+        t.Fatalf("delete of a missing key: %d %s", w.Code, w.Body)
+    }
+}
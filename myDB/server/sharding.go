@@ -0,0 +1,545 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "net/rpc"
+    "os"
+    "path/filepath"
+    "slices"
+    "sync"
+    "time"
+
+    "github.com/shafigh75/go_files/myDB/ring"
+)
+
+const (
+    migrateBatchSize = 500 // keys sent to a new owner per Migrate call
+    shardRPCTimeout  = 5 * time.Second
+    tombstoneTTL     = 10 * time.Minute // how long keys may still arrive after the last Migrate
+)
+
+// ShardNodesArgs carries a new shard membership. Epoch must grow with every
+// change so that nodes ignore stale or repeated updates.
+type ShardNodesArgs struct {
+    Epoch uint64
+    Nodes []string
+}
+
+// ShardNodesReply describes the membership a node currently uses.
+type ShardNodesReply struct {
+    Epoch    uint64   `json:"epoch"`
+    Nodes    []string `json:"nodes"`
+    Replicas int      `json:"replicas"`
+}
+
+// MigrateArgs carries keys moving to the node that now owns them.
+type MigrateArgs struct {
+    Entries []Mutation
+}
+
+// MigrateReply reports how many of the keys were stored.
+type MigrateReply struct {
+    Applied int
+}
+
+// shardState is what is saved to disk so runtime membership changes survive a restart.
+type shardState struct {
+    Epoch uint64   `json:"epoch"`
+    Nodes []string `json:"nodes"`
+}
+
+// Sharding spreads keys over several nodes with a consistent hash ring.
+// Each node stores the keys it owns, the HTTP API forwards other keys to
+// their owner and RPC clients are told where a key lives. It is registered
+// as the "Sharding" RPC service.
+type Sharding struct {
+    store     *InMemoryStore
+    self      string // RPC address of this node as it appears on the ring
+    replicas  int
+    statePath string
+
+    mu          sync.RWMutex
+    epoch       uint64
+    ring        *ring.Ring
+    prev        []*ring.Ring // rings before the changes whose keys may still be moving, newest first
+    rebalancing bool
+    moved       uint64        // keys handed to other nodes since boot
+    stop        chan struct{} // closed by Stop
+    running     sync.WaitGroup
+
+    clientsMu sync.Mutex
+    clients   map[string]*rpc.Client
+
+    // Keys deleted here while keys may still be moving in, so that a
+    // Migrate batch read before the delete does not bring them back. They
+    // are dropped once no batch has arrived for tombstoneTTL.
+    tombMu      sync.Mutex
+    tombstones  map[string]struct{}
+    movingUntil time.Time
+}
+
+// NewSharding puts store in sharded mode. The membership saved in statePath
+// wins over nodes, since it may include changes made at runtime.
+func NewSharding(store *InMemoryStore, self string, nodes []string, replicas int, statePath string) (*Sharding, error) {
+    sh := &Sharding{
+        store:     store,
+        self:      self,
+        replicas:  replicas,
+        statePath: statePath,
+        clients:   make(map[string]*rpc.Client),
+        stop:      make(chan struct{}),
+    }
+    if err := os.MkdirAll(filepath.Dir(statePath), 0o755); err != nil {
+        return nil, err
+    }
+    if data, err := os.ReadFile(statePath); err == nil {
+        var st shardState
+        if err := json.Unmarshal(data, &st); err != nil {
+            return nil, fmt.Errorf("read %s: %w", statePath, err)
+        }
+        sh.epoch, nodes = st.Epoch, st.Nodes
+    } else if !os.IsNotExist(err) {
+        return nil, err
+    }
+    sh.ring = ring.New(replicas, nodes...)
+    store.sharding = sh
+    return sh, nil
+}
+
+// Owner returns the RPC address of the node owning key.
+func (sh *Sharding) Owner(key string) string {
+    sh.mu.RLock()
+    defer sh.mu.RUnlock()
+    return sh.ring.Get(key)
+}
+
+// previousOwners returns who owned key under each membership whose keys
+// may still be moving, newest first and without this node. It is empty
+// when no keys are moving. Two changes close together can leave a key on
+// the owner before the last one, so every pending ring counts.
+func (sh *Sharding) previousOwners(key string) []string {
+    sh.mu.RLock()
+    defer sh.mu.RUnlock()
+    var owners []string
+    for _, r := range sh.prev {
+        owner := r.Get(key)
+        if owner == "" || owner == sh.self || slices.Contains(owners, owner) {
+            continue
+        }
+        owners = append(owners, owner)
+    }
+    return owners
+}
+
+// Nodes returns the current membership.
+func (sh *Sharding) Nodes(args *ShardNodesArgs, reply *ShardNodesReply) error {
+    sh.mu.RLock()
+    defer sh.mu.RUnlock()
+    reply.Epoch = sh.epoch
+    reply.Nodes = sh.ring.Nodes()
+    reply.Replicas = sh.replicas
+    return nil
+}
+
+// SetNodes switches to a new membership and starts moving the keys this
+// node no longer owns to their new owners in the background.
+func (sh *Sharding) SetNodes(args *ShardNodesArgs, reply *ShardNodesReply) error {
+    sh.mu.Lock()
+    if args.Epoch <= sh.epoch {
+        sh.mu.Unlock()
+        return sh.Nodes(&ShardNodesArgs{}, reply)
+    }
+    data, err := json.Marshal(shardState{Epoch: args.Epoch, Nodes: args.Nodes})
+    if err == nil {
+        err = writeFileAtomic(sh.statePath, data)
+    }
+    if err != nil {
+        sh.mu.Unlock()
+        return fmt.Errorf("save shard membership: %w", err)
+    }
+    sh.prev = append([]*ring.Ring{sh.ring}, sh.prev...)
+    sh.ring = ring.New(sh.replicas, args.Nodes...)
+    sh.epoch = args.Epoch
+    start := !sh.rebalancing && !sh.stopped()
+    sh.rebalancing = true
+    if start {
+        sh.running.Add(1)
+    }
+    sh.mu.Unlock()
+    sh.expectMoves()
+
+    fmt.Printf("Shard membership changed to %v (epoch %d)\n", args.Nodes, args.Epoch)
+    if start {
+        go func() {
+            defer sh.running.Done()
+            sh.rebalance()
+        }()
+    }
+    return sh.Nodes(&ShardNodesArgs{}, reply)
+}
+
+// Migrate stores keys handed over by their previous owner. A key that was
+// written or deleted here in the meantime is newer, so it is kept.
+func (sh *Sharding) Migrate(args *MigrateArgs, reply *MigrateReply) error {
+    sh.expectMoves()
+    for _, m := range args.Entries {
+        applied, err := sh.store.setIfAbsent(m, sh.deleted)
+        if err != nil {
+            return err
+        }
+        if applied {
+            reply.Applied++
+        }
+    }
+    return nil
+}
+
+// Stop ends a rebalance in progress after the batch it is sending and
+// waits for it, so no key is dropped once the WAL is closed. The rebalance
+// starts over when the node comes back.
+func (sh *Sharding) Stop() {
+    sh.mu.Lock()
+    if !sh.stopped() {
+        close(sh.stop)
+    }
+    sh.mu.Unlock()
+    sh.running.Wait()
+}
+
+func (sh *Sharding) stopped() bool {
+    select {
+    case <-sh.stop:
+        return true
+    default:
+        return false
+    }
+}
+
+// rebalance moves every local key whose owner changed to that owner. It
+// runs again if the membership changed while it was working.
+func (sh *Sharding) rebalance() {
+    for {
+        sh.mu.RLock()
+        epoch := sh.epoch
+        sh.mu.RUnlock()
+
+        moved, err := sh.moveForeignKeys()
+        if sh.stopped() {
+            return
+        }
+        if err != nil {
+            fmt.Println("Error rebalancing shards, retrying:", err)
+            select {
+            case <-sh.stop:
+                return
+            case <-time.After(time.Second):
+            }
+            continue
+        }
+
+        sh.mu.Lock()
+        sh.moved += uint64(moved)
+        if sh.epoch == epoch {
+            sh.prev = nil
+            sh.rebalancing = false
+            sh.mu.Unlock()
+            fmt.Printf("Shard rebalance done, moved %d keys\n", moved)
+            return
+        }
+        sh.mu.Unlock()
+    }
+}
+
+// moveForeignKeys sends the keys owned by other nodes to them in batches and
+// drops the local copies once the owner has them.
+func (sh *Sharding) moveForeignKeys() (int, error) {
+    _, entries := sh.store.copyEntries()
+    batches := make(map[string][]Mutation)
+    for key, v := range entries {
+        owner := sh.Owner(key)
+        if owner == "" || owner == sh.self {
+            continue
+        }
+        m := setMutation(key, v)
+        m.Revision = v.Revision
+        batches[owner] = append(batches[owner], m)
+    }
+
+    moved := 0
+    for owner, batch := range batches {
+        for len(batch) > 0 && !sh.stopped() {
+            n := min(len(batch), migrateBatchSize)
+            var reply MigrateReply
+            if err := sh.call(owner, "Sharding.Migrate", &MigrateArgs{Entries: batch[:n]}, &reply); err != nil {
+                return moved, fmt.Errorf("migrate to %s: %w", owner, err)
+            }
+            for _, m := range batch[:n] {
+                if sh.Owner(m.Key) == sh.self {
+                    continue
+                }
+                if err := sh.store.dropIfUnchanged(m); err != nil {
+                    return moved, fmt.Errorf("drop moved key %q: %w", m.Key, err)
+                }
+            }
+            moved += n
+            batch = batch[n:]
+        }
+    }
+    return moved, nil
+}
+
+// Lookup reads a key straight from this node's store. New owners use it
+// to serve keys that have not reached them yet during a rebalance.
+func (sh *Sharding) Lookup(req *RPCRequest, resp *RPCResponse) error {
+    if v, exists := sh.store.entry(req.Key); exists && v.Type != TypeString {
+        resp.Success = false
+        resp.Error = errWrongType.Error()
+    } else if exists {
+        resp.Success = true
+        resp.Data = v.Value
+        resp.Revision = v.Revision
+    } else {
+        resp.Success = false
+        resp.Error = errKeyNotFound.Error()
+    }
+    return nil
+}
+
+// Forget deletes a key from this node's store without routing it. New
+// owners use it so a key deleted during a rebalance is not moved back.
+func (sh *Sharding) Forget(req *RPCRequest, resp *RPCResponse) error {
+    if err := sh.store.write(Mutation{Op: OpDelete, Key: req.Key}); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
+    resp.Success = true
+    return nil
+}
+
+// expectMoves notes that other nodes may send keys here for tombstoneTTL.
+func (sh *Sharding) expectMoves() {
+    sh.tombMu.Lock()
+    defer sh.tombMu.Unlock()
+    sh.movingUntil = time.Now().Add(tombstoneTTL)
+}
+
+// tombstone records that key is being deleted here, so that a Migrate
+// batch does not bring it back. It must be called before the delete is
+// visible, or under the store lock with it, as Migrate checks under it.
+func (sh *Sharding) tombstone(key string) {
+    sh.tombMu.Lock()
+    defer sh.tombMu.Unlock()
+    if time.Now().After(sh.movingUntil) {
+        sh.tombstones = nil
+        return
+    }
+    if sh.tombstones == nil {
+        sh.tombstones = make(map[string]struct{})
+    }
+    sh.tombstones[key] = struct{}{}
+}
+
+// deleted reports whether key was deleted here while keys were moving in.
+func (sh *Sharding) deleted(key string) bool {
+    sh.tombMu.Lock()
+    defer sh.tombMu.Unlock()
+    if time.Now().After(sh.movingUntil) {
+        sh.tombstones = nil
+        return false
+    }
+    _, ok := sh.tombstones[key]
+    return ok
+}
+
+// lookupPrevious asks the previous owners of key for it while keys are
+// moving, newest first.
+func (sh *Sharding) lookupPrevious(key string) (ValueWithTTL, bool) {
+    for _, prev := range sh.previousOwners(key) {
+        var resp RPCResponse
+        if err := sh.call(prev, "Sharding.Lookup", &RPCRequest{Key: key}, &resp); err == nil && resp.Success {
+            return ValueWithTTL{Value: resp.Data, Revision: resp.Revision}, true
+        }
+    }
+    return ValueWithTTL{}, false
+}
+
+// forgetPrevious removes key from its previous owners while keys are moving.
+func (sh *Sharding) forgetPrevious(key string) {
+    for _, prev := range sh.previousOwners(key) {
+        var resp RPCResponse
+        if err := sh.call(prev, "Sharding.Forget", &RPCRequest{Key: key}, &resp); err != nil {
+            fmt.Printf("Error deleting %q from previous owner %s: %v\n", key, prev, err)
+        }
+    }
+}
+
+// proxyCommand serves an HTTP request for a typed value command on a key
+// owned by another node by calling the owner over RPC.
+func (sh *Sharding) proxyCommand(w http.ResponseWriter, owner string, req *CommandRequest) {
+    var resp CommandResponse
+    if err := sh.call(owner, "InMemoryStore.RPCCommand", req, &resp); err != nil {
+        w.WriteHeader(http.StatusBadGateway)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: fmt.Sprintf("shard %s: %v", owner, err)})
+        return
+    }
+    if !resp.Success {
+        w.WriteHeader(errorStatus(resp.Error))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: resp.Reply.value()})
+}
+
+// broadcast sends a new membership to every node in the old and the new one.
+func (sh *Sharding) broadcast(nodes []string) (ShardNodesReply, error) {
+    sh.mu.RLock()
+    args := ShardNodesArgs{Epoch: sh.epoch + 1, Nodes: nodes}
+    targets := map[string]bool{}
+    for _, n := range sh.ring.Nodes() {
+        targets[n] = true
+    }
+    sh.mu.RUnlock()
+    for _, n := range nodes {
+        targets[n] = true
+    }
+
+    var reply ShardNodesReply
+    var errs []error
+    for n := range targets {
+        var r ShardNodesReply
+        var err error
+        if n == sh.self {
+            err = sh.SetNodes(&args, &r)
+        } else {
+            err = sh.call(n, "Sharding.SetNodes", &args, &r)
+        }
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", n, err))
+        }
+    }
+    sh.Nodes(&ShardNodesArgs{}, &reply)
+    return reply, errors.Join(errs...)
+}
+
+// call invokes method on the node at addr, redialing broken connections.
+func (sh *Sharding) call(addr, method string, args, reply interface{}) error {
+    sh.clientsMu.Lock()
+    client, ok := sh.clients[addr]
+    if !ok {
+        c, err := dialTimeout(addr, shardRPCTimeout)
+        if err != nil {
+            sh.clientsMu.Unlock()
+            return err
+        }
+        client = c
+        sh.clients[addr] = c
+    }
+    sh.clientsMu.Unlock()
+
+    call := client.Go(method, args, reply, make(chan *rpc.Call, 1))
+    select {
+    case <-call.Done:
+        if isConnError(call.Error) {
+            sh.dropClient(addr, client)
+        }
+        return call.Error
+    case <-time.After(shardRPCTimeout):
+        sh.dropClient(addr, client)
+        return fmt.Errorf("%s to %s timed out", method, addr)
+    }
+}
+
+func (sh *Sharding) dropClient(addr string, c *rpc.Client) {
+    sh.clientsMu.Lock()
+    defer sh.clientsMu.Unlock()
+    if sh.clients[addr] == c {
+        delete(sh.clients, addr)
+        c.Close()
+    }
+}
+
+// ShardStatus is returned by the /shards endpoint.
+type ShardStatus struct {
+    Self        string   `json:"self"`
+    Epoch       uint64   `json:"epoch"`
+    Nodes       []string `json:"nodes"`
+    Replicas    int      `json:"replicas"`
+    Rebalancing bool     `json:"rebalancing"`
+    MovedKeys   uint64   `json:"moved_keys"`
+}
+
+func (sh *Sharding) status() ShardStatus {
+    sh.mu.RLock()
+    defer sh.mu.RUnlock()
+    return ShardStatus{
+        Self:        sh.self,
+        Epoch:       sh.epoch,
+        Nodes:       sh.ring.Nodes(),
+        Replicas:    sh.replicas,
+        Rebalancing: sh.rebalancing,
+        MovedKeys:   sh.moved,
+    }
+}
+
+// statusHandler reports the membership and rebalancing progress.
+func (sh *Sharding) statusHandler(w http.ResponseWriter, r *http.Request) {
+    if !authorized(w, r, "Sharding.Nodes", nil) {
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: sh.status()})
+}
+
+// nodesHandler changes the membership from any node: POST {"addr"} adds a
+// node, DELETE ?addr= removes one. The change is sent to every node.
+func (sh *Sharding) nodesHandler(w http.ResponseWriter, r *http.Request) {
+    method := "Sharding.Nodes"
+    if r.Method != http.MethodGet {
+        method = "Sharding.SetNodes"
+    }
+    if !authorized(w, r, method, nil) {
+        return
+    }
+    nodes := sh.status().Nodes
+    switch r.Method {
+    case http.MethodGet:
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: nodes})
+        return
+    case http.MethodPost:
+        var body struct {
+            Addr string `json:"addr"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Addr == "" {
+            httpError(w, http.StatusBadRequest, "Invalid request")
+            return
+        }
+        nodes = append(nodes, body.Addr)
+    case http.MethodDelete:
+        addr := r.URL.Query().Get("addr")
+        var out []string
+        for _, n := range nodes {
+            if n != addr {
+                out = append(out, n)
+            }
+        }
+        if len(out) == len(nodes) || len(out) == 0 {
+            httpError(w, http.StatusBadRequest, "Invalid request")
+            return
+        }
+        nodes = out
+    default:
+        methodNotAllowed(w, "GET, POST, DELETE")
+        return
+    }
+
+    reply, err := sh.broadcast(nodes)
+    if err != nil {
+        w.WriteHeader(http.StatusBadGateway)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Data: reply, Error: err.Error()})
+        return
+    }
+    json.NewEncoder(w).Encode(APIResponse{Success: true, Data: reply})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "net/rpc"
+    "path/filepath"
+    "testing"
+    "time"
+
+    "github.com/shafigh75/go_files/myDB/ring"
+)
+
+// startShard runs a sharded node on a local port with the given
+// membership; nil means just this node.
+func startShard(t *testing.T, nodes []string) *Sharding {
+    t.Helper()
+    l, err := net.Listen("tcp", "127.0.0.1:0")
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { l.Close() })
+    self := l.Addr().String()
+    if nodes == nil {
+        nodes = []string{self}
+    }
+    sh, err := NewSharding(NewInMemoryStore(), self, nodes, 50, filepath.Join(t.TempDir(), "shards.json"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    server := rpc.NewServer()
+    server.RegisterName("Sharding", sh)
+    go server.Accept(l)
+    return sh
+}
+
+func TestShardRebalance(t *testing.T) {
+    a := startShard(t, nil)
+    for i := 0; i < 200; i++ {
+        a.store.Set(fmt.Sprint("k", i), fmt.Sprint("v", i), 0)
+    }
+    b := startShard(t, []string{a.self})
+
+    // b joins: a moves the keys b now owns and keeps the rest.
+    if _, err := a.broadcast([]string{a.self, b.self}); err != nil {
+        t.Fatal(err)
+    }
+    waitFor(t, "the rebalance", func() bool { return !a.status().Rebalancing })
+    moved := 0
+    for i := 0; i < 200; i++ {
+        key := fmt.Sprint("k", i)
+        owner, other := a, b
+        if a.Owner(key) == b.self {
+            owner, other = b, a
+            moved++
+        }
+        if v, _, _ := owner.store.Get(key); v != fmt.Sprint("v", i) {
+            t.Fatalf("%s on its owner %s = %q", key, owner.self, v)
+        }
+        if _, _, ok := other.store.Get(key); ok {
+            t.Fatalf("%s is still on %s", key, other.self)
+        }
+    }
+    if moved == 0 || a.status().MovedKeys != uint64(moved) {
+        t.Fatalf("moved %d keys, a reports %d", moved, a.status().MovedKeys)
+    }
+}
+
+func TestShardMigrateAfterDelete(t *testing.T) {
+    a := startShard(t, nil)
+    b := startShard(t, []string{a.self})
+    if _, err := a.broadcast([]string{a.self, b.self}); err != nil {
+        t.Fatal(err)
+    }
+
+    // A batch a read before the keys were deleted or written on b arrives
+    // late: the deleted key stays deleted and the written one keeps its
+    // newer value. Keys b has not seen are stored.
+    b.store.Set("written", "new", 0)
+    if _, err := b.store.remove("deleted"); err != nil {
+        t.Fatal(err)
+    }
+    var reply MigrateReply
+    late := []Mutation{
+        {Op: OpSet, Key: "deleted", Value: "old", Revision: 3},
+        {Op: OpSet, Key: "written", Value: "old", Revision: 3},
+        {Op: OpSet, Key: "moved", Value: "old", Revision: 3},
+    }
+    if err := b.Migrate(&MigrateArgs{Entries: late}, &reply); err != nil {
+        t.Fatal(err)
+    }
+    if reply.Applied != 1 {
+        t.Fatalf("applied %d keys", reply.Applied)
+    }
+    if _, _, ok := b.store.Get("deleted"); ok {
+        t.Fatal("a deleted key was brought back")
+    }
+    if v, _, _ := b.store.Get("written"); v != "new" {
+        t.Fatalf("written = %q", v)
+    }
+    if v, rev, _ := b.store.Get("moved"); v != "old" || rev != 3 {
+        t.Fatalf("moved = %q at revision %d", v, rev)
+    }
+}
+
+func TestShardStop(t *testing.T) {
+    a := startShard(t, nil)
+    for i := 0; i < 50; i++ {
+        a.store.Set(fmt.Sprint("k", i), "v", 0)
+    }
+    down := "127.0.0.1:1" // nothing listens there
+
+    // The rebalance cannot reach the new node and keeps retrying until
+    // Stop, which leaves the keys in place.
+    a.broadcast([]string{a.self, down})
+    if !a.status().Rebalancing {
+        t.Fatal("no rebalance started")
+    }
+    stopped := make(chan struct{})
+    go func() {
+        a.Stop()
+        close(stopped)
+    }()
+    select {
+    case <-stopped:
+    case <-time.After(shardRPCTimeout + 2*time.Second):
+        t.Fatal("Stop waits for the rebalance")
+    }
+    for i := 0; i < 50; i++ {
+        if _, _, ok := a.store.Get(fmt.Sprint("k", i)); !ok {
+            t.Fatalf("k%d was dropped", i)
+        }
+    }
+}
+
+func TestShardChangesCloseTogether(t *testing.T) {
+    a := startShard(t, nil)
+    b := startShard(t, []string{a.self})
+    c := startShard(t, []string{a.self})
+    t.Cleanup(c.Stop)
+    down := "127.0.0.1:1" // nothing listens there
+
+    // c cannot finish moving its keys to down, so the second change comes
+    // while the first one is still being rebalanced.
+    for i := 0; i < 50; i++ {
+        c.store.Set(fmt.Sprint("stuck", i), "v", 0)
+    }
+    first := []string{a.self, b.self, down}
+    second := append(first, c.self)
+    var reply ShardNodesReply
+    if err := c.SetNodes(&ShardNodesArgs{Epoch: 1, Nodes: first}, &reply); err != nil {
+        t.Fatal(err)
+    }
+    if err := c.SetNodes(&ShardNodesArgs{Epoch: 2, Nodes: second}, &reply); err != nil {
+        t.Fatal(err)
+    }
+    if !c.status().Rebalancing {
+        t.Fatal("the first rebalance finished")
+    }
+
+    // A key a held before both changes, that b was to get from the first
+    // and c owns since the second, is still found on a.
+    firstRing, secondRing := ring.New(50, first...), ring.New(50, second...)
+    key := ""
+    for i := 0; key == ""; i++ {
+        k := fmt.Sprint("k", i)
+        if firstRing.Get(k) == b.self && secondRing.Get(k) == c.self {
+            key = k
+        }
+    }
+    a.store.Set(key, "old", 0)
+    if v, _, err := c.store.lookup(key); err != nil || v.Value != "old" {
+        t.Fatalf("%s on c: %q %v", key, v.Value, err)
+    }
+    if _, err := c.store.remove(key); err != nil {
+        t.Fatal(err)
+    }
+    if _, _, ok := a.store.Get(key); ok {
+        t.Fatalf("%s is still on a after c deleted it", key)
+    }
+}
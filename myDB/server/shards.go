@@ -0,0 +1,189 @@
+package main
+
+import (
+    "math/rand"
+    "sync"
+    "time"
+)
+
+// storeShards is the number of independently locked maps the keys are
+// spread over. A power of two, so a shard is picked with a mask.
+const storeShards = 64
+
+// shardedMap holds the keys of an InMemoryStore in storeShards maps, picked
+// by a hash of the key, each with its own lock. Reads of single keys take
+// only the lock of their shard, so they run in parallel with each other
+// and with writes to other shards instead of queuing on one lock.
+//
+// A write to a single key holds the store's mu for reading and the
+// shard's writer lock, see lockWrites, so writes to keys of other shards
+// go on at the same time and only the store's commit section orders them.
+// Work over the whole store holds the store's mu for writing instead,
+// which keeps every writer out. Either way the map is only changed with
+// the shard locked as well, for the readers. A writer therefore sees no
+// other change to its shard and may call get without the shard lock; each
+// and access need the store's mu held for writing.
+type shardedMap struct {
+    shards [storeShards]storeShard
+}
+
+type storeShard struct {
+    mu       sync.RWMutex
+    wmu      sync.Mutex // held by the writer of a single key, see lockWrites
+    m        map[string]ValueWithTTL
+    access   map[string]*keyAccess // how the keys are used, when the eviction policy tracks it
+    volatile map[string]struct{}   // the keys with a TTL, sampled by volatile-ttl eviction
+    _        [64]byte              // keeps the locks of neighbouring shards off one cache line
+}
+
+func newShardedMap() *shardedMap {
+    sm := &shardedMap{}
+    for i := range sm.shards {
+        sm.shards[i].m = make(map[string]ValueWithTTL)
+        sm.shards[i].volatile = make(map[string]struct{})
+    }
+    return sm
+}
+
+// shard returns the shard of key, by its 32-bit FNV-1a hash.
+func (sm *shardedMap) shard(key string) *storeShard {
+    h := uint32(2166136261)
+    for i := 0; i < len(key); i++ {
+        h ^= uint32(key[i])
+        h *= 16777619
+    }
+    return &sm.shards[h&(storeShards-1)]
+}
+
+// lockWrites keeps the other writers of single keys out of the shard of key
+// until unlock is called. Readers are not held up. The caller must hold
+// the store's mu for reading.
+func (sm *shardedMap) lockWrites(key string) (unlock func()) {
+    sh := sm.shard(key)
+    sh.wmu.Lock()
+    return sh.wmu.Unlock
+}
+
+// read returns the value of key, recording the read for the LRU and LFU
+// policies when track is set. It is safe without holding the store's mu.
+func (sm *shardedMap) read(key string, track bool) (ValueWithTTL, bool) {
+    sh := sm.shard(key)
+    sh.mu.RLock()
+    defer sh.mu.RUnlock()
+    v, ok := sh.m[key]
+    if ok && track {
+        if a, ok := sh.access[key]; ok {
+            a.touch(time.Now().UnixNano())
+        }
+    }
+    return v, ok
+}
+
+// get returns the value of key. The caller must hold the store's mu for
+// writing, or for reading together with lockWrites of key.
+func (sm *shardedMap) get(key string) (ValueWithTTL, bool) {
+    v, ok := sm.shard(key).m[key]
+    return v, ok
+}
+
+// set stores v under key, recording the write when track is set. The
+// caller must hold the store's mu for writing, or for reading together
+// with lockWrites of key.
+func (sm *shardedMap) set(key string, v ValueWithTTL, track bool) {
+    sh := sm.shard(key)
+    sh.mu.Lock()
+    defer sh.mu.Unlock()
+    sh.m[key] = v
+    if v.Expiration > 0 {
+        sh.volatile[key] = struct{}{}
+    } else {
+        delete(sh.volatile, key)
+    }
+    if !track {
+        return
+    }
+    now := time.Now().UnixNano()
+    a, ok := sh.access[key]
+    if !ok {
+        if sh.access == nil {
+            sh.access = make(map[string]*keyAccess)
+        }
+        a = &keyAccess{}
+        a.count.Store(lfuInitialCount)
+        a.last.Store(now)
+        sh.access[key] = a
+    }
+    a.touch(now)
+}
+
+// del removes key and what was recorded about its use. The caller must
+// hold the store's mu like for set.
+func (sm *shardedMap) del(key string) {
+    sh := sm.shard(key)
+    sh.mu.Lock()
+    defer sh.mu.Unlock()
+    delete(sh.m, key)
+    delete(sh.access, key)
+    delete(sh.volatile, key)
+}
+
+// access returns what was recorded about the use of key. The caller must
+// hold the store's mu for writing.
+func (sm *shardedMap) access(key string) (*keyAccess, bool) {
+    a, ok := sm.shard(key).access[key]
+    return a, ok
+}
+
+// each calls fn for every key until fn returns false. It starts at a
+// random shard, and the maps start at a random key, so stopping early
+// gives a sample of the keys. The caller must hold the store's mu for
+// writing.
+func (sm *shardedMap) each(fn func(key string, v ValueWithTTL) bool) {
+    start := rand.Intn(storeShards)
+    for i := 0; i < storeShards; i++ {
+        for key, v := range sm.shards[(start+i)%storeShards].m {
+            if !fn(key, v) {
+                return
+            }
+        }
+    }
+}
+
+// eachVolatile is each for the keys with a TTL only.
+func (sm *shardedMap) eachVolatile(fn func(key string, v ValueWithTTL) bool) {
+    start := rand.Intn(storeShards)
+    for i := 0; i < storeShards; i++ {
+        sh := &sm.shards[(start+i)%storeShards]
+        for key := range sh.volatile {
+            if !fn(key, sh.m[key]) {
+                return
+            }
+        }
+    }
+}
+
+// len returns the number of keys, expired ones included. The caller must
+// hold the store's mu for writing.
+func (sm *shardedMap) len() int {
+    n := 0
+    for i := range sm.shards {
+        n += len(sm.shards[i].m)
+    }
+    return n
+}
+
+// reset replaces every key with entries and forgets how the keys were
+// used. The caller must hold the store's mu for writing.
+func (sm *shardedMap) reset(entries map[string]ValueWithTTL, track bool) {
+    for i := range sm.shards {
+        sh := &sm.shards[i]
+        sh.mu.Lock()
+        sh.m = make(map[string]ValueWithTTL)
+        sh.access = nil
+        sh.volatile = make(map[string]struct{})
+        sh.mu.Unlock()
+    }
+    for key, v := range entries {
+        sm.set(key, v, track)
+    }
+}
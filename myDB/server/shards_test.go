@@ -0,0 +1,246 @@
+package main
+
+import (
+    "fmt"
+    "math/rand"
+    "reflect"
+    "sync"
+    "testing"
+    "time"
+)
+
+const benchKeys = 100000
+
+// singleLockMap is the design shardedMap replaced: one RWMutex for all
+// keys, taken by readers and writers alike.
+type singleLockMap struct {
+    mu sync.RWMutex
+    m  map[string]ValueWithTTL
+}
+
+func (sm *singleLockMap) read(key string) (ValueWithTTL, bool) {
+    sm.mu.RLock()
+    defer sm.mu.RUnlock()
+    v, ok := sm.m[key]
+    return v, ok
+}
+
+func (sm *singleLockMap) set(key string, v ValueWithTTL) {
+    sm.mu.Lock()
+    defer sm.mu.Unlock()
+    sm.m[key] = v
+}
+
+// lockedShards locks shardedMap the way InMemoryStore does: writes hold
+// the store's mu for reading, the writer lock of their shard and, for as
+// long as it takes to bump the revision, the commit lock; reads hold only
+// their shard. With serialWrites set, writes hold the store's mu for
+// writing instead, as they did before the commit lock.
+type lockedShards struct {
+    mu           sync.RWMutex
+    commitMu     sync.Mutex
+    rev          uint64
+    sm           *shardedMap
+    serialWrites bool
+}
+
+func (ls *lockedShards) read(key string) (ValueWithTTL, bool) {
+    return ls.sm.read(key, false)
+}
+
+func (ls *lockedShards) set(key string, v ValueWithTTL) {
+    if ls.serialWrites {
+        ls.mu.Lock()
+        defer ls.mu.Unlock()
+    } else {
+        ls.mu.RLock()
+        defer ls.mu.RUnlock()
+        defer ls.sm.lockWrites(key)()
+    }
+    ls.commitMu.Lock()
+    ls.rev++
+    ls.commitMu.Unlock()
+    ls.sm.set(key, v, false)
+}
+
+type benchMap interface {
+    read(key string) (ValueWithTTL, bool)
+    set(key string, v ValueWithTTL)
+}
+
+var readRatios = []int{90, 50, 10, 0} // percent of operations that are reads
+
+func benchKeyNames() []string {
+    keys := make([]string, benchKeys)
+    for i := range keys {
+        keys[i] = fmt.Sprintf("key-%d", i)
+    }
+    return keys
+}
+
+// runMixed runs b.N operations from parallel goroutines, readPercent of
+// them reads of random keys and the rest writes.
+func runMixed(b *testing.B, keys []string, readPercent int, read func(string), write func(string)) {
+    b.ResetTimer()
+    b.RunParallel(func(pb *testing.PB) {
+        r := rand.New(rand.NewSource(rand.Int63()))
+        for pb.Next() {
+            key := keys[r.Intn(len(keys))]
+            if r.Intn(100) < readPercent {
+                read(key)
+            } else {
+                write(key)
+            }
+        }
+    })
+}
+
+func BenchmarkMapMixed(b *testing.B) {
+    keys := benchKeyNames()
+    designs := []struct {
+        name string
+        new  func() benchMap
+    }{
+        {"single-lock", func() benchMap { return &singleLockMap{m: make(map[string]ValueWithTTL)} }},
+        {"sharded-serial-writes", func() benchMap { return &lockedShards{sm: newShardedMap(), serialWrites: true} }},
+        {"sharded", func() benchMap { return &lockedShards{sm: newShardedMap()} }},
+    }
+    for _, ratio := range readRatios {
+        for _, d := range designs {
+            b.Run(fmt.Sprintf("reads=%d%%/%s", ratio, d.name), func(b *testing.B) {
+                m := d.new()
+                for _, key := range keys {
+                    m.set(key, ValueWithTTL{Value: "v"})
+                }
+                runMixed(b, keys, ratio,
+                    func(key string) { m.read(key) },
+                    func(key string) { m.set(key, ValueWithTTL{Value: "v"}) })
+            })
+        }
+    }
+}
+
+// BenchmarkStoreMixed runs Get and Set on a whole store. The single-lock
+// store reads the way InMemoryStore did before the keys were sharded,
+// under a lock that writes hold for writing, and it and the serial-writes
+// store make every Set under that lock, the way writes were made one at a
+// time before they took only their shard.
+func BenchmarkStoreMixed(b *testing.B) {
+    keys := benchKeyNames()
+    serialSet := func(s *InMemoryStore, mu *sync.RWMutex, key string) {
+        mu.Lock()
+        defer mu.Unlock()
+        s.Set(key, "v", 0)
+    }
+    designs := []struct {
+        name string
+        get  func(s *InMemoryStore, mu *sync.RWMutex, key string)
+        set  func(s *InMemoryStore, mu *sync.RWMutex, key string)
+    }{
+        {"single-lock", func(s *InMemoryStore, mu *sync.RWMutex, key string) {
+            mu.RLock()
+            v, ok := s.store.get(key)
+            mu.RUnlock()
+            if ok {
+                v.expired(time.Now().UnixMilli())
+            }
+        }, serialSet},
+        {"sharded-serial-writes", func(s *InMemoryStore, _ *sync.RWMutex, key string) { s.Get(key) }, serialSet},
+        {"sharded", func(s *InMemoryStore, _ *sync.RWMutex, key string) { s.Get(key) }, func(s *InMemoryStore, _ *sync.RWMutex, key string) { s.Set(key, "v", 0) }},
+    }
+    for _, ratio := range readRatios {
+        for _, d := range designs {
+            b.Run(fmt.Sprintf("reads=%d%%/%s", ratio, d.name), func(b *testing.B) {
+                s := NewInMemoryStore()
+                for _, key := range keys {
+                    s.Set(key, "v", 0)
+                }
+                var mu sync.RWMutex
+                runMixed(b, keys, ratio,
+                    func(key string) { d.get(s, &mu, key) },
+                    func(key string) { d.set(s, &mu, key) })
+            })
+        }
+    }
+}
+
+func TestShardedMapRace(t *testing.T) {
+    s := NewInMemoryStore()
+    s.limit = newMemoryLimit(1<<20, evictLRU)
+    var wg sync.WaitGroup
+    for g := 0; g < 8; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < 2000; i++ {
+                key := fmt.Sprintf("key-%d", (g*31+i)%500)
+                if i%3 == 0 {
+                    if err := s.Set(key, "value", 0); err != nil {
+                        t.Error(err)
+                        return
+                    }
+                } else {
+                    s.Get(key)
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+    keys, _ := s.keyStats()
+    if keys != 500 {
+        t.Fatalf("got %d keys, want 500", keys)
+    }
+}
+
+// TestParallelWrites writes keys of many shards at once, some of them from
+// several goroutines, and checks that no increment is lost and that the
+// WAL and the change log hold the writes in the order of their revisions.
+func TestParallelWrites(t *testing.T) {
+    walDir, snapDir := t.TempDir(), t.TempDir()
+    s, _ := bootStore(t, walDir, snapDir, 2)
+    s.changes = newChangeLog(0, 100000)
+    const writers, rounds = 8, 500
+    var wg sync.WaitGroup
+    for g := 0; g < writers; g++ {
+        wg.Add(1)
+        go func(g int) {
+            defer wg.Done()
+            for i := 0; i < rounds; i++ {
+                if _, err := s.IncrBy(fmt.Sprint("counter-", i%10), 1); err != nil {
+                    t.Error(err)
+                    return
+                }
+                key := fmt.Sprintf("key-%d-%d", g, i%50)
+                if err := s.Set(key, fmt.Sprint(i), 0); err != nil {
+                    t.Error(err)
+                    return
+                }
+                if i%7 == 0 {
+                    s.Delete(key)
+                }
+            }
+        }(g)
+    }
+    wg.Wait()
+    for i := 0; i < 10; i++ {
+        if v, _, _ := s.Get(fmt.Sprint("counter-", i)); v != fmt.Sprint(writers*rounds/10) {
+            t.Fatalf("counter-%d is %s, want %d", i, v, writers*rounds/10)
+        }
+    }
+    changes, _, _ := s.changes.since(0, 1<<30)
+    for i, c := range changes {
+        if c.Rev != uint64(i+1) {
+            t.Fatalf("change %d has revision %d", i, c.Rev)
+        }
+    }
+    if rev := s.revision(); rev != uint64(len(changes)) {
+        t.Fatalf("revision %d after %d changes", rev, len(changes))
+    }
+    want := storeDump(s)
+    s.wal.Close()
+    s, _ = bootStore(t, walDir, snapDir, 2)
+    defer s.wal.Close()
+    if got := storeDump(s); !reflect.DeepEqual(got, want) {
+        t.Fatalf("after replaying the WAL:\n%v\nwant\n%v", got, want)
+    }
+}
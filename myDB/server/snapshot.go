@@ -0,0 +1,443 @@
+package main
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash"
+    "hash/crc32"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+const (
+    snapshotMagic   = "MYDBSNAP"
+    snapshotVersion = 1
+    snapshotPrefix  = "snapshot-"
+    snapshotSuffix  = ".snap"
+)
+
+var errCorruptSnapshot = errors.New("corrupt snapshot")
+
+// SnapshotInfo describes a snapshot file written to disk.
+type SnapshotInfo struct {
+    File       string    `json:"file"`
+    Keys       int       `json:"keys"`
+    Bytes      int64     `json:"bytes"`
+    WALSegment uint64    `json:"wal_segment"` // first WAL segment not covered by the snapshot
+    CreatedAt  time.Time `json:"created_at"`
+}
+
+// Snapshotter writes point-in-time copies of the store to disk and loads the
+// newest valid one at boot, so recovery only has to replay the WAL written
+// since then.
+type Snapshotter struct {
+    mu     sync.Mutex // one snapshot at a time
+    dir    string
+    retain int
+    store  *InMemoryStore
+
+    lastRev atomic.Uint64 // revision of the newest snapshot
+    lastAt  atomic.Int64  // and when it was taken, in Unix nanoseconds
+}
+
+// NewSnapshotter creates a Snapshotter that keeps the newest retain snapshots in dir.
+func NewSnapshotter(dir string, retain int, store *InMemoryStore) (*Snapshotter, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, err
+    }
+    if retain < 1 {
+        retain = 1
+    }
+    return &Snapshotter{dir: dir, retain: retain, store: store}, nil
+}
+
+// Take writes a snapshot of the current store contents. Once it is safely
+// on disk, snapshots beyond the retention count and the WAL segments that
+// no retained snapshot needs are removed.
+func (sn *Snapshotter) Take() (SnapshotInfo, error) {
+    sn.mu.Lock()
+    defer sn.mu.Unlock()
+
+    walSeq, rev, entries, err := sn.store.capture()
+    if err != nil {
+        return SnapshotInfo{}, err
+    }
+
+    now := time.Now()
+    name := fmt.Sprintf("%s%019d%s", snapshotPrefix, now.UnixNano(), snapshotSuffix)
+    path := filepath.Join(sn.dir, name)
+    size, err := writeSnapshotFile(path, walSeq, rev, entries)
+    if err != nil {
+        return SnapshotInfo{}, err
+    }
+
+    sn.lastRev.Store(rev)
+    sn.lastAt.Store(now.UnixNano())
+    if err := sn.prune(); err != nil {
+        fmt.Println("Error pruning old snapshots:", err)
+    }
+
+    return SnapshotInfo{File: name, Keys: len(entries), Bytes: size, WALSegment: walSeq, CreatedAt: now}, nil
+}
+
+// StartSnapshotRoutine starts a background goroutine that takes a snapshot every interval.
+// The returned stop ends it, after a snapshot in progress is written.
+func (sn *Snapshotter) StartSnapshotRoutine(interval time.Duration) (stop func()) {
+    return every(interval, func() {
+        if info, err := sn.Take(); err != nil {
+            fmt.Println("Error taking snapshot:", err)
+        } else {
+            fmt.Printf("Snapshot %s written with %d keys\n", info.File, info.Keys)
+        }
+    })
+}
+
+// LoadLatest restores the store from the newest snapshot that passes its
+// checksum, falling back to older ones. It returns the first WAL segment
+// that still has to be replayed on top of it (0 when there is no snapshot).
+func (sn *Snapshotter) LoadLatest() (uint64, error) {
+    names, err := sn.list()
+    if err != nil {
+        return 0, err
+    }
+    for i := len(names) - 1; i >= 0; i-- {
+        path := filepath.Join(sn.dir, names[i])
+        walSeq, rev, entries, err := readSnapshotFile(path)
+        if err != nil {
+            fmt.Printf("Skipping snapshot %s: %v\n", path, err)
+            continue
+        }
+        sn.store.restore(rev, entries)
+        sn.lastRev.Store(rev)
+        if fi, err := os.Stat(path); err == nil {
+            sn.lastAt.Store(fi.ModTime().UnixNano())
+        }
+        fmt.Printf("Loaded snapshot %s with %d keys\n", names[i], len(entries))
+        return walSeq, nil
+    }
+    return 0, nil
+}
+
+// last returns the revision and time of the newest snapshot taken or
+// loaded, a zero time when there is none.
+func (sn *Snapshotter) last() (uint64, time.Time) {
+    at := sn.lastAt.Load()
+    if at == 0 {
+        return sn.lastRev.Load(), time.Time{}
+    }
+    return sn.lastRev.Load(), time.Unix(0, at)
+}
+
+// SetRetain changes how many snapshots are kept, from the next snapshot on.
+func (sn *Snapshotter) SetRetain(retain int) {
+    sn.mu.Lock()
+    defer sn.mu.Unlock()
+    sn.retain = max(retain, 1)
+}
+
+// prune removes all but the newest sn.retain snapshots and truncates the WAL
+// up to the oldest snapshot that is kept.
+func (sn *Snapshotter) prune() error {
+    names, err := sn.list()
+    if err != nil {
+        return err
+    }
+    if len(names) > sn.retain {
+        for _, name := range names[:len(names)-sn.retain] {
+            if err := os.Remove(filepath.Join(sn.dir, name)); err != nil {
+                return err
+            }
+        }
+        names = names[len(names)-sn.retain:]
+    }
+
+    if sn.store.wal == nil || len(names) == 0 {
+        return nil
+    }
+    walSeq, err := readSnapshotHeader(filepath.Join(sn.dir, names[0]))
+    if err != nil {
+        return err
+    }
+    return sn.store.wal.TruncateBefore(walSeq)
+}
+
+// list returns the snapshot file names in dir, oldest first.
+func (sn *Snapshotter) list() ([]string, error) {
+    entries, err := os.ReadDir(sn.dir)
+    if err != nil {
+        return nil, err
+    }
+    var names []string
+    for _, e := range entries {
+        name := e.Name()
+        if !e.IsDir() && strings.HasPrefix(name, snapshotPrefix) && strings.HasSuffix(name, snapshotSuffix) {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names) // names embed a fixed-width timestamp
+    return names, nil
+}
+
+// writeSnapshotFile writes the snapshot to a temporary file, fsyncs it and
+// renames it into place so a crash never leaves a half-written snapshot
+// under the final name.
+func writeSnapshotFile(path string, walSeq, rev uint64, entries map[string]ValueWithTTL) (int64, error) {
+    tmp := path + ".tmp"
+    f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+    if err != nil {
+        return 0, err
+    }
+    cleanup := func(err error) (int64, error) {
+        f.Close()
+        os.Remove(tmp)
+        return 0, err
+    }
+
+    bw := bufio.NewWriter(f)
+    if err := writeSnapshot(bw, walSeq, rev, entries); err != nil {
+        return cleanup(err)
+    }
+    if err := bw.Flush(); err != nil {
+        return cleanup(err)
+    }
+    if err := f.Sync(); err != nil {
+        return cleanup(err)
+    }
+    info, err := f.Stat()
+    if err != nil {
+        return cleanup(err)
+    }
+    if err := f.Close(); err != nil {
+        os.Remove(tmp)
+        return 0, err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return 0, err
+    }
+    return info.Size(), syncDir(filepath.Dir(path))
+}
+
+func readSnapshotFile(path string) (uint64, uint64, map[string]ValueWithTTL, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return 0, 0, nil, err
+    }
+    defer f.Close()
+    return readSnapshot(bufio.NewReader(f))
+}
+
+// readSnapshotBytes parses a snapshot that was sent over the network.
+func readSnapshotBytes(data []byte) (uint64, uint64, map[string]ValueWithTTL, error) {
+    return readSnapshot(bufio.NewReader(bytes.NewReader(data)))
+}
+
+// readSnapshotHeader returns the WAL segment recorded in a snapshot without
+// reading its entries.
+func readSnapshotHeader(path string) (uint64, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return 0, err
+    }
+    defer f.Close()
+    header := make([]byte, len(snapshotMagic)+1+8)
+    if _, err := io.ReadFull(f, header); err != nil {
+        return 0, err
+    }
+    if string(header[:len(snapshotMagic)]) != snapshotMagic {
+        return 0, errCorruptSnapshot
+    }
+    return binary.LittleEndian.Uint64(header[len(snapshotMagic)+1:]), nil
+}
+
+// writeSnapshot serializes entries as
+//
+//	[magic "MYDBSNAP"][version byte][wal segment uint64][store revision uvarint][count uvarint]
+//	count × [key len uvarint][key][value len uvarint][value][expiration ms varint][type byte][revision uvarint]
+//	[crc32c uint32 of everything before]
+//
+// where value is the encoded collection for keys that are not strings.
+func writeSnapshot(w io.Writer, walSeq, rev uint64, entries map[string]ValueWithTTL) error {
+    sum := crc32.New(crcTable)
+    mw := io.MultiWriter(w, sum)
+
+    buf := make([]byte, 0, 64)
+    buf = append(buf, snapshotMagic...)
+    buf = append(buf, snapshotVersion)
+    buf = binary.LittleEndian.AppendUint64(buf, walSeq)
+    buf = binary.AppendUvarint(buf, rev)
+    buf = binary.AppendUvarint(buf, uint64(len(entries)))
+    if _, err := mw.Write(buf); err != nil {
+        return err
+    }
+
+    for key, v := range entries {
+        value := v.Value
+        if v.coll != nil {
+            value = v.coll.encode()
+        }
+        buf = buf[:0]
+        buf = binary.AppendUvarint(buf, uint64(len(key)))
+        buf = append(buf, key...)
+        buf = binary.AppendUvarint(buf, uint64(len(value)))
+        buf = append(buf, value...)
+        buf = binary.AppendVarint(buf, v.Expiration)
+        buf = append(buf, byte(v.Type))
+        buf = binary.AppendUvarint(buf, v.Revision)
+        if _, err := mw.Write(buf); err != nil {
+            return err
+        }
+    }
+
+    _, err := w.Write(binary.LittleEndian.AppendUint32(nil, sum.Sum32()))
+    return err
+}
+
+// readSnapshot parses a snapshot written by writeSnapshot and verifies its
+// checksum. It returns the WAL segment, the store revision and the
+// entries.
+func readSnapshot(r *bufio.Reader) (uint64, uint64, map[string]ValueWithTTL, error) {
+    cr := newChecksumReader(r)
+
+    header := make([]byte, len(snapshotMagic)+1+8)
+    if err := cr.readFull(header); err != nil {
+        return 0, 0, nil, err
+    }
+    if string(header[:len(snapshotMagic)]) != snapshotMagic {
+        return 0, 0, nil, errCorruptSnapshot
+    }
+    if version := header[len(snapshotMagic)]; version != snapshotVersion {
+        return 0, 0, nil, fmt.Errorf("unsupported snapshot version %d", version)
+    }
+    walSeq := binary.LittleEndian.Uint64(header[len(snapshotMagic)+1:])
+
+    rev, err := binary.ReadUvarint(cr)
+    if err != nil {
+        return 0, 0, nil, err
+    }
+    count, err := binary.ReadUvarint(cr)
+    if err != nil {
+        return 0, 0, nil, err
+    }
+    entries := make(map[string]ValueWithTTL, min(count, 1<<20))
+    for i := uint64(0); i < count; i++ {
+        key, err := cr.readString()
+        if err != nil {
+            return 0, 0, nil, err
+        }
+        value, err := cr.readString()
+        if err != nil {
+            return 0, 0, nil, err
+        }
+        exp, err := binary.ReadVarint(cr)
+        if err != nil {
+            return 0, 0, nil, err
+        }
+        t, err := cr.ReadByte()
+        if err != nil {
+            return 0, 0, nil, err
+        }
+        v := ValueWithTTL{Value: value, Expiration: exp, Type: ValueType(t)}
+        if v.Type != TypeString {
+            if v.coll, err = decodeCollection(v.Type, value); err != nil {
+                return 0, 0, nil, err
+            }
+            v.Value = ""
+        }
+        if v.Revision, err = binary.ReadUvarint(cr); err != nil {
+            return 0, 0, nil, err
+        }
+        entries[key] = v
+    }
+
+    want := cr.Sum32()
+    trailer := make([]byte, 4)
+    if _, err := io.ReadFull(r, trailer); err != nil {
+        return 0, 0, nil, err
+    }
+    if binary.LittleEndian.Uint32(trailer) != want {
+        return 0, 0, nil, fmt.Errorf("checksum mismatch: %w", errCorruptSnapshot)
+    }
+    return walSeq, rev, entries, nil
+}
+
+// checksumReader feeds every byte it reads into a running checksum. Single
+// bytes are batched so varint decoding does not hash one byte at a time.
+type checksumReader struct {
+    r       *bufio.Reader
+    sum     hash.Hash32
+    pending []byte
+}
+
+func newChecksumReader(r *bufio.Reader) *checksumReader {
+    return &checksumReader{r: r, sum: crc32.New(crcTable), pending: make([]byte, 0, 4096)}
+}
+
+func (c *checksumReader) ReadByte() (byte, error) {
+    b, err := c.r.ReadByte()
+    if err != nil {
+        return b, err
+    }
+    c.pending = append(c.pending, b)
+    if len(c.pending) == cap(c.pending) {
+        c.flush()
+    }
+    return b, nil
+}
+
+func (c *checksumReader) readFull(buf []byte) error {
+    c.flush()
+    if _, err := io.ReadFull(c.r, buf); err != nil {
+        if err == io.EOF {
+            return io.ErrUnexpectedEOF
+        }
+        return err
+    }
+    c.sum.Write(buf)
+    return nil
+}
+
+// Sum32 returns the checksum of everything read so far.
+func (c *checksumReader) Sum32() uint32 {
+    c.flush()
+    return c.sum.Sum32()
+}
+
+func (c *checksumReader) flush() {
+    c.sum.Write(c.pending)
+    c.pending = c.pending[:0]
+}
+
+func (c *checksumReader) readString() (string, error) {
+    l, err := binary.ReadUvarint(c)
+    if err != nil {
+        return "", err
+    }
+    if l > walMaxRecordSize {
+        return "", errCorruptSnapshot
+    }
+    buf := make([]byte, l)
+    if err := c.readFull(buf); err != nil {
+        return "", err
+    }
+    return string(buf), nil
+}
+
+// syncDir fsyncs a directory so a rename inside it survives a crash.
+func syncDir(dir string) error {
+    d, err := os.Open(dir)
+    if err != nil {
+        return err
+    }
+    defer d.Close()
+    return d.Sync()
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "fmt"
+    "os"
+    "path/filepath"
+    "reflect"
+    "sort"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// bootStore recovers a store from the snapshots in snapDir and the WAL in
+// walDir, the way the server does at boot.
+func bootStore(t *testing.T, walDir, snapDir string, retain int) (*InMemoryStore, *Snapshotter) {
+    t.Helper()
+    s := NewInMemoryStore()
+    sn, err := NewSnapshotter(snapDir, retain, s)
+    if err != nil {
+        t.Fatal(err)
+    }
+    from, err := sn.LoadLatest()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if s.wal, err = OpenWAL(walDir, WALOptions{}, from, s.replay); err != nil {
+        t.Fatal(err)
+    }
+    s.snapshots = sn
+    return s, sn
+}
+
+// storeDump describes every key of s and its revision, listing the
+// members of hashes and sets in order.
+func storeDump(s *InMemoryStore) map[string]string {
+    rev, entries := s.copyEntries()
+    out := map[string]string{"": fmt.Sprint("revision ", rev)}
+    for key, v := range entries {
+        contents := v.Value
+        if v.coll != nil {
+            flat, _ := decodeStrings(v.coll.encode())
+            if v.Type == TypeHash || v.Type == TypeSet {
+                sort.Strings(flat)
+            }
+            contents = strings.Join(flat, ",")
+            if v.Type == TypeZSet {
+                contents = fmt.Sprint(v.coll.(*zsetValue).sorted)
+            }
+        }
+        out[key] = fmt.Sprintf("%s %d %d %q", v.Type, v.Expiration, v.Revision, contents)
+    }
+    return out
+}
+
+func TestSnapshotRecovery(t *testing.T) {
+    walDir, snapDir := t.TempDir(), t.TempDir()
+    s, sn := bootStore(t, walDir, snapDir, 2)
+    s.Set("a", "1", 0)
+    s.Set("b", "2", 3600)
+    s.Set("gone", "x", 0)
+    runCommands(t, s,
+        []string{"RPUSH", "list", "x", "y"},
+        []string{"HSET", "hash", "f", "v", "g", "w"},
+        []string{"SADD", "set", "m", "n"},
+        []string{"ZADD", "zset", "1.5", "m", "-inf", "n"},
+    )
+    s.Delete("gone")
+    first, err := sn.Take()
+    if err != nil {
+        t.Fatal(err)
+    }
+    s.Set("a", "3", 0)
+    runCommands(t, s, []string{"RPUSH", "list", "z"})
+    if _, err := sn.Take(); err != nil {
+        t.Fatal(err)
+    }
+    s.Set("c", "4", 0)
+    s.Delete("b")
+    want := storeDump(s)
+    s.wal.Close()
+
+    // The WAL older than the oldest snapshot kept is gone.
+    for _, path := range segmentFiles(t, walDir) {
+        seq, _ := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), walSuffix), 10, 64)
+        if seq < first.WALSegment {
+            t.Fatalf("segment %d is still there, the snapshot starts at %d", seq, first.WALSegment)
+        }
+    }
+
+    // The newest snapshot and the WAL after it give back every key with
+    // its expiration and revision.
+    s, _ = bootStore(t, walDir, snapDir, 2)
+    s.wal.Close()
+    if got := storeDump(s); !reflect.DeepEqual(got, want) {
+        t.Fatalf("recovered %v, want %v", got, want)
+    }
+
+    // A damaged newest snapshot is skipped for the older one, whose WAL
+    // was kept.
+    names, err := sn.list()
+    if err != nil || len(names) != 2 {
+        t.Fatalf("snapshots: %v %v", names, err)
+    }
+    newest := filepath.Join(snapDir, names[1])
+    data, _ := os.ReadFile(newest)
+    data[len(data)/2] ^= 0xff
+    os.WriteFile(newest, data, 0o644)
+    s, _ = bootStore(t, walDir, snapDir, 2)
+    s.wal.Close()
+    if got := storeDump(s); !reflect.DeepEqual(got, want) {
+        t.Fatalf("recovered from the older snapshot %v, want %v", got, want)
+    }
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+    "context"
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "net"
+    "os"
+    "sync"
+    "time"
+)
+
+// tlsHandshakeTimeout bounds the handshake of an incoming connection.
+const tlsHandshakeTimeout = 10 * time.Second
+
+// TLSOptions are the files given with -tls-cert, -tls-key and -tls-ca.
+type TLSOptions struct {
+    CertFile   string // certificate of this node, PEM
+    KeyFile    string // its private key, PEM
+    CAFile     string // CAs that sign client certificates and the other nodes' certificates
+    ClientAuth string // none, optional or require
+}
+
+var clientAuthModes = map[string]tls.ClientAuthType{
+    "none":     tls.NoClientCert,
+    "optional": tls.VerifyClientCertIfGiven,
+    "require":  tls.RequireAndVerifyClientCert,
+}
+
+// tlsFiles serves the certificates of the TLS options to the listeners and
+// to the connections this node opens to the others. reload reads the files
+// again, so certificates can be replaced without a restart (on SIGHUP);
+// connections made before keep the ones they started with.
+type tlsFiles struct {
+    opts       TLSOptions
+    clientAuth tls.ClientAuthType
+
+    mu   sync.RWMutex
+    cert *tls.Certificate
+    cas  *x509.CertPool // nil without -tls-ca
+}
+
+func newTLSFiles(opts TLSOptions) (*tlsFiles, error) {
+    if opts.CertFile == "" || opts.KeyFile == "" {
+        return nil, errors.New("-tls-cert and -tls-key go together")
+    }
+    mode, ok := clientAuthModes[opts.ClientAuth]
+    if !ok {
+        return nil, fmt.Errorf("unknown client auth %q, use none, optional or require", opts.ClientAuth)
+    }
+    if opts.CAFile == "" && mode != tls.NoClientCert {
+        if mode == tls.RequireAndVerifyClientCert {
+            return nil, errors.New("client certificates can only be required with -tls-ca")
+        }
+        mode = tls.NoClientCert
+    }
+    f := &tlsFiles{opts: opts, clientAuth: mode}
+    if err := f.reload(); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+// reload reads the certificate, key and CAs again. On error the ones
+// loaded before stay in use.
+func (f *tlsFiles) reload() error {
+    cert, err := tls.LoadX509KeyPair(f.opts.CertFile, f.opts.KeyFile)
+    if err != nil {
+        return err
+    }
+    var cas *x509.CertPool
+    if f.opts.CAFile != "" {
+        data, err := os.ReadFile(f.opts.CAFile)
+        if err != nil {
+            return err
+        }
+        cas = x509.NewCertPool()
+        if !cas.AppendCertsFromPEM(data) {
+            return fmt.Errorf("no certificates in %s", f.opts.CAFile)
+        }
+    }
+    f.mu.Lock()
+    f.cert, f.cas = &cert, cas
+    f.mu.Unlock()
+    return nil
+}
+
+func (f *tlsFiles) current() (*tls.Certificate, *x509.CertPool) {
+    f.mu.RLock()
+    defer f.mu.RUnlock()
+    return f.cert, f.cas
+}
+
+// serverConfig is the TLS configuration of the listeners. Each handshake
+// picks up what was loaded last.
+func (f *tlsFiles) serverConfig() *tls.Config {
+    return &tls.Config{
+        MinVersion: tls.VersionTLS12,
+        GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+            cert, cas := f.current()
+            return &tls.Config{
+                MinVersion:   tls.VersionTLS12,
+                Certificates: []tls.Certificate{*cert},
+                ClientCAs:    cas,
+                ClientAuth:   f.clientAuth,
+            }, nil
+        },
+    }
+}
+
+// clientConfig is the TLS configuration of a connection to another node:
+// its certificate is checked against -tls-ca (or the system CAs) and this
+// node's certificate is presented as the client certificate.
+func (f *tlsFiles) clientConfig(serverName string) *tls.Config {
+    cert, cas := f.current()
+    return &tls.Config{
+        MinVersion:   tls.VersionTLS12,
+        ServerName:   serverName,
+        RootCAs:      cas,
+        Certificates: []tls.Certificate{*cert},
+    }
+}
+
+// listen listens on addr, with TLS when files is set.
+func listen(addr string, files *tlsFiles) (net.Listener, error) {
+    l, err := net.Listen("tcp", addr)
+    if err != nil || files == nil {
+        return l, err
+    }
+    return tls.NewListener(l, files.serverConfig()), nil
+}
+
+// clusterTLS is set when the nodes talk to each other over TLS, see dialRPC.
+var clusterTLS *tlsFiles
+
+// dialRPC connects to the RPC port of another node, over TLS when the
+// cluster uses it. A timeout of 0 waits as long as it takes.
+func dialRPC(addr string, timeout time.Duration) (net.Conn, error) {
+    conn, err := net.DialTimeout("tcp", addr, timeout)
+    if err != nil || clusterTLS == nil {
+        return conn, err
+    }
+    host, _, err := net.SplitHostPort(addr)
+    if err != nil || host == "" {
+        host = "localhost"
+    }
+    tc := tls.Client(conn, clusterTLS.clientConfig(host))
+    ctx := context.Background()
+    if timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, timeout)
+        defer cancel()
+    }
+    if err := tc.HandshakeContext(ctx); err != nil {
+        conn.Close()
+        return nil, err
+    }
+    return tc, nil
+}
+
+// certUser returns the user named by the common name of the verified
+// client certificate of a connection, or nil.
+func (a *ACL) certUser(state *tls.ConnectionState) *ACLUser {
+    if a == nil || state == nil || len(state.VerifiedChains) == 0 {
+        return nil
+    }
+    return a.users[state.VerifiedChains[0][0].Subject.CommonName]
+}
+
+// handshake completes the TLS handshake of conn, if it is a TLS
+// connection, and returns the user its client certificate names.
+func (a *ACL) handshake(conn net.Conn) (*ACLUser, error) {
+    tc, ok := conn.(*tls.Conn)
+    if !ok {
+        return nil, nil
+    }
+    tc.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+    defer tc.SetDeadline(time.Time{})
+    if err := tc.Handshake(); err != nil {
+        return nil, err
+    }
+    state := tc.ConnectionState()
+    return a.certUser(&state), nil
+}
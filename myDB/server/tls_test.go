@@ -0,0 +1,216 @@
+package main
+
+import (
+    "crypto/ecdsa"
+    "crypto/elliptic"
+    "crypto/rand"
+    "crypto/tls"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/pem"
+    "math/big"
+    "net"
+    "net/rpc"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+)
+
+// testCA signs certificates for the tests, made up on the spot.
+type testCA struct {
+    cert *x509.Certificate
+    key  *ecdsa.PrivateKey
+    file string // the CA certificate, PEM
+}
+
+var testSerial int64
+
+func newTestCA(t *testing.T) *testCA {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    testSerial++
+    tmpl := &x509.Certificate{
+        SerialNumber:          big.NewInt(testSerial),
+        Subject:               pkix.Name{CommonName: "test CA"},
+        NotBefore:             time.Now().Add(-time.Hour),
+        NotAfter:              time.Now().Add(time.Hour),
+        IsCA:                  true,
+        KeyUsage:              x509.KeyUsageCertSign,
+        BasicConstraintsValid: true,
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cert, _ := x509.ParseCertificate(der)
+    ca := &testCA{cert: cert, key: key, file: filepath.Join(t.TempDir(), "ca.pem")}
+    writePEM(t, ca.file, "CERTIFICATE", der)
+    return ca
+}
+
+// issue writes a certificate for cn, valid for localhost as a server and
+// as a client, and its key to dir, and returns their paths.
+func (ca *testCA) issue(t *testing.T, dir, cn string) (certFile, keyFile string) {
+    t.Helper()
+    key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+    if err != nil {
+        t.Fatal(err)
+    }
+    testSerial++
+    tmpl := &x509.Certificate{
+        SerialNumber: big.NewInt(testSerial),
+        Subject:      pkix.Name{CommonName: cn},
+        DNSNames:     []string{"localhost"},
+        IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+        NotBefore:    time.Now().Add(-time.Hour),
+        NotAfter:     time.Now().Add(time.Hour),
+        KeyUsage:     x509.KeyUsageDigitalSignature,
+        ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+    }
+    der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    keyDER, err := x509.MarshalECPrivateKey(key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    certFile, keyFile = filepath.Join(dir, cn+".pem"), filepath.Join(dir, cn+"-key.pem")
+    writePEM(t, certFile, "CERTIFICATE", der)
+    writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+    return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+    t.Helper()
+    if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+        t.Fatal(err)
+    }
+}
+
+// serveTLS listens on a free port with files and hands every connection to
+// serve.
+func serveTLS(t *testing.T, files *tlsFiles, serve func(net.Conn)) string {
+    t.Helper()
+    l, err := listen("127.0.0.1:0", files)
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { l.Close() })
+    go func() {
+        for {
+            conn, err := l.Accept()
+            if err != nil {
+                return
+            }
+            go serve(conn)
+        }
+    }()
+    return l.Addr().String()
+}
+
+func TestTLSReload(t *testing.T) {
+    ca := newTestCA(t)
+    dir := t.TempDir()
+    certFile, keyFile := ca.issue(t, dir, "node-a")
+    files, err := newTLSFiles(TLSOptions{CertFile: certFile, KeyFile: keyFile, ClientAuth: "none"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    addr := serveTLS(t, files, func(conn net.Conn) {
+        conn.(*tls.Conn).Handshake()
+        conn.Close()
+    })
+
+    serverName := func() string {
+        roots := x509.NewCertPool()
+        roots.AddCert(ca.cert)
+        conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+        if err != nil {
+            t.Fatal(err)
+        }
+        defer conn.Close()
+        return conn.ConnectionState().PeerCertificates[0].Subject.CommonName
+    }
+    if got := serverName(); got != "node-a" {
+        t.Fatalf("got certificate of %q, want node-a", got)
+    }
+
+    // Replace the files, as a renewal would, and reload them.
+    newCert, newKey := ca.issue(t, dir, "node-b")
+    os.Rename(newCert, certFile)
+    os.Rename(newKey, keyFile)
+    if err := files.reload(); err != nil {
+        t.Fatal(err)
+    }
+    if got := serverName(); got != "node-b" {
+        t.Fatalf("after reload got certificate of %q, want node-b", got)
+    }
+
+    // A broken file keeps the certificate loaded before.
+    os.WriteFile(keyFile, []byte("garbage"), 0600)
+    if err := files.reload(); err == nil {
+        t.Fatal("reload of a broken key succeeded")
+    }
+    if got := serverName(); got != "node-b" {
+        t.Fatalf("after failed reload got certificate of %q, want node-b", got)
+    }
+}
+
+func TestTLSClientCertUser(t *testing.T) {
+    ca := newTestCA(t)
+    dir := t.TempDir()
+    serverCert, serverKey := ca.issue(t, dir, "server")
+    files, err := newTLSFiles(TLSOptions{CertFile: serverCert, KeyFile: serverKey, CAFile: ca.file, ClientAuth: "optional"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    acl, err := NewACL(ACLConfig{Users: []ACLUser{{
+        Name:        "app",
+        Permissions: []Permission{{Prefix: "app:", Access: accessWrite}},
+    }}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    rpc.Register(NewInMemoryStore())
+    addr := serveTLS(t, files, func(conn net.Conn) { acl.serveRPC(conn, 1) })
+
+    // A node dials with its own certificate, which names user app.
+    appCert, appKey := ca.issue(t, dir, "app")
+    clusterTLS, err = newTLSFiles(TLSOptions{CertFile: appCert, KeyFile: appKey, CAFile: ca.file, ClientAuth: "none"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer func() { clusterTLS = nil }()
+    client, err := dialTimeout(addr, time.Second)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer client.Close()
+    var resp RPCResponse
+    if err := client.Call("InMemoryStore.RPCSet", &RPCRequest{Key: "app:x", Value: "1"}, &resp); err != nil || !resp.Success {
+        t.Fatalf("set as app: %v %+v", err, resp)
+    }
+    err = client.Call("InMemoryStore.RPCSet", &RPCRequest{Key: "other", Value: "1"}, &resp)
+    if err == nil || !strings.HasPrefix(err.Error(), "NOPERM") {
+        t.Fatalf("set of another key as app: got %v, want NOPERM", err)
+    }
+
+    // Without a client certificate the connection has to log in.
+    roots := x509.NewCertPool()
+    roots.AddCert(ca.cert)
+    conn, err := tls.Dial("tcp", addr, &tls.Config{RootCAs: roots, ServerName: "localhost"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    anon := rpc.NewClient(conn)
+    defer anon.Close()
+    if err := anon.Call("InMemoryStore.RPCGet", &RPCRequest{Key: "app:x"}, &resp); err == nil || err.Error() != errNoAuth.Error() {
+        t.Fatalf("get without a certificate: got %v, want NOAUTH", err)
+    }
+}
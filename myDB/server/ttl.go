@@ -0,0 +1,223 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+)
+
+var (
+    errInvalidTTL  = errors.New("ERR invalid TTL, it must be 0 (no expiry) or a positive number of seconds")
+    errKeyNotFound = errors.New("Key not found or expired")
+)
+
+// checkTTL rejects a TTL that is negative or so large that the expiration
+// would not fit in Unix milliseconds. 0 means the key does not expire.
+func checkTTL(ttl int64) error {
+    if ttl < 0 || ttl > (math.MaxInt64-time.Now().UnixMilli())/1000 {
+        return errInvalidTTL
+    }
+    return nil
+}
+
+// Expire gives key ttl seconds to live from now, replacing any expiration it
+// had, and reports whether the key exists. ttl must be positive: use
+// Persist to take the expiration away.
+func (s *InMemoryStore) Expire(key string, ttl int64) (bool, error) {
+    if ttl == 0 {
+        return false, errInvalidTTL
+    }
+    if err := checkTTL(ttl); err != nil {
+        return false, err
+    }
+    return s.expireAt(key, expirationAfter(ttl))
+}
+
+// expireAt sets the expiration of key, in Unix milliseconds, if it exists.
+func (s *InMemoryStore) expireAt(key string, expiration int64) (bool, error) {
+    found := false
+    err := s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        if !exists {
+            return nil, nil
+        }
+        found = true
+        v.Expiration = expiration
+        m := setMutation(key, v)
+        return &m, nil
+    })
+    return found && err == nil, err
+}
+
+// Persist removes the expiration of key. It reports whether the key exists
+// and whether it had an expiration to remove.
+func (s *InMemoryStore) Persist(key string) (found, changed bool, err error) {
+    err = s.update(key, func(v ValueWithTTL, exists bool) (*Mutation, error) {
+        found = exists
+        if !exists || v.Expiration == noExpiration {
+            return nil, nil
+        }
+        changed = true
+        v.Expiration = noExpiration
+        m := setMutation(key, v)
+        return &m, nil
+    })
+    return found, changed && err == nil, err
+}
+
+// TTL returns the milliseconds key has left to live, or -1 when it does
+// not expire, and whether it exists.
+func (s *InMemoryStore) TTL(key string) (int64, bool) {
+    v, exists := s.entry(key)
+    switch {
+    case !exists:
+        return 0, false
+    case v.Expiration == noExpiration:
+        return -1, true
+    default:
+        return max(v.Expiration-time.Now().UnixMilli(), 0), true
+    }
+}
+
+// RPCExpire sets a TTL of req.TTL seconds on an existing key.
+func (s *InMemoryStore) RPCExpire(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    found, err := s.Expire(req.Key, req.TTL)
+    if err == nil && !found {
+        err = errKeyNotFound
+    }
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    resp.Exists = true
+    return nil
+}
+
+// RPCPersist removes the TTL of a key. Data is "1" when the key had one and
+// "0" when it already did not expire.
+func (s *InMemoryStore) RPCPersist(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    found, changed, err := s.Persist(req.Key)
+    if err == nil && !found {
+        err = errKeyNotFound
+    }
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    resp.Success = true
+    resp.Exists = true
+    resp.Data = strconv.FormatInt(boolInt(changed), 10)
+    return nil
+}
+
+// RPCTTL returns the milliseconds the key has left to live in Data, or -1
+// when it does not expire.
+func (s *InMemoryStore) RPCTTL(req *RPCRequest, resp *RPCResponse) error {
+    if s.movedTo(req.Key, resp) {
+        return nil
+    }
+    if err := s.checkRead(); err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        resp.Leader = s.leaderAddr()
+        return nil
+    }
+    ttl, exists := s.TTL(req.Key)
+    if !exists {
+        resp.Success = false
+        resp.Error = errKeyNotFound.Error()
+        return nil
+    }
+    resp.Success = true
+    resp.Exists = true
+    resp.Data = strconv.FormatInt(ttl, 10)
+    return nil
+}
+
+// expireHandler takes {"key", "ttl"} and sets the TTL of an existing key,
+// in seconds.
+func (store *InMemoryStore) expireHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req RPCRequest
+    store.limitBody(w, r, false)
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        bodyError(w, err)
+        return
+    }
+    args := &RPCRequest{Key: req.Key, TTL: req.TTL}
+    if !authorized(w, r, "InMemoryStore.RPCExpire", args) {
+        return
+    }
+    resp, err := store.invoke("RPCExpire", store.RPCExpire, args)
+    writeRPCResult(w, resp, err, nil)
+}
+
+// persistHandler takes {"key"} and removes its TTL. data tells whether the
+// key had one.
+func (store *InMemoryStore) persistHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req RPCRequest
+    store.limitBody(w, r, false)
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        bodyError(w, err)
+        return
+    }
+    args := &RPCRequest{Key: req.Key}
+    if !authorized(w, r, "InMemoryStore.RPCPersist", args) {
+        return
+    }
+    resp, err := store.invoke("RPCPersist", store.RPCPersist, args)
+    writeRPCResult(w, resp, err, func(out *APIResponse) {
+        out.Data = resp.Data == "1"
+    })
+}
+
+// ttlHandler serves GET /ttl?key=, answering with the seconds and
+// milliseconds the key has left to live, both -1 when it does not expire.
+func (store *InMemoryStore) ttlHandler(w http.ResponseWriter, r *http.Request) {
+    if err := store.checkRead(); err != nil {
+        if !store.redirectToLeader(w, r) {
+            w.WriteHeader(http.StatusServiceUnavailable)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        }
+        return
+    }
+    args := &RPCRequest{Key: r.URL.Query().Get("key")}
+    if !authorized(w, r, "InMemoryStore.RPCTTL", args) {
+        return
+    }
+    resp, err := store.invoke("RPCTTL", store.RPCTTL, args)
+    writeRPCResult(w, resp, err, func(out *APIResponse) {
+        ms, _ := strconv.ParseInt(resp.Data, 10, 64)
+        ttl := ms
+        if ms > 0 {
+            ttl = (ms + 500) / 1000
+        }
+        out.Data = map[string]int64{"ttl": ttl, "pttl": ms}
+    })
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+    "fmt"
+    "math"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "sync/atomic"
+    "testing"
+    "time"
+)
+
+func TestMillisecondExpiry(t *testing.T) {
+    s := NewInMemoryStore()
+    s.Set("short", "v", 0)
+    s.Set("renewed", "v", 0)
+    s.Set("kept", "v", 0)
+    at := time.Now().UnixMilli() + 50
+    for _, key := range []string{"short", "renewed", "kept"} {
+        if found, err := s.expireAt(key, at); !found || err != nil {
+            t.Fatalf("expire %s: %v %v", key, found, err)
+        }
+    }
+    if ttl, ok := s.TTL("short"); !ok || ttl <= 0 || ttl > 50 {
+        t.Fatalf("ttl: %v %v", ttl, ok)
+    }
+    // Changing or dropping the expiration leaves a stale timer behind,
+    // which Cleanup must ignore.
+    s.Set("renewed", "w", 0)
+    s.Persist("kept")
+
+    time.Sleep(60 * time.Millisecond)
+    if _, _, ok := s.Get("short"); ok {
+        t.Fatal("the key is there 10ms after it expired")
+    }
+    s.Cleanup()
+    s.mu.RLock()
+    _, stored := s.store.get("short")
+    s.mu.RUnlock()
+    if stored || s.expiry.Len() != 0 {
+        t.Fatalf("after cleanup: stored %v, %d timers left", stored, s.expiry.Len())
+    }
+    for _, key := range []string{"renewed", "kept"} {
+        if _, _, ok := s.Get(key); !ok {
+            t.Fatalf("%s expired on a stale timer", key)
+        }
+    }
+}
+
+func TestTTLSemantics(t *testing.T) {
+    s := NewInMemoryStore()
+
+    // A TTL of 0 means the key does not expire.
+    if err := s.Set("k", "v", 0); err != nil {
+        t.Fatal(err)
+    }
+    if ttl, ok := s.TTL("k"); !ok || ttl != -1 {
+        t.Fatalf("ttl of a key set with 0: %v %v", ttl, ok)
+    }
+
+    // Negative TTLs, and ones whose expiration would overflow, are
+    // rejected everywhere and change nothing.
+    for _, ttl := range []int64{-1, 1 << 60, math.MaxInt64} {
+        if err := s.Set("k", "w", ttl); err != errInvalidTTL {
+            t.Fatalf("set with a ttl of %d: %v", ttl, err)
+        }
+    }
+    for _, ttl := range []int64{0, -1, math.MaxInt64} {
+        if _, err := s.Expire("k", ttl); err != errInvalidTTL {
+            t.Fatalf("expire %d: %v", ttl, err)
+        }
+    }
+    if _, err := s.Txn(nil, []TxnOp{{Op: "set", Key: "k", Value: "w", TTL: -1}}); err != errInvalidTTL {
+        t.Fatalf("txn with a negative ttl: %v", err)
+    }
+    if v, _, _ := s.Get("k"); v != "v" {
+        t.Fatalf("value after rejected writes: %s", v)
+    }
+    if ttl, _ := s.TTL("k"); ttl != -1 {
+        t.Fatalf("ttl after rejected writes: %v", ttl)
+    }
+
+    // EXPIRE, PERSIST and TTL.
+    if found, err := s.Expire("k", 100); !found || err != nil {
+        t.Fatalf("expire: %v %v", found, err)
+    }
+    if ttl, _ := s.TTL("k"); ttl <= 99000 || ttl > 100000 {
+        t.Fatalf("ttl after expire: %v", ttl)
+    }
+    if found, changed, err := s.Persist("k"); !found || !changed || err != nil {
+        t.Fatalf("persist: %v %v %v", found, changed, err)
+    }
+    if found, changed, _ := s.Persist("k"); !found || changed {
+        t.Fatalf("persist without a ttl: %v %v", found, changed)
+    }
+    // TTLs far in the future are kept exactly.
+    if found, err := s.Expire("k", 1<<40); !found || err != nil {
+        t.Fatalf("expire 1<<40: %v %v", found, err)
+    }
+    if ttl, _ := s.TTL("k"); ttl <= (1<<40-1)*1000 {
+        t.Fatalf("ttl after expire 1<<40: %v", ttl)
+    }
+    s.Persist("k")
+    if found, _ := s.Expire("missing", 10); found {
+        t.Fatal("expire of a missing key found it")
+    }
+
+    // Over HTTP, a negative TTL is a bad request and a missing key is not
+    // found.
+    for _, tt := range []struct {
+        body string
+        code int
+    }{
+        {`{"key": "k", "ttl": -5}`, http.StatusBadRequest},
+        {`{"key": "missing", "ttl": 5}`, http.StatusNotFound},
+        {`{"key": "k", "ttl": 5}`, http.StatusOK},
+    } {
+        w := httptest.NewRecorder()
+        s.expireHandler(w, httptest.NewRequest("POST", "/expire", strings.NewReader(tt.body)))
+        if w.Code != tt.code {
+            t.Fatalf("%s: %d %s", tt.body, w.Code, w.Body)
+        }
+    }
+    w := httptest.NewRecorder()
+    s.persistHandler(w, httptest.NewRequest("GET", "/persist", nil))
+    if w.Code != http.StatusMethodNotAllowed {
+        t.Fatalf("persist with GET: %d %s", w.Code, w.Body)
+    }
+    w = httptest.NewRecorder()
+    s.expireHandler(w, httptest.NewRequest("POST", "/expire", strings.NewReader(`{"key": "k", "ttl": 5, "value": "`+strings.Repeat("v", 3<<20)+`"}`)))
+    if w.Code != http.StatusRequestEntityTooLarge {
+        t.Fatalf("expire with a large body: %d", w.Code)
+    }
+    w = httptest.NewRecorder()
+    s.ttlHandler(w, httptest.NewRequest("GET", "/ttl?key=k", nil))
+    if !strings.Contains(w.Body.String(), `"ttl":5`) {
+        t.Fatalf("ttl over HTTP: %d %s", w.Code, w.Body)
+    }
+}
+
+// BenchmarkSetGetDuringExpiry measures Set and Get while Cleanup removes
+// expiringKeys keys that came due at once, next to the same load with
+// nothing to expire. max-us is the slowest Set and Get: Cleanup removes the
+// keys a batch at a time, so it should stay close to the idle one rather
+// than grow with the number of keys expiring.
+func BenchmarkSetGetDuringExpiry(b *testing.B) {
+    const expiringKeys = 200000
+    for _, expiring := range []int{0, expiringKeys} {
+        b.Run(fmt.Sprintf("expiring=%d", expiring), func(b *testing.B) {
+            s := NewInMemoryStore()
+            at := time.Now().UnixMilli() + 10
+            for i := 0; i < expiring; i++ {
+                s.write(Mutation{Op: OpSet, Key: fmt.Sprint("expiring:", i), Value: "v", Expiration: at})
+            }
+            time.Sleep(time.Until(time.UnixMilli(at + 1)))
+
+            cleaned := make(chan struct{})
+            var worst atomic.Int64
+            var next atomic.Int64
+            b.ResetTimer()
+            go func() {
+                s.Cleanup()
+                close(cleaned)
+            }()
+            b.RunParallel(func(pb *testing.PB) {
+                for pb.Next() {
+                    key := fmt.Sprint("k", next.Add(1)%1000)
+                    start := time.Now()
+                    s.Set(key, "v", 0)
+                    s.Get(key)
+                    if d := int64(time.Since(start)); d > worst.Load() {
+                        worst.Store(d)
+                    }
+                }
+            })
+            b.StopTimer()
+            <-cleaned
+            if n := s.expiry.Len(); n != 0 {
+                b.Fatalf("%d keys left to expire", n)
+            }
+            b.ReportMetric(float64(worst.Load())/1e3, "max-us")
+        })
+    }
+}
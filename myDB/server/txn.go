@@ -0,0 +1,326 @@
+package main
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// TxnCondition must hold for a transaction to be applied: the key must be
+// at Revision, or must not exist when Revision is 0.
+type TxnCondition struct {
+    Key      string `json:"key"`
+    Revision uint64 `json:"revision"`
+}
+
+// TxnOp is one write of a transaction.
+type TxnOp struct {
+    Op    string `json:"op"` // "set" or "delete"
+    Key   string `json:"key"`
+    Value string `json:"value,omitempty"`
+    TTL   int64  `json:"ttl,omitempty"` // TTL in seconds, for "set"; 0 for no expiry
+}
+
+// TxnFailure is a condition of a transaction that did not hold.
+type TxnFailure struct {
+    Index    int    `json:"index"` // position in the conditions
+    Key      string `json:"key"`
+    Expected uint64 `json:"expected"`
+    Revision uint64 `json:"revision"` // current revision, 0 when the key does not exist
+}
+
+// TxnError is returned when conditions of a transaction did not hold.
+// Nothing was written.
+type TxnError struct {
+    Failed []TxnFailure
+}
+
+func (e *TxnError) Error() string {
+    parts := make([]string, len(e.Failed))
+    for i, f := range e.Failed {
+        switch {
+        case f.Revision == 0:
+            parts[i] = fmt.Sprintf("condition %d: key %q does not exist", f.Index, f.Key)
+        case f.Expected == 0:
+            parts[i] = fmt.Sprintf("condition %d: key %q exists at revision %d", f.Index, f.Key, f.Revision)
+        default:
+            parts[i] = fmt.Sprintf("condition %d: key %q is at revision %d, not %d", f.Index, f.Key, f.Revision, f.Expected)
+        }
+    }
+    return "CONFLICT " + strings.Join(parts, "; ")
+}
+
+var errCrossShard = errors.New("CROSSSHARD the keys of a transaction must live on one node")
+
+// Txn checks conds and, if they all hold, applies ops as one unit: other
+// writes cannot come in between, and the ops are logged and replicated as
+// a single record, so a crash never leaves only some of them applied. It
+// returns the revision each op gave its key (0 for deletes). When a
+// condition does not hold, nothing is written and the error is a *TxnError.
+func (s *InMemoryStore) Txn(conds []TxnCondition, ops []TxnOp) ([]uint64, error) {
+    for _, op := range ops {
+        if op.Op != "set" && op.Op != "delete" {
+            return nil, fmt.Errorf("ERR unknown transaction op %q", op.Op)
+        }
+        if err := checkTTL(op.TTL); err != nil {
+            return nil, err
+        }
+    }
+
+    var m Mutation
+    var revs []uint64
+    if s.raft != nil {
+        s.proposeMu.Lock()
+        defer s.proposeMu.Unlock()
+        if err := s.raft.CheckRead(); err != nil {
+            return nil, err
+        }
+        var err error
+        s.mu.Lock()
+        m, revs, err = s.prepareTxn(conds, ops)
+        s.mu.Unlock()
+        if err == nil && len(ops) > 0 {
+            if err = s.makeRoom(m); err == nil {
+                err = s.raft.Propose(m)
+            }
+        }
+        if err != nil {
+            return nil, err
+        }
+    } else {
+        s.mu.Lock()
+        if s.follower != nil {
+            s.mu.Unlock()
+            return nil, errReadOnly
+        }
+        var err error
+        m, revs, err = s.prepareTxn(conds, ops)
+        if err == nil && len(ops) > 0 {
+            err = s.commit(m)
+        }
+        if err == nil && s.sharding != nil {
+            for _, op := range ops {
+                if op.Op == "delete" {
+                    s.sharding.tombstone(op.Key)
+                }
+            }
+        }
+        s.mu.Unlock()
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if s.sharding != nil {
+        for _, op := range ops {
+            if op.Op == "delete" {
+                s.sharding.forgetPrevious(op.Key)
+            }
+        }
+    }
+    return revs, nil
+}
+
+// prepareTxn checks conds and turns ops into one batch mutation with the
+// revisions already assigned. The caller must hold s.mu for writing.
+func (s *InMemoryStore) prepareTxn(conds []TxnCondition, ops []TxnOp) (Mutation, []uint64, error) {
+    now := time.Now().UnixMilli()
+    current := func(key string) uint64 {
+        if v, ok := s.store.get(key); ok && !v.expired(now) {
+            return v.Revision
+        }
+        return 0
+    }
+    var failed []TxnFailure
+    for i, c := range conds {
+        if rev := current(c.Key); rev != c.Revision {
+            failed = append(failed, TxnFailure{Index: i, Key: c.Key, Expected: c.Revision, Revision: rev})
+        }
+    }
+    if failed != nil {
+        return Mutation{}, nil, &TxnError{Failed: failed}
+    }
+
+    // Revisions count on from the ones given earlier in the batch, the way
+    // stamp would if the ops were committed one by one.
+    assigned := make(map[string]uint64)
+    ms := make([]Mutation, len(ops))
+    revs := make([]uint64, len(ops))
+    for i, op := range ops {
+        if op.Op == "delete" {
+            ms[i] = Mutation{Op: OpDelete, Key: op.Key}
+            assigned[op.Key] = 0
+            continue
+        }
+        rev, ok := assigned[op.Key]
+        if !ok {
+            if v, exists := s.store.get(op.Key); exists {
+                rev = v.Revision
+            }
+        }
+        rev++
+        assigned[op.Key] = rev
+        ms[i] = Mutation{Op: OpSet, Key: op.Key, Value: op.Value, Expiration: expirationAfter(op.TTL), Revision: rev}
+        revs[i] = rev
+    }
+    return batchMutation(ms), revs, nil
+}
+
+// batchMutation wraps ms into one mutation, so they are logged, replicated
+// and applied together.
+func batchMutation(ms []Mutation) Mutation {
+    records := make([]string, len(ms))
+    for i, m := range ms {
+        records[i] = string(encodeMutation(m))
+    }
+    return Mutation{Op: OpBatch, Value: encodeStrings(records), batch: ms}
+}
+
+// ops returns the mutations of a batch. Batches that arrive encoded (from
+// a leader or a raft peer) are decoded here.
+func (m Mutation) ops() []Mutation {
+    if m.batch != nil {
+        return m.batch
+    }
+    ms, err := decodeBatch(m.Value)
+    if err != nil {
+        fmt.Println("Error decoding batch:", err)
+    }
+    return ms
+}
+
+func decodeBatch(data string) ([]Mutation, error) {
+    records, err := decodeStrings(data)
+    if err != nil {
+        return nil, err
+    }
+    ms := make([]Mutation, len(records))
+    for i, r := range records {
+        if ms[i], err = decodeMutation([]byte(r)); err != nil {
+            return nil, err
+        }
+        if ms[i].Op == OpBatch {
+            return nil, fmt.Errorf("nested batch: %w", errCorruptEntry)
+        }
+    }
+    return ms, nil
+}
+
+// txnKeys returns every key a transaction reads or writes.
+func txnKeys(req *TxnRequest) []string {
+    keys := make([]string, 0, len(req.Conditions)+len(req.Ops))
+    for _, c := range req.Conditions {
+        keys = append(keys, c.Key)
+    }
+    for _, op := range req.Ops {
+        keys = append(keys, op.Key)
+    }
+    return keys
+}
+
+// txnOwner returns the node owning all keys of req, or errCrossShard when
+// they are spread over several nodes.
+func (s *InMemoryStore) txnOwner(req *TxnRequest) (owner string, local bool, err error) {
+    local = true
+    for i, key := range txnKeys(req) {
+        o, l := s.route(key)
+        if i > 0 && o != owner {
+            return "", false, errCrossShard
+        }
+        owner, local = o, l
+    }
+    return owner, local, nil
+}
+
+type TxnRequest struct {
+    Conditions []TxnCondition `json:"conditions"`
+    Ops        []TxnOp        `json:"ops"`
+}
+
+type TxnResponse struct {
+    Success   bool         `json:"success"`
+    Error     string       `json:"error,omitempty"`
+    Failed    []TxnFailure `json:"failed,omitempty"`    // conditions that did not hold
+    Revisions []uint64     `json:"revisions,omitempty"` // revision each op gave its key
+    Leader    string       `json:"leader,omitempty"`
+    Owner     string       `json:"owner,omitempty"`
+}
+
+func (s *InMemoryStore) RPCTxn(req *TxnRequest, resp *TxnResponse) error {
+    owner, local, err := s.txnOwner(req)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
+    if !local {
+        resp.Success = false
+        resp.Error = "MOVED " + owner
+        resp.Owner = owner
+        return nil
+    }
+    revs, err := s.Txn(req.Conditions, req.Ops)
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        var txnErr *TxnError
+        if errors.As(err, &txnErr) {
+            resp.Failed = txnErr.Failed
+        } else {
+            resp.Leader = s.leaderAddr()
+        }
+        return nil
+    }
+    resp.Success = true
+    resp.Revisions = revs
+    return nil
+}
+
+// txnHandler serves POST /txn with a TxnRequest. A transaction whose
+// conditions do not hold is answered with 409 and the failed conditions.
+func (store *InMemoryStore) txnHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        methodNotAllowed(w, "POST")
+        return
+    }
+    if store.redirectToLeader(w, r) {
+        return
+    }
+    var req TxnRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        httpError(w, http.StatusBadRequest, "Invalid request")
+        return
+    }
+    if !authorized(w, r, "InMemoryStore.RPCTxn", &req) {
+        return
+    }
+
+    var resp TxnResponse
+    owner, local, err := store.txnOwner(&req)
+    switch {
+    case err != nil:
+        resp.Error = err.Error()
+    case local:
+        store.RPCTxn(&req, &resp)
+    default:
+        if err = store.sharding.call(owner, "InMemoryStore.RPCTxn", &req, &resp); err != nil {
+            w.WriteHeader(http.StatusBadGateway)
+            json.NewEncoder(w).Encode(APIResponse{Success: false, Error: fmt.Sprintf("shard %s: %v", owner, err)})
+            return
+        }
+    }
+
+    switch {
+    case resp.Success:
+        json.NewEncoder(w).Encode(APIResponse{Success: true, Data: map[string]interface{}{"revisions": resp.Revisions}})
+    case resp.Failed != nil:
+        w.WriteHeader(http.StatusConflict)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error, Data: map[string]interface{}{"failed": resp.Failed}})
+    default:
+        w.WriteHeader(errorStatus(resp.Error))
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: resp.Error})
+    }
+}
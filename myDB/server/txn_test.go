@@ -0,0 +1,66 @@
+package main
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+func TestTxnFailures(t *testing.T) {
+    s := NewInMemoryStore()
+    s.Set("a", "1", 0)
+    s.Set("a", "2", 0)
+    s.Set("b", "1", 0)
+    _, revA, _ := s.Get("a")
+
+    // Every condition that does not hold is reported, with what was
+    // expected and what the key is at, and none of the ops is applied.
+    _, err := s.Txn(
+        []TxnCondition{{"a", revA}, {"b", 0}, {"c", 1}, {"a", revA - 1}},
+        []TxnOp{{Op: "set", Key: "a", Value: "3"}, {Op: "delete", Key: "b"}, {Op: "set", Key: "c", Value: "1"}},
+    )
+    var txnErr *TxnError
+    if !errors.As(err, &txnErr) {
+        t.Fatalf("txn with failed conditions: %v", err)
+    }
+    want := []TxnFailure{
+        {Index: 1, Key: "b", Expected: 0, Revision: 1},
+        {Index: 2, Key: "c", Expected: 1, Revision: 0},
+        {Index: 3, Key: "a", Expected: revA - 1, Revision: revA},
+    }
+    if !reflect.DeepEqual(txnErr.Failed, want) {
+        t.Fatalf("failed %+v, want %+v", txnErr.Failed, want)
+    }
+    if !strings.HasPrefix(err.Error(), "CONFLICT ") {
+        t.Fatalf("error: %v", err)
+    }
+    if v, rev, _ := s.Get("a"); v != "2" || rev != revA {
+        t.Fatalf("a was written: %s at %d", v, rev)
+    }
+    if _, _, ok := s.Get("b"); !ok {
+        t.Fatal("b was deleted")
+    }
+    if _, _, ok := s.Get("c"); ok {
+        t.Fatal("c was set")
+    }
+
+    // The failures reach HTTP clients with a 409.
+    r := httptest.NewRequest("POST", "/txn", strings.NewReader(`{"conditions": [{"key": "c", "revision": 1}], "ops": [{"op": "set", "key": "c", "value": "1"}]}`))
+    w := httptest.NewRecorder()
+    s.txnHandler(w, r)
+    if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), `"failed":[{"index":0,"key":"c","expected":1,"revision":0}]`) {
+        t.Fatalf("txn over HTTP: %d %s", w.Code, w.Body)
+    }
+
+    // With the conditions holding, the ops are applied.
+    revs, err := s.Txn([]TxnCondition{{"a", revA}, {"c", 0}}, []TxnOp{{Op: "set", Key: "a", Value: "3"}, {Op: "delete", Key: "b"}})
+    if err != nil || !reflect.DeepEqual(revs, []uint64{revA + 1, 0}) {
+        t.Fatalf("txn: %v %v", revs, err)
+    }
+    if _, _, ok := s.Get("b"); ok {
+        t.Fatal("b was not deleted")
+    }
+}
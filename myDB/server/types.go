@@ -0,0 +1,539 @@
+package main
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "math"
+    "sort"
+    "strconv"
+)
+
+// ValueType is the kind of value stored under a key.
+type ValueType uint8
+
+const (
+    TypeString ValueType = iota
+    TypeList
+    TypeHash
+    TypeSet
+    TypeZSet
+)
+
+func (t ValueType) String() string {
+    switch t {
+    case TypeString:
+        return "string"
+    case TypeList:
+        return "list"
+    case TypeHash:
+        return "hash"
+    case TypeSet:
+        return "set"
+    case TypeZSet:
+        return "zset"
+    default:
+        return fmt.Sprintf("type(%d)", uint8(t))
+    }
+}
+
+// errWrongType is returned when a command is used on a key of another type.
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// collection is a list, hash, set or sorted set value. A stored collection
+// is never changed in place: every change builds a new one, so readers and
+// snapshots can keep using the old one without holding the store lock.
+type collection interface {
+    len() int
+    encode() string
+    size() int // rough bytes held, for the memory limit
+}
+
+// setMutation returns the mutation that stores v under key. It leaves the
+// revision of v out, so the key gets the next one when the mutation is made.
+func setMutation(key string, v ValueWithTTL) Mutation {
+    m := Mutation{Op: OpSet, Key: key, Value: v.Value, Expiration: v.Expiration, Type: v.Type, coll: v.coll}
+    if v.coll != nil {
+        m.Value = v.coll.encode()
+    }
+    return m
+}
+
+// entry returns the value m stores. Collections that arrive encoded (from
+// the WAL, a leader or a raft peer) are decoded here.
+func (m Mutation) entry() ValueWithTTL {
+    v := ValueWithTTL{Value: m.Value, Expiration: m.Expiration, Type: m.Type, Revision: m.Revision, coll: m.coll}
+    if m.Type != TypeString {
+        v.Value = ""
+        if v.coll == nil {
+            c, err := decodeCollection(m.Type, m.Value)
+            if err != nil {
+                fmt.Printf("Error decoding %s value of %q: %v\n", m.Type, m.Key, err)
+            }
+            v.coll = c
+        }
+    }
+    return v
+}
+
+// result returns the value the key of m holds once the set or update m is
+// applied over old, its current value. An update changes the collection
+// under the key, or an empty one when the key is missing or expired at now.
+func (m Mutation) result(old ValueWithTTL, exists bool, now int64) (ValueWithTTL, error) {
+    if m.Op != OpUpdate {
+        return m.entry(), nil
+    }
+    v := ValueWithTTL{Expiration: m.Expiration, Type: m.Type, Revision: m.Revision, coll: m.coll}
+    if v.coll != nil {
+        return v, nil
+    }
+    var c collection
+    if exists && !old.expired(now) {
+        if old.Type != m.Type {
+            return v, errWrongType
+        }
+        c = old.coll
+    }
+    change, err := decodeStrings(m.Value)
+    if err != nil {
+        return v, err
+    }
+    v.coll, err = applyChange(m.Type, c, change)
+    return v, err
+}
+
+// applyChange returns c, a collection of type t that may be nil, with an
+// element-level change made to it: the name of the change followed by its
+// arguments, such as {"rpush", "a", "b"} or {"zadd", "1.5", "m"}. The
+// commands make their changes with it and log only the change, which WAL
+// replay, followers and raft peers repeat here to get the same result.
+func applyChange(t ValueType, c collection, change []string) (collection, error) {
+    if len(change) == 0 {
+        return nil, errCorruptEntry
+    }
+    name, args := change[0], change[1:]
+    switch t {
+    case TypeList:
+        l, _ := c.(*listValue)
+        if out := l.change(name, args); out != nil {
+            return out, nil
+        }
+    case TypeHash:
+        h, _ := c.(*hashValue)
+        if out := h.change(name, args); out != nil {
+            return out, nil
+        }
+    case TypeSet:
+        s, _ := c.(*setValue)
+        if out := s.change(name, args); out != nil {
+            return out, nil
+        }
+    case TypeZSet:
+        z, _ := c.(*zsetValue)
+        if out := z.change(name, args); out != nil {
+            return out, nil
+        }
+    }
+    return nil, fmt.Errorf("bad %s change %q: %w", t, name, errCorruptEntry)
+}
+
+// listValue is an ordered list of strings.
+type listValue struct {
+    items []string
+}
+
+func (l *listValue) len() int {
+    if l == nil {
+        return 0
+    }
+    return len(l.items)
+}
+
+func (l *listValue) encode() string {
+    return encodeStrings(l.items)
+}
+
+func (l *listValue) size() int {
+    n := 0
+    for _, item := range l.items {
+        n += len(item) + elementOverhead
+    }
+    return n
+}
+
+// change returns l, which may be nil, with the change name made to it, or
+// nil when that is not a list change. A popped list shares its items with
+// l, which no later change writes to.
+func (l *listValue) change(name string, args []string) *listValue {
+    var old []string
+    if l != nil {
+        old = l.items
+    }
+    switch name {
+    case "lpush":
+        items := make([]string, 0, len(old)+len(args))
+        for i := len(args) - 1; i >= 0; i-- {
+            items = append(items, args[i])
+        }
+        return &listValue{items: append(items, old...)}
+    case "rpush":
+        items := make([]string, 0, len(old)+len(args))
+        items = append(items, old...)
+        return &listValue{items: append(items, args...)}
+    case "lpop", "rpop":
+        if len(args) != 1 {
+            return nil
+        }
+        n, err := strconv.Atoi(args[0])
+        if err != nil || n < 0 {
+            return nil
+        }
+        n = min(n, len(old))
+        if name == "lpop" {
+            return &listValue{items: old[n:]}
+        }
+        return &listValue{items: old[:len(old)-n]}
+    }
+    return nil
+}
+
+// hashValue maps fields to values.
+type hashValue struct {
+    fields map[string]string
+}
+
+func (h *hashValue) len() int {
+    if h == nil {
+        return 0
+    }
+    return len(h.fields)
+}
+
+func (h *hashValue) encode() string {
+    flat := make([]string, 0, 2*len(h.fields))
+    for f, v := range h.fields {
+        flat = append(flat, f, v)
+    }
+    return encodeStrings(flat)
+}
+
+func (h *hashValue) size() int {
+    n := 0
+    for f, v := range h.fields {
+        n += len(f) + len(v) + 2*elementOverhead
+    }
+    return n
+}
+
+// field returns the value of field f in h, which may be nil.
+func (h *hashValue) field(f string) (string, bool) {
+    if h == nil {
+        return "", false
+    }
+    v, ok := h.fields[f]
+    return v, ok
+}
+
+// copy returns a modifiable copy of h, which may be nil.
+func (h *hashValue) copy() *hashValue {
+    out := &hashValue{fields: make(map[string]string, h.len()+1)}
+    if h != nil {
+        for f, v := range h.fields {
+            out.fields[f] = v
+        }
+    }
+    return out
+}
+
+// change returns a copy of h, which may be nil, with the change name made
+// to it, or nil when that is not a hash change.
+func (h *hashValue) change(name string, args []string) *hashValue {
+    switch {
+    case name == "hset" && len(args)%2 == 0:
+        out := h.copy()
+        for i := 0; i < len(args); i += 2 {
+            out.fields[args[i]] = args[i+1]
+        }
+        return out
+    case name == "hdel":
+        out := h.copy()
+        for _, f := range args {
+            delete(out.fields, f)
+        }
+        return out
+    }
+    return nil
+}
+
+// setValue is an unordered set of unique strings.
+type setValue struct {
+    members map[string]struct{}
+}
+
+func (s *setValue) len() int {
+    if s == nil {
+        return 0
+    }
+    return len(s.members)
+}
+
+func (s *setValue) encode() string {
+    flat := make([]string, 0, len(s.members))
+    for m := range s.members {
+        flat = append(flat, m)
+    }
+    return encodeStrings(flat)
+}
+
+func (s *setValue) size() int {
+    n := 0
+    for m := range s.members {
+        n += len(m) + elementOverhead
+    }
+    return n
+}
+
+// copy returns a modifiable copy of s, which may be nil.
+func (s *setValue) copy() *setValue {
+    out := &setValue{members: make(map[string]struct{}, s.len()+1)}
+    if s != nil {
+        for m := range s.members {
+            out.members[m] = struct{}{}
+        }
+    }
+    return out
+}
+
+// contains reports whether member is in s, which may be nil.
+func (s *setValue) contains(member string) bool {
+    if s == nil {
+        return false
+    }
+    _, ok := s.members[member]
+    return ok
+}
+
+// change returns a copy of s, which may be nil, with the change name made
+// to it, or nil when that is not a set change.
+func (s *setValue) change(name string, args []string) *setValue {
+    switch name {
+    case "sadd":
+        out := s.copy()
+        for _, m := range args {
+            out.members[m] = struct{}{}
+        }
+        return out
+    case "srem":
+        out := s.copy()
+        for _, m := range args {
+            delete(out.members, m)
+        }
+        return out
+    }
+    return nil
+}
+
+// zsetEntry is a member of a sorted set with its score.
+type zsetEntry struct {
+    Member string
+    Score  float64
+}
+
+// zsetValue is a set of members ordered by score, then by member.
+type zsetValue struct {
+    scores map[string]float64
+    sorted []zsetEntry
+}
+
+func (z *zsetValue) len() int {
+    if z == nil {
+        return 0
+    }
+    return len(z.sorted)
+}
+
+func (z *zsetValue) encode() string {
+    buf := binary.AppendUvarint(nil, uint64(len(z.sorted)))
+    for _, e := range z.sorted {
+        buf = binary.AppendUvarint(buf, uint64(len(e.Member)))
+        buf = append(buf, e.Member...)
+        buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(e.Score))
+    }
+    return string(buf)
+}
+
+// size counts every member twice, as it is both in scores and in sorted.
+func (z *zsetValue) size() int {
+    n := 0
+    for _, e := range z.sorted {
+        n += 2 * (len(e.Member) + 8 + elementOverhead)
+    }
+    return n
+}
+
+// score returns the score of member in z, which may be nil.
+func (z *zsetValue) score(member string) (float64, bool) {
+    if z == nil {
+        return 0, false
+    }
+    s, ok := z.scores[member]
+    return s, ok
+}
+
+// with returns a copy of z (which may be nil) with the scores in changes
+// set and the members in removed taken out.
+func (z *zsetValue) with(changes map[string]float64, removed []string) *zsetValue {
+    out := &zsetValue{scores: make(map[string]float64, z.len()+len(changes))}
+    if z != nil {
+        for m, s := range z.scores {
+            out.scores[m] = s
+        }
+    }
+    for m, s := range changes {
+        out.scores[m] = s
+    }
+    for _, m := range removed {
+        delete(out.scores, m)
+    }
+    out.sorted = make([]zsetEntry, 0, len(out.scores))
+    for m, s := range out.scores {
+        out.sorted = append(out.sorted, zsetEntry{Member: m, Score: s})
+    }
+    sort.Slice(out.sorted, func(i, j int) bool { return zsetLess(out.sorted[i], out.sorted[j]) })
+    return out
+}
+
+// change returns a copy of z, which may be nil, with the change name made
+// to it, or nil when that is not a sorted set change. zadd takes score and
+// member pairs, as ZADD does.
+func (z *zsetValue) change(name string, args []string) *zsetValue {
+    switch {
+    case name == "zadd" && len(args)%2 == 0:
+        changes := make(map[string]float64, len(args)/2)
+        for i := 0; i < len(args); i += 2 {
+            score, err := parseScore(args[i])
+            if err != nil {
+                return nil
+            }
+            changes[args[i+1]] = score
+        }
+        return z.with(changes, nil)
+    case name == "zrem":
+        return z.with(nil, args)
+    }
+    return nil
+}
+
+func zsetLess(a, b zsetEntry) bool {
+    if a.Score != b.Score {
+        return a.Score < b.Score
+    }
+    return a.Member < b.Member
+}
+
+// decodeCollection parses a collection encoded by its encode method.
+func decodeCollection(t ValueType, data string) (collection, error) {
+    if t == TypeZSet {
+        z, err := decodeZSet(data)
+        if err != nil {
+            return nil, err
+        }
+        return z, nil
+    }
+    flat, err := decodeStrings(data)
+    if err != nil {
+        return nil, err
+    }
+    switch t {
+    case TypeList:
+        return &listValue{items: flat}, nil
+    case TypeHash:
+        if len(flat)%2 != 0 {
+            return nil, errCorruptEntry
+        }
+        h := &hashValue{fields: make(map[string]string, len(flat)/2)}
+        for i := 0; i < len(flat); i += 2 {
+            h.fields[flat[i]] = flat[i+1]
+        }
+        return h, nil
+    case TypeSet:
+        s := &setValue{members: make(map[string]struct{}, len(flat))}
+        for _, m := range flat {
+            s.members[m] = struct{}{}
+        }
+        return s, nil
+    default:
+        return nil, fmt.Errorf("unknown value type %d: %w", t, errCorruptEntry)
+    }
+}
+
+func decodeZSet(data string) (*zsetValue, error) {
+    buf := []byte(data)
+    n, l := binary.Uvarint(buf)
+    if l <= 0 || n > uint64(len(buf)) {
+        return nil, errCorruptEntry
+    }
+    buf = buf[l:]
+    changes := make(map[string]float64, n)
+    for i := uint64(0); i < n; i++ {
+        member, rest, ok := readString(buf)
+        if !ok || len(rest) < 8 {
+            return nil, errCorruptEntry
+        }
+        changes[member] = math.Float64frombits(binary.LittleEndian.Uint64(rest))
+        buf = rest[8:]
+    }
+    if len(buf) != 0 {
+        return nil, errCorruptEntry
+    }
+    return (*zsetValue)(nil).with(changes, nil), nil
+}
+
+// encodeStrings serializes ss as [count uvarint] count × [len uvarint][bytes].
+func encodeStrings(ss []string) string {
+    size := binary.MaxVarintLen64
+    for _, s := range ss {
+        size += binary.MaxVarintLen64 + len(s)
+    }
+    buf := make([]byte, 0, size)
+    buf = binary.AppendUvarint(buf, uint64(len(ss)))
+    for _, s := range ss {
+        buf = binary.AppendUvarint(buf, uint64(len(s)))
+        buf = append(buf, s...)
+    }
+    return string(buf)
+}
+
+func decodeStrings(data string) ([]string, error) {
+    buf := []byte(data)
+    n, l := binary.Uvarint(buf)
+    if l <= 0 || n > uint64(len(buf)) {
+        return nil, errCorruptEntry
+    }
+    buf = buf[l:]
+    ss := make([]string, 0, n)
+    for i := uint64(0); i < n; i++ {
+        s, rest, ok := readString(buf)
+        if !ok {
+            return nil, errCorruptEntry
+        }
+        ss = append(ss, s)
+        buf = rest
+    }
+    if len(buf) != 0 {
+        return nil, errCorruptEntry
+    }
+    return ss, nil
+}
+
+// formatScore formats a sorted set score the way Redis does.
+func formatScore(f float64) string {
+    switch {
+    case math.IsInf(f, 1):
+        return "inf"
+    case math.IsInf(f, -1):
+        return "-inf"
+    default:
+        return strconv.FormatFloat(f, 'g', -1, 64)
+    }
+}
@@ -0,0 +1,542 @@
+package main
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "hash/crc32"
+    "io"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+    "sync"
+)
+
+// Op identifies the kind of change a Mutation makes to the store.
+type Op uint8
+
+const (
+    OpSet Op = iota + 1
+    OpDelete
+    OpBatch  // several mutations applied together, encoded in Value
+    OpExpire // removal of a key whose TTL ran out
+    OpEvict  // removal of a key to stay within the memory limit
+    OpUpdate // element-level change to a collection, encoded in Value
+)
+
+// Mutation is a single change to the store. Expiration is absolute, so
+// replaying a mutation later gives the same result as applying it now.
+type Mutation struct {
+    Op         Op
+    Key        string
+    Value      string    // the string, the encoded collection, or the change of an OpUpdate
+    Expiration int64     // Unix time in milliseconds, 0 means no expiry
+    Type       ValueType // type of the value set by OpSet or changed by OpUpdate
+    Revision   uint64    // revision the key gets from OpSet or OpUpdate, see InMemoryStore.stamp
+
+    coll  collection // decoded form of Value, or the result of an OpUpdate, when the mutation was made here
+    batch []Mutation // decoded form of Value for OpBatch
+}
+
+const (
+    walMagic         = "MYDBWAL"
+    walVersion       = 1
+    walHeaderSize    = len(walMagic) + 1
+    walFrameSize     = 8       // record length + CRC32
+    walMaxRecordSize = 1 << 28 // anything bigger is treated as corruption
+    walSuffix        = ".wal"
+)
+
+var (
+    crcTable        = crc32.MakeTable(crc32.Castagnoli)
+    errCorruptEntry = errors.New("corrupt WAL entry")
+)
+
+// WALOptions controls how the write-ahead log is written.
+type WALOptions struct {
+    SegmentSize int64 // rotate to a new segment once the current one is this big
+    SyncOnWrite bool  // fsync after every append before acknowledging
+}
+
+// WAL is an append-only, checksummed log of mutations split into numbered
+// segment files. Every record is framed as
+//
+//	[length uint32][crc32c uint32][payload]
+//
+// so a record torn by a crash can be detected on replay.
+type WAL struct {
+    mu   sync.Mutex
+    dir  string
+    opts WALOptions
+    file *os.File
+    buf  *bufio.Writer
+    seq  uint64 // number of the segment currently being written
+    size int64
+
+    unsynced int64 // bytes appended since the last fsync
+}
+
+// OpenWAL opens the write-ahead log in dir, creating it if needed, and
+// replays every intact record of segment from onwards through apply before
+// accepting new appends. Older segments are already covered by a snapshot.
+// A record torn by a crash at the end of the last segment is logged and cut
+// off. A bad record anywhere else fails the boot: segments are synced
+// before the next one is started, so it is corruption rather than a crash,
+// and skipping it would silently lose the writes after it.
+func OpenWAL(dir string, opts WALOptions, from uint64, apply func(Mutation)) (*WAL, error) {
+    if err := os.MkdirAll(dir, 0o755); err != nil {
+        return nil, err
+    }
+    segments, err := listSegments(dir)
+    if err != nil {
+        return nil, err
+    }
+
+    w := &WAL{dir: dir, opts: opts}
+    next := max(from, 1)
+    for i, seq := range segments {
+        if seq < from {
+            continue
+        }
+        last := i == len(segments)-1
+        if err := w.replaySegment(seq, last, apply); err != nil {
+            return nil, err
+        }
+        next = seq
+    }
+
+    if err := w.openSegment(next); err != nil {
+        return nil, err
+    }
+    return w, nil
+}
+
+// Append writes m to the log. When SyncOnWrite is set the record is on disk
+// by the time Append returns.
+func (w *WAL) Append(m Mutation) error {
+    payload := encodeMutation(m)
+
+    w.mu.Lock()
+    defer w.mu.Unlock()
+
+    if w.opts.SegmentSize > 0 && w.size >= w.opts.SegmentSize {
+        if err := w.rotate(); err != nil {
+            return err
+        }
+    }
+
+    n, err := writeFrame(w.buf, payload)
+    if err != nil {
+        return err
+    }
+    w.size += n
+
+    if err := w.buf.Flush(); err != nil {
+        return err
+    }
+    if !w.opts.SyncOnWrite {
+        w.unsynced += n
+        return nil
+    }
+    if err := w.file.Sync(); err != nil {
+        return err
+    }
+    w.unsynced = 0
+    return nil
+}
+
+// unsyncedBytes returns how much of the WAL a crash of the machine could
+// still lose, which is only ever more than 0 without SyncOnWrite.
+func (w *WAL) unsyncedBytes() int64 {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.unsynced
+}
+
+// SetSyncOnWrite changes SyncOnWrite for the appends from now on.
+func (w *WAL) SetSyncOnWrite(on bool) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.opts.SyncOnWrite = on
+}
+
+// Sync flushes buffered records and fsyncs the current segment.
+func (w *WAL) Sync() error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if err := w.buf.Flush(); err != nil {
+        return err
+    }
+    if err := w.file.Sync(); err != nil {
+        return err
+    }
+    w.unsynced = 0
+    return nil
+}
+
+// Close syncs and closes the current segment.
+func (w *WAL) Close() error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if err := w.buf.Flush(); err != nil {
+        w.file.Close()
+        return err
+    }
+    if err := w.file.Sync(); err != nil {
+        w.file.Close()
+        return err
+    }
+    return w.file.Close()
+}
+
+// Rotate starts a new segment and returns its number, so that every record
+// appended from now on lives in that segment or later ones. If the current
+// segment is still empty it is reused.
+func (w *WAL) Rotate() (uint64, error) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if w.size == int64(walHeaderSize) {
+        return w.seq, nil
+    }
+    if err := w.rotate(); err != nil {
+        return 0, err
+    }
+    return w.seq, nil
+}
+
+// TruncateBefore removes every segment older than seq. It is called once a
+// snapshot covering those segments is safely on disk.
+func (w *WAL) TruncateBefore(seq uint64) error {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    segments, err := listSegments(w.dir)
+    if err != nil {
+        return err
+    }
+    for _, s := range segments {
+        if s >= seq || s == w.seq {
+            break
+        }
+        if err := os.Remove(w.segmentPath(s)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// rotate closes the current segment and starts the next one.
+// The caller must hold w.mu.
+func (w *WAL) rotate() error {
+    if err := w.buf.Flush(); err != nil {
+        return err
+    }
+    if err := w.file.Sync(); err != nil {
+        return err
+    }
+    w.unsynced = 0
+    if err := w.file.Close(); err != nil {
+        return err
+    }
+    return w.openSegment(w.seq + 1)
+}
+
+// openSegment opens segment seq for appending, writing the header if the
+// file is new (or was left empty by a crash).
+func (w *WAL) openSegment(seq uint64) error {
+    f, err := os.OpenFile(w.segmentPath(seq), os.O_CREATE|os.O_RDWR, 0o644)
+    if err != nil {
+        return err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return err
+    }
+    size := info.Size()
+    if size < int64(walHeaderSize) {
+        if err := f.Truncate(0); err != nil {
+            f.Close()
+            return err
+        }
+        header := append([]byte(walMagic), walVersion)
+        if _, err := f.WriteAt(header, 0); err != nil {
+            f.Close()
+            return err
+        }
+        if err := f.Sync(); err != nil {
+            f.Close()
+            return err
+        }
+        size = int64(walHeaderSize)
+    }
+    if _, err := f.Seek(size, io.SeekStart); err != nil {
+        f.Close()
+        return err
+    }
+
+    w.file = f
+    w.buf = bufio.NewWriter(f)
+    w.seq = seq
+    w.size = size
+    return nil
+}
+
+// replaySegment feeds every record of segment seq to apply. Only the last
+// segment may end in a torn record, which is truncated so new appends
+// follow the last good one; any other bad record is an error.
+func (w *WAL) replaySegment(seq uint64, last bool, apply func(Mutation)) error {
+    path := w.segmentPath(seq)
+    f, err := os.Open(path)
+    if err != nil {
+        return err
+    }
+    defer f.Close()
+
+    r := bufio.NewReader(f)
+    header := make([]byte, walHeaderSize)
+    if _, err := io.ReadFull(r, header); err != nil {
+        if !last {
+            return fmt.Errorf("WAL: %s has no complete header", path)
+        }
+        // A crash right after creating the segment leaves it short.
+        fmt.Printf("WAL: segment %s has no complete header, ignoring it\n", path)
+        return os.Truncate(path, 0)
+    }
+    if string(header[:len(walMagic)]) != walMagic {
+        return fmt.Errorf("WAL: %s is not a WAL segment", path)
+    }
+    if header[len(walMagic)] != walVersion {
+        return fmt.Errorf("WAL: %s has unsupported version %d", path, header[len(walMagic)])
+    }
+
+    offset := int64(walHeaderSize)
+    for {
+        m, n, err := readRecord(r)
+        if err == io.EOF {
+            return nil
+        }
+        if err != nil {
+            err = fmt.Errorf("WAL: %v in %s at offset %d", err, path, offset)
+            if !last {
+                return err
+            }
+            torn, terr := tornTail(f, offset)
+            if terr != nil {
+                return terr
+            }
+            if !torn {
+                return err
+            }
+            fmt.Printf("%v, cutting off the torn tail\n", err)
+            return os.Truncate(path, offset)
+        }
+        apply(m)
+        offset += n
+    }
+}
+
+// tornTail reports whether the bad record at offset in f is what a crash
+// in the middle of appending leaves behind: the file ends within the
+// record or right after it, or only zeros follow where it starts.
+func tornTail(f *os.File, offset int64) (bool, error) {
+    info, err := f.Stat()
+    if err != nil {
+        return false, err
+    }
+    size := info.Size()
+    var frame [walFrameSize]byte
+    if size-offset < walFrameSize {
+        return true, nil
+    }
+    if _, err := f.ReadAt(frame[:], offset); err != nil {
+        return false, err
+    }
+    length := int64(binary.LittleEndian.Uint32(frame[0:4]))
+    if length == 0 {
+        return onlyZeros(io.NewSectionReader(f, offset, size-offset))
+    }
+    return length <= walMaxRecordSize && offset+walFrameSize+length >= size, nil
+}
+
+// onlyZeros reports whether r holds nothing but zero bytes.
+func onlyZeros(r io.Reader) (bool, error) {
+    buf := make([]byte, 32<<10)
+    for {
+        n, err := r.Read(buf)
+        for _, b := range buf[:n] {
+            if b != 0 {
+                return false, nil
+            }
+        }
+        if err == io.EOF {
+            return true, nil
+        }
+        if err != nil {
+            return false, err
+        }
+    }
+}
+
+func (w *WAL) segmentPath(seq uint64) string {
+    return filepath.Join(w.dir, fmt.Sprintf("%016d%s", seq, walSuffix))
+}
+
+// listSegments returns the sequence numbers of all segments in dir, oldest first.
+func listSegments(dir string) ([]uint64, error) {
+    entries, err := os.ReadDir(dir)
+    if err != nil {
+        return nil, err
+    }
+    var segments []uint64
+    for _, e := range entries {
+        name := e.Name()
+        if e.IsDir() || !strings.HasSuffix(name, walSuffix) {
+            continue
+        }
+        var seq uint64
+        if _, err := fmt.Sscanf(strings.TrimSuffix(name, walSuffix), "%d", &seq); err != nil {
+            continue
+        }
+        segments = append(segments, seq)
+    }
+    sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+    return segments, nil
+}
+
+// readRecord reads one framed mutation. It returns io.EOF only on a clean
+// record boundary; anything else that stops short is reported as corruption.
+func readRecord(r *bufio.Reader) (Mutation, int64, error) {
+    payload, n, err := readFrame(r)
+    if err != nil {
+        return Mutation{}, 0, err
+    }
+    m, err := decodeMutation(payload)
+    if err != nil {
+        return Mutation{}, 0, err
+    }
+    return m, n, nil
+}
+
+// writeFrame writes payload framed with its length and checksum and returns
+// the number of bytes written.
+func writeFrame(w io.Writer, payload []byte) (int64, error) {
+    var frame [walFrameSize]byte
+    binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload)))
+    binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+    if _, err := w.Write(frame[:]); err != nil {
+        return 0, err
+    }
+    if _, err := w.Write(payload); err != nil {
+        return 0, err
+    }
+    return int64(walFrameSize + len(payload)), nil
+}
+
+// readFrame reads one framed payload and verifies its checksum. It returns
+// io.EOF only on a clean frame boundary.
+func readFrame(r *bufio.Reader) ([]byte, int64, error) {
+    var frame [walFrameSize]byte
+    if _, err := io.ReadFull(r, frame[:]); err != nil {
+        if err == io.EOF {
+            return nil, 0, io.EOF
+        }
+        return nil, 0, fmt.Errorf("torn record header: %w", err)
+    }
+    length := binary.LittleEndian.Uint32(frame[0:4])
+    sum := binary.LittleEndian.Uint32(frame[4:8])
+    if length == 0 || length > walMaxRecordSize {
+        return nil, 0, errCorruptEntry
+    }
+    payload := make([]byte, length)
+    if _, err := io.ReadFull(r, payload); err != nil {
+        return nil, 0, fmt.Errorf("torn record: %w", err)
+    }
+    if crc32.Checksum(payload, crcTable) != sum {
+        return nil, 0, fmt.Errorf("checksum mismatch: %w", errCorruptEntry)
+    }
+    return payload, int64(walFrameSize) + int64(length), nil
+}
+
+// encodeMutation serializes m as
+//
+//	[op byte][expiration varint][key len uvarint][key][value len uvarint][value][type byte][revision uvarint]
+func encodeMutation(m Mutation) []byte {
+    buf := make([]byte, 0, 2+4*binary.MaxVarintLen64+len(m.Key)+len(m.Value))
+    buf = append(buf, byte(m.Op))
+    buf = binary.AppendVarint(buf, m.Expiration)
+    buf = binary.AppendUvarint(buf, uint64(len(m.Key)))
+    buf = append(buf, m.Key...)
+    buf = binary.AppendUvarint(buf, uint64(len(m.Value)))
+    buf = append(buf, m.Value...)
+    buf = append(buf, byte(m.Type))
+    buf = binary.AppendUvarint(buf, m.Revision)
+    return buf
+}
+
+func decodeMutation(buf []byte) (Mutation, error) {
+    var m Mutation
+    if len(buf) < 1 {
+        return m, errCorruptEntry
+    }
+    m.Op = Op(buf[0])
+    buf = buf[1:]
+
+    exp, n := binary.Varint(buf)
+    if n <= 0 {
+        return m, errCorruptEntry
+    }
+    m.Expiration = exp
+    buf = buf[n:]
+
+    key, buf, ok := readString(buf)
+    if !ok {
+        return m, errCorruptEntry
+    }
+    value, buf, ok := readString(buf)
+    if !ok {
+        return m, errCorruptEntry
+    }
+    m.Key, m.Value = key, value
+    if len(buf) < 1 {
+        return m, errCorruptEntry
+    }
+    m.Type = ValueType(buf[0])
+    rev, n := binary.Uvarint(buf[1:])
+    if n <= 0 || n != len(buf)-1 {
+        return m, errCorruptEntry
+    }
+    m.Revision = rev
+    if m.Type != TypeString && m.Op == OpSet {
+        coll, err := decodeCollection(m.Type, m.Value)
+        if err != nil {
+            return m, err
+        }
+        m.coll = coll
+    }
+
+    switch m.Op {
+    case OpSet, OpDelete, OpExpire, OpEvict:
+        return m, nil
+    case OpUpdate:
+        _, err := decodeStrings(m.Value)
+        return m, err
+    case OpBatch:
+        batch, err := decodeBatch(m.Value)
+        m.batch = batch
+        return m, err
+    default:
+        return m, fmt.Errorf("unknown op %d: %w", m.Op, errCorruptEntry)
+    }
+}
+
+// readString reads a uvarint length-prefixed string from buf.
+func readString(buf []byte) (string, []byte, bool) {
+    l, n := binary.Uvarint(buf)
+    if n <= 0 || uint64(len(buf)-n) < l {
+        return "", buf, false
+    }
+    buf = buf[n:]
+    return string(buf[:l]), buf[l:], true
+}
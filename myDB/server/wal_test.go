@@ -0,0 +1,220 @@
+package main
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+)
+
+// replayKeys opens the WAL in dir and returns the keys of the records it
+// replayed.
+func replayKeys(dir string) ([]string, *WAL, error) {
+    var keys []string
+    w, err := OpenWAL(dir, WALOptions{SyncOnWrite: true}, 0, func(m Mutation) { keys = append(keys, m.Key) })
+    return keys, w, err
+}
+
+// writeWAL appends a record for each key, starting a new segment before
+// the keys in rotateAt, and closes the log.
+func writeWAL(t *testing.T, dir string, keys []string, rotateAt ...string) {
+    t.Helper()
+    _, w, err := replayKeys(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, key := range keys {
+        for _, r := range rotateAt {
+            if r == key {
+                if _, err := w.Rotate(); err != nil {
+                    t.Fatal(err)
+                }
+            }
+        }
+        if err := w.Append(Mutation{Op: OpSet, Key: key, Value: "value of " + key}); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if err := w.Close(); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+    t.Helper()
+    files, err := filepath.Glob(filepath.Join(dir, "*"+walSuffix))
+    if err != nil || len(files) == 0 {
+        t.Fatalf("segments: %v %v", files, err)
+    }
+    return files
+}
+
+func TestWALReplay(t *testing.T) {
+    dir := t.TempDir()
+    writeWAL(t, dir, []string{"a", "b", "c"}, "b")
+    // Reopening after a restart, or a crash with the records synced,
+    // replays them all and appends after them.
+    writeWAL(t, dir, []string{"d"})
+    keys, w, err := replayKeys(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    w.Close()
+    if got := strings.Join(keys, ","); got != "a,b,c,d" {
+        t.Fatalf("replayed %s", got)
+    }
+}
+
+func TestWALTornTail(t *testing.T) {
+    for _, tear := range []struct {
+        name string
+        tear func(path string, size int64) error
+    }{
+        {"cut in the last record", func(path string, size int64) error { return os.Truncate(path, size-3) }},
+        {"cut in the last frame header", func(path string, size int64) error { return os.Truncate(path, size-int64(len("value of c"))-8) }},
+        {"zeros after the last record", func(path string, size int64) error {
+            f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+            if err != nil {
+                return err
+            }
+            defer f.Close()
+            _, err = f.Write(make([]byte, 4096))
+            return err
+        }},
+    } {
+        t.Run(tear.name, func(t *testing.T) {
+            dir := t.TempDir()
+            writeWAL(t, dir, []string{"a", "b", "c"})
+            path := segmentFiles(t, dir)[0]
+            info, _ := os.Stat(path)
+            if err := tear.tear(path, info.Size()); err != nil {
+                t.Fatal(err)
+            }
+
+            // The torn record is cut off and new records follow the last
+            // good one.
+            writeWAL(t, dir, []string{"d"})
+            keys, w, err := replayKeys(dir)
+            if err != nil {
+                t.Fatal(err)
+            }
+            w.Close()
+            want := "a,b,d"
+            if strings.HasPrefix(tear.name, "zeros") {
+                want = "a,b,c,d"
+            }
+            if got := strings.Join(keys, ","); got != want {
+                t.Fatalf("replayed %s, want %s", got, want)
+            }
+        })
+    }
+}
+
+func TestWALCorruption(t *testing.T) {
+    for _, tt := range []struct {
+        name    string
+        segment int // which segment file to damage
+    }{
+        {"middle of the last segment", 1},
+        {"earlier segment", 0},
+    } {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := t.TempDir()
+            writeWAL(t, dir, []string{"a", "b", "c", "d", "e"}, "c")
+            path := segmentFiles(t, dir)[tt.segment]
+            data, err := os.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            // Flip a byte in the value of the first record of the segment.
+            i := strings.Index(string(data), "value of ")
+            data[i] ^= 0xff
+            if err := os.WriteFile(path, data, 0o644); err != nil {
+                t.Fatal(err)
+            }
+
+            _, w, err := replayKeys(dir)
+            if err == nil {
+                w.Close()
+                t.Fatal("corruption was not reported")
+            }
+            if !strings.Contains(err.Error(), filepath.Base(path)) {
+                t.Fatalf("error does not name the segment: %v", err)
+            }
+            after, _ := os.ReadFile(path)
+            if len(after) != len(data) {
+                t.Fatalf("the segment was cut from %d to %d bytes", len(data), len(after))
+            }
+        })
+    }
+}
+
+// runCommands runs each command on s and fails the test on an error.
+func runCommands(t *testing.T, s *InMemoryStore, cmds ...[]string) []Reply {
+    t.Helper()
+    var replies []Reply
+    for _, args := range cmds {
+        cmd, err := lookupCommand(args)
+        if err != nil {
+            t.Fatal(err)
+        }
+        reply, err := cmd.run(s, args)
+        if err != nil {
+            t.Fatalf("%v: %v", args, err)
+        }
+        replies = append(replies, reply)
+    }
+    return replies
+}
+
+func TestWALCollectionChanges(t *testing.T) {
+    dir := t.TempDir()
+    s := NewInMemoryStore()
+    w, err := OpenWAL(dir, WALOptions{}, 0, s.replay)
+    if err != nil {
+        t.Fatal(err)
+    }
+    s.wal = w
+
+    // Each push logs the pushed item, not the whole list.
+    item := strings.Repeat("x", 100)
+    for i := 0; i < 200; i++ {
+        runCommands(t, s, []string{"RPUSH", "list", item})
+    }
+    runCommands(t, s,
+        []string{"LPUSH", "list", "a", "b"},
+        []string{"RPOP", "list", "3"},
+        []string{"HSET", "hash", "f", "1", "g", "2"},
+        []string{"HINCRBY", "hash", "f", "5"},
+        []string{"HDEL", "hash", "g"},
+        []string{"SADD", "set", "a", "b", "c"},
+        []string{"SREM", "set", "b"},
+        []string{"ZADD", "zset", "1", "a", "2", "b", "+inf", "c"},
+        []string{"ZINCRBY", "zset", "0.5", "a"},
+        []string{"ZREM", "zset", "b"},
+    )
+    w.Close()
+    info, err := os.Stat(segmentFiles(t, dir)[0])
+    if err != nil {
+        t.Fatal(err)
+    }
+    if info.Size() > int64(200*(len(item)+50)) {
+        t.Fatalf("the WAL holds %d bytes for 200 pushes of %d bytes", info.Size(), len(item))
+    }
+
+    reads := [][]string{
+        {"LRANGE", "list", "0", "2"}, {"LLEN", "list"}, {"HGETALL", "hash"},
+        {"SMEMBERS", "set"}, {"ZRANGE", "zset", "0", "-1", "WITHSCORES"},
+    }
+    want := runCommands(t, s, reads...)
+    replayed := NewInMemoryStore()
+    if w, err = OpenWAL(dir, WALOptions{}, 0, replayed.replay); err != nil {
+        t.Fatal(err)
+    }
+    w.Close()
+    got := runCommands(t, replayed, reads...)
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("replayed %+v, want %+v", got, want)
+    }
+}
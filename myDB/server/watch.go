@@ -0,0 +1,227 @@
+package main
+
+import (
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+const watchHeartbeat = 15 * time.Second // how often an idle SSE stream sends a comment
+
+// errCompacted is returned when a watch asks for revisions that are no
+// longer in the change log. The watcher has to read the keys again and
+// watch from the current revision.
+var errCompacted = errors.New("COMPACTED the requested revision is no longer available, read the keys again and watch from now")
+
+// WatchEvent is a change to one key. The events of a transaction or of a
+// batch of expirations or evictions share their revision.
+type WatchEvent struct {
+    Rev        uint64 `json:"rev"`
+    Type       string `json:"type"` // "set", "delete", "expire" or "evict"
+    Key        string `json:"key"`
+    Value      string `json:"value,omitempty"`      // the new value of a string key
+    ValueType  string `json:"value_type,omitempty"` // set for lists, hashes, sets and sorted sets
+    Expiration int64  `json:"expiration,omitempty"` // Unix time in milliseconds
+}
+
+// WatchRequest asks for the events on keys starting with Prefix (all keys
+// when empty), from revision From on. From 0 means from now.
+type WatchRequest struct {
+    Prefix string `json:"prefix"`
+    From   uint64 `json:"from"`
+}
+
+// WatchResponse carries the next events. Next is the From to send with the
+// following request, so a client that reconnects with it misses nothing.
+type WatchResponse struct {
+    Success bool         `json:"success"`
+    Error   string       `json:"error,omitempty"`
+    Events  []WatchEvent `json:"events,omitempty"`
+    Next    uint64       `json:"next"`
+}
+
+// Watch waits until there are events for keys starting with prefix at
+// revision from or later, and returns them with the revision to continue
+// from. When ctx is done first it returns no events, but next still moves
+// past the changes to other keys. Only the keys stored on this node are
+// watched.
+func (s *InMemoryStore) Watch(ctx context.Context, prefix string, from uint64) ([]WatchEvent, uint64, error) {
+    from, err := s.watchStart(from)
+    if err != nil {
+        return nil, from, err
+    }
+    for {
+        changes, wait, ok := s.changes.since(from-1, streamBatchSize)
+        if !ok {
+            return nil, from, errCompacted
+        }
+        var events []WatchEvent
+        for _, c := range changes {
+            events = appendEvents(events, c.Rev, c.Mutation, prefix)
+            from = c.Rev + 1
+        }
+        if len(events) > 0 {
+            return events, from, nil
+        }
+        if len(changes) > 0 {
+            continue
+        }
+        select {
+        case <-wait:
+        case <-ctx.Done():
+            return nil, from, nil
+        }
+    }
+}
+
+// watchStart checks that a watch can start at revision from, where 0
+// stands for the next revision, and returns it.
+func (s *InMemoryStore) watchStart(from uint64) (uint64, error) {
+    current := s.revision()
+    if from == 0 {
+        return current + 1, nil
+    }
+    if from > current+1 {
+        return from, fmt.Errorf("ERR revision %d is ahead of the store, which is at %d", from, current)
+    }
+    if _, _, ok := s.changes.since(from-1, 0); !ok {
+        return from, errCompacted
+    }
+    return from, nil
+}
+
+// appendEvents adds the events m made on keys starting with prefix.
+func appendEvents(events []WatchEvent, rev uint64, m Mutation, prefix string) []WatchEvent {
+    if m.Op == OpBatch {
+        for _, op := range m.ops() {
+            events = appendEvents(events, rev, op, prefix)
+        }
+        return events
+    }
+    if !strings.HasPrefix(m.Key, prefix) {
+        return events
+    }
+    e := WatchEvent{Rev: rev, Key: m.Key}
+    switch m.Op {
+    case OpSet, OpUpdate:
+        e.Type = "set"
+        e.Expiration = m.Expiration
+        if m.Type == TypeString {
+            e.Value = m.Value
+        } else {
+            e.ValueType = m.Type.String()
+        }
+    case OpDelete:
+        e.Type = "delete"
+    case OpExpire:
+        e.Type = "expire"
+    case OpEvict:
+        e.Type = "evict"
+    default:
+        return events
+    }
+    return append(events, e)
+}
+
+// RPCWatch is the RPC form of Watch. Each call waits up to streamWait for
+// events, so a client streams by calling it again with Next.
+func (s *InMemoryStore) RPCWatch(req *WatchRequest, resp *WatchResponse) error {
+    ctx, cancel := context.WithTimeout(context.Background(), streamWait)
+    defer cancel()
+    events, next, err := s.Watch(ctx, req.Prefix, req.From)
+    resp.Next = next
+    if err != nil {
+        resp.Success = false
+        resp.Error = err.Error()
+        return nil
+    }
+    resp.Success = true
+    resp.Events = events
+    return nil
+}
+
+// watchHandler streams events as server-sent events on GET
+// /watch?prefix=...&rev=N. Every event is a JSON WatchEvent, and the last
+// event of each revision carries it as id, so a reconnecting EventSource
+// resumes after it through Last-Event-ID. Without rev or Last-Event-ID the
+// stream starts at the current revision.
+func (store *InMemoryStore) watchHandler(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodGet {
+        methodNotAllowed(w, "GET")
+        return
+    }
+    flusher, ok := w.(http.Flusher)
+    if !ok {
+        httpError(w, http.StatusInternalServerError, "Streaming not supported")
+        return
+    }
+
+    prefix := r.URL.Query().Get("prefix")
+    if !authorized(w, r, "InMemoryStore.RPCWatch", &WatchRequest{Prefix: prefix}) {
+        return
+    }
+    var from uint64
+    if id := r.Header.Get("Last-Event-ID"); id != "" {
+        last, err := strconv.ParseUint(id, 10, 64)
+        if err != nil {
+            httpError(w, http.StatusBadRequest, "Invalid Last-Event-ID")
+            return
+        }
+        from = last + 1
+    } else if rev := r.URL.Query().Get("rev"); rev != "" {
+        var err error
+        if from, err = strconv.ParseUint(rev, 10, 64); err != nil {
+            httpError(w, http.StatusBadRequest, "Invalid rev")
+            return
+        }
+    }
+    // Check the starting point before committing to a stream, so a bad
+    // revision is answered with a plain status.
+    from, err := store.watchStart(from)
+    if err != nil {
+        status := http.StatusBadRequest
+        if err == errCompacted {
+            status = http.StatusGone
+        }
+        w.WriteHeader(status)
+        json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+        return
+    }
+
+    w.Header().Set("Content-Type", "text/event-stream")
+    w.Header().Set("Cache-Control", "no-cache")
+    w.WriteHeader(http.StatusOK)
+    flusher.Flush()
+
+    for {
+        ctx, cancel := context.WithTimeout(r.Context(), watchHeartbeat)
+        events, next, err := store.Watch(ctx, prefix, from)
+        cancel()
+        if r.Context().Err() != nil {
+            return
+        }
+        if err != nil {
+            fmt.Fprintf(w, "event: error\ndata: %s\n\n", err)
+            flusher.Flush()
+            return
+        }
+        for i, e := range events {
+            data, _ := json.Marshal(e)
+            if i == len(events)-1 || events[i+1].Rev != e.Rev {
+                fmt.Fprintf(w, "id: %d\n", e.Rev)
+            }
+            fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+        }
+        if len(events) == 0 {
+            // Move the client's Last-Event-ID past changes to other keys.
+            fmt.Fprintf(w, ": heartbeat\nid: %d\n\n", next-1)
+        }
+        flusher.Flush()
+        from = next
+    }
+}
@@ -0,0 +1,148 @@
+// Package skiplist implements an ordered set of strings as an indexable
+// skip list, used by myDB to keep its keys in order next to the hash map
+// that holds their values. Besides ordered iteration it answers how many
+// keys sort before a given one in O(log n), so key ranges can be counted
+// without walking them.
+package skiplist
+
+import "math/rand"
+
+const (
+    maxLevel = 32
+    branch   = 4 // one node in branch gets promoted to the next level
+)
+
+type node struct {
+    key  string
+    next []*node
+    span []int // number of level 0 steps next[i] skips over
+}
+
+// List is an ordered set of strings. It is not safe for concurrent use.
+type List struct {
+    head   *node
+    level  int
+    length int
+}
+
+// New returns an empty list.
+func New() *List {
+    return &List{
+        head:  &node{next: make([]*node, maxLevel), span: make([]int, maxLevel)},
+        level: 1,
+    }
+}
+
+// Len returns the number of keys in the list.
+func (l *List) Len() int {
+    return l.length
+}
+
+func randomLevel() int {
+    level := 1
+    for level < maxLevel && rand.Intn(branch) == 0 {
+        level++
+    }
+    return level
+}
+
+// Insert adds key and reports whether it was not there yet.
+func (l *List) Insert(key string) bool {
+    var update [maxLevel]*node
+    var rank [maxLevel]int
+    x := l.head
+    for i := l.level - 1; i >= 0; i-- {
+        if i < l.level-1 {
+            rank[i] = rank[i+1]
+        }
+        for x.next[i] != nil && x.next[i].key < key {
+            rank[i] += x.span[i]
+            x = x.next[i]
+        }
+        update[i] = x
+    }
+    if x.next[0] != nil && x.next[0].key == key {
+        return false
+    }
+
+    level := randomLevel()
+    if level > l.level {
+        for i := l.level; i < level; i++ {
+            rank[i] = 0
+            update[i] = l.head
+            update[i].span[i] = l.length
+        }
+        l.level = level
+    }
+    n := &node{key: key, next: make([]*node, level), span: make([]int, level)}
+    for i := 0; i < level; i++ {
+        n.next[i] = update[i].next[i]
+        update[i].next[i] = n
+        n.span[i] = update[i].span[i] - (rank[0] - rank[i])
+        update[i].span[i] = rank[0] - rank[i] + 1
+    }
+    for i := level; i < l.level; i++ {
+        update[i].span[i]++
+    }
+    l.length++
+    return true
+}
+
+// Delete removes key and reports whether it was there.
+func (l *List) Delete(key string) bool {
+    var update [maxLevel]*node
+    x := l.head
+    for i := l.level - 1; i >= 0; i-- {
+        for x.next[i] != nil && x.next[i].key < key {
+            x = x.next[i]
+        }
+        update[i] = x
+    }
+    x = x.next[0]
+    if x == nil || x.key != key {
+        return false
+    }
+
+    for i := 0; i < l.level; i++ {
+        if update[i].next[i] == x {
+            update[i].span[i] += x.span[i] - 1
+            update[i].next[i] = x.next[i]
+        } else {
+            update[i].span[i]--
+        }
+    }
+    for l.level > 1 && l.head.next[l.level-1] == nil {
+        l.level--
+    }
+    l.length--
+    return true
+}
+
+// Rank returns the number of keys that sort before key.
+func (l *List) Rank(key string) int {
+    rank := 0
+    x := l.head
+    for i := l.level - 1; i >= 0; i-- {
+        for x.next[i] != nil && x.next[i].key < key {
+            rank += x.span[i]
+            x = x.next[i]
+        }
+    }
+    return rank
+}
+
+// Ascend calls fn for every key from from on, in order, until fn returns
+// false. The list must not be changed while Ascend runs.
+func (l *List) Ascend(from string, fn func(key string) bool) {
+    x := l.head
+    for i := l.level - 1; i >= 0; i-- {
+        for x.next[i] != nil && x.next[i].key < from {
+            x = x.next[i]
+        }
+    }
+    for x = x.next[0]; x != nil; x = x.next[0] {
+        if !fn(x.key) {
+            return
+        }
+    }
+}
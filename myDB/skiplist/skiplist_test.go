@@ -0,0 +1,62 @@
+package skiplist
+
+import (
+    "fmt"
+    "math/rand"
+    "sort"
+    "testing"
+)
+
+func TestList(t *testing.T) {
+    l := New()
+    want := make(map[string]bool)
+    for i := 0; i < 5000; i++ {
+        key := fmt.Sprint(rand.Intn(2000))
+        if rand.Intn(3) == 0 {
+            if l.Delete(key) != want[key] {
+                t.Fatalf("delete %s: reported %v", key, !want[key])
+            }
+            delete(want, key)
+        } else {
+            if l.Insert(key) == want[key] {
+                t.Fatalf("insert %s: reported %v", key, want[key])
+            }
+            want[key] = true
+        }
+    }
+
+    keys := make([]string, 0, len(want))
+    for key := range want {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+    if l.Len() != len(keys) {
+        t.Fatalf("length %d, want %d", l.Len(), len(keys))
+    }
+    var got []string
+    l.Ascend("", func(key string) bool {
+        got = append(got, key)
+        return true
+    })
+    if fmt.Sprint(got) != fmt.Sprint(keys) {
+        t.Fatal("keys out of order")
+    }
+
+    // Rank counts the keys before any string, there or not, and Ascend
+    // starts at the first key not before it.
+    for _, key := range []string{"", "1", "1000", "1000a", "5", "999", "a"} {
+        rank := sort.SearchStrings(keys, key)
+        if got := l.Rank(key); got != rank {
+            t.Fatalf("rank of %q is %d, want %d", key, got, rank)
+        }
+        var first []string
+        l.Ascend(key, func(k string) bool {
+            first = append(first, k)
+            return len(first) < 2
+        })
+        end := min(rank+2, len(keys))
+        if fmt.Sprint(first) != fmt.Sprint(keys[rank:end]) {
+            t.Fatalf("ascend from %q: %v, want %v", key, first, keys[rank:end])
+        }
+    }
+}
@@ -1,67 +1,49 @@
 package main
 
 import (
+    "context"
     "fmt"
-    "net/rpc"
-)
-
-// RPCRequest and RPCResponse structures
-type RPCRequest struct {
-    Key   string `json:"key"`
-    Value string `json:"value,omitempty"`
-    TTL   int64  `json:"ttl"` // TTL in seconds
-}
+    "time"
 
-type RPCResponse struct {
-    Success bool   `json:"success"`
-    Data    string `json:"data,omitempty"`
-    Error   string `json:"error,omitempty"`
-}
+    "github.com/shafigh75/go_files/myDB/client"
+)
 
 func main() {
-    // Connect to the RPC server
-    client, err := rpc.Dial("tcp", "localhost:1234")
+    // Connect to the gRPC server
+    db, err := client.New(client.Options{Servers: []string{"localhost:50051"}})
     if err != nil {
-        fmt.Println("Error connecting to RPC server:", err)
+        fmt.Println("Error connecting to gRPC server:", err)
         return
     }
-    defer client.Close()
+    defer db.Close()
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    defer cancel()
 
     // Example: Set a key
-    setReq := RPCRequest{Key: "exampleKey", Value: "exampleValue", TTL: 60}
-    var setResp RPCResponse
-    err = client.Call("InMemoryStore.RPCSet", &setReq, &setResp)
-    if err != nil {
-        fmt.Println("Error calling RPCSet:", err)
+    if err := db.Set(ctx, "exampleKey", "exampleValue", time.Minute); err != nil {
+        fmt.Println("Error calling Set:", err)
         return
     }
-    fmt.Println("Set Response:", setResp)
+    fmt.Println("Set the key")
 
     // Example: Get the key
-    getReq := RPCRequest{Key: "exampleKey"}
-    var getResp RPCResponse
-    err = client.Call("InMemoryStore.RPCGet", &getReq, &getResp)
+    value, revision, err := db.Get(ctx, "exampleKey")
     if err != nil {
-        fmt.Println("Error calling RPCGet:", err)
+        fmt.Println("Error calling Get:", err)
         return
-      }
-    fmt.Println("Get Response:", getResp)
+    }
+    fmt.Println("Get Response:", value, revision)
 
     // Example: Delete the key
-    deleteReq := RPCRequest{Key: "exampleKey"}
-    var deleteResp RPCResponse
-    err = client.Call("InMemoryStore.RPCDelete", &deleteReq, &deleteResp)
+    existed, err := db.Delete(ctx, "exampleKey")
     if err != nil {
-        fmt.Println("Error calling RPCDelete:", err)
+        fmt.Println("Error calling Delete:", err)
         return
     }
-    fmt.Println("Delete Response:", deleteResp)
+    fmt.Println("Delete Response:", existed)
 
-    // Attempt to get the key again after deletion
-    err = client.Call("InMemoryStore.RPCGet", &getReq, &getResp)
-    if err != nil {
-        fmt.Println("Error calling RPCGet after deletion:", err)
-        return
-    }
-    fmt.Println("Get Response after deletion:", getResp)
+    // Attempt to get the key again after deletion, which fails with
+    // client.ErrNotFound
+    _, _, err = db.Get(ctx, "exampleKey")
+    fmt.Println("Get Response after deletion:", err)
 }
@@ -0,0 +1,109 @@
+// Package timingwheel implements a hierarchical timing wheel, used by myDB
+// to find the keys whose TTL has run out without scanning every key. Each
+// deadline is placed in a slot of the level whose span covers it, and
+// slots of the upper levels are cascaded into the lower ones as time gets
+// close, so adding a deadline is O(1) and advancing the wheel costs in
+// proportion to the deadlines that come due, not to the ones pending.
+package timingwheel
+
+import "sync"
+
+const (
+    slotBits = 6
+    slots    = 1 << slotBits // per level
+    mask     = slots - 1
+    levels   = 7 // 42 bits of ticks: with millisecond ticks, more than a century
+    maxSpan  = int64(1)<<(slotBits*levels) - 1
+)
+
+// Timer is a deadline registered for a key. At is in ticks, which is
+// whatever unit the caller counts time in.
+type Timer struct {
+    Key string
+    At  int64
+}
+
+// Wheel holds deadlines until they come due. A deadline cannot be removed:
+// callers that change or drop it check the timers the wheel hands out
+// against their current state and ignore the stale ones. It is safe for
+// concurrent use.
+type Wheel struct {
+    mu      sync.Mutex
+    now     int64 // the next tick to fire; every deadline before it has been handed out
+    buckets [levels][slots][]Timer
+    count   int
+}
+
+// New returns an empty wheel whose time starts at now.
+func New(now int64) *Wheel {
+    return &Wheel{now: now}
+}
+
+// Len returns the number of deadlines waiting, stale ones included.
+func (w *Wheel) Len() int {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.count
+}
+
+// Add registers a deadline for key at tick at. A deadline that has already
+// passed is handed out by the next Advance past the wheel's current time.
+func (w *Wheel) Add(key string, at int64) {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.add(Timer{Key: key, At: at})
+    w.count++
+}
+
+// add places t in the lowest level whose span reaches it.
+func (w *Wheel) add(t Timer) {
+    at := max(t.At, w.now)
+    delta := at - w.now
+    if delta > maxSpan {
+        // Kept in the top level until it comes into reach.
+        at, delta = w.now+maxSpan, maxSpan
+    }
+    level := 0
+    for level < levels-1 && delta >= int64(1)<<(slotBits*(level+1)) {
+        level++
+    }
+    i := (at >> (slotBits * level)) & mask
+    w.buckets[level][i] = append(w.buckets[level][i], t)
+}
+
+// Advance moves the wheel to now and returns the deadlines at or before it.
+func (w *Wheel) Advance(now int64) []Timer {
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    var due []Timer
+    for w.now <= now {
+        if w.count == len(due) {
+            w.now = now + 1 // nothing left to find on the way
+            break
+        }
+        i := w.now & mask
+        if i == 0 {
+            w.cascade(1)
+        }
+        due = append(due, w.buckets[0][i]...)
+        w.buckets[0][i] = nil
+        w.now++
+    }
+    w.count -= len(due)
+    return due
+}
+
+// cascade moves the slot of level that starts at the current tick down
+// into the lower levels, after doing the same for the level above when its
+// slot starts here too.
+func (w *Wheel) cascade(level int) {
+    i := (w.now >> (slotBits * level)) & mask
+    if i == 0 && level < levels-1 {
+        w.cascade(level + 1)
+    }
+    bucket := w.buckets[level][i]
+    w.buckets[level][i] = nil
+    for _, t := range bucket {
+        w.add(t)
+    }
+}
@@ -0,0 +1,62 @@
+package timingwheel
+
+import (
+    "math/rand"
+    "sort"
+    "testing"
+)
+
+func TestWheel(t *testing.T) {
+    w := New(1000)
+    want := make(map[string]int64)
+    add := func(key string, at int64) {
+        w.Add(key, at)
+        want[key] = at
+    }
+    // Deadlines in the lower levels, and one that has already passed.
+    add("past", 10)
+    for level := 0; level < 4; level++ {
+        for i := 0; i < 20; i++ {
+            span := int64(1) << (slotBits * (level + 1))
+            add(string(rune('a'+level))+string(rune('a'+i)), 1000+rand.Int63n(span))
+        }
+    }
+    if w.Len() != len(want) {
+        t.Fatalf("len %d, want %d", w.Len(), len(want))
+    }
+
+    // Each Advance hands out exactly the deadlines up to its time.
+    var times []int64
+    for _, at := range want {
+        times = append(times, max(at, 1000))
+    }
+    sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+    for _, to := range times {
+        for _, timer := range w.Advance(to) {
+            if at, ok := want[timer.Key]; !ok || at != timer.At || at > to {
+                t.Fatalf("%+v handed out at %d", timer, to)
+            }
+            delete(want, timer.Key)
+        }
+        for key, at := range want {
+            if at <= to {
+                t.Fatalf("%s at %d not handed out by %d", key, at, to)
+            }
+        }
+    }
+    if len(want) != 0 || w.Len() != 0 {
+        t.Fatalf("left: %v, len %d", want, w.Len())
+    }
+
+    // A deadline added behind the wheel comes out with the next Advance,
+    // and one past the span of the top level waits until it is due.
+    now := times[len(times)-1] + 1
+    w.Add("late", now-5)
+    w.Add("far", now+maxSpan+123)
+    if due := w.Advance(now); len(due) != 1 || due[0].Key != "late" || w.Len() != 1 {
+        t.Fatalf("late deadline: %v, %d left", due, w.Len())
+    }
+    if due := w.Advance(now + 1<<20); len(due) != 0 {
+        t.Fatalf("far deadline handed out early: %v", due)
+    }
+}